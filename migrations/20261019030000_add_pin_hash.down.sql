@@ -0,0 +1 @@
+ALTER TABLE `accesscontrol` DROP COLUMN `pin_hash`;
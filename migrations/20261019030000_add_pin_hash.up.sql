@@ -0,0 +1 @@
+ALTER TABLE `accesscontrol` ADD `pin_hash` varchar(128) DEFAULT NULL;
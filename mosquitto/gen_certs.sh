@@ -0,0 +1,32 @@
+#!/bin/sh
+# Creates a self-signed CA, a server certificate for the mosquitto service
+# and a client certificate for porter. Only use these for development!
+set -eu
+
+CERT_DIR="${1:-$(dirname "$0")/certs}"
+SERVER_NAME="${SERVER_NAME:-localhost}"
+CLIENT_NAME="${CLIENT_NAME:-porter}"
+DAYS="${DAYS:-365}"
+
+mkdir -p "$CERT_DIR"
+cd "$CERT_DIR"
+
+openssl req -x509 -new -nodes -newkey rsa:2048 -days "$DAYS" \
+  -keyout ca.key -out ca.crt -subj "/CN=porter development CA"
+
+openssl req -new -nodes -newkey rsa:2048 \
+  -keyout server.key -out server.csr -subj "/CN=$SERVER_NAME"
+printf 'subjectAltName=DNS:%s,DNS:mosquitto,IP:127.0.0.1\n' "$SERVER_NAME" > server.ext
+openssl x509 -req -in server.csr -CA ca.crt -CAkey ca.key -CAcreateserial \
+  -days "$DAYS" -extfile server.ext -out server.crt
+
+openssl req -new -nodes -newkey rsa:2048 \
+  -keyout client.key -out client.csr -subj "/CN=$CLIENT_NAME"
+printf 'extendedKeyUsage=clientAuth\n' > client.ext
+openssl x509 -req -in client.csr -CA ca.crt -CAkey ca.key -CAcreateserial \
+  -days "$DAYS" -extfile client.ext -out client.crt
+
+rm -f server.csr server.ext client.csr client.ext ca.srl
+# mosquitto runs as its own user within the container
+chmod 0644 ca.crt server.crt client.crt server.key
+chmod 0600 ca.key client.key
@@ -0,0 +1,201 @@
+package broker
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"metamakers.org/door-controller-mqtt/mqtt"
+)
+
+// Access is what a mosquitto ACL rule allows on its topic. Deny rules
+// win over every other rule that matches.
+type Access string
+
+const (
+	Read      Access = "read"
+	Write     Access = "write"
+	ReadWrite Access = "readwrite"
+	Deny      Access = "deny"
+)
+
+func (access Access) allows(requested Access) bool {
+	return access == ReadWrite || access == requested
+}
+
+// Rule is a single topic or pattern line. Patterns apply to every user
+// with %u and %c replaced by the username and client ID.
+type Rule struct {
+	Access  Access
+	Topic   string
+	Pattern bool
+}
+
+func (rule Rule) String() string {
+	keyword := "topic"
+	if rule.Pattern {
+		keyword = "pattern"
+	}
+	return fmt.Sprintf("%s %s %s", keyword, rule.Access, rule.Topic)
+}
+
+type User struct {
+	Name    string
+	Comment string
+	Rules   []Rule
+}
+
+// ACL is a mosquitto acl_file. Rules before the first user apply to
+// anonymous clients.
+type ACL struct {
+	Anonymous []Rule
+	Users     []User
+}
+
+func (acl ACL) user(name string) (User, bool) {
+	for _, user := range acl.Users {
+		if user.Name == name {
+			return user, true
+		}
+	}
+	return User{}, false
+}
+
+// Allowed reports whether mosquitto would let the user read or write the
+// topic. Clients are assumed to connect with their username as their
+// client ID, as the doors do.
+func (acl ACL) Allowed(username string, requested Access, topic string) bool {
+	topicRules := acl.Anonymous
+	if username != "" {
+		user, _ := acl.user(username)
+		topicRules = user.Rules
+	}
+
+	// Patterns apply to every client no matter where they're listed
+	replacer := strings.NewReplacer("%u", username, "%c", username)
+	rules := make([]Rule, 0)
+	for _, rule := range acl.Anonymous {
+		if rule.Pattern {
+			rules = append(rules, Rule{Access: rule.Access, Topic: replacer.Replace(rule.Topic)})
+		}
+	}
+	for _, user := range acl.Users {
+		for _, rule := range user.Rules {
+			if rule.Pattern {
+				rules = append(rules, Rule{Access: rule.Access, Topic: replacer.Replace(rule.Topic)})
+			}
+		}
+	}
+	for _, rule := range topicRules {
+		if !rule.Pattern {
+			rules = append(rules, rule)
+		}
+	}
+
+	allowed := false
+	for _, rule := range rules {
+		if !mqtt.MatchFilter(rule.Topic, topic) {
+			continue
+		}
+		if rule.Access == Deny {
+			return false
+		}
+		if rule.Access.allows(requested) {
+			allowed = true
+		}
+	}
+	return allowed
+}
+
+func (acl ACL) WriteTo(writer io.Writer) (int64, error) {
+	builder := strings.Builder{}
+	builder.WriteString("# Generated by porter broker acl, changes will be overwritten\n")
+	for _, rule := range acl.Anonymous {
+		builder.WriteString(rule.String() + "\n")
+	}
+	for _, user := range acl.Users {
+		builder.WriteString("\n")
+		if user.Comment != "" {
+			builder.WriteString("# " + user.Comment + "\n")
+		}
+		builder.WriteString("user " + user.Name + "\n")
+		for _, rule := range user.Rules {
+			builder.WriteString(rule.String() + "\n")
+		}
+	}
+
+	written, err := io.WriteString(writer, builder.String())
+	return int64(written), err
+}
+
+// ParseACL reads a mosquitto acl_file. Rules for a user that is listed
+// more than once are merged, as mosquitto does.
+func ParseACL(reader io.Reader) (ACL, error) {
+	acl := ACL{Anonymous: make([]Rule, 0), Users: make([]User, 0)}
+	current := -1
+
+	scanner := bufio.NewScanner(reader)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		keyword, rest, _ := strings.Cut(line, " ")
+		rest = strings.TrimSpace(rest)
+		switch keyword {
+		case "user":
+			if rest == "" {
+				return ACL{}, fmt.Errorf("Line %d: user needs a username", lineNumber)
+			}
+			current = -1
+			for idx, user := range acl.Users {
+				if user.Name == rest {
+					current = idx
+				}
+			}
+			if current == -1 {
+				acl.Users = append(acl.Users, User{Name: rest, Rules: make([]Rule, 0)})
+				current = len(acl.Users) - 1
+			}
+		case "topic", "pattern":
+			rule, err := parseRule(rest, keyword == "pattern")
+			if err != nil {
+				return ACL{}, fmt.Errorf("Line %d: %w", lineNumber, err)
+			}
+			if current == -1 {
+				acl.Anonymous = append(acl.Anonymous, rule)
+			} else {
+				acl.Users[current].Rules = append(acl.Users[current].Rules, rule)
+			}
+		default:
+			return ACL{}, fmt.Errorf("Line %d: unknown keyword %s", lineNumber, keyword)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return ACL{}, err
+	}
+
+	return acl, nil
+}
+
+func parseRule(raw string, pattern bool) (Rule, error) {
+	first, rest, found := strings.Cut(raw, " ")
+	access := Access(first)
+	switch access {
+	case Read, Write, ReadWrite, Deny:
+		rest = strings.TrimSpace(rest)
+		if !found || rest == "" {
+			return Rule{}, fmt.Errorf("%s rule needs a topic", access)
+		}
+		return Rule{Access: access, Topic: rest, Pattern: pattern}, nil
+	}
+
+	// mosquitto treats a rule without an access as readwrite, and the
+	// topic itself can contain spaces
+	if raw == "" {
+		return Rule{}, fmt.Errorf("rule needs a topic")
+	}
+	return Rule{Access: ReadWrite, Topic: raw, Pattern: pattern}, nil
+}
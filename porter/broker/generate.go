@@ -0,0 +1,133 @@
+package broker
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"metamakers.org/door-controller-mqtt/mqtt"
+)
+
+// Registry is every account that connects to the broker, grouped by the
+// role it plays. Doors connect with their client ID as their username.
+type Registry struct {
+	Doors      []string
+	AccessList []string
+	Porter     []string
+	// Testing accounts can publish anything in the namespace, for replay
+	// and simulate. Leave it empty outside of test brokers.
+	Testing []string
+}
+
+func (registry Registry) validate() error {
+	if len(registry.Doors) == 0 {
+		return errors.New("The door registry is empty")
+	}
+
+	roles := make(map[string]string)
+	add := func(role string, username string) error {
+		if username == "" || strings.ContainsAny(username, " \t") {
+			return fmt.Errorf("Invalid %s username %q", role, username)
+		}
+		if existing, exists := roles[username]; exists {
+			return fmt.Errorf("%s is listed as both a %s and a %s", username, existing, role)
+		}
+		roles[username] = role
+		return nil
+	}
+
+	for _, door := range registry.Doors {
+		if err := mqtt.ValidateClientID(door); err != nil {
+			return fmt.Errorf("Invalid door %s: %w", door, err)
+		}
+		if err := add("door", door); err != nil {
+			return err
+		}
+	}
+	for _, username := range registry.AccessList {
+		if err := add("access list publisher", username); err != nil {
+			return err
+		}
+	}
+	for _, username := range registry.Porter {
+		if err := add("porter", username); err != nil {
+			return err
+		}
+	}
+	for _, username := range registry.Testing {
+		if err := add("test publisher", username); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Generate builds the ACL for the topic scheme. Doors can only publish
+// under their own <level>/<client ID>, rpc replies included, and only
+// read the access list, health checks and requests meant for them.
+// Only the access list publishers can publish the access list, and
+// porter (diary, watch and rpc) can read everything in the namespace.
+// Test publishers can read and write everything in the namespace.
+func Generate(namespace mqtt.Namespace, registry Registry) (ACL, error) {
+	if err := namespace.Validate(); err != nil {
+		return ACL{}, err
+	}
+	if err := registry.validate(); err != nil {
+		return ACL{}, err
+	}
+
+	topic := func(level string, clientID string) string {
+		return mqtt.Topic{Namespace: namespace, Level: level, ClientID: clientID}.Build()
+	}
+
+	acl := ACL{Anonymous: make([]Rule, 0), Users: make([]User, 0)}
+
+	for _, door := range registry.Doors {
+		rules := make([]Rule, 0)
+		for _, level := range mqtt.DoorLevels {
+			rules = append(rules, Rule{Access: Write, Topic: topic(level, door)})
+		}
+		rules = append(rules,
+			Rule{Access: Write, Topic: topic(mqtt.ResponseLevel, door)},
+			Rule{Access: Read, Topic: topic(mqtt.AccessListLevel, "")},
+			Rule{Access: Read, Topic: topic(mqtt.HealthCheckLevel, "")},
+			Rule{Access: Read, Topic: topic(mqtt.RequestLevel, "")},
+			Rule{Access: Read, Topic: topic(mqtt.RequestLevel, door)},
+		)
+		acl.Users = append(acl.Users, User{Name: door, Comment: "door", Rules: rules})
+	}
+
+	for _, username := range registry.AccessList {
+		acl.Users = append(acl.Users, User{
+			Name:    username,
+			Comment: "access list publisher",
+			Rules: []Rule{
+				{Access: Write, Topic: topic(mqtt.AccessListLevel, "")},
+			},
+		})
+	}
+
+	for _, username := range registry.Porter {
+		acl.Users = append(acl.Users, User{
+			Name:    username,
+			Comment: "porter diary, watch and rpc",
+			Rules: []Rule{
+				{Access: Read, Topic: namespace.Wildcard()},
+				{Access: Write, Topic: topic(mqtt.HealthCheckLevel, "")},
+				{Access: Write, Topic: topic(mqtt.RequestLevel, "") + "/#"},
+			},
+		})
+	}
+
+	for _, username := range registry.Testing {
+		acl.Users = append(acl.Users, User{
+			Name:    username,
+			Comment: "test publisher for replay and simulate",
+			Rules: []Rule{
+				{Access: ReadWrite, Topic: namespace.Wildcard()},
+			},
+		})
+	}
+
+	return acl, nil
+}
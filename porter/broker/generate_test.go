@@ -0,0 +1,145 @@
+package broker
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"metamakers.org/door-controller-mqtt/mqtt"
+)
+
+// developmentRegistry is the accounts the compose file's broker has
+var developmentRegistry = Registry{
+	Doors:      []string{"door_one", "door_two", "door_three", "door_four", "door_five"},
+	AccessList: []string{"access_list"},
+	Porter:     []string{"porter"},
+	Testing:    []string{"porter_test"},
+}
+
+func TestDevelopmentACLIsCurrent(t *testing.T) {
+	committed, err := os.ReadFile("../../mosquitto/acl_file")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	acl, err := Generate(mqtt.DefaultNamespace, developmentRegistry)
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	generated := bytes.Buffer{}
+	acl.WriteTo(&generated)
+
+	if !bytes.Equal(committed, generated.Bytes()) {
+		t.Error("mosquitto/acl_file is stale, regenerate it with porter broker acl --doors door_one,door_two,door_three,door_four,door_five --test_users porter_test -o ../mosquitto/acl_file")
+	}
+}
+
+func TestGeneratedACLAllows(t *testing.T) {
+	namespace := mqtt.Namespace("site/door_controller")
+	generated, err := Generate(namespace, Registry{
+		Doors:      []string{"door_one", "door_two"},
+		AccessList: []string{"access_list"},
+		Porter:     []string{"porter"},
+		Testing:    []string{"porter_test"},
+	})
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	written := bytes.Buffer{}
+	generated.WriteTo(&written)
+	acl, err := ParseACL(&written)
+	if err != nil {
+		t.Fatalf("ParseACL failed: %v", err)
+	}
+
+	topic := func(level string, clientID string) string {
+		return mqtt.Topic{Namespace: namespace, Level: level, ClientID: clientID}.Build()
+	}
+
+	type check struct {
+		username string
+		access   Access
+		topic    string
+		want     bool
+	}
+	checks := make([]check, 0)
+	for _, level := range mqtt.DoorLevels {
+		checks = append(checks,
+			check{username: "door_one", access: Write, topic: topic(level, "door_one"), want: true},
+			check{username: "door_one", access: Write, topic: topic(level, "door_two"), want: false},
+			check{username: "door_one", access: Read, topic: topic(level, "door_one"), want: false},
+			check{username: "porter", access: Read, topic: topic(level, "door_two"), want: true},
+			check{username: "porter", access: Write, topic: topic(level, "door_one"), want: false},
+			check{username: "access_list", access: Write, topic: topic(level, "door_one"), want: false},
+			check{username: "porter_test", access: Write, topic: topic(level, "door_one"), want: true},
+			check{username: "", access: Write, topic: topic(level, "door_one"), want: false},
+			check{username: "stranger", access: Write, topic: topic(level, "door_one"), want: false},
+		)
+	}
+	checks = append(checks,
+		// Doors only reply as themselves
+		check{username: "door_one", access: Write, topic: topic(mqtt.ResponseLevel, "door_one"), want: true},
+		check{username: "door_one", access: Write, topic: topic(mqtt.ResponseLevel, "door_two"), want: false},
+		check{username: "door_one", access: Write, topic: topic(mqtt.ResponseLevel, "porter_rpc_1"), want: false},
+		check{username: "door_one", access: Write, topic: topic(mqtt.ResponseLevel, ""), want: false},
+		check{username: "door_one", access: Write, topic: topic(mqtt.ResponseLevel, "door_one") + "/extra", want: false},
+		check{username: "door_two", access: Write, topic: topic(mqtt.ResponseLevel, "door_two"), want: true},
+		check{username: "door_two", access: Write, topic: topic(mqtt.ResponseLevel, "door_one"), want: false},
+		check{username: "door_one", access: Read, topic: topic(mqtt.ResponseLevel, "door_one"), want: false},
+		check{username: "porter", access: Read, topic: topic(mqtt.ResponseLevel, "door_one"), want: true},
+		check{username: "porter", access: Write, topic: topic(mqtt.ResponseLevel, "door_one"), want: false},
+
+		check{username: "door_one", access: Read, topic: topic(mqtt.AccessListLevel, ""), want: true},
+		check{username: "door_one", access: Write, topic: topic(mqtt.AccessListLevel, ""), want: false},
+		check{username: "door_one", access: Read, topic: topic(mqtt.HealthCheckLevel, ""), want: true},
+		check{username: "door_one", access: Write, topic: topic(mqtt.HealthCheckLevel, ""), want: false},
+		check{username: "door_one", access: Read, topic: topic(mqtt.RequestLevel, ""), want: true},
+		check{username: "door_one", access: Read, topic: topic(mqtt.RequestLevel, "door_one"), want: true},
+		check{username: "door_one", access: Read, topic: topic(mqtt.RequestLevel, "door_two"), want: false},
+		check{username: "door_one", access: Write, topic: topic(mqtt.RequestLevel, "door_two"), want: false},
+
+		check{username: "access_list", access: Write, topic: topic(mqtt.AccessListLevel, ""), want: true},
+		check{username: "access_list", access: Read, topic: topic(mqtt.HealthCheckLevel, ""), want: false},
+
+		// Porter only publishes health checks and rpc requests
+		check{username: "porter", access: Write, topic: topic(mqtt.HealthCheckLevel, ""), want: true},
+		check{username: "porter", access: Write, topic: topic(mqtt.RequestLevel, ""), want: true},
+		check{username: "porter", access: Write, topic: topic(mqtt.RequestLevel, "door_one"), want: true},
+		check{username: "porter", access: Write, topic: topic(mqtt.AccessListLevel, ""), want: false},
+		check{username: "porter", access: Read, topic: "other_site/door_controller/unlock/door_one", want: false},
+
+		check{username: "porter_test", access: Write, topic: topic(mqtt.AccessListLevel, ""), want: true},
+		check{username: "porter_test", access: Read, topic: topic(mqtt.ResponseLevel, "door_one"), want: true},
+		check{username: "porter_test", access: Write, topic: "other_site/door_controller/unlock/door_one", want: false},
+	)
+
+	for _, check := range checks {
+		if got := acl.Allowed(check.username, check.access, check.topic); got != check.want {
+			t.Errorf("%q %s %s: got %t, want %t", check.username, check.access, check.topic, got, check.want)
+		}
+	}
+}
+
+func TestGenerateRejectsRegistry(t *testing.T) {
+	tests := []struct {
+		name     string
+		registry Registry
+		err      string
+	}{
+		{name: "no doors", registry: Registry{Porter: []string{"porter"}}, err: "empty"},
+		{name: "invalid door", registry: Registry{Doors: []string{"door/one"}}, err: "Invalid door"},
+		{name: "username with a space", registry: Registry{Doors: []string{"door_one"}, Porter: []string{"por ter"}}, err: "Invalid porter username"},
+		{name: "door and porter", registry: Registry{Doors: []string{"door_one"}, Porter: []string{"door_one"}}, err: "both a door and a porter"},
+		{name: "porter and test publisher", registry: Registry{Doors: []string{"door_one"}, Porter: []string{"porter"}, Testing: []string{"porter"}}, err: "both a porter and a test publisher"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Generate(mqtt.DefaultNamespace, test.registry)
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("got %v, want an error containing %q", err, test.err)
+			}
+		})
+	}
+}
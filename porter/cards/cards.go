@@ -0,0 +1,112 @@
+package cards
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// maxProblems stops a completely broken list from producing an error too
+// long to publish
+const maxProblems = 5
+
+// Set is the list of cards a door controller lets in, along with the PIN
+// verifier of every card that needs one
+type Set struct {
+	cards map[string]*Verifier
+}
+
+func NewSet() Set {
+	return Set{cards: make(map[string]*Verifier)}
+}
+
+// ListError lists every problem found in an access list
+type ListError struct {
+	Problems []string
+}
+
+func (err *ListError) Error() string {
+	if len(err.Problems) <= maxProblems {
+		return strings.Join(err.Problems, "; ")
+	}
+	return fmt.Sprintf(
+		"%s; and %d more",
+		strings.Join(err.Problems[:maxProblems], "; "),
+		len(err.Problems)-maxProblems,
+	)
+}
+
+// Parse reads an access list with one card per line, written as <card> or
+// <card>|<PIN verifier>. Every card has to be in the encoding's canonical
+// form and no card can be listed twice, a single trailing newline is
+// allowed. An empty list is valid and lets nobody in.
+func Parse(list string, encoding Encoding) (Set, error) {
+	set := NewSet()
+	list = strings.TrimSuffix(strings.ReplaceAll(list, "\r\n", "\n"), "\n")
+	if list == "" {
+		return set, nil
+	}
+
+	problems := make([]string, 0)
+	seen := make(map[string]int)
+	for index, line := range strings.Split(list, "\n") {
+		number := index + 1
+		card, rawVerifier, hasPIN := strings.Cut(line, "|")
+		if err := Validate(encoding, card); err != nil {
+			problems = append(problems, fmt.Sprintf("line %d: %v", number, err))
+			continue
+		}
+		var verifier *Verifier
+		if hasPIN {
+			parsed, err := ParseVerifier(rawVerifier)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("line %d: %v", number, err))
+				continue
+			}
+			verifier = &parsed
+		}
+		if first, duplicate := seen[card]; duplicate {
+			problems = append(problems, fmt.Sprintf("line %d: card %s is already on line %d", number, card, first))
+			continue
+		}
+		seen[card] = number
+		set.cards[card] = verifier
+	}
+
+	if len(problems) > 0 {
+		return NewSet(), &ListError{Problems: problems}
+	}
+	return set, nil
+}
+
+func (set Set) Contains(card string) bool {
+	_, found := set.cards[card]
+	return found
+}
+
+// Verifier returns the card's PIN verifier, false when the card doesn't
+// need a PIN
+func (set Set) Verifier(card string) (Verifier, bool) {
+	verifier := set.cards[card]
+	if verifier == nil {
+		return Verifier{}, false
+	}
+	return *verifier, true
+}
+
+func (set Set) Len() int {
+	return len(set.cards)
+}
+
+// Search returns the cards containing the query in order, an empty query
+// returns every card
+func (set Set) Search(query string) []string {
+	matches := make([]string, 0, len(set.cards))
+	for card := range set.cards {
+		if strings.Contains(card, query) {
+			matches = append(matches, card)
+		}
+	}
+	sort.Strings(matches)
+	return matches
+}
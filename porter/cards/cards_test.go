@@ -0,0 +1,147 @@
+package cards
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	verifier := "pbkdf2-sha256$1$706f72746572$22bea00dd50e9d879588f1c840d94830b43c09ee28df4092efb9be08e35ad640"
+
+	tests := []struct {
+		name     string
+		list     string
+		encoding Encoding
+		cards    []string
+		pins     []string
+		problems []string
+	}{
+		{name: "empty", list: "", encoding: Decimal10{}, cards: []string{}},
+		{name: "only a newline", list: "\n", encoding: Decimal10{}, cards: []string{}},
+		{name: "one card", list: "0001234567", encoding: Decimal10{}, cards: []string{"0001234567"}},
+		{name: "trailing newline", list: "0001234567\n0007654321\n", encoding: Decimal10{}, cards: []string{"0001234567", "0007654321"}},
+		{name: "windows line endings", list: "0001234567\r\n0007654321\r\n", encoding: Decimal10{}, cards: []string{"0001234567", "0007654321"}},
+		{name: "card with a PIN", list: "0001234567|" + verifier + "\n0007654321", encoding: Decimal10{}, cards: []string{"0001234567", "0007654321"}, pins: []string{"0001234567"}},
+		{name: "wiegand26", list: "012:03456\n255:65535", encoding: Wiegand26{}, cards: []string{"012:03456", "255:65535"}},
+		{name: "hexuid", list: "04A23B1C5D6E80", encoding: HexUID{}, cards: []string{"04A23B1C5D6E80"}},
+		{
+			name:     "duplicate",
+			list:     "0001234567\n0007654321\n0001234567",
+			encoding: Decimal10{},
+			problems: []string{"line 3: card 0001234567 is already on line 1"},
+		},
+		{
+			name:     "duplicate with a PIN",
+			list:     "0001234567\n0001234567|" + verifier,
+			encoding: Decimal10{},
+			problems: []string{"line 2: card 0001234567 is already on line 1"},
+		},
+		{
+			name:     "not canonical",
+			list:     "1234567",
+			encoding: Decimal10{},
+			problems: []string{`line 1: Card "1234567" must be written as 0001234567`},
+		},
+		{
+			name:     "lower case hexuid",
+			list:     "04a23b1c5d6e80",
+			encoding: HexUID{},
+			problems: []string{`line 1: Card "04a23b1c5d6e80" must be written as 04A23B1C5D6E80`},
+		},
+		{
+			name:     "blank line",
+			list:     "0001234567\n\n0007654321",
+			encoding: Decimal10{},
+			problems: []string{`line 2: Card "" must be up to 10 digits`},
+		},
+		{
+			name:     "invalid card and verifier",
+			list:     "00012345678\n0001234567|1234",
+			encoding: Decimal10{},
+			problems: []string{
+				`line 1: Card "00012345678" must be up to 10 digits`,
+				"line 2: PIN verifier must be written as pbkdf2-sha256$<iterations>$<salt>$<hash>",
+			},
+		},
+		{
+			name:     "card from another encoding",
+			list:     "012:03456",
+			encoding: Decimal10{},
+			problems: []string{`line 1: Card "012:03456" must be up to 10 digits`},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			set, err := Parse(test.list, test.encoding)
+			if test.problems != nil {
+				var listErr *ListError
+				if !errors.As(err, &listErr) {
+					t.Fatalf("got %v, want a ListError", err)
+				}
+				if !slices.Equal(listErr.Problems, test.problems) {
+					t.Errorf("problems: got %q, want %q", listErr.Problems, test.problems)
+				}
+				// Nothing from a broken list is let in
+				if set.Len() != 0 {
+					t.Errorf("got %d cards from a broken list", set.Len())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+
+			if got := set.Search(""); !slices.Equal(got, test.cards) {
+				t.Errorf("cards: got %v, want %v", got, test.cards)
+			}
+			for _, card := range test.cards {
+				_, hasPIN := set.Verifier(card)
+				if want := slices.Contains(test.pins, card); hasPIN != want {
+					t.Errorf("%s needs a PIN: got %t, want %t", card, hasPIN, want)
+				}
+			}
+		})
+	}
+}
+
+func TestListErrorLimitsProblems(t *testing.T) {
+	_, err := Parse(strings.Repeat("x\n", 8), Decimal10{})
+	if err == nil {
+		t.Fatal("Parse succeeded, want an error")
+	}
+	if got := strings.Count(err.Error(), "line "); got != maxProblems {
+		t.Errorf("got %d problems in %q, want %d", got, err, maxProblems)
+	}
+	if !strings.HasSuffix(err.Error(), "; and 3 more") {
+		t.Errorf("got %q, want it to end with the 3 problems left out", err)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	set, err := Parse("0001234567\n0007654321\n0001230000", Decimal10{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{query: "", want: []string{"0001230000", "0001234567", "0007654321"}},
+		{query: "123", want: []string{"0001230000", "0001234567"}},
+		{query: "654", want: []string{"0007654321"}},
+		{query: "999", want: []string{}},
+	}
+
+	for _, test := range tests {
+		if got := set.Search(test.query); !slices.Equal(got, test.want) {
+			t.Errorf("Search(%q): got %v, want %v", test.query, got, test.want)
+		}
+	}
+	if !set.Contains("0007654321") || set.Contains("7654321") {
+		t.Error("Contains only matches the canonical form")
+	}
+}
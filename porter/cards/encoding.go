@@ -0,0 +1,179 @@
+package cards
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Encoding is how a reader writes the cards it reads. Cards are listed
+// and published in the encoding's canonical form.
+type Encoding interface {
+	Name() string
+	// Normalize turns a code entered at the reader into its canonical
+	// form, or says why it isn't a card
+	Normalize(code string) (string, error)
+	// Format writes a card number from the access system's database
+	Format(number uint64) (string, error)
+	// Characters are the ones a code can be typed with
+	Characters() string
+	// MaxLength is the longest a code can be typed as
+	MaxLength() int
+	Placeholder() string
+}
+
+const (
+	Decimal10Name = "decimal10"
+	Wiegand26Name = "wiegand26"
+	HexUIDName    = "hexuid"
+)
+
+var encodings = map[string]Encoding{
+	Decimal10Name: Decimal10{},
+	Wiegand26Name: Wiegand26{},
+	HexUIDName:    HexUID{},
+}
+
+// LookupEncoding finds an encoding by name, an empty name is decimal10
+func LookupEncoding(name string) (Encoding, error) {
+	if name == "" {
+		return Decimal10{}, nil
+	}
+	if encoding, found := encodings[name]; found {
+		return encoding, nil
+	}
+	names := make([]string, 0, len(encodings))
+	for name := range encodings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return nil, fmt.Errorf("Unknown card encoding %s, expected one of %s", name, strings.Join(names, ", "))
+}
+
+// Validate checks a card is written in the encoding's canonical form, as
+// access lists have to be
+func Validate(encoding Encoding, card string) error {
+	normalized, err := encoding.Normalize(card)
+	if err != nil {
+		return err
+	}
+	if normalized != card {
+		return fmt.Errorf("Card %q must be written as %s", card, normalized)
+	}
+	return nil
+}
+
+// Decimal10 is a card number of exactly 10 digits, shorter numbers are
+// padded with leading zeros
+type Decimal10 struct{}
+
+func (Decimal10) Name() string {
+	return Decimal10Name
+}
+
+func (Decimal10) Normalize(code string) (string, error) {
+	if code == "" || len(code) > 10 || strings.Trim(code, "0123456789") != "" {
+		return "", fmt.Errorf("Card %q must be up to 10 digits", code)
+	}
+	return strings.Repeat("0", 10-len(code)) + code, nil
+}
+
+func (Decimal10) Format(number uint64) (string, error) {
+	if number > 9_999_999_999 {
+		return "", fmt.Errorf("Card number %d is longer than 10 digits", number)
+	}
+	return fmt.Sprintf("%010d", number), nil
+}
+
+func (Decimal10) Characters() string {
+	return "0123456789"
+}
+
+func (Decimal10) MaxLength() int {
+	return 10
+}
+
+func (Decimal10) Placeholder() string {
+	return "0001234567"
+}
+
+// Wiegand26 is the facility code and card number sent in a 26 bit
+// Wiegand frame, written as facility:card like 012:03456
+type Wiegand26 struct{}
+
+func (Wiegand26) Name() string {
+	return Wiegand26Name
+}
+
+func (Wiegand26) Normalize(code string) (string, error) {
+	rawFacility, rawCard, found := strings.Cut(code, ":")
+	if !found {
+		return "", fmt.Errorf("Card %q must be written as facility:card", code)
+	}
+	facility, err := strconv.ParseUint(rawFacility, 10, 8)
+	if err != nil {
+		return "", fmt.Errorf("Card %q must have a facility code from 0 to 255", code)
+	}
+	card, err := strconv.ParseUint(rawCard, 10, 16)
+	if err != nil {
+		return "", fmt.Errorf("Card %q must have a card number from 0 to 65535", code)
+	}
+	return fmt.Sprintf("%03d:%05d", facility, card), nil
+}
+
+// Format reads the number as the 24 data bits of the frame, the facility
+// code followed by the card number
+func (Wiegand26) Format(number uint64) (string, error) {
+	if number >= 1<<24 {
+		return "", fmt.Errorf("Card number %d doesn't fit in 24 bits", number)
+	}
+	return fmt.Sprintf("%03d:%05d", number>>16, number&0xffff), nil
+}
+
+func (Wiegand26) Characters() string {
+	return "0123456789:"
+}
+
+func (Wiegand26) MaxLength() int {
+	return 9
+}
+
+func (Wiegand26) Placeholder() string {
+	return "012:03456"
+}
+
+// HexUID is the 7 byte UID of an ISO 14443 card in upper case hex, the
+// bytes can be typed separated by colons
+type HexUID struct{}
+
+func (HexUID) Name() string {
+	return HexUIDName
+}
+
+func (HexUID) Normalize(code string) (string, error) {
+	uid := strings.ToUpper(strings.ReplaceAll(code, ":", ""))
+	if len(uid) != 14 || strings.Trim(uid, "0123456789ABCDEF") != "" {
+		return "", fmt.Errorf("Card %q must be a 7 byte UID in hex", code)
+	}
+	return uid, nil
+}
+
+func (HexUID) Format(number uint64) (string, error) {
+	if number >= 1<<56 {
+		return "", fmt.Errorf("Card number %d is longer than 7 bytes", number)
+	}
+	return fmt.Sprintf("%014X", number), nil
+}
+
+func (HexUID) Characters() string {
+	return "0123456789abcdefABCDEF:"
+}
+
+func (HexUID) MaxLength() int {
+	return 20
+}
+
+func (HexUID) Placeholder() string {
+	return "04A23B1C5D6E80"
+}
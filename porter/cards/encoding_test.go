@@ -0,0 +1,153 @@
+package cards
+
+import (
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name     string
+		encoding Encoding
+		code     string
+		want     string
+		wantErr  bool
+	}{
+		{name: "decimal10 padded", encoding: Decimal10{}, code: "1234567", want: "0001234567"},
+		{name: "decimal10 single digit", encoding: Decimal10{}, code: "0", want: "0000000000"},
+		{name: "decimal10 full length", encoding: Decimal10{}, code: "9999999999", want: "9999999999"},
+		{name: "decimal10 too long", encoding: Decimal10{}, code: "12345678901", wantErr: true},
+		{name: "decimal10 empty", encoding: Decimal10{}, code: "", wantErr: true},
+		{name: "decimal10 letters", encoding: Decimal10{}, code: "12345abc", wantErr: true},
+		{name: "decimal10 sign", encoding: Decimal10{}, code: "-1234", wantErr: true},
+		{name: "decimal10 space", encoding: Decimal10{}, code: " 1234", wantErr: true},
+
+		{name: "wiegand26 padded", encoding: Wiegand26{}, code: "12:3456", want: "012:03456"},
+		{name: "wiegand26 lowest", encoding: Wiegand26{}, code: "0:0", want: "000:00000"},
+		{name: "wiegand26 highest", encoding: Wiegand26{}, code: "255:65535", want: "255:65535"},
+		{name: "wiegand26 facility too high", encoding: Wiegand26{}, code: "256:00001", wantErr: true},
+		{name: "wiegand26 card too high", encoding: Wiegand26{}, code: "012:65536", wantErr: true},
+		{name: "wiegand26 negative facility", encoding: Wiegand26{}, code: "-1:00001", wantErr: true},
+		{name: "wiegand26 signed card", encoding: Wiegand26{}, code: "012:+3456", wantErr: true},
+		{name: "wiegand26 no separator", encoding: Wiegand26{}, code: "01203456", wantErr: true},
+		{name: "wiegand26 empty facility", encoding: Wiegand26{}, code: ":03456", wantErr: true},
+		{name: "wiegand26 empty card", encoding: Wiegand26{}, code: "012:", wantErr: true},
+		{name: "wiegand26 extra part", encoding: Wiegand26{}, code: "012:034:56", wantErr: true},
+		{name: "wiegand26 hex", encoding: Wiegand26{}, code: "0x1:03456", wantErr: true},
+
+		{name: "hexuid upper case", encoding: HexUID{}, code: "04A23B1C5D6E80", want: "04A23B1C5D6E80"},
+		{name: "hexuid lower case", encoding: HexUID{}, code: "04a23b1c5d6e80", want: "04A23B1C5D6E80"},
+		{name: "hexuid mixed case", encoding: HexUID{}, code: "04a23B1c5D6e80", want: "04A23B1C5D6E80"},
+		{name: "hexuid colons", encoding: HexUID{}, code: "04:a2:3b:1c:5d:6e:80", want: "04A23B1C5D6E80"},
+		{name: "hexuid 4 byte UID", encoding: HexUID{}, code: "04A23B1C", wantErr: true},
+		{name: "hexuid 10 byte UID", encoding: HexUID{}, code: "04A23B1C5D6E80112233", wantErr: true},
+		{name: "hexuid odd length", encoding: HexUID{}, code: "04A23B1C5D6E8", wantErr: true},
+		{name: "hexuid not hex", encoding: HexUID{}, code: "04A23B1C5D6EZZ", wantErr: true},
+		{name: "hexuid empty", encoding: HexUID{}, code: "", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := test.encoding.Normalize(test.code)
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("Normalize(%q) = %s, want an error", test.code, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Normalize(%q) failed: %v", test.code, err)
+			}
+			if got != test.want {
+				t.Errorf("Normalize(%q): got %s, want %s", test.code, got, test.want)
+			}
+			if len(test.code) > test.encoding.MaxLength() {
+				t.Errorf("%q is longer than the MaxLength %d", test.code, test.encoding.MaxLength())
+			}
+			// The canonical form is canonical
+			if err := Validate(test.encoding, got); err != nil {
+				t.Errorf("Validate(%s) failed: %v", got, err)
+			}
+		})
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		encoding Encoding
+		number   uint64
+		want     string
+		wantErr  bool
+	}{
+		{name: "decimal10", encoding: Decimal10{}, number: 1234567, want: "0001234567"},
+		{name: "decimal10 highest", encoding: Decimal10{}, number: 9_999_999_999, want: "9999999999"},
+		{name: "decimal10 too long", encoding: Decimal10{}, number: 10_000_000_000, wantErr: true},
+
+		{name: "wiegand26", encoding: Wiegand26{}, number: 12<<16 | 3456, want: "012:03456"},
+		{name: "wiegand26 zero", encoding: Wiegand26{}, number: 0, want: "000:00000"},
+		{name: "wiegand26 highest", encoding: Wiegand26{}, number: 1<<24 - 1, want: "255:65535"},
+		{name: "wiegand26 over 24 bits", encoding: Wiegand26{}, number: 1 << 24, wantErr: true},
+
+		{name: "hexuid", encoding: HexUID{}, number: 0x04A23B1C5D6E80, want: "04A23B1C5D6E80"},
+		{name: "hexuid padded", encoding: HexUID{}, number: 0xff, want: "000000000000FF"},
+		{name: "hexuid highest", encoding: HexUID{}, number: 1<<56 - 1, want: "FFFFFFFFFFFFFF"},
+		{name: "hexuid over 7 bytes", encoding: HexUID{}, number: 1 << 56, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := test.encoding.Format(test.number)
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("Format(%d) = %s, want an error", test.number, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Format(%d) failed: %v", test.number, err)
+			}
+			if got != test.want {
+				t.Errorf("Format(%d): got %s, want %s", test.number, got, test.want)
+			}
+			// Formatted cards go straight onto the access list
+			if err := Validate(test.encoding, got); err != nil {
+				t.Errorf("Validate(%s) failed: %v", got, err)
+			}
+		})
+	}
+}
+
+func TestLookupEncoding(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{name: "", want: Decimal10Name},
+		{name: Decimal10Name, want: Decimal10Name},
+		{name: Wiegand26Name, want: Wiegand26Name},
+		{name: HexUIDName, want: HexUIDName},
+		{name: "HEXUID", wantErr: true},
+		{name: "wiegand34", wantErr: true},
+	}
+
+	for _, test := range tests {
+		encoding, err := LookupEncoding(test.name)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("LookupEncoding(%q) succeeded, want an error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("LookupEncoding(%q) failed: %v", test.name, err)
+		}
+		if encoding.Name() != test.want {
+			t.Errorf("LookupEncoding(%q): got %s, want %s", test.name, encoding.Name(), test.want)
+		}
+		// The placeholder shows a valid card
+		if err := Validate(encoding, encoding.Placeholder()); err != nil {
+			t.Errorf("%s placeholder: %v", encoding.Name(), err)
+		}
+	}
+}
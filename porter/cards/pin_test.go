@@ -0,0 +1,116 @@
+package cards
+
+import (
+	"strings"
+	"testing"
+)
+
+// The hashes were worked out with Python's hashlib.pbkdf2_hmac
+func TestVerifierKnownAnswers(t *testing.T) {
+	tests := []struct {
+		verifier string
+		pin      string
+		want     bool
+	}{
+		{verifier: "pbkdf2-sha256$4096$000102030405060708090a0b0c0d0e0f$0d8ff29f17f144693efffa42dc5caf40b4aa290fa98aa70775833d62623c22d7", pin: "4821", want: true},
+		{verifier: "pbkdf2-sha256$4096$000102030405060708090a0b0c0d0e0f$0d8ff29f17f144693efffa42dc5caf40b4aa290fa98aa70775833d62623c22d7", pin: "4822", want: false},
+		{verifier: "pbkdf2-sha256$4096$000102030405060708090a0b0c0d0e0f$0d8ff29f17f144693efffa42dc5caf40b4aa290fa98aa70775833d62623c22d7", pin: "04821", want: false},
+		{verifier: "pbkdf2-sha256$1$706f72746572$22bea00dd50e9d879588f1c840d94830b43c09ee28df4092efb9be08e35ad640", pin: "00001234", want: true},
+		{verifier: "pbkdf2-sha256$2$706f72746572$22bea00dd50e9d879588f1c840d94830b43c09ee28df4092efb9be08e35ad640", pin: "00001234", want: false},
+		{verifier: "pbkdf2-sha256$1$706f72746572$22bea00dd50e9d879588f1c840d94830b43c09ee28df4092efb9be08e35ad640", pin: "1234", want: false},
+	}
+
+	for _, test := range tests {
+		verifier, err := ParseVerifier(test.verifier)
+		if err != nil {
+			t.Fatalf("ParseVerifier(%s) failed: %v", test.verifier, err)
+		}
+		if got := verifier.Check(test.pin); got != test.want {
+			t.Errorf("%s with PIN %s: got %t, want %t", test.verifier, test.pin, got, test.want)
+		}
+		if got := verifier.String(); got != test.verifier {
+			t.Errorf("String: got %s, want %s", got, test.verifier)
+		}
+	}
+}
+
+func TestHashPIN(t *testing.T) {
+	tests := []struct {
+		pin     string
+		wantErr bool
+	}{
+		{pin: "1234"},
+		{pin: "0000"},
+		{pin: "12345678"},
+		{pin: "123", wantErr: true},
+		{pin: "123456789", wantErr: true},
+		{pin: "12a4", wantErr: true},
+		{pin: " 1234", wantErr: true},
+		{pin: "", wantErr: true},
+	}
+
+	for _, test := range tests {
+		verifier, err := HashPIN(test.pin)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("HashPIN(%q) succeeded, want an error", test.pin)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("HashPIN(%q) failed: %v", test.pin, err)
+		}
+
+		parsed, err := ParseVerifier(verifier.String())
+		if err != nil {
+			t.Fatalf("ParseVerifier(%s) failed: %v", verifier, err)
+		}
+		if parsed.Iterations != PINIterations || len(parsed.Salt) != pinSaltLength {
+			t.Errorf("got %d iterations and a %d byte salt, want %d and %d", parsed.Iterations, len(parsed.Salt), PINIterations, pinSaltLength)
+		}
+		if !parsed.Check(test.pin) {
+			t.Errorf("%s doesn't accept PIN %s", verifier, test.pin)
+		}
+		if parsed.Check("99999") {
+			t.Errorf("%s accepts PIN 99999", verifier)
+		}
+	}
+
+	// Every verifier gets its own salt
+	first, _ := HashPIN("1234")
+	second, _ := HashPIN("1234")
+	if first.String() == second.String() {
+		t.Error("Two verifiers for the same PIN are the same")
+	}
+}
+
+func TestParseVerifierRejects(t *testing.T) {
+	hash := strings.Repeat("ab", pinHashLength)
+	tests := []struct {
+		name     string
+		verifier string
+	}{
+		{name: "empty", verifier: ""},
+		{name: "plain PIN", verifier: "1234"},
+		{name: "other scheme", verifier: "bcrypt$4096$00ff$" + hash},
+		{name: "missing hash", verifier: "pbkdf2-sha256$4096$00ff"},
+		{name: "extra part", verifier: "pbkdf2-sha256$4096$00ff$" + hash + "$00"},
+		{name: "iterations not a number", verifier: "pbkdf2-sha256$many$00ff$" + hash},
+		{name: "zero iterations", verifier: "pbkdf2-sha256$0$00ff$" + hash},
+		{name: "negative iterations", verifier: "pbkdf2-sha256$-1$00ff$" + hash},
+		{name: "empty salt", verifier: "pbkdf2-sha256$4096$$" + hash},
+		{name: "salt not hex", verifier: "pbkdf2-sha256$4096$salt$" + hash},
+		{name: "odd length salt", verifier: "pbkdf2-sha256$4096$0ff$" + hash},
+		{name: "short hash", verifier: "pbkdf2-sha256$4096$00ff$" + hash[2:]},
+		{name: "long hash", verifier: "pbkdf2-sha256$4096$00ff$" + hash + "ab"},
+		{name: "hash not hex", verifier: "pbkdf2-sha256$4096$00ff$" + strings.Repeat("zz", pinHashLength)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if verifier, err := ParseVerifier(test.verifier); err == nil {
+				t.Errorf("ParseVerifier(%q) succeeded with %s, want an error", test.verifier, verifier)
+			}
+		})
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"net/url"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -18,6 +19,9 @@ import (
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 
+	"metamakers.org/door-controller-mqtt/cards"
+	"metamakers.org/door-controller-mqtt/config"
+	"metamakers.org/door-controller-mqtt/connection"
 	"metamakers.org/door-controller-mqtt/mqtt"
 )
 
@@ -28,20 +32,23 @@ var accessListCmd = &cobra.Command{
 	Run:   runAccessList,
 }
 
-var dbUri string
-
 func init() {
 	rootCmd.AddCommand(accessListCmd)
 
-	accessListCmd.Flags().StringVarP(&dbUri, "db_uri", "d", "", "Uri used to connect to the database")
+	accessListCmd.Flags().StringP("db_uri", "d", config.Default().AccessList.DBUri, "Uri used to connect to the database")
+	accessListCmd.Flags().String("card_encoding", config.Default().AccessList.CardEncoding, "How cards are written for the door readers: decimal10, wiegand26 or hexuid")
 }
 
+var accessListConnectTimeout = time.Minute
+
 type AccessControl struct {
 	ID      int    `db:"id"`
 	CardNum int    `db:"rfid_card_num"`
 	CardVal int    `db:"rfid_card_val"`
 	Status  string `db:"status"`
 	Comment string `db:"comment"`
+	// PinHash is the card's PIN verifier, made with porter pin_hash
+	PinHash sql.NullString `db:"pin_hash"`
 }
 
 func runAccessList(cmd *cobra.Command, args []string) {
@@ -54,23 +61,11 @@ func runAccessList(cmd *cobra.Command, args []string) {
 	queryErr := make(chan error, 1)
 	cardList := make(chan string, 1)
 
-	if result, found := os.LookupEnv("DB_CONNECTION_URI"); found {
-		dbUri = result
-	}
-
-	if result, found := os.LookupEnv("MQTT_URI"); found {
-		mqttUri = result
-	}
-
-	if result, found := os.LookupEnv("MQTT_USER"); found {
-		username = result
-	}
-
-	if result, found := os.LookupEnv("MQTT_PASSWORD"); found {
-		password = result
-	}
+	cfg := loadConfig(cmd)
+	namespace := loadNamespace(cfg)
+	encoding := loadCardEncoding(cfg.AccessList.CardEncoding)
 
-	db, err := sql.Open("mysql", dbUri)
+	db, err := sql.Open("mysql", cfg.AccessList.DBUri)
 	if err != nil {
 		log.Error().
 			Str("error", err.Error()).
@@ -100,44 +95,66 @@ func runAccessList(cmd *cobra.Command, args []string) {
 			return
 		}
 
-		var list string
-		for idx, code := range accessCodes {
+		// A card the readers can't be sent is left out rather than
+		// stopping every other card from being published
+		list := make([]string, 0, len(accessCodes))
+		for _, code := range accessCodes {
+			if code.CardVal < 0 {
+				log.Error().
+					Str("event", "SkippingCard").
+					Int("card_number", code.CardVal).
+					Msg(fmt.Sprintf("Skipping card %d, card numbers can't be negative", code.CardVal))
+				continue
+			}
+			card, err := encoding.Format(uint64(code.CardVal))
+			if err != nil {
+				log.Error().
+					Str("error", err.Error()).
+					Str("event", "SkippingCard").
+					Int("card_number", code.CardVal).
+					Msg(fmt.Sprintf("Skipping card: %v", err))
+				continue
+			}
+			if code.PinHash.Valid && code.PinHash.String != "" {
+				// A card with a broken verifier is left out, not let
+				// in without its PIN
+				if _, err := cards.ParseVerifier(code.PinHash.String); err != nil {
+					log.Error().
+						Str("error", err.Error()).
+						Str("event", "SkippingCard").
+						Int("card_number", code.CardVal).
+						Msg(fmt.Sprintf("Skipping card %s: %v", card, err))
+					continue
+				}
+				log.Info().
+					Str("event", "AddingCard").
+					Int("card_number", code.CardVal).
+					Str("card", card).
+					Bool("pin", true).
+					Msg(fmt.Sprintf("Adding card %s with a PIN to list", card))
+				list = append(list, card+"|"+code.PinHash.String)
+				continue
+			}
 			log.Info().
 				Str("event", "AddingCard").
 				Int("card_number", code.CardVal).
-				Msg(fmt.Sprintf("Adding card %010d to list", code.CardVal))
-			list += fmt.Sprintf("%010d", code.CardVal)
-			if idx < len(accessCodes)-1 {
-				list += "\n"
-			}
+				Str("card", card).
+				Msg(fmt.Sprintf("Adding card %s to list", card))
+			list = append(list, card)
 		}
 
-		cardList <- list
+		cardList <- strings.Join(list, "\n")
 	}()
 
-	serverUrl, err := url.Parse(mqttUri)
-	if err != nil {
-		log.Error().
-			Str("error", err.Error()).
-			Str("event", "URLParse").
-			Msg(fmt.Sprintf("Url parse Error: %v\n", err))
-		syscall.Exit(2)
-		return
-	}
-
-	clientConfig := autopaho.ClientConfig{
-		ServerUrls:                    []*url.URL{serverUrl},
-		ConnectUsername:               username,
-		ConnectPassword:               []byte(password),
-		KeepAlive:                     20,
-		CleanStartOnInitialConnection: true,
-		SessionExpiryInterval:         60,
-		OnConnectionUp: func(connectionManager *autopaho.ConnectionManager, connectionAck *paho.Connack) {
-			log.Info().
-				Str("event", "OnConnectionUp").
-				Str("response", connectionAck.Properties.ResponseInfo).
-				Msg("Connected to MQTT broker")
-
+	clientConfig, err := connection.Options{
+		URIs:          cfg.MQTT.URIs,
+		Username:      cfg.MQTT.Username,
+		Password:      cfg.MQTT.Password,
+		ClientID:      cfg.MQTT.Username,
+		Transport:     loadTransport(cfg),
+		CleanStart:    true,
+		SessionExpiry: time.Minute,
+		OnConnectionUp: func(connectionManager *autopaho.ConnectionManager, connectionAck *paho.Connack, broker *url.URL) {
 			timeout := time.NewTimer(time.Second * 30)
 			select {
 			case <-timeout.C:
@@ -148,21 +165,25 @@ func runAccessList(cmd *cobra.Command, args []string) {
 			case list := <-cardList:
 				if _, err := connectionManager.Publish(ctx, &paho.Publish{
 					QoS:     2,
-					Topic:   mqtt.AccessListTopic,
+					Topic:   mqtt.Topic{Namespace: namespace, Level: mqtt.AccessListLevel}.Build(),
 					Payload: []byte(list),
 				}); err != nil {
-					if ctx.Err() == nil {
-						log.Error().
-							Str("error", err.Error()).
-							Str("event", "AccessListPublish").
-							Msg(fmt.Sprintf("Failed to publish: %v", err))
-					} else {
+					if ctx.Err() != nil {
 						log.Warn().
 							Str("error", err.Error()).
 							Str("event", "AccessListPublish").
 							Msg(fmt.Sprintf("Published cancelled by context: %v", err))
+						fatalErr <- err
+						return
 					}
-					fatalErr <- err
+					// The connection dropped mid publish, keep the list
+					// for when the next broker comes up
+					log.Warn().
+						Str("error", err.Error()).
+						Str("event", "AccessListPublish").
+						Str("broker", broker.Redacted()).
+						Msg(fmt.Sprintf("Failed to publish, retrying once reconnected: %v", err))
+					cardList <- list
 					return
 				}
 				done <- true
@@ -174,40 +195,14 @@ func runAccessList(cmd *cobra.Command, args []string) {
 				fatalErr <- err
 			}
 		},
-		OnConnectError: func(err error) {
-			log.Error().
-				Str("error", err.Error()).
-				Str("event", "OnConnectError").
-				Msg(fmt.Sprintf("MQTT Connection error: %v", err))
-			fatalErr <- err
-		},
-		ClientConfig: paho.ClientConfig{
-			ClientID: username,
-			OnClientError: func(err error) {
-				log.Error().
-					Str("error", err.Error()).
-					Str("event", "OnClientError").
-					Msg(fmt.Sprintf("MQTT Client error: %v", err))
-				fatalErr <- err
-			},
-			OnServerDisconnect: func(disconnect *paho.Disconnect) {
-				err := errors.New("Disconnected from MQTT broker")
-				if disconnect.Properties != nil {
-					log.Warn().
-						Str("error", err.Error()).
-						Str("reason", disconnect.Properties.ReasonString).
-						Str("event", "OnServerDisconnect").
-						Msg(fmt.Sprintf("MQTT client disconnect: %v", err))
-					fatalErr <- err
-				} else {
-					log.Warn().
-						Str("error", err.Error()).
-						Str("event", "OnServerDisconnect").
-						Msg(fmt.Sprintf("MQTT client disconnect: %v", err))
-					fatalErr <- err
-				}
-			},
-		},
+	}.ClientConfig(ctx)
+	if err != nil {
+		log.Error().
+			Str("error", err.Error()).
+			Str("event", "URLParse").
+			Msg(fmt.Sprintf("Url parse Error: %v\n", err))
+		syscall.Exit(2)
+		return
 	}
 
 	serverConnection, err := autopaho.NewConnection(ctx, clientConfig)
@@ -222,6 +217,16 @@ func runAccessList(cmd *cobra.Command, args []string) {
 		}
 	}
 
+	// A broker being down isn't fatal while there are backups to fail
+	// over to, but giving up is better than waiting forever
+	go func() {
+		connectCtx, cancelConnect := context.WithTimeout(ctx, accessListConnectTimeout)
+		defer cancelConnect()
+		if err := serverConnection.AwaitConnection(connectCtx); err != nil && ctx.Err() == nil {
+			fatalErr <- fmt.Errorf("Failed to connect to any MQTT broker: %w", err)
+		}
+	}()
+
 	select {
 	case <-done:
 		log.Info().
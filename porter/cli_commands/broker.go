@@ -0,0 +1,139 @@
+package cli_commands
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"syscall"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	"metamakers.org/door-controller-mqtt/broker"
+	"metamakers.org/door-controller-mqtt/config"
+)
+
+var brokerCmd = &cobra.Command{
+	Use:   "broker",
+	Short: "Generates config for the MQTT broker",
+	Long:  "Generates config for the MQTT broker from the door registry",
+}
+
+var brokerACLCmd = &cobra.Command{
+	Use:   "acl",
+	Short: "Generates a mosquitto ACL file for the topic scheme",
+	Long: `Generates a mosquitto ACL file for the topic scheme from the door registry.
+Each door can only publish under its own <level>/<client_id> and only read the
+access list, health checks and its requests. Only the access list users can
+publish the access list, and the porter users can read every topic. The test
+users can read and write every topic, for replay and simulate.`,
+	Run: runBrokerACL,
+}
+
+var brokerACLCheckCmd = &cobra.Command{
+	Use:   "check <acl_file> <username> <read|write> <topic>",
+	Short: "Checks whether an ACL file lets a user read or write a topic",
+	Long:  "Checks whether an ACL file lets a user read or write a topic, exits with 1 when it doesn't",
+	Args:  cobra.ExactArgs(4),
+	Run:   runBrokerACLCheck,
+}
+
+func init() {
+	rootCmd.AddCommand(brokerCmd)
+	brokerCmd.AddCommand(brokerACLCmd)
+	brokerACLCmd.AddCommand(brokerACLCheckCmd)
+
+	defaults := config.Default().Broker
+	brokerACLCmd.Flags().StringSlice("doors", defaults.Doors, "Client IDs of the door controllers")
+	brokerACLCmd.Flags().StringSlice("access_list_users", defaults.AccessListUsers, "Usernames allowed to publish the access list")
+	brokerACLCmd.Flags().StringSlice("porter_users", defaults.PorterUsers, "Usernames used by diary, watch and rpc")
+	brokerACLCmd.Flags().StringSlice("test_users", defaults.TestUsers, "Usernames allowed to publish anything, for replay and simulate on test brokers")
+	brokerACLCmd.Flags().StringP("acl_file", "o", defaults.ACLFile, "File the ACL is written to (defaults to stdout)")
+}
+
+func runBrokerACL(cmd *cobra.Command, args []string) {
+	cfg := loadConfig(cmd)
+
+	acl, err := broker.Generate(loadNamespace(cfg), broker.Registry{
+		Doors:      cfg.Broker.Doors,
+		AccessList: cfg.Broker.AccessListUsers,
+		Porter:     cfg.Broker.PorterUsers,
+		Testing:    cfg.Broker.TestUsers,
+	})
+	if err != nil {
+		log.Error().
+			Str("error", err.Error()).
+			Str("event", "ACLGenerate").
+			Msg(fmt.Sprintf("Failed to generate ACL: %v", err))
+		syscall.Exit(2)
+	}
+
+	generated := bytes.Buffer{}
+	acl.WriteTo(&generated)
+
+	// mosquitto refuses to start with an ACL file it can't read, so make
+	// sure it parses before it replaces a working one
+	if _, err := broker.ParseACL(bytes.NewReader(generated.Bytes())); err != nil {
+		log.Error().
+			Str("error", err.Error()).
+			Str("event", "ACLGenerate").
+			Msg(fmt.Sprintf("Generated ACL doesn't parse: %v", err))
+		syscall.Exit(1)
+	}
+
+	if cfg.Broker.ACLFile == "" {
+		os.Stdout.Write(generated.Bytes())
+		return
+	}
+
+	if err := os.WriteFile(cfg.Broker.ACLFile, generated.Bytes(), 0o644); err != nil {
+		log.Error().
+			Str("error", err.Error()).
+			Str("event", "ACLWrite").
+			Str("path", cfg.Broker.ACLFile).
+			Msg(fmt.Sprintf("Failed to write ACL: %v", err))
+		syscall.Exit(1)
+	}
+	log.Info().
+		Str("event", "ACLWrite").
+		Str("path", cfg.Broker.ACLFile).
+		Int("doors", len(cfg.Broker.Doors)).
+		Msg(fmt.Sprintf("Wrote ACL to %s", cfg.Broker.ACLFile))
+}
+
+func runBrokerACLCheck(cmd *cobra.Command, args []string) {
+	path, username, access, topic := args[0], args[1], broker.Access(args[2]), args[3]
+	if access != broker.Read && access != broker.Write {
+		log.Error().
+			Str("event", "ACLCheck").
+			Msg(fmt.Sprintf("Access must be %s or %s, got %s", broker.Read, broker.Write, access))
+		syscall.Exit(2)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		log.Error().
+			Str("error", err.Error()).
+			Str("event", "ACLCheck").
+			Str("path", path).
+			Msg(fmt.Sprintf("Failed to open ACL: %v", err))
+		syscall.Exit(2)
+	}
+	defer file.Close()
+
+	acl, err := broker.ParseACL(file)
+	if err != nil {
+		log.Error().
+			Str("error", err.Error()).
+			Str("event", "ACLCheck").
+			Str("path", path).
+			Msg(fmt.Sprintf("Failed to parse ACL: %v", err))
+		syscall.Exit(2)
+	}
+
+	if !acl.Allowed(username, access, topic) {
+		fmt.Printf("denied: %s can't %s %s\n", username, access, topic)
+		syscall.Exit(1)
+	}
+	fmt.Printf("allowed: %s can %s %s\n", username, access, topic)
+}
@@ -0,0 +1,47 @@
+package cli_commands
+
+import (
+	"fmt"
+	"syscall"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect porter's config",
+	Long:  "Inspect the config porter builds from the config file, environment variables and flags",
+}
+
+var configShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Print the effective config",
+	Long:  "Print the effective config as YAML with every secret redacted",
+	Run:   runConfigShow,
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configShowCmd)
+}
+
+func runConfigShow(cmd *cobra.Command, args []string) {
+	cfg, path := loadConfigFile(cmd)
+
+	content, err := cfg.Redacted().YAML()
+	if err != nil {
+		log.Error().
+			Str("error", err.Error()).
+			Str("event", "ConfigShow").
+			Msg(fmt.Sprintf("Failed to encode config: %v", err))
+		syscall.Exit(1)
+	}
+
+	if path == "" {
+		fmt.Println("# no config file found, showing defaults and environment")
+	} else {
+		fmt.Printf("# loaded from %s\n", path)
+	}
+	fmt.Print(string(content))
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
@@ -17,6 +18,9 @@ import (
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
+	"metamakers.org/door-controller-mqtt/config"
+	"metamakers.org/door-controller-mqtt/connection"
+	"metamakers.org/door-controller-mqtt/diary"
 	"metamakers.org/door-controller-mqtt/mqtt"
 )
 
@@ -29,6 +33,19 @@ var diaryCmd = &cobra.Command{
 
 func init() {
 	rootCmd.AddCommand(diaryCmd)
+
+	defaults := config.Default().Diary
+	diaryCmd.Flags().String("http_addr", defaults.HTTPAddr, "Address the status API listens on, leave empty to disable")
+	diaryCmd.Flags().Duration("unhealthy_after", defaults.UnhealthyAfter, "How long a door can go without publishing before it's unhealthy")
+	diaryCmd.Flags().Duration("health_check_interval", defaults.HealthCheckInterval, "How often a health check is sent to the doors")
+	diaryCmd.Flags().Duration("check_health_interval", defaults.CheckHealthInterval, "How often the health of each door is checked")
+	diaryCmd.Flags().Duration("dedup_window", defaults.Dedup.Window, "How long handled messages are remembered to detect redeliveries")
+	diaryCmd.Flags().Int("dedup_size", defaults.Dedup.Size, "Maximum number of handled messages remembered to detect redeliveries")
+	diaryCmd.Flags().String("dedup_mode", defaults.Dedup.Mode, "What to do with duplicate and retained messages: suppress or flag")
+	diaryCmd.Flags().String("client_id", defaults.ClientID, "Stable client ID the broker keeps the session under (defaults to the username)")
+	diaryCmd.Flags().StringSlice("sites", defaults.Sites, "Sites to watch as name=namespace, or just the namespace (defaults to --namespace)")
+	diaryCmd.Flags().Duration("session_expiry", defaults.SessionExpiry, "How long the broker keeps the session, and queues events, while diary is offline")
+	diaryCmd.Flags().Bool("clean_start", defaults.CleanStart, "Discard any session the broker kept when diary starts")
 }
 
 var (
@@ -78,62 +95,41 @@ func notifyReloading() error {
 	return handleNotifyError(state, err, "reloading")
 }
 
-var unhealthyDuration = time.Minute * 5
-var sendHealthCheckDuration = time.Minute * 2
-var checkHealthDuration = time.Second * 15
-
-type ClientState int
-
-const (
-	Healthy = iota
-	Unhealthy
-)
-
-var clientStateNames = map[ClientState]string{
-	Healthy:   "healthy",
-	Unhealthy: "unhealthy",
-}
-
-func (clientState ClientState) String() string {
-	return clientStateNames[clientState]
-}
-
-type ClientHealth struct {
-	LastSeen       time.Time
-	State          ClientState
-	UnhealthyAfter time.Time
-}
+// queueDrainIdle is how long without a message before the queue the
+// broker kept for diary's session counts as drained
+const queueDrainIdle = time.Second * 2
 
-func NewClientHealth() ClientHealth {
-	now := time.Now()
-	return ClientHealth{
-		now,
-		Healthy,
-		now.Add(unhealthyDuration),
+// drainOnConnect counts the messages queued for diary's session. The
+// broker starts sending them as soon as it accepts the connection, before
+// the subscriptions are made, so counting starts on the CONNACK.
+func drainOnConnect(ctx context.Context, queueDrain *diary.QueueDrain, drained func(count int, duration time.Duration)) func(*paho.Connack) {
+	return func(connectionAck *paho.Connack) {
+		if !connectionAck.SessionPresent {
+			return
+		}
+		queueDrain.Start()
+		go func() {
+			drained(queueDrain.Wait(ctx, queueDrainIdle))
+		}()
 	}
 }
 
-func (clientHealth ClientHealth) Transitioned() (ClientHealth, bool) {
-	now := time.Now()
-	switch clientHealth.State {
-	case Healthy:
-		if clientHealth.UnhealthyAfter.Before(now) {
-			clientHealth.State = Unhealthy
-			return clientHealth, true
-		}
-	case Unhealthy:
-		if clientHealth.UnhealthyAfter.After(now) {
-			clientHealth.State = Healthy
-			return clientHealth, true
+// diarySubscriptions are made at QoS 1 so the broker queues the doors'
+// events in diary's session while it's offline. Retain handling 1 stops
+// the broker replaying retained messages for subscriptions the session
+// already has.
+func diarySubscriptions(sites []diary.Site) []paho.SubscribeOptions {
+	subscriptions := make([]paho.SubscribeOptions, 0)
+	for _, site := range sites {
+		for _, level := range mqtt.DoorLevels {
+			subscriptions = append(subscriptions, paho.SubscribeOptions{
+				Topic:          site.Namespace.LevelWildcard(level),
+				QoS:            1,
+				RetainHandling: 1,
+			})
 		}
 	}
-	return clientHealth, false
-}
-
-func (clientHealth ClientHealth) BumpLastSeen() ClientHealth {
-	clientHealth.LastSeen = time.Now()
-	clientHealth.UnhealthyAfter = clientHealth.LastSeen.Add(unhealthyDuration)
-	return clientHealth
+	return subscriptions
 }
 
 func runDiaryCmd(cmd *cobra.Command, _ []string) {
@@ -145,146 +141,224 @@ func runDiaryCmd(cmd *cobra.Command, _ []string) {
 	reloadCtx, cancel := signal.NotifyContext(ctx, syscall.SIGHUP)
 	defer cancel()
 
-	if result, found := os.LookupEnv("MQTT_URI"); found {
-		mqttUri = result
-	}
+	cfg := loadConfig(cmd)
 
-	if result, found := os.LookupEnv("MQTT_USER"); found {
-		username = result
+	clientID := cfg.Diary.ClientID
+	if clientID == "" {
+		clientID = cfg.MQTT.Username
 	}
 
-	if result, found := os.LookupEnv("MQTT_PASSWORD"); found {
-		password = result
+	dedupMode := cfg.Diary.Dedup.Mode
+	if dedupMode != config.DedupModeSuppress && dedupMode != config.DedupModeFlag {
+		log.Error().
+			Str("event", "DedupMode").
+			Str("dedup_mode", dedupMode).
+			Msg(fmt.Sprintf("Unknown dedup mode %s, expected %s or %s", dedupMode, config.DedupModeSuppress, config.DedupModeFlag))
+		syscall.Exit(2)
+		return
 	}
 
-	serverUrl, err := url.Parse(mqttUri)
+	sites, err := diary.ParseSites(cfg.Diary.Sites, mqtt.Namespace(cfg.MQTT.Namespace))
 	if err != nil {
 		log.Error().
 			Str("error", err.Error()).
-			Str("event", "URLParse").
-			Msg(fmt.Sprintf("Url parse Error: %v\n", err))
+			Str("event", "Sites").
+			Msg(fmt.Sprintf("Invalid sites: %v", err))
 		syscall.Exit(2)
 		return
 	}
 
-	lastSeen := make(map[string]ClientHealth, 0)
+	diary.UnhealthyDuration = cfg.Diary.UnhealthyAfter
 
-	router := paho.NewStandardRouter()
-	router.RegisterHandler(mqtt.RootLevel+"/#", func(publish *paho.Publish) {
+	if err := initDiaryLogging(cfg.Diary.Log); err != nil {
+		log.Error().
+			Str("error", err.Error()).
+			Str("event", "LogSinks").
+			Msg(fmt.Sprintf("Failed to set up log sinks: %v", err))
+		syscall.Exit(2)
+		return
+	}
+
+	store := diary.NewStore(50)
+	deduplicator := diary.NewDeduplicator(cfg.Diary.Dedup.Window, cfg.Diary.Dedup.Size, dedupMode == config.DedupModeSuppress)
+	queueDrain := &diary.QueueDrain{}
 
-		topicChunks := strings.Split(publish.Topic, "/")
+	if httpAddr := cfg.Diary.HTTPAddr; httpAddr != "" {
+		server := diary.NewServer(httpAddr, store)
+		go func() {
+			log.Info().
+				Str("event", "HTTPServer").
+				Str("addr", httpAddr).
+				Msg("Starting status API")
+			if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Error().
+					Str("error", err.Error()).
+					Str("event", "HTTPServer").
+					Str("addr", httpAddr).
+					Msg(fmt.Sprintf("Status API stopped: %v", err))
+			}
+		}()
+		go func() {
+			<-ctx.Done()
+			shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), time.Second*5)
+			defer cancelShutdown()
+			server.Shutdown(shutdownCtx)
+		}()
+	}
 
-		if len(topicChunks) < 3 {
+	handlePublish := func(site diary.Site, publish *paho.Publish) {
+		queueDrain.Received()
+
+		topic, err := mqtt.ParseTopic(site.Namespace, publish.Topic)
+		if err == nil && topic.ClientID == "" {
+			err = errors.New("Received no client ID")
+		}
+
+		if err != nil {
 			log.Error().
+				Str("error", err.Error()).
 				Str("event", "TopicParser").
 				Uint16("packet_id", publish.PacketID).
 				Bool("duplicate", publish.Duplicate()).
 				Bool("retain", publish.Retain).
 				Str("qos", string(publish.QoS)).
+				Str("site", site.Name).
 				Str("topic", publish.Topic).
 				Str("content_type", publish.Properties.ContentType).
 				Str("payload", string(publish.Payload)).
-				Msg("Unable to parse topic! Received less than 3 chunks")
+				Msg(fmt.Sprintf("Unable to parse topic! %v", err))
 			return
 		}
 
 		var logLevel *zerolog.Event
-		switch topicChunks[1] {
-		case mqtt.LogFatalLevel:
+		switch topic.Level {
+		case mqtt.LogFatalLevel, mqtt.ForcedOpenLevel, mqtt.PinLockoutLevel:
 			logLevel = log.Error()
-		case mqtt.LogWarnLevel, mqtt.DeniedAccessLevel:
+		case mqtt.LogWarnLevel, mqtt.DeniedAccessLevel, mqtt.HeldOpenLevel, mqtt.PinFailedLevel:
 			logLevel = log.Warn()
 		default:
 			logLevel = log.Info()
 		}
 
-		clientID := topicChunks[len(topicChunks)-1]
-		// Any message received from a client should bump
-		// its last seem value
-		if client, found := lastSeen[clientID]; found {
-			lastSeen[clientID] = client.BumpLastSeen()
+		delivery := deduplicator.Classify(
+			topic.ClientID,
+			publish.Topic,
+			publish.Payload,
+			publish.Duplicate(),
+			publish.Retain,
+		)
+		if delivery == diary.Fresh {
+			// Any message received from a client should bump
+			// its last seem value
+			store.Seen(site.Name, topic.ClientID)
 		} else {
-			lastSeen[clientID] = NewClientHealth()
+			// Replays after a reconnect must not raise the same
+			// alerts a second time
+			logLevel = log.Debug()
+			if !deduplicator.Keep(delivery) {
+				log.Debug().
+					Str("event", "PublishSuppressed").
+					Uint16("packet_id", publish.PacketID).
+					Bool("duplicate", publish.Duplicate()).
+					Bool("retain", publish.Retain).
+					Str("delivery", delivery.String()).
+					Str("site", site.Name).
+					Str("clientID", topic.ClientID).
+					Str("topic", publish.Topic).
+					Str("payload", string(publish.Payload)).
+					Msg(fmt.Sprintf("Suppressed %s publish", delivery))
+				return
+			}
 		}
 
+		store.Record(diary.Event{
+			Time:      time.Now(),
+			Site:      site.Name,
+			ClientID:  topic.ClientID,
+			Level:     topic.Level,
+			Topic:     publish.Topic,
+			Payload:   string(publish.Payload),
+			QoS:       publish.QoS,
+			Retain:    publish.Retain,
+			Duplicate: publish.Duplicate(),
+			Delivery:  delivery,
+		})
+
 		logLevel.
 			Str("event", "PublishHandler").
 			Uint16("packet_id", publish.PacketID).
 			Bool("duplicate", publish.Duplicate()).
 			Bool("retain", publish.Retain).
+			Str("delivery", delivery.String()).
 			Str("qos", string(publish.QoS)).
-			Str("clientID", clientID).
+			Str("site", site.Name).
+			Str("clientID", topic.ClientID).
 			Str("topic", publish.Topic).
 			Str("content_type", publish.Properties.ContentType).
 			Str("payload", string(publish.Payload)).
 			Msg("Publish payload was handled")
-	})
-
-	clientConfig := autopaho.ClientConfig{
-		ServerUrls:                    []*url.URL{serverUrl},
-		ConnectUsername:               username,
-		ConnectPassword:               []byte(password),
-		KeepAlive:                     20,
-		CleanStartOnInitialConnection: true,
-		SessionExpiryInterval:         60,
-		OnConnectionUp: func(connectionManager *autopaho.ConnectionManager, connectionAck *paho.Connack) {
+
+		if topic.Level == mqtt.ForcedOpenLevel && delivery == diary.Fresh {
+			log.Error().
+				Str("event", "ForcedEntry").
+				Str("site", site.Name).
+				Str("clientID", topic.ClientID).
+				Str("payload", string(publish.Payload)).
+				Msg(fmt.Sprintf("Door %s was forced open", topic.ClientID))
+		}
+		if topic.Level == mqtt.PinLockoutLevel && delivery == diary.Fresh {
+			card, _, _ := strings.Cut(string(publish.Payload), "|")
+			log.Error().
+				Str("event", "PinLockout").
+				Str("site", site.Name).
+				Str("clientID", topic.ClientID).
+				Str("card", card).
+				Str("payload", string(publish.Payload)).
+				Msg(fmt.Sprintf("Door %s locked out card %s after too many bad PINs", topic.ClientID, card))
+		}
+	}
+
+	router := paho.NewStandardRouter()
+	for _, site := range sites {
+		router.RegisterHandler(site.Namespace.Wildcard(), func(publish *paho.Publish) {
+			handlePublish(site, publish)
+		})
+	}
+
+	clientConfig, err := connection.Options{
+		URIs:          cfg.MQTT.URIs,
+		Username:      cfg.MQTT.Username,
+		Password:      cfg.MQTT.Password,
+		ClientID:      clientID,
+		Transport:     loadTransport(cfg),
+		CleanStart:    cfg.Diary.CleanStart,
+		SessionExpiry: cfg.Diary.SessionExpiry,
+		Subscriptions: diarySubscriptions(sites),
+		OnConnect: drainOnConnect(ctx, queueDrain, func(count int, duration time.Duration) {
 			log.Info().
-				Str("event", "OnConnectionUp").
-				Str("response", connectionAck.Properties.ResponseInfo).
-				Msg("Connected to MQTT broker")
-
-			if _, err := connectionManager.Subscribe(ctx, &paho.Subscribe{
-				Subscriptions: []paho.SubscribeOptions{
-					{Topic: mqtt.LogInfoTopic + "/#", QoS: 1},
-					{Topic: mqtt.LogWarnTopic + "/#", QoS: 1},
-					{Topic: mqtt.LogFatalTopic + "/#", QoS: 1},
-					{Topic: mqtt.LockTopic + "/#", QoS: 1},
-					{Topic: mqtt.UnlockTopic + "/#", QoS: 1},
-					{Topic: mqtt.DeniedAccessTopic + "/#", QoS: 1},
-					{Topic: mqtt.CheckInTopic + "/#", QoS: 1},
-				},
-			}); err != nil {
-				log.Error().
-					Str("error", err.Error()).
-					Str("event", "MQTTSubscribe").
-					Msg(fmt.Sprintf("MQTT failed to subscribe: %v", err))
-			}
+				Str("event", "QueueDrained").
+				Int("count", count).
+				Str("duration", duration.String()).
+				Msg(fmt.Sprintf("Drained %d queued messages after reconnecting", count))
+		}),
+		OnConnectionUp: func(connectionManager *autopaho.ConnectionManager, connectionAck *paho.Connack, broker *url.URL) {
+			store.SetBroker(broker.Redacted())
+			store.SetConnected(true, nil)
 		},
-		OnConnectError: func(err error) {
-			log.Error().
-				Str("error", err.Error()).
-				Str("event", "OnConnectError").
-				Msg(fmt.Sprintf("MQTT Connection error: %v", err))
+		OnConnectionDown: func(err error) {
+			store.SetConnected(false, err)
 		},
-		ClientConfig: paho.ClientConfig{
-			ClientID: username,
-			OnPublishReceived: []func(paho.PublishReceived) (bool, error){
-				func(publish paho.PublishReceived) (bool, error) {
-					router.Route(publish.Packet.Packet())
-					return true, nil
-				},
-			},
-			OnClientError: func(err error) {
-				log.Error().
-					Str("error", err.Error()).
-					Str("event", "OnClientError").
-					Msg(fmt.Sprintf("MQTT Client error: %v", err))
-			},
-			OnServerDisconnect: func(disconnect *paho.Disconnect) {
-				if disconnect.Properties != nil {
-					log.Warn().
-						Str("error", err.Error()).
-						Str("reason", disconnect.Properties.ReasonString).
-						Str("event", "OnServerDisconnect").
-						Msg(fmt.Sprintf("MQTT client disconnect: %v", err))
-				} else {
-					log.Warn().
-						Str("error", err.Error()).
-						Str("event", "OnServerDisconnect").
-						Msg(fmt.Sprintf("MQTT client disconnect: %v", err))
-				}
-			},
+		OnPublishReceived: func(publish *paho.Publish) {
+			router.Route(publish.Packet())
 		},
+	}.ClientConfig(ctx)
+	if err != nil {
+		log.Error().
+			Str("error", err.Error()).
+			Str("event", "URLParse").
+			Msg(fmt.Sprintf("Url parse Error: %v\n", err))
+		syscall.Exit(2)
+		return
 	}
 
 	serverConnection, err := autopaho.NewConnection(ctx, clientConfig)
@@ -306,36 +380,34 @@ func runDiaryCmd(cmd *cobra.Command, _ []string) {
 		}
 	}
 
-	sendHealthCheckTicker := time.NewTicker(sendHealthCheckDuration)
-	checkHealthTicker := time.NewTicker(checkHealthDuration)
+	sendHealthCheckTicker := time.NewTicker(cfg.Diary.HealthCheckInterval)
+	checkHealthTicker := time.NewTicker(cfg.Diary.CheckHealthInterval)
 	for {
 		select {
 		case <-checkHealthTicker.C:
-			for key, clientHealth := range lastSeen {
-				newClientHealth, transitioned := clientHealth.Transitioned()
-				if transitioned {
-					lastSeen[key] = newClientHealth
-					switch newClientHealth.State {
-					case Unhealthy:
-						log.Error().
-							Str("event", "Unhealthy").
-							Str("client_id", key).
-							Str("from", clientHealth.State.String()).
-							Str("to", newClientHealth.State.String()).
-							Str("last_seen", newClientHealth.LastSeen.String()).
-							Str("unhealthy_after", newClientHealth.UnhealthyAfter.String()).
-							Str("unhealthy_at", time.Now().String()).
-							Msg(fmt.Sprintf("Client %s is now unhealthy", key))
-					case Healthy:
-						log.Info().
-							Str("event", "Healthy").
-							Str("client_id", key).
-							Str("from", clientHealth.State.String()).
-							Str("to", newClientHealth.State.String()).
-							Str("last_seen", newClientHealth.LastSeen.String()).
-							Str("unhealthy_after", newClientHealth.UnhealthyAfter.String()).
-							Msg(fmt.Sprintf("Client %s is now healthy", key))
-					}
+			for _, transition := range store.CheckTransitions() {
+				switch transition.To.State {
+				case diary.Unhealthy:
+					log.Error().
+						Str("event", "Unhealthy").
+						Str("site", transition.To.Site).
+						Str("client_id", transition.ClientID).
+						Str("from", transition.From.State.String()).
+						Str("to", transition.To.State.String()).
+						Str("last_seen", transition.To.LastSeen.String()).
+						Str("unhealthy_after", transition.To.UnhealthyAfter.String()).
+						Str("unhealthy_at", time.Now().String()).
+						Msg(fmt.Sprintf("Client %s is now unhealthy", transition.ClientID))
+				case diary.Healthy:
+					log.Info().
+						Str("event", "Healthy").
+						Str("site", transition.To.Site).
+						Str("client_id", transition.ClientID).
+						Str("from", transition.From.State.String()).
+						Str("to", transition.To.State.String()).
+						Str("last_seen", transition.To.LastSeen.String()).
+						Str("unhealthy_after", transition.To.UnhealthyAfter.String()).
+						Msg(fmt.Sprintf("Client %s is now healthy", transition.ClientID))
 				}
 			}
 
@@ -344,26 +416,29 @@ func runDiaryCmd(cmd *cobra.Command, _ []string) {
 				Str("event", "HealthCheckTicker").
 				Msg("Sending health check")
 
-			if _, err = serverConnection.Publish(ctx, &paho.Publish{
-				QoS:     1,
-				Topic:   mqtt.HealthCheckTopic,
-				Payload: []byte(username),
-			}); err != nil {
-				if ctx.Err() == nil {
-					log.Error().
-						Str("error", err.Error()).
-						Str("event", "MQTTPublish").
-						Str("topic", mqtt.HealthCheckTopic).
-						Msg(fmt.Sprintf("Failed to publish: %v", err))
-				} else {
-					log.Warn().
-						Str("error", err.Error()).
-						Str("event", "MQTTPublish").
-						Str("topic", mqtt.HealthCheckTopic).
-						Msg(fmt.Sprintf("Published cancelled by context: %v", err))
+			for _, site := range sites {
+				topic := mqtt.Topic{Namespace: site.Namespace, Level: mqtt.HealthCheckLevel}.Build()
+				if _, err = serverConnection.Publish(ctx, &paho.Publish{
+					QoS:     1,
+					Topic:   topic,
+					Payload: []byte(cfg.MQTT.Username),
+				}); err != nil {
+					if ctx.Err() == nil {
+						log.Error().
+							Str("error", err.Error()).
+							Str("event", "MQTTPublish").
+							Str("site", site.Name).
+							Str("topic", topic).
+							Msg(fmt.Sprintf("Failed to publish: %v", err))
+					} else {
+						log.Warn().
+							Str("error", err.Error()).
+							Str("event", "MQTTPublish").
+							Str("site", site.Name).
+							Str("topic", topic).
+							Msg(fmt.Sprintf("Published cancelled by context: %v", err))
+					}
 				}
-
-				continue
 			}
 
 			log.Info().
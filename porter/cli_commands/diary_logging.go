@@ -0,0 +1,69 @@
+package cli_commands
+
+import (
+	"fmt"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"metamakers.org/door-controller-mqtt/config"
+	"metamakers.org/door-controller-mqtt/logging"
+)
+
+func init() {
+	defaults := config.Default().Diary.Log
+	diaryCmd.Flags().String("log_file", defaults.File, "Path of a JSON lines file to also write logs to")
+	diaryCmd.Flags().String("log_file_level", defaults.FileLevel, "Minimum level written to the log file")
+	diaryCmd.Flags().Int("log_file_max_size", defaults.FileMaxSize, "Size in megabytes the log file can grow to before it is rotated")
+	diaryCmd.Flags().Duration("log_file_max_age", defaults.FileMaxAge, "How long rotated log files are kept, 0 keeps them forever")
+	diaryCmd.Flags().Int("log_file_max_backups", defaults.FileMaxBackups, "How many rotated log files are kept, 0 keeps them all")
+	diaryCmd.Flags().String("syslog_addr", defaults.SyslogAddr, "Address of a syslog server to also send logs to (e.g. localhost:514, or /dev/log with --syslog_network unixgram)")
+	diaryCmd.Flags().String("syslog_network", defaults.SyslogNetwork, "Network used to reach the syslog server: udp, tcp, unix or unixgram")
+	diaryCmd.Flags().String("syslog_level", defaults.SyslogLevel, "Minimum level sent to the syslog server")
+}
+
+// initDiaryLogging adds the configured log sinks alongside stderr
+func initDiaryLogging(logConfig config.DiaryLogConfig) error {
+	sinks := make([]logging.Sink, 0)
+
+	if logConfig.File != "" {
+		level, err := zerolog.ParseLevel(logConfig.FileLevel)
+		if err != nil {
+			return fmt.Errorf("Invalid log file level: %w", err)
+		}
+		rotatingFile, err := logging.NewRotatingFile(
+			logConfig.File,
+			int64(logConfig.FileMaxSize)*1024*1024,
+			logConfig.FileMaxAge,
+			logConfig.FileMaxBackups,
+		)
+		if err != nil {
+			return fmt.Errorf("Failed to open log file: %w", err)
+		}
+		sinks = append(sinks, logging.Sink{Writer: rotatingFile, Level: level})
+	}
+
+	if logConfig.SyslogAddr != "" {
+		level, err := zerolog.ParseLevel(logConfig.SyslogLevel)
+		if err != nil {
+			return fmt.Errorf("Invalid syslog level: %w", err)
+		}
+		syslogWriter, err := logging.NewSyslogWriter(logConfig.SyslogNetwork, logConfig.SyslogAddr, "porter-diary")
+		if err != nil {
+			return fmt.Errorf("Failed to connect to syslog: %w", err)
+		}
+		sinks = append(sinks, logging.Sink{Writer: syslogWriter, Level: level})
+	}
+
+	logging.Init(sinks...)
+
+	log.Info().
+		Str("event", "LogSinks").
+		Str("log_file", logConfig.File).
+		Str("log_file_level", logConfig.FileLevel).
+		Str("syslog_addr", logConfig.SyslogAddr).
+		Str("syslog_network", logConfig.SyslogNetwork).
+		Str("syslog_level", logConfig.SyslogLevel).
+		Msg("Log sinks initialised")
+
+	return nil
+}
@@ -0,0 +1,118 @@
+package cli_commands
+
+import (
+	"context"
+	"net/url"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/eclipse/paho.golang/autopaho"
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/rs/zerolog"
+
+	"metamakers.org/door-controller-mqtt/config"
+	"metamakers.org/door-controller-mqtt/connection"
+	"metamakers.org/door-controller-mqtt/diary"
+	"metamakers.org/door-controller-mqtt/mqtt"
+	"metamakers.org/door-controller-mqtt/testbroker"
+)
+
+// connectDiary connects the way diary does, returning whether the broker
+// still had diary's session. The number of queued messages is sent to
+// drained once they stop arriving.
+func connectDiary(t *testing.T, ctx context.Context, uri string, published chan<- string, drained chan<- int) (*autopaho.ConnectionManager, bool) {
+	t.Helper()
+
+	defaults := config.Default().Diary
+	sites := []diary.Site{{Name: "test", Namespace: mqtt.DefaultNamespace}}
+	sessionPresent := make(chan bool, 1)
+	queueDrain := &diary.QueueDrain{}
+	logger := zerolog.Nop()
+	clientConfig, err := connection.Options{
+		URIs:          []string{uri},
+		ClientID:      "diary_test",
+		CleanStart:    defaults.CleanStart,
+		SessionExpiry: defaults.SessionExpiry,
+		Subscriptions: diarySubscriptions(sites),
+		OnConnect: drainOnConnect(ctx, queueDrain, func(count int, duration time.Duration) {
+			drained <- count
+		}),
+		OnConnectionUp: func(connectionManager *autopaho.ConnectionManager, connectionAck *paho.Connack, broker *url.URL) {
+			sessionPresent <- connectionAck.SessionPresent
+		},
+		OnPublishReceived: func(publish *paho.Publish) {
+			queueDrain.Received()
+			published <- publish.Topic + " " + string(publish.Payload)
+		},
+		Logger: &logger,
+	}.ClientConfig(ctx)
+	if err != nil {
+		t.Fatalf("Failed to build client config: %v", err)
+	}
+
+	connectionManager, err := autopaho.NewConnection(ctx, clientConfig)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	select {
+	case present := <-sessionPresent:
+		return connectionManager, present
+	case <-time.After(5 * time.Second):
+		t.Fatal("Diary didn't connect")
+		return nil, false
+	}
+}
+
+func TestDiaryReceivesEventsPublishedWhileOffline(t *testing.T) {
+	broker := testbroker.Start(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	published := make(chan string, 10)
+	drained := make(chan int, 1)
+
+	connectionManager, _ := connectDiary(t, ctx, broker.URI, published, drained)
+	if err := connectionManager.Disconnect(ctx); err != nil {
+		t.Fatalf("Failed to disconnect: %v", err)
+	}
+
+	unlock := mqtt.Topic{Namespace: mqtt.DefaultNamespace, Level: mqtt.UnlockLevel, ClientID: "door_one"}.Build()
+	payloads := []string{"0001234567|2026-10-19 10:00:00", "0001234567|2026-10-19 10:00:05", "0007654321|2026-10-19 10:01:00"}
+	for _, payload := range payloads {
+		broker.Publish(t, unlock, payload, false, 1)
+	}
+
+	connectionManager, sessionPresent := connectDiary(t, ctx, broker.URI, published, drained)
+	defer connectionManager.Disconnect(ctx)
+	if !sessionPresent {
+		t.Error("Broker didn't keep diary's session")
+	}
+
+	// The broker doesn't keep the queue in order
+	want := make([]string, 0, len(payloads))
+	got := make([]string, 0, len(payloads))
+	for _, payload := range payloads {
+		want = append(want, unlock+" "+payload)
+		select {
+		case message := <-published:
+			got = append(got, message)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Only %d of the %d events published while diary was offline were delivered", len(got), len(payloads))
+		}
+	}
+	slices.Sort(got)
+	if !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// Every queued message is counted, including the ones the broker sent
+	// before the subscriptions were made again
+	select {
+	case count := <-drained:
+		if count != len(payloads) {
+			t.Errorf("drained: got %d, want %d", count, len(payloads))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("The queue never finished draining")
+	}
+}
@@ -1,13 +1,21 @@
 package cli_commands
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
+	"metamakers.org/door-controller-mqtt/config"
 	"metamakers.org/door-controller-mqtt/models"
+	"metamakers.org/door-controller-mqtt/mqtt"
 )
 
 var mimicCmd = &cobra.Command{
@@ -19,23 +27,42 @@ var mimicCmd = &cobra.Command{
 
 func init() {
 	rootCmd.AddCommand(mimicCmd)
+
+	defaults := config.Default().Mimic
+	mimicCmd.Flags().Bool("fail_health_check", defaults.FailHealthCheck, "Start with health checks set to fail")
+	mimicCmd.Flags().Bool("fail_access_list", defaults.FailAccessList, "Start with access list rebuilds set to fail")
+	mimicCmd.Flags().String("door_message", defaults.DoorMessage, "Door message selected at start: card_list, unlock or denied_access")
+	mimicCmd.Flags().String("card_encoding", defaults.CardEncoding, "How cards are written: decimal10, wiegand26 or hexuid")
+	mimicCmd.Flags().Bool("headless", defaults.Headless, "Run without a terminal, writing a JSON lines transcript")
+	mimicCmd.Flags().StringSlice("swipe", defaults.Swipes, "Card swiped when headless, as <card>[#<pin>][:<door_message>]")
+	mimicCmd.Flags().Duration("swipe_interval", defaults.SwipeInterval, "Time between headless swipes")
+	mimicCmd.Flags().Bool("swipe_repeat", defaults.SwipeRepeat, "Start over once every card has been swiped")
+	mimicCmd.Flags().String("transcript", defaults.Transcript, "File the headless transcript is written to (defaults to stdout)")
+	mimicCmd.Flags().Duration("duration", defaults.Duration, "Stop headless mimic after this long (0 runs until stopped)")
+	mimicCmd.Flags().Duration("unlock_duration", defaults.UnlockDuration, "How long the door stays unlocked after a granted swipe")
+	mimicCmd.Flags().Duration("held_open_after", defaults.HeldOpenAfter, "How long the door can be open before it's held open")
+	mimicCmd.Flags().Int("pin_attempts", defaults.PinAttempts, "Bad PINs in a row before a card is locked out")
+	mimicCmd.Flags().Duration("pin_lockout", defaults.PinLockout, "How long a card stays locked out")
+	mimicCmd.Flags().String("favourites_file", defaults.FavouritesFile, "File the swipe history's favourites are kept in (defaults to $XDG_DATA_HOME/porter/mimic_favourites.json)")
+	mimicCmd.Flags().StringSlice("fault", defaults.Faults.Enabled, "Fault switched on at start, can be repeated")
+	mimicCmd.Flags().Duration("fault_latency", defaults.Faults.Latency, "How long responses are delayed by delay_responses")
+	mimicCmd.Flags().Duration("fault_clock_skew", defaults.Faults.ClockSkew, "How far clock_skew moves payload timestamps")
+	mimicCmd.Flags().Duration("fault_disconnect_interval", defaults.Faults.DisconnectInterval, "Time between sudden_disconnect drops")
+	mimicCmd.Flags().Duration("fault_storm_delay", defaults.Faults.StormDelay, "How long each connection lasts during reconnect_storm")
+	mimicCmd.Flags().Duration("fault_held_open_interval", defaults.Faults.HeldOpenInterval, "Time between door_held_open alarms")
 }
 
 func runMimic(cmd *cobra.Command, args []string) {
-	if result, found := os.LookupEnv("MQTT_URI"); found {
-		mqttUri = result
-	}
+	cfg := loadConfig(cmd)
+	validateMimic(cfg)
 
-	if result, found := os.LookupEnv("MQTT_USER"); found {
-		username = result
-	}
-
-	if result, found := os.LookupEnv("MQTT_PASSWORD"); found {
-		password = result
+	if cfg.Mimic.Headless {
+		runHeadlessMimic(cmd.Context(), cfg)
+		return
 	}
 
 	if _, err := tea.NewProgram(
-		models.InitMinicModel(cmd.Context(), mqttUri, username, password),
+		models.InitMinicModel(cmd.Context(), cfg.MQTT.URIs, loadNamespace(cfg), cfg.MQTT.Username, cfg.MQTT.Password, loadTransport(cfg), cfg.Mimic),
 	).Run(); err != nil {
 		log.Error().
 			Str("error", err.Error()).
@@ -43,3 +70,141 @@ func runMimic(cmd *cobra.Command, args []string) {
 			Msg(fmt.Sprintf("Error running TUI: %v", err))
 	}
 }
+
+func validateMimic(cfg config.Config) {
+	if err := models.ValidateDoorMessage(cfg.Mimic.DoorMessage); err != nil {
+		log.Error().
+			Str("error", err.Error()).
+			Str("event", "ConfigLoad").
+			Msg(err.Error())
+		syscall.Exit(2)
+	}
+
+	loadCardEncoding(cfg.Mimic.CardEncoding)
+
+	if cfg.Mimic.PinAttempts < 1 {
+		log.Error().
+			Str("event", "ConfigLoad").
+			Int("pin_attempts", cfg.Mimic.PinAttempts).
+			Msg("PIN attempts must be at least 1")
+		syscall.Exit(2)
+	}
+
+	for _, fault := range cfg.Mimic.Faults.Enabled {
+		if err := models.ValidateFault(fault); err != nil {
+			log.Error().
+				Str("error", err.Error()).
+				Str("event", "ConfigLoad").
+				Msg(err.Error())
+			syscall.Exit(2)
+		}
+	}
+
+	// The mimic publishes under its username so it has to fit in a
+	// single topic level
+	if err := mqtt.ValidateClientID(cfg.MQTT.Username); err != nil {
+		log.Error().
+			Str("error", err.Error()).
+			Str("event", "ClientID").
+			Msg(fmt.Sprintf("Username can't be used as a client ID: %v", err))
+		syscall.Exit(2)
+	}
+}
+
+func runHeadlessMimic(ctx context.Context, cfg config.Config) {
+	swipes := make([]models.Swipe, 0, len(cfg.Mimic.Swipes))
+	for _, raw := range cfg.Mimic.Swipes {
+		swipe, err := models.ParseSwipe(raw, cfg.Mimic.DoorMessage, loadCardEncoding(cfg.Mimic.CardEncoding))
+		if err != nil {
+			log.Error().
+				Str("error", err.Error()).
+				Str("event", "ConfigLoad").
+				Msg(fmt.Sprintf("Invalid swipe: %v", err))
+			syscall.Exit(2)
+		}
+		swipes = append(swipes, swipe)
+	}
+
+	transcript := os.Stdout
+	if cfg.Mimic.Transcript != "" {
+		file, err := os.Create(cfg.Mimic.Transcript)
+		if err != nil {
+			log.Error().
+				Str("error", err.Error()).
+				Str("event", "Transcript").
+				Str("path", cfg.Mimic.Transcript).
+				Msg(fmt.Sprintf("Failed to create transcript: %v", err))
+			syscall.Exit(2)
+		}
+		defer file.Close()
+		transcript = file
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if cfg.Mimic.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.Mimic.Duration)
+		defer cancel()
+	}
+
+	// Swipes can't be published until the first connection is up
+	connected := make(chan bool)
+	var connectedOnce sync.Once
+	transcriptWriter := models.NewTranscriptWriter(transcript)
+	record := func(entry models.TranscriptEntry) {
+		if err := transcriptWriter.Record(entry); err != nil {
+			log.Error().
+				Str("error", err.Error()).
+				Str("event", "Transcript").
+				Msg(fmt.Sprintf("Failed to write transcript: %v", err))
+		}
+		if entry.Event == models.TranscriptStatus && entry.Connected != nil && *entry.Connected {
+			connectedOnce.Do(func() { close(connected) })
+		}
+	}
+
+	program := tea.NewProgram(
+		models.InitMinicModel(ctx, cfg.MQTT.URIs, loadNamespace(cfg), cfg.MQTT.Username, cfg.MQTT.Password, loadTransport(cfg), cfg.Mimic),
+		tea.WithContext(ctx),
+		tea.WithInput(nil),
+		tea.WithoutRenderer(),
+		tea.WithoutSignalHandler(),
+		tea.WithFilter(models.TranscriptFilter(record)),
+	)
+
+	go func() {
+		select {
+		case <-connected:
+		case <-ctx.Done():
+			return
+		}
+
+		for {
+			for _, swipe := range swipes {
+				for _, msg := range swipe.Messages() {
+					program.Send(msg)
+				}
+
+				timer := time.NewTimer(cfg.Mimic.SwipeInterval)
+				select {
+				case <-timer.C:
+				case <-ctx.Done():
+					timer.Stop()
+					return
+				}
+			}
+			if !cfg.Mimic.SwipeRepeat || len(swipes) == 0 {
+				return
+			}
+		}
+	}()
+
+	if _, err := program.Run(); err != nil && !errors.Is(err, tea.ErrProgramKilled) {
+		log.Error().
+			Str("error", err.Error()).
+			Str("event", "Headless").
+			Msg(fmt.Sprintf("Error running headless mimic: %v", err))
+		syscall.Exit(1)
+	}
+}
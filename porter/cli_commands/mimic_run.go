@@ -0,0 +1,145 @@
+package cli_commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	"metamakers.org/door-controller-mqtt/config"
+	"metamakers.org/door-controller-mqtt/models"
+	"metamakers.org/door-controller-mqtt/scenario"
+)
+
+var mimicRunCmd = &cobra.Command{
+	Use:   "run <scenario.yaml>",
+	Short: "Runs a scenario against a headless mimic",
+	Long: `Runs a scenario against a headless mimic and exits with 1 when a step fails.
+A scenario is a list of steps run in order, like waiting for a health check,
+failing the next one, swiping a card and expecting diary to have logged it.
+The mimic starts with the options in the mimic section of the config.`,
+	Args: cobra.ExactArgs(1),
+	Run:  runMimicScenario,
+}
+
+func init() {
+	mimicCmd.AddCommand(mimicRunCmd)
+
+	defaults := config.Default().Scenario
+	mimicRunCmd.Flags().String("diary_url", defaults.DiaryURL, "Diary's HTTP API, used by expect_log_from")
+	mimicRunCmd.Flags().Duration("timeout", defaults.Timeout, "How long a step waits when it doesn't set its own timeout")
+	mimicRunCmd.Flags().String("transcript", defaults.Transcript, "File a JSON lines transcript of the run is written to")
+}
+
+func runMimicScenario(cmd *cobra.Command, args []string) {
+	cfg := loadConfig(cmd)
+	validateMimic(cfg)
+	namespace := loadNamespace(cfg)
+
+	file, err := os.Open(args[0])
+	if err != nil {
+		log.Error().
+			Str("error", err.Error()).
+			Str("event", "ScenarioLoad").
+			Str("path", args[0]).
+			Msg(fmt.Sprintf("Failed to open scenario: %v", err))
+		syscall.Exit(2)
+	}
+	loaded, err := scenario.Parse(file, loadCardEncoding(cfg.Mimic.CardEncoding))
+	file.Close()
+	if err != nil {
+		log.Error().
+			Str("error", err.Error()).
+			Str("event", "ScenarioLoad").
+			Str("path", args[0]).
+			Msg(fmt.Sprintf("Invalid scenario: %v", err))
+		syscall.Exit(2)
+	}
+
+	record := func(entry models.TranscriptEntry) {}
+	if cfg.Scenario.Transcript != "" {
+		transcript, err := os.Create(cfg.Scenario.Transcript)
+		if err != nil {
+			log.Error().
+				Str("error", err.Error()).
+				Str("event", "Transcript").
+				Str("path", cfg.Scenario.Transcript).
+				Msg(fmt.Sprintf("Failed to create transcript: %v", err))
+			syscall.Exit(2)
+		}
+		defer transcript.Close()
+
+		transcriptWriter := models.NewTranscriptWriter(transcript)
+		record = func(entry models.TranscriptEntry) {
+			transcriptWriter.Record(entry)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var program *tea.Program
+	runner := scenario.NewRunner(namespace, cfg.MQTT.Username, cfg.Mimic, cfg.Scenario, func(msg tea.Msg) {
+		program.Send(msg)
+	})
+	transcriptFilter := models.TranscriptFilter(record)
+	program = tea.NewProgram(
+		models.InitMinicModel(ctx, cfg.MQTT.URIs, namespace, cfg.MQTT.Username, cfg.MQTT.Password, loadTransport(cfg), cfg.Mimic),
+		tea.WithContext(ctx),
+		tea.WithInput(nil),
+		tea.WithoutRenderer(),
+		tea.WithoutSignalHandler(),
+		tea.WithFilter(func(model tea.Model, msg tea.Msg) tea.Msg {
+			runner.Observe(msg)
+			return transcriptFilter(model, msg)
+		}),
+	)
+
+	name := loaded.Name
+	if name == "" {
+		name = args[0]
+	}
+
+	result := make(chan error, 1)
+	go func() {
+		result <- runner.Run(ctx, loaded, func(index int, step scenario.Step) {
+			log.Info().
+				Str("event", "ScenarioStep").
+				Int("step", index+1).
+				Msg(step.String())
+		})
+		// Cancelling the program's context can leave bubbletea stuck
+		// sending the last command, quitting goes through its event loop
+		program.Quit()
+	}()
+
+	if _, err := program.Run(); err != nil && !errors.Is(err, tea.ErrProgramKilled) {
+		log.Error().
+			Str("error", err.Error()).
+			Str("event", "Headless").
+			Msg(fmt.Sprintf("Error running headless mimic: %v", err))
+		syscall.Exit(1)
+	}
+
+	if err := <-result; err != nil {
+		log.Error().
+			Str("error", err.Error()).
+			Str("event", "ScenarioFailed").
+			Str("scenario", name).
+			Msg(fmt.Sprintf("Scenario %s failed: %v", name, err))
+		syscall.Exit(1)
+	}
+	log.Info().
+		Str("event", "ScenarioPassed").
+		Str("scenario", name).
+		Int("steps", len(loaded.Steps)).
+		Msg(fmt.Sprintf("Scenario %s passed %d steps", name, len(loaded.Steps)))
+}
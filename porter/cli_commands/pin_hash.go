@@ -0,0 +1,80 @@
+package cli_commands
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+
+	"metamakers.org/door-controller-mqtt/cards"
+)
+
+var pinHashCmd = &cobra.Command{
+	Use:   "pin_hash",
+	Short: "Hashes a card's PIN for the access control database",
+	Long: `Hashes a card's PIN into the verifier stored in the pin_hash column of
+accesscontrol. The PIN is read from stdin so it isn't left in the shell's
+history, and is asked for twice when stdin is a terminal, e.g.
+
+  echo 1234 | porter pin_hash`,
+	Args: cobra.NoArgs,
+	Run:  runPinHash,
+}
+
+func init() {
+	rootCmd.AddCommand(pinHashCmd)
+}
+
+func runPinHash(cmd *cobra.Command, args []string) {
+	pin, err := readPIN()
+	if err != nil {
+		log.Error().
+			Str("error", err.Error()).
+			Str("event", "PinHash").
+			Msg(fmt.Sprintf("Failed to read PIN: %v", err))
+		syscall.Exit(2)
+	}
+
+	verifier, err := cards.HashPIN(pin)
+	if err != nil {
+		log.Error().
+			Str("error", err.Error()).
+			Str("event", "PinHash").
+			Msg(err.Error())
+		syscall.Exit(2)
+	}
+	fmt.Println(verifier)
+}
+
+func readPIN() (string, error) {
+	stdin := int(os.Stdin.Fd())
+	if !term.IsTerminal(stdin) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return "", err
+		}
+		return strings.TrimSpace(line), nil
+	}
+
+	fmt.Fprint(os.Stderr, "PIN: ")
+	pin, err := term.ReadPassword(stdin)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprint(os.Stderr, "PIN again: ")
+	again, err := term.ReadPassword(stdin)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	if string(pin) != string(again) {
+		return "", fmt.Errorf("PINs don't match")
+	}
+	return string(pin), nil
+}
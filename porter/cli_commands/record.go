@@ -0,0 +1,137 @@
+package cli_commands
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/eclipse/paho.golang/autopaho"
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	"metamakers.org/door-controller-mqtt/config"
+	"metamakers.org/door-controller-mqtt/connection"
+	"metamakers.org/door-controller-mqtt/recording"
+)
+
+var recordCmd = &cobra.Command{
+	Use:   "record <file>",
+	Short: "Records every message published under the namespace",
+	Long: `Records every message published under the namespace to a file, one JSON line
+per message with its topic, payload, QoS, retain flag, properties and the time it
+was received. Use - to write to stdout. The recording can be republished with
+porter replay.`,
+	Args: cobra.ExactArgs(1),
+	Run:  runRecord,
+}
+
+func init() {
+	rootCmd.AddCommand(recordCmd)
+
+	defaults := config.Default().Record
+	recordCmd.Flags().String("client_id", defaults.ClientID, "Client ID used to connect to the MQTT broker (defaults to <username>_record_<pid>)")
+	recordCmd.Flags().Duration("duration", defaults.Duration, "Stop recording after this long (0 records until stopped)")
+}
+
+func runRecord(cmd *cobra.Command, args []string) {
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	cfg := loadConfig(cmd)
+	namespace := loadNamespace(cfg)
+
+	clientID := cfg.Record.ClientID
+	if clientID == "" {
+		clientID = fmt.Sprintf("%s_record_%d", cfg.MQTT.Username, os.Getpid())
+	}
+
+	var output io.Writer = os.Stdout
+	if path := args[0]; path != "-" {
+		file, err := os.Create(path)
+		if err != nil {
+			log.Error().
+				Str("error", err.Error()).
+				Str("event", "Recording").
+				Str("path", path).
+				Msg(fmt.Sprintf("Failed to create recording: %v", err))
+			syscall.Exit(2)
+		}
+		defer file.Close()
+		output = file
+	}
+	writer := recording.NewWriter(output)
+
+	if cfg.Record.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.Record.Duration)
+		defer cancel()
+	}
+
+	router := paho.NewStandardRouter()
+	router.RegisterHandler(namespace.Wildcard(), func(publish *paho.Publish) {
+		if err := writer.Write(recording.FromPublish(publish, time.Now())); err != nil {
+			log.Error().
+				Str("error", err.Error()).
+				Str("event", "Recording").
+				Str("topic", publish.Topic).
+				Msg(fmt.Sprintf("Failed to record message: %v", err))
+		}
+	})
+
+	clientConfig, err := connection.Options{
+		URIs:          cfg.MQTT.URIs,
+		Username:      cfg.MQTT.Username,
+		Password:      cfg.MQTT.Password,
+		ClientID:      clientID,
+		Transport:     loadTransport(cfg),
+		CleanStart:    true,
+		SessionExpiry: 0,
+		Subscriptions: []paho.SubscribeOptions{
+			// Without retain as published the broker clears the retain
+			// flag of live messages, and replaying them wouldn't retain
+			// them again
+			{Topic: namespace.Wildcard(), QoS: 2, RetainAsPublished: true},
+		},
+		OnConnectionUp: func(connectionManager *autopaho.ConnectionManager, connectionAck *paho.Connack, broker *url.URL) {
+			log.Info().
+				Str("event", "Recording").
+				Str("broker", broker.Redacted()).
+				Str("topic", namespace.Wildcard()).
+				Msg(fmt.Sprintf("Recording %s", namespace.Wildcard()))
+		},
+		OnPublishReceived: func(publish *paho.Publish) {
+			router.Route(publish.Packet())
+		},
+	}.ClientConfig(ctx)
+	if err != nil {
+		log.Error().
+			Str("error", err.Error()).
+			Str("event", "URLParse").
+			Msg(fmt.Sprintf("Url parse Error: %v\n", err))
+		syscall.Exit(2)
+		return
+	}
+
+	serverConnection, err := autopaho.NewConnection(ctx, clientConfig)
+	if err != nil {
+		log.Error().
+			Str("error", err.Error()).
+			Str("event", "NewConnection").
+			Msg(fmt.Sprintf("New connection start interrupted: %v", err))
+		syscall.Exit(3)
+		return
+	}
+
+	<-ctx.Done()
+	serverConnection.Disconnect(context.Background())
+	log.Info().
+		Str("event", "RecordingStopped").
+		Int("count", writer.Count()).
+		Msg(fmt.Sprintf("Recorded %d messages", writer.Count()))
+}
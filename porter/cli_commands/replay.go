@@ -0,0 +1,209 @@
+package cli_commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/eclipse/paho.golang/autopaho"
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	"metamakers.org/door-controller-mqtt/config"
+	"metamakers.org/door-controller-mqtt/connection"
+	"metamakers.org/door-controller-mqtt/recording"
+)
+
+var replayCmd = &cobra.Command{
+	Use:   "replay <file>",
+	Short: "Republishes a recording made by porter record",
+	Long: `Republishes a recording made by porter record, keeping the time between
+messages unless --speed is given. Topics can be rewritten to replay a real
+controller's traffic as a test door, e.g.
+
+  porter replay door_one.jsonl --speed 10 --rewrite_client_id door_one=door_test`,
+	Args: cobra.ExactArgs(1),
+	Run:  runReplay,
+}
+
+func init() {
+	rootCmd.AddCommand(replayCmd)
+
+	defaults := config.Default().Replay
+	replayCmd.Flags().String("client_id", defaults.ClientID, "Client ID used to connect to the MQTT broker (defaults to <username>_replay_<pid>)")
+	replayCmd.Flags().Float64("speed", defaults.Speed, "How much faster than recorded to replay, 0 replays without waiting")
+	replayCmd.Flags().StringSlice("rewrite_client_id", defaults.RewriteClientIDs, "Replace a client ID in topics under the namespace as from=to, can be repeated")
+	replayCmd.Flags().StringSlice("rewrite_topic", defaults.RewriteTopics, "Replace the start of a topic as from=to, can be repeated")
+}
+
+var replayConnectTimeout = time.Second * 30
+
+func runReplay(cmd *cobra.Command, args []string) {
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	cfg := loadConfig(cmd)
+	namespace := loadNamespace(cfg)
+
+	if cfg.Replay.Speed < 0 {
+		log.Error().
+			Str("event", "ConfigLoad").
+			Float64("speed", cfg.Replay.Speed).
+			Msg("Speed can't be negative")
+		syscall.Exit(2)
+	}
+	rewrite := recording.Rewrite{
+		Namespace: namespace,
+		ClientIDs: loadReplacements(cfg.Replay.RewriteClientIDs),
+		Topics:    loadReplacements(cfg.Replay.RewriteTopics),
+	}
+
+	file, err := os.Open(args[0])
+	if err != nil {
+		log.Error().
+			Str("error", err.Error()).
+			Str("event", "Recording").
+			Str("path", args[0]).
+			Msg(fmt.Sprintf("Failed to open recording: %v", err))
+		syscall.Exit(2)
+	}
+	messages, err := recording.Read(file)
+	file.Close()
+	if err != nil {
+		log.Error().
+			Str("error", err.Error()).
+			Str("event", "Recording").
+			Str("path", args[0]).
+			Msg(fmt.Sprintf("Invalid recording: %v", err))
+		syscall.Exit(2)
+	}
+
+	clientID := cfg.Replay.ClientID
+	if clientID == "" {
+		clientID = fmt.Sprintf("%s_replay_%d", cfg.MQTT.Username, os.Getpid())
+	}
+	ready := make(chan *autopaho.ConnectionManager, 1)
+
+	clientConfig, err := connection.Options{
+		URIs:          cfg.MQTT.URIs,
+		Username:      cfg.MQTT.Username,
+		Password:      cfg.MQTT.Password,
+		ClientID:      clientID,
+		Transport:     loadTransport(cfg),
+		CleanStart:    true,
+		SessionExpiry: 0,
+		OnConnectionUp: func(connectionManager *autopaho.ConnectionManager, connectionAck *paho.Connack, broker *url.URL) {
+			select {
+			case ready <- connectionManager:
+			default:
+			}
+		},
+	}.ClientConfig(ctx)
+	if err != nil {
+		log.Error().
+			Str("error", err.Error()).
+			Str("event", "URLParse").
+			Msg(fmt.Sprintf("Url parse Error: %v\n", err))
+		syscall.Exit(2)
+		return
+	}
+
+	serverConnection, err := autopaho.NewConnection(ctx, clientConfig)
+	if err != nil {
+		log.Error().
+			Str("error", err.Error()).
+			Str("event", "NewConnection").
+			Msg(fmt.Sprintf("New connection start interrupted: %v", err))
+		syscall.Exit(3)
+		return
+	}
+
+	connectTimeout := time.NewTimer(replayConnectTimeout)
+	defer connectTimeout.Stop()
+
+	select {
+	case <-ready:
+	case <-connectTimeout.C:
+		log.Error().
+			Str("event", "FatalError").
+			Msg("Failed to connect to any MQTT broker")
+		serverConnection.Disconnect(ctx)
+		syscall.Exit(4)
+	case <-ctx.Done():
+		log.Info().
+			Str("event", "stopping").
+			Msg("Termination signal received")
+		return
+	}
+
+	// Messages published while the connection is down fail and are
+	// skipped, the replay carries on once it's back
+	failed := 0
+	replayer := recording.Replayer{
+		Publisher: serverConnection,
+		Speed:     cfg.Replay.Speed,
+		Rewrite:   rewrite,
+		Published: func(message recording.Message, topic string, err error) {
+			if err != nil {
+				failed += 1
+				log.Error().
+					Str("error", err.Error()).
+					Str("event", "ReplayPublish").
+					Str("topic", topic).
+					Str("recorded_topic", message.Topic).
+					Msg(fmt.Sprintf("Failed to replay message: %v", err))
+				return
+			}
+			log.Debug().
+				Str("event", "ReplayPublish").
+				Str("topic", topic).
+				Str("recorded_topic", message.Topic).
+				Str("payload", message.Payload).
+				Msg("Replayed message")
+		},
+	}
+
+	log.Info().
+		Str("event", "Replay").
+		Str("path", args[0]).
+		Int("count", len(messages)).
+		Float64("speed", cfg.Replay.Speed).
+		Msg(fmt.Sprintf("Replaying %d messages", len(messages)))
+	published, err := replayer.Replay(ctx, messages)
+	serverConnection.Disconnect(context.Background())
+
+	if err != nil && !errors.Is(err, context.Canceled) {
+		log.Error().
+			Str("error", err.Error()).
+			Str("event", "Replay").
+			Msg(fmt.Sprintf("Replay stopped: %v", err))
+	}
+	log.Info().
+		Str("event", "ReplayFinished").
+		Int("published", published).
+		Int("failed", failed).
+		Int("count", len(messages)).
+		Msg(fmt.Sprintf("Replayed %d of %d messages", published, len(messages)))
+	if failed > 0 || published < len(messages) {
+		syscall.Exit(1)
+	}
+}
+
+// loadReplacements exits when a rewrite isn't written as from=to
+func loadReplacements(raw []string) []recording.Replacement {
+	replacements, err := recording.ParseReplacements(raw)
+	if err != nil {
+		log.Error().
+			Str("error", err.Error()).
+			Str("event", "ConfigLoad").
+			Msg(err.Error())
+		syscall.Exit(2)
+	}
+	return replacements
+}
@@ -1,9 +1,16 @@
 package cli_commands
 
 import (
+	"fmt"
 	"os"
+	"syscall"
 
+	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
+	"metamakers.org/door-controller-mqtt/cards"
+	"metamakers.org/door-controller-mqtt/config"
+	"metamakers.org/door-controller-mqtt/connection"
+	"metamakers.org/door-controller-mqtt/mqtt"
 )
 
 var rootCmd = &cobra.Command{
@@ -19,12 +26,106 @@ func Execute() {
 	}
 }
 
-var username string
-var password string
-var mqttUri string
+var configPath string
 
 func init() {
-	rootCmd.PersistentFlags().StringVarP(&username, "username", "u", "", "Username used to authenicate with the MQTT Broker")
-	rootCmd.PersistentFlags().StringVarP(&password, "password", "p", "", "Password used to authenicate with the MQTT Broker")
-	rootCmd.PersistentFlags().StringVarP(&mqttUri, "mqtt_uri", "m", "", "Uri used to connect to the mqtt broker")
+	defaults := config.Default().MQTT
+	rootCmd.PersistentFlags().StringVar(&configPath, "config", "", "Path of the config file (defaults to searching the XDG config directories and /etc/porter)")
+	rootCmd.PersistentFlags().String("credential_helper", config.Default().CredentialHelper, "Command run to look up secrets that have not been set, given the secret's config key (e.g. mqtt.password)")
+	rootCmd.PersistentFlags().String("namespace", defaults.Namespace, "Topic namespace the door controllers publish under, e.g. site/m2c/door_controller")
+	rootCmd.PersistentFlags().StringP("username", "u", defaults.Username, "Username used to authenicate with the MQTT Broker")
+	rootCmd.PersistentFlags().StringP("password", "p", defaults.Password, "Password used to authenicate with the MQTT Broker")
+	rootCmd.PersistentFlags().StringSliceP("mqtt_uri", "m", defaults.URIs, "Uri used to connect to the mqtt broker, repeat it or comma separate uris to fail over to backup brokers in order")
+	rootCmd.PersistentFlags().String("tls_ca", defaults.TLS.CA, "CA bundle used to verify the MQTT broker (defaults to the system CAs)")
+	rootCmd.PersistentFlags().String("tls_cert", defaults.TLS.Cert, "Client certificate used to authenticate with the MQTT broker")
+	rootCmd.PersistentFlags().String("tls_key", defaults.TLS.Key, "Key of the client certificate")
+	rootCmd.PersistentFlags().String("tls_server_name", defaults.TLS.ServerName, "Overrides the server name the MQTT broker's certificate is checked against")
+	rootCmd.PersistentFlags().String("tls_min_version", defaults.TLS.MinVersion, "Minimum TLS version: 1.0, 1.1, 1.2 or 1.3")
+	rootCmd.PersistentFlags().String("ws_path", defaults.WebSocket.Path, "Path used by ws:// and wss:// uris that don't have one")
+	rootCmd.PersistentFlags().StringArray("ws_header", defaults.WebSocket.Headers, "Header sent when connecting over a websocket as \"Name: value\", can be repeated")
+}
+
+// loadConfig resolves the effective config of the command being run. It
+// exits when the config can't be loaded, as nothing can run without it.
+func loadConfig(cmd *cobra.Command) config.Config {
+	cfg, _ := loadConfigFile(cmd)
+	return cfg
+}
+
+// loadConfigFile loads the config along with the path of the file it was
+// read from, exiting when it can't be loaded
+func loadConfigFile(cmd *cobra.Command) (config.Config, string) {
+	if configPath == "" {
+		configPath = os.Getenv("PORTER_CONFIG")
+	}
+
+	cfg, path, err := config.Load(configPath, cmd.Name(), cmd.Flags())
+	if err != nil {
+		log.Error().
+			Str("error", err.Error()).
+			Str("event", "ConfigLoad").
+			Str("path", path).
+			Msg(fmt.Sprintf("Failed to load config: %v", err))
+		syscall.Exit(2)
+	}
+
+	return cfg, path
+}
+
+// loadNamespace returns the namespace every topic is published under,
+// exiting when it can't be used as a topic prefix
+func loadNamespace(cfg config.Config) mqtt.Namespace {
+	namespace := mqtt.Namespace(cfg.MQTT.Namespace)
+	if err := namespace.Validate(); err != nil {
+		log.Error().
+			Str("error", err.Error()).
+			Str("event", "Namespace").
+			Str("namespace", cfg.MQTT.Namespace).
+			Msg(fmt.Sprintf("Invalid topic namespace: %v", err))
+		syscall.Exit(2)
+	}
+
+	return namespace
+}
+
+// loadCardEncoding exits when the card encoding doesn't exist
+func loadCardEncoding(name string) cards.Encoding {
+	encoding, err := cards.LookupEncoding(name)
+	if err != nil {
+		log.Error().
+			Str("error", err.Error()).
+			Str("event", "ConfigLoad").
+			Str("card_encoding", name).
+			Msg(err.Error())
+		syscall.Exit(2)
+	}
+	return encoding
+}
+
+// loadTransport builds how the brokers are reached, exiting when the CA
+// bundle, client certificate or websocket headers can't be used
+func loadTransport(cfg config.Config) connection.Transport {
+	tlsConfig, err := cfg.MQTT.TLS.Build()
+	if err != nil {
+		log.Error().
+			Str("error", err.Error()).
+			Str("event", "TLSConfig").
+			Msg(fmt.Sprintf("Failed to load TLS config: %v", err))
+		syscall.Exit(2)
+	}
+
+	webSocketHeaders, err := cfg.MQTT.WebSocket.Header()
+	if err != nil {
+		log.Error().
+			Str("error", err.Error()).
+			Str("event", "WebSocketConfig").
+			Msg(fmt.Sprintf("Failed to load websocket config: %v", err))
+		syscall.Exit(2)
+	}
+
+	return connection.Transport{
+		TLS:              tlsConfig,
+		WebSocketPath:    cfg.MQTT.WebSocket.Path,
+		WebSocketHeaders: webSocketHeaders,
+	}
 }
@@ -0,0 +1,181 @@
+package cli_commands
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/eclipse/paho.golang/autopaho"
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	"metamakers.org/door-controller-mqtt/config"
+	"metamakers.org/door-controller-mqtt/connection"
+	"metamakers.org/door-controller-mqtt/mqtt"
+	"metamakers.org/door-controller-mqtt/rpc"
+)
+
+var rpcCmd = &cobra.Command{
+	Use:   "rpc <client_id> <method> [params]",
+	Short: "Calls a method on a door controller and prints the replies",
+	Long: `Calls a method on a door controller and prints each reply as a line of JSON.
+The params are passed to the method as JSON. With --all every door controller is
+called and the replies are collected until the timeout, e.g.
+
+  porter rpc door_one card_count
+  porter rpc --all ping`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if all, _ := cmd.Flags().GetBool("all"); all {
+			return cobra.RangeArgs(1, 2)(cmd, args)
+		}
+		return cobra.RangeArgs(2, 3)(cmd, args)
+	},
+	Run: runRPC,
+}
+
+func init() {
+	rootCmd.AddCommand(rpcCmd)
+
+	defaults := config.Default().RPC
+	rpcCmd.Flags().Bool("all", false, "Call every door controller instead of a single one")
+	rpcCmd.Flags().String("client_id", defaults.ClientID, "Client ID used to connect to the MQTT broker (defaults to <username>_rpc_<pid>)")
+	rpcCmd.Flags().Duration("timeout", defaults.Timeout, "How long to wait for replies")
+}
+
+var rpcConnectTimeout = time.Second * 30
+
+func runRPC(cmd *cobra.Command, args []string) {
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	cfg := loadConfig(cmd)
+	namespace := loadNamespace(cfg)
+
+	call := rpc.Call{Timeout: cfg.RPC.Timeout}
+	if all, _ := cmd.Flags().GetBool("all"); !all {
+		call.ClientID, args = args[0], args[1:]
+		if err := mqtt.ValidateClientID(call.ClientID); err != nil {
+			log.Error().
+				Str("error", err.Error()).
+				Str("event", "ClientID").
+				Msg(fmt.Sprintf("Invalid door client ID: %v", err))
+			syscall.Exit(2)
+		}
+	}
+	call.Method = args[0]
+	if len(args) > 1 {
+		if !json.Valid([]byte(args[1])) {
+			log.Error().
+				Str("event", "Params").
+				Str("params", args[1]).
+				Msg("Params must be valid JSON")
+			syscall.Exit(2)
+		}
+		call.Params = json.RawMessage(args[1])
+	}
+
+	// Replies are matched by their correlation data, so any number of
+	// callers can run at once as long as their client IDs differ
+	clientID := cfg.RPC.ClientID
+	if clientID == "" {
+		clientID = fmt.Sprintf("%s_rpc_%d", cfg.MQTT.Username, os.Getpid())
+	}
+	if err := mqtt.ValidateClientID(clientID); err != nil {
+		log.Error().
+			Str("error", err.Error()).
+			Str("event", "ClientID").
+			Msg(fmt.Sprintf("Invalid client ID: %v", err))
+		syscall.Exit(2)
+	}
+
+	caller := rpc.NewCaller(namespace)
+	ready := make(chan *autopaho.ConnectionManager, 1)
+
+	clientConfig, err := connection.Options{
+		URIs:          cfg.MQTT.URIs,
+		Username:      cfg.MQTT.Username,
+		Password:      cfg.MQTT.Password,
+		ClientID:      clientID,
+		Transport:     loadTransport(cfg),
+		CleanStart:    true,
+		SessionExpiry: 0,
+		Subscriptions: []paho.SubscribeOptions{
+			{Topic: caller.ResponseFilter(), QoS: 1},
+		},
+		OnConnectionUp: func(connectionManager *autopaho.ConnectionManager, connectionAck *paho.Connack, broker *url.URL) {
+			select {
+			case ready <- connectionManager:
+			default:
+			}
+		},
+		OnPublishReceived: caller.HandleResponse,
+	}.ClientConfig(ctx)
+	if err != nil {
+		log.Error().
+			Str("error", err.Error()).
+			Str("event", "URLParse").
+			Msg(fmt.Sprintf("Url parse Error: %v\n", err))
+		syscall.Exit(2)
+		return
+	}
+
+	serverConnection, err := autopaho.NewConnection(ctx, clientConfig)
+	if err != nil {
+		log.Error().
+			Str("error", err.Error()).
+			Str("event", "NewConnection").
+			Msg(fmt.Sprintf("New connection start interrupted: %v", err))
+		syscall.Exit(3)
+		return
+	}
+
+	connectTimeout := time.NewTimer(rpcConnectTimeout)
+	defer connectTimeout.Stop()
+
+	var connectionManager *autopaho.ConnectionManager
+	select {
+	case connectionManager = <-ready:
+	case <-connectTimeout.C:
+		log.Error().
+			Str("event", "FatalError").
+			Msg("Failed to connect to any MQTT broker")
+		serverConnection.Disconnect(ctx)
+		syscall.Exit(4)
+	case <-ctx.Done():
+		log.Info().
+			Str("event", "stopping").
+			Msg("Termination signal received")
+		return
+	}
+
+	responses, err := caller.Call(ctx, connectionManager, call)
+	exitCode := 0
+	for _, response := range responses {
+		encoded, _ := json.Marshal(response)
+		fmt.Println(string(encoded))
+		if response.Error != "" {
+			exitCode = 1
+		}
+	}
+	if err != nil && !errors.Is(err, context.Canceled) {
+		log.Error().
+			Str("error", err.Error()).
+			Str("event", "RPCCall").
+			Str("client_id", call.ClientID).
+			Str("method", call.Method).
+			Msg(fmt.Sprintf("Call to %s failed: %v", call.Method, err))
+		exitCode = 4
+	}
+
+	serverConnection.Disconnect(context.Background())
+	if exitCode != 0 {
+		syscall.Exit(exitCode)
+	}
+}
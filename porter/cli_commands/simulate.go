@@ -0,0 +1,155 @@
+package cli_commands
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	"metamakers.org/door-controller-mqtt/config"
+	"metamakers.org/door-controller-mqtt/connection"
+	"metamakers.org/door-controller-mqtt/mqtt"
+	"metamakers.org/door-controller-mqtt/simulate"
+)
+
+var simulateCmd = &cobra.Command{
+	Use:   "simulate",
+	Short: "Simulates a fleet of door controllers to load test the broker and diary",
+	Long: `Simulates a fleet of door controllers in one process to load test the broker and diary.
+Each controller has its own connection and client ID, answers health checks and
+access lists like mimic does, and swipes random cards. Publish latency and errors
+are reported while it runs, and the final report is printed as JSON.`,
+	Run: runSimulate,
+}
+
+func init() {
+	rootCmd.AddCommand(simulateCmd)
+
+	defaults := config.Default().Simulate
+	simulateCmd.Flags().Int("doors", defaults.Doors, "Number of controllers to simulate")
+	simulateCmd.Flags().String("client_prefix", defaults.ClientPrefix, "Client IDs are the prefix followed by a number")
+	simulateCmd.Flags().Duration("swipe_interval", defaults.SwipeInterval, "Mean time between swipes at each door (0 disables swipes)")
+	simulateCmd.Flags().Float64("deny_ratio", defaults.DenyRatio, "Share of swipes that are denied, from 0 to 1")
+	simulateCmd.Flags().Float64("health_check_failure", defaults.HealthCheckFailure, "Probability of a door ignoring a health check, from 0 to 1")
+	simulateCmd.Flags().Duration("disconnect_interval", defaults.DisconnectInterval, "Mean time before a door randomly disconnects (0 disables disconnects)")
+	simulateCmd.Flags().Duration("reconnect_delay", defaults.ReconnectDelay, "Time a door stays offline after disconnecting")
+	simulateCmd.Flags().Duration("report_interval", defaults.ReportInterval, "How often progress is logged")
+	simulateCmd.Flags().Duration("duration", defaults.Duration, "Stop after this long (0 runs until stopped)")
+	simulateCmd.Flags().Int("seed", defaults.Seed, "Seed for the random timings and cards (0 picks one)")
+}
+
+func runSimulate(cmd *cobra.Command, args []string) {
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	cfg := loadConfig(cmd)
+	namespace := loadNamespace(cfg)
+
+	options := simulate.Options{
+		Count:        cfg.Simulate.Doors,
+		ClientPrefix: cfg.Simulate.ClientPrefix,
+		Namespace:    namespace,
+		Connection: connection.Options{
+			URIs:      cfg.MQTT.URIs,
+			Username:  cfg.MQTT.Username,
+			Password:  cfg.MQTT.Password,
+			Transport: loadTransport(cfg),
+		},
+		SwipeInterval:      cfg.Simulate.SwipeInterval,
+		DenyRatio:          cfg.Simulate.DenyRatio,
+		HealthCheckFailure: cfg.Simulate.HealthCheckFailure,
+		DisconnectInterval: cfg.Simulate.DisconnectInterval,
+		ReconnectDelay:     cfg.Simulate.ReconnectDelay,
+		LockDelay:          time.Second * 8,
+		Seed:               int64(cfg.Simulate.Seed),
+	}
+
+	if err := validateSimulation(cfg.Simulate, options); err != nil {
+		log.Error().
+			Str("error", err.Error()).
+			Str("event", "ConfigLoad").
+			Msg(fmt.Sprintf("Invalid simulation: %v", err))
+		syscall.Exit(2)
+	}
+
+	if cfg.Simulate.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.Simulate.Duration)
+		defer cancel()
+	}
+
+	log.Info().
+		Str("event", "SimulationStart").
+		Int("doors", options.Count).
+		Str("first_client_id", options.ClientID(0)).
+		Msg(fmt.Sprintf("Simulating %d door controllers", options.Count))
+
+	stats := simulate.NewStats()
+	finished := make(chan bool)
+	go func() {
+		simulate.Run(ctx, options, stats)
+		close(finished)
+	}()
+
+	ticker := time.NewTicker(cfg.Simulate.ReportInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			report := stats.Report()
+			log.Info().
+				Str("event", "SimulationReport").
+				Int("connected", report.Connected).
+				Int("published", report.TotalPublished()).
+				Int("errors", report.TotalErrors()).
+				Float64("p50_ms", report.Latency.P50).
+				Float64("p99_ms", report.Latency.P99).
+				Msg(fmt.Sprintf(
+					"%d/%d connected, %d published, %d errors, p50 %.1fms p99 %.1fms",
+					report.Connected, options.Count, report.TotalPublished(), report.TotalErrors(), report.Latency.P50, report.Latency.P99,
+				))
+		case <-finished:
+			report := stats.Report()
+			encoded, _ := json.MarshalIndent(report, "", "  ")
+			fmt.Println(string(encoded))
+			if report.TotalErrors() > 0 {
+				log.Warn().
+					Str("event", "SimulationErrors").
+					Int("errors", report.TotalErrors()).
+					Str("last_error", report.LastError).
+					Msg(fmt.Sprintf("%d publishes failed, last error: %s", report.TotalErrors(), report.LastError))
+				syscall.Exit(1)
+			}
+			return
+		}
+	}
+}
+
+func validateSimulation(simulateConfig config.SimulateConfig, options simulate.Options) error {
+	if options.Count < 1 {
+		return fmt.Errorf("At least one door is needed, got %d", options.Count)
+	}
+	if err := mqtt.ValidateClientID(options.ClientID(0)); err != nil {
+		return err
+	}
+	if options.DenyRatio < 0 || options.DenyRatio > 1 {
+		return fmt.Errorf("Deny ratio must be between 0 and 1, got %v", options.DenyRatio)
+	}
+	if options.HealthCheckFailure < 0 || options.HealthCheckFailure > 1 {
+		return fmt.Errorf("Health check failure must be between 0 and 1, got %v", options.HealthCheckFailure)
+	}
+	if simulateConfig.ReportInterval <= 0 {
+		return fmt.Errorf("Report interval must be positive, got %v", simulateConfig.ReportInterval)
+	}
+	if _, err := connection.ParseURIs(options.Connection.URIs); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package cli_commands
+
+import (
+	"fmt"
+	"os"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"metamakers.org/door-controller-mqtt/config"
+	"metamakers.org/door-controller-mqtt/models"
+)
+
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Live dashboard of every door controller",
+	Long:  "Live dashboard showing the health and events of every door controller",
+	Run:   runWatch,
+}
+
+func init() {
+	rootCmd.AddCommand(watchCmd)
+
+	watchCmd.Flags().String("client_id", config.Default().Watch.ClientID, "Client ID used to connect to the MQTT broker (defaults to <username>_watch_<pid>)")
+}
+
+func runWatch(cmd *cobra.Command, args []string) {
+	cfg := loadConfig(cmd)
+
+	// Sharing a client ID with diary would make the broker
+	// disconnect one of them every time the other connects
+	clientID := cfg.Watch.ClientID
+	if clientID == "" {
+		clientID = fmt.Sprintf("%s_watch_%d", cfg.MQTT.Username, os.Getpid())
+	}
+
+	if _, err := tea.NewProgram(
+		models.InitWatchModel(cmd.Context(), cfg.MQTT.URIs, loadNamespace(cfg), cfg.MQTT.Username, cfg.MQTT.Password, clientID, loadTransport(cfg)),
+		tea.WithAltScreen(),
+	).Run(); err != nil {
+		log.Error().
+			Str("error", err.Error()).
+			Str("event", "TUI").
+			Msg(fmt.Sprintf("Error running TUI: %v", err))
+	}
+}
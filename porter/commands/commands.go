@@ -5,22 +5,35 @@ import (
 	"errors"
 	"fmt"
 	"net/url"
+	"strings"
 	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/eclipse/paho.golang/autopaho"
 	"github.com/eclipse/paho.golang/paho"
+	"github.com/rs/zerolog"
 
+	"metamakers.org/door-controller-mqtt/connection"
 	"metamakers.org/door-controller-mqtt/messages"
 	"metamakers.org/door-controller-mqtt/mqtt"
+	"metamakers.org/door-controller-mqtt/rpc"
 )
 
-func Init(mqttUri string, username string, password string) tea.Cmd {
+// Publisher is the part of the connection manager the publish commands
+// need, mimic wraps it to inject faults into what it publishes
+type Publisher interface {
+	Publish(ctx context.Context, publish *paho.Publish) (*paho.PublishResponse, error)
+}
+
+func Init(mqttUris []string, namespace mqtt.Namespace, username string, password string, clientID string, transport connection.Transport) tea.Cmd {
 	return func() tea.Msg {
 		return messages.MqttCredentials{
-			URI:      mqttUri,
-			Username: username,
-			Password: password,
+			URIs:      mqttUris,
+			Namespace: namespace,
+			Username:  username,
+			Password:  password,
+			ClientID:  clientID,
+			Transport: transport,
 		}
 	}
 }
@@ -29,57 +42,54 @@ func InitConnection(
 	ctx context.Context,
 	mqttConnectionStatus chan messages.MqttStatus,
 	mqttMessages chan messages.MqttMessage,
-	mqttUri string,
+	mqttUris []string,
 	username string,
 	password string,
+	clientID string,
+	transport connection.Transport,
 ) tea.Cmd {
 	return func() tea.Msg {
-		serverUrl, err := url.Parse(mqttUri)
-		if err != nil {
-			return messages.UrlParseError{
-				URI: mqttUri,
-				Err: err,
-			}
-		}
-
-		clientConfig := autopaho.ClientConfig{
-			ServerUrls:                    []*url.URL{serverUrl},
-			ConnectUsername:               username,
-			ConnectPassword:               []byte(password),
-			KeepAlive:                     20,
-			CleanStartOnInitialConnection: false,
-			SessionExpiryInterval:         60,
-			ConnectRetryDelay:             time.Second * 5,
-			OnConnectionUp: func(connectionManager *autopaho.ConnectionManager, connectionAck *paho.Connack) {
-				mqttConnectionStatus <- messages.MqttStatus{Connected: true, Err: nil, Reason: "", Code: 0}
-			},
-			OnConnectError: func(err error) {
-				mqttConnectionStatus <- messages.MqttStatus{Connected: false, Err: err, Reason: "", Code: 254}
+		// Anything logged would draw over the TUI, the status
+		// channel is how problems are shown instead
+		logger := zerolog.Nop()
+		clientConfig, err := connection.Options{
+			URIs:          mqttUris,
+			Username:      username,
+			Password:      password,
+			ClientID:      clientID,
+			Transport:     transport,
+			CleanStart:    false,
+			SessionExpiry: time.Minute,
+			OnConnectionUp: func(connectionManager *autopaho.ConnectionManager, connectionAck *paho.Connack, broker *url.URL) {
+				mqttConnectionStatus <- messages.MqttStatus{Connected: true, Err: nil, Reason: "", Code: 0, Broker: broker.Redacted()}
 			},
-			ClientConfig: paho.ClientConfig{
-				ClientID: username,
-				OnPublishReceived: []func(paho.PublishReceived) (bool, error){
-					func(publishReveived paho.PublishReceived) (bool, error) {
-						publish := publishReveived.Packet.Packet()
-						mqttMessages <- messages.MqttMessage{
-							Topic:   publish.Topic,
-							Payload: string(publish.Payload),
-						}
-						return true, nil
-					},
-				},
-				OnClientError: func(err error) {
-					mqttConnectionStatus <- messages.MqttStatus{Connected: false, Err: err, Reason: "", Code: 255}
-				},
-				OnServerDisconnect: func(disconnect *paho.Disconnect) {
+			OnConnectionDown: func(err error) {
+				var disconnectErr connection.DisconnectError
+				if errors.As(err, &disconnectErr) {
 					mqttConnectionStatus <- messages.MqttStatus{
 						Connected: false,
 						Err:       err,
-						Reason:    disconnect.Properties.ReasonString,
-						Code:      disconnect.ReasonCode,
+						Reason:    disconnectErr.Reason,
+						Code:      disconnectErr.ReasonCode,
 					}
-				},
+					return
+				}
+				mqttConnectionStatus <- messages.MqttStatus{Connected: false, Err: err, Reason: "", Code: 255}
 			},
+			OnPublishReceived: func(publish *paho.Publish) {
+				mqttMessages <- messages.MqttMessage{
+					Topic:      publish.Topic,
+					Payload:    string(publish.Payload),
+					Properties: publish.Properties,
+				}
+			},
+			Logger: &logger,
+		}.ClientConfig(ctx)
+		if err != nil {
+			return messages.UrlParseError{
+				URI: strings.Join(mqttUris, ","),
+				Err: err,
+			}
 		}
 
 		serverConnection, err := autopaho.NewConnection(ctx, clientConfig)
@@ -109,40 +119,47 @@ func WaitForStatus(mqttConnectionStatus chan messages.MqttStatus) tea.Cmd {
 	}
 }
 
-func PublishCardCode(serverConnection *autopaho.ConnectionManager, ctx context.Context, topic string, code string) tea.Cmd {
+func PublishCardCode(serverConnection Publisher, ctx context.Context, topic string, code string) tea.Cmd {
 	return func() tea.Msg {
-		payload := fmt.Sprintf("%010s|%s", code, time.Now().UTC().Format("2006-01-02 15:04:05"))
-		if _, err := serverConnection.Publish(ctx, &paho.Publish{
+		publish := &paho.Publish{
 			QoS:     1,
 			Topic:   topic,
-			Payload: []byte(payload),
-		}); err != nil {
+			Payload: []byte(fmt.Sprintf("%s|%s", code, time.Now().UTC().Format(mqtt.TimestampFormat))),
+		}
+		if _, err := serverConnection.Publish(ctx, publish); err != nil {
 			return messages.PublishMessage{
 				Topic:   topic,
-				Payload: payload,
+				Payload: string(publish.Payload),
 				Err:     err,
 			}
 		}
 		return messages.PublishMessage{
 			Topic:   topic,
-			Payload: payload,
+			Payload: string(publish.Payload),
 			Err:     nil,
 		}
 	}
 }
 
-func PublishUnlock(serverConnection *autopaho.ConnectionManager, ctx context.Context, clientID string, code string) tea.Cmd {
-	topic := mqtt.UnlockTopic + "/" + clientID
+func PublishUnlock(serverConnection Publisher, ctx context.Context, namespace mqtt.Namespace, clientID string, code string) tea.Cmd {
+	topic := mqtt.Topic{Namespace: namespace, Level: mqtt.UnlockLevel, ClientID: clientID}.Build()
 	return PublishCardCode(serverConnection, ctx, topic, code)
 }
 
-func PublishDeniedAccess(serverConnection *autopaho.ConnectionManager, ctx context.Context, clientID string, code string) tea.Cmd {
-	topic := mqtt.DeniedAccessTopic + "/" + clientID
+func PublishDeniedAccess(serverConnection Publisher, ctx context.Context, namespace mqtt.Namespace, clientID string, code string) tea.Cmd {
+	topic := mqtt.Topic{Namespace: namespace, Level: mqtt.DeniedAccessLevel, ClientID: clientID}.Build()
 	return PublishCardCode(serverConnection, ctx, topic, code)
 }
 
-func PublishLock(serverConnection *autopaho.ConnectionManager, ctx context.Context, clientID string, code string) tea.Cmd {
-	topic := mqtt.LockTopic + "/" + clientID
+func PublishLock(serverConnection Publisher, ctx context.Context, namespace mqtt.Namespace, clientID string, code string) tea.Cmd {
+	topic := mqtt.Topic{Namespace: namespace, Level: mqtt.LockLevel, ClientID: clientID}.Build()
+	return PublishCardCode(serverConnection, ctx, topic, code)
+}
+
+// PublishDoorEvent publishes a level from the door's state machine with
+// the card the door was unlocked with
+func PublishDoorEvent(serverConnection Publisher, ctx context.Context, namespace mqtt.Namespace, clientID string, level string, code string) tea.Cmd {
+	topic := mqtt.Topic{Namespace: namespace, Level: level, ClientID: clientID}.Build()
 	return PublishCardCode(serverConnection, ctx, topic, code)
 }
 
@@ -154,88 +171,130 @@ func DelayCommandBy(duration time.Duration, cmd tea.Cmd) tea.Cmd {
 	}
 }
 
-func SubscribeToAccessList(serverConnection *autopaho.ConnectionManager, ctx context.Context) tea.Cmd {
-	return func() tea.Msg {
-		if serverConnection == nil {
-			return messages.SubscribeMessage{
-				Topic: mqtt.AccessListTopic,
-				Err: errors.New(
-					fmt.Sprintf("Connection is nil! Cannot subscribe to: %s", mqtt.AccessListTopic),
-				),
-			}
-		}
-		if _, err := serverConnection.Subscribe(ctx, &paho.Subscribe{
-			Subscriptions: []paho.SubscribeOptions{
-				{Topic: mqtt.AccessListTopic, QoS: 1},
-			},
-		}); err != nil {
-			return messages.SubscribeMessage{Topic: mqtt.AccessListTopic, Err: err}
-		}
+func SubscribeToAccessList(serverConnection *autopaho.ConnectionManager, ctx context.Context, namespace mqtt.Namespace) tea.Cmd {
+	return subscribe(serverConnection, ctx, mqtt.Topic{Namespace: namespace, Level: mqtt.AccessListLevel}.Build())
+}
+
+func SubscribeToHealthCheck(serverConnection *autopaho.ConnectionManager, ctx context.Context, namespace mqtt.Namespace) tea.Cmd {
+	return subscribe(serverConnection, ctx, mqtt.Topic{Namespace: namespace, Level: mqtt.HealthCheckLevel}.Build())
+}
+
+func SubscribeToAll(serverConnection *autopaho.ConnectionManager, ctx context.Context, namespace mqtt.Namespace) tea.Cmd {
+	return subscribe(serverConnection, ctx, namespace.Wildcard())
+}
 
-		return messages.SubscribeMessage{Topic: mqtt.AccessListTopic, Err: nil}
+func SubscribeToRequests(serverConnection *autopaho.ConnectionManager, ctx context.Context, responder *rpc.Responder) tea.Cmd {
+	cmds := make([]tea.Cmd, 0)
+	for _, topic := range responder.Topics() {
+		cmds = append(cmds, subscribe(serverConnection, ctx, topic))
 	}
+	return tea.Batch(cmds...)
 }
 
-func SubscribeToHealthCheck(serverConnection *autopaho.ConnectionManager, ctx context.Context) tea.Cmd {
+func subscribe(serverConnection *autopaho.ConnectionManager, ctx context.Context, topic string) tea.Cmd {
 	return func() tea.Msg {
 		if serverConnection == nil {
 			return messages.SubscribeMessage{
-				Topic: mqtt.AccessListTopic,
+				Topic: topic,
 				Err: errors.New(
-					fmt.Sprintf("Connection is nil! Cannot subscribe to: %s", mqtt.HealthCheckTopic),
+					fmt.Sprintf("Connection is nil! Cannot subscribe to: %s", topic),
 				),
 			}
 		}
 		if _, err := serverConnection.Subscribe(ctx, &paho.Subscribe{
 			Subscriptions: []paho.SubscribeOptions{
-				{Topic: mqtt.HealthCheckTopic, QoS: 1},
+				{Topic: topic, QoS: 1},
 			},
 		}); err != nil {
-			return messages.SubscribeMessage{Topic: mqtt.HealthCheckTopic, Err: err}
+			return messages.SubscribeMessage{Topic: topic, Err: err}
 		}
 
-		return messages.SubscribeMessage{Topic: mqtt.HealthCheckTopic, Err: nil}
+		return messages.SubscribeMessage{Topic: topic, Err: nil}
 	}
 }
 
-func publishMessage(serverConnection *autopaho.ConnectionManager, ctx context.Context, topic string, payload string) tea.Cmd {
+func TickEvery(duration time.Duration) tea.Cmd {
+	return tea.Tick(duration, func(now time.Time) tea.Msg {
+		return messages.Tick(now)
+	})
+}
+
+func Publish(serverConnection Publisher, ctx context.Context, topic string, payload string) tea.Cmd {
 	return func() tea.Msg {
-		if _, err := serverConnection.Publish(ctx, &paho.Publish{
+		// The payload is reported as it was published, a Publisher
+		// injecting faults may have changed it
+		publish := &paho.Publish{
 			QoS:     1,
 			Topic:   topic,
 			Payload: []byte(payload),
-		}); err != nil {
-			return messages.PublishMessage{Topic: topic, Payload: payload, Err: err}
 		}
-		return messages.PublishMessage{Topic: topic, Payload: payload, Err: nil}
+		if _, err := serverConnection.Publish(ctx, publish); err != nil {
+			return messages.PublishMessage{Topic: topic, Payload: string(publish.Payload), Err: err}
+		}
+		return messages.PublishMessage{Topic: topic, Payload: string(publish.Payload), Err: nil}
 	}
 }
 
-func HealthCheckHandler(serverConnection *autopaho.ConnectionManager, ctx context.Context, clientID string) tea.Cmd {
-	topic := mqtt.CheckInTopic + "/" + clientID
-	return publishMessage(serverConnection, ctx, topic, clientID)
+func HealthCheckHandler(serverConnection Publisher, ctx context.Context, namespace mqtt.Namespace, clientID string) tea.Cmd {
+	topic := mqtt.Topic{Namespace: namespace, Level: mqtt.CheckInLevel, ClientID: clientID}.Build()
+	return Publish(serverConnection, ctx, topic, clientID)
 }
 
-func FailHealthCheckHandler(clientID string) tea.Cmd {
-	topic := mqtt.CheckInTopic + "/" + clientID
+func FailHealthCheckHandler(namespace mqtt.Namespace, clientID string) tea.Cmd {
+	topic := mqtt.Topic{Namespace: namespace, Level: mqtt.CheckInLevel, ClientID: clientID}.Build()
 	return func() tea.Msg {
 		return messages.PublishMessage{Topic: topic, Payload: clientID, Err: errors.New("Set to fail health checks")}
 	}
 }
 
-func AccessListHandler(serverConnection *autopaho.ConnectionManager, ctx context.Context, clientID string) tea.Cmd {
-	logInfoTopic := mqtt.LogInfoTopic + "/" + clientID
+func AccessListHandler(serverConnection Publisher, ctx context.Context, namespace mqtt.Namespace, clientID string) tea.Cmd {
+	logInfoTopic := mqtt.Topic{Namespace: namespace, Level: mqtt.LogInfoLevel, ClientID: clientID}.Build()
 	return tea.Batch(
-		publishMessage(serverConnection, ctx, logInfoTopic, "Completed rebuilding cards.txt"),
-		publishMessage(serverConnection, ctx, logInfoTopic, "Rebuilding cards.txt"),
+		Publish(serverConnection, ctx, logInfoTopic, "Completed rebuilding cards.txt"),
+		Publish(serverConnection, ctx, logInfoTopic, "Rebuilding cards.txt"),
 	)
 }
 
-func FailAccessListHandler(serverConnection *autopaho.ConnectionManager, ctx context.Context, clientID string) tea.Cmd {
-	logInfoTopic := mqtt.LogInfoTopic + "/" + clientID
-	logFatalTopic := mqtt.LogFatalTopic + "/" + clientID
+func FailAccessListHandler(serverConnection Publisher, ctx context.Context, namespace mqtt.Namespace, clientID string) tea.Cmd {
+	logInfoTopic := mqtt.Topic{Namespace: namespace, Level: mqtt.LogInfoLevel, ClientID: clientID}.Build()
+	logFatalTopic := mqtt.Topic{Namespace: namespace, Level: mqtt.LogFatalLevel, ClientID: clientID}.Build()
 	return tea.Batch(
-		publishMessage(serverConnection, ctx, logFatalTopic, "Failed to read cards.txt"),
-		publishMessage(serverConnection, ctx, logInfoTopic, "Rebuilding cards.txt"),
+		Publish(serverConnection, ctx, logFatalTopic, "Failed to read cards.txt"),
+		Publish(serverConnection, ctx, logInfoTopic, "Rebuilding cards.txt"),
 	)
 }
+
+// InvalidAccessListHandler reports a list that didn't pass validation,
+// the controller keeps the cards it already had
+func InvalidAccessListHandler(serverConnection Publisher, ctx context.Context, namespace mqtt.Namespace, clientID string, err error) tea.Cmd {
+	logInfoTopic := mqtt.Topic{Namespace: namespace, Level: mqtt.LogInfoLevel, ClientID: clientID}.Build()
+	logFatalTopic := mqtt.Topic{Namespace: namespace, Level: mqtt.LogFatalLevel, ClientID: clientID}.Build()
+	return tea.Batch(
+		Publish(serverConnection, ctx, logFatalTopic, fmt.Sprintf("Invalid cards.txt, keeping the previous cards: %v", err)),
+		Publish(serverConnection, ctx, logInfoTopic, "Rebuilding cards.txt"),
+	)
+}
+
+// RespondToRequest runs the requested method and publishes the reply on
+// the door's response topic
+func RespondToRequest(serverConnection Publisher, ctx context.Context, responder *rpc.Responder, msg messages.MqttMessage) tea.Cmd {
+	return func() tea.Msg {
+		response, ok := responder.Respond(&paho.Publish{
+			Topic:      msg.Topic,
+			Payload:    []byte(msg.Payload),
+			Properties: msg.Properties,
+		})
+		if !ok {
+			return messages.PublishMessage{
+				Topic:   msg.Topic,
+				Payload: msg.Payload,
+				Err:     errors.New("Request has no response topic"),
+			}
+		}
+
+		if _, err := serverConnection.Publish(ctx, response); err != nil {
+			return messages.PublishMessage{Topic: response.Topic, Payload: string(response.Payload), Err: err}
+		}
+		return messages.PublishMessage{Topic: response.Topic, Payload: string(response.Payload), Err: nil}
+	}
+}
@@ -0,0 +1,317 @@
+package config
+
+import (
+	"time"
+
+	"metamakers.org/door-controller-mqtt/mqtt"
+)
+
+// Every setting can come from a flag, an environment variable, the config
+// file or its default, in that order of precedence. The struct tags tie a
+// setting to each of those sources:
+//
+//   - yaml: key in the config file
+//   - env: environment variable
+//   - flag: command line flag
+//   - secret: redacted when the config is shown, and can also be read
+//     from a file or a credential helper (see secrets.go)
+//
+// Top level sections tagged with a command are only given the flags of
+// that command, the mqtt section is shared by every command.
+type Config struct {
+	CredentialHelper string           `yaml:"credential_helper" env:"PORTER_CREDENTIAL_HELPER" flag:"credential_helper"`
+	MQTT             MQTTConfig       `yaml:"mqtt"`
+	AccessList       AccessListConfig `yaml:"access_list" command:"access_list"`
+	Broker           BrokerConfig     `yaml:"broker" command:"acl"`
+	Diary            DiaryConfig      `yaml:"diary" command:"diary"`
+	Mimic            MimicConfig      `yaml:"mimic" command:"mimic"`
+	Record           RecordConfig     `yaml:"record" command:"record"`
+	Replay           ReplayConfig     `yaml:"replay" command:"replay"`
+	RPC              RPCConfig        `yaml:"rpc" command:"rpc"`
+	Scenario         ScenarioConfig   `yaml:"scenario" command:"run"`
+	Simulate         SimulateConfig   `yaml:"simulate" command:"simulate"`
+	Watch            WatchConfig      `yaml:"watch" command:"watch"`
+}
+
+type MQTTConfig struct {
+	URIs      []string        `yaml:"uris" env:"MQTT_URI" flag:"mqtt_uri"`
+	Namespace string          `yaml:"namespace" env:"MQTT_NAMESPACE" flag:"namespace"`
+	Username  string          `yaml:"username" env:"MQTT_USER" flag:"username"`
+	Password  string          `yaml:"password" env:"MQTT_PASSWORD" flag:"password" secret:"true"`
+	TLS       TLSConfig       `yaml:"tls"`
+	WebSocket WebSocketConfig `yaml:"websocket"`
+}
+
+// WebSocketConfig is only used for ws:// and wss:// broker URIs. The path
+// is used by the URIs that don't have one, and the headers are sent with
+// every upgrade request as "Name: value".
+type WebSocketConfig struct {
+	Path    string   `yaml:"path" env:"MQTT_WS_PATH" flag:"ws_path"`
+	Headers []string `yaml:"headers" env:"MQTT_WS_HEADERS" flag:"ws_header" secret:"true"`
+}
+
+// TLSConfig is only used for mqtts:// (and other TLS) broker URIs. The
+// system's CA pool is used unless a CA bundle is given, and a client
+// certificate is only sent when both the cert and key are given.
+type TLSConfig struct {
+	CA         string `yaml:"ca" env:"MQTT_TLS_CA" flag:"tls_ca"`
+	Cert       string `yaml:"cert" env:"MQTT_TLS_CERT" flag:"tls_cert"`
+	Key        string `yaml:"key" env:"MQTT_TLS_KEY" flag:"tls_key"`
+	ServerName string `yaml:"server_name" env:"MQTT_TLS_SERVER_NAME" flag:"tls_server_name"`
+	MinVersion string `yaml:"min_version" env:"MQTT_TLS_MIN_VERSION" flag:"tls_min_version"`
+}
+
+// AccessListConfig is used by access_list, cards are written in the
+// encoding the door readers use
+type AccessListConfig struct {
+	DBUri        string `yaml:"db_uri" env:"DB_CONNECTION_URI" flag:"db_uri" secret:"true"`
+	CardEncoding string `yaml:"card_encoding" env:"ACCESS_LIST_CARD_ENCODING" flag:"card_encoding"`
+}
+
+// BrokerConfig is the registry of accounts the broker's ACL is generated
+// for, grouped by the role they play
+type BrokerConfig struct {
+	Doors           []string `yaml:"doors" env:"BROKER_DOORS" flag:"doors"`
+	AccessListUsers []string `yaml:"access_list_users" env:"BROKER_ACCESS_LIST_USERS" flag:"access_list_users"`
+	PorterUsers     []string `yaml:"porter_users" env:"BROKER_PORTER_USERS" flag:"porter_users"`
+	TestUsers       []string `yaml:"test_users" env:"BROKER_TEST_USERS" flag:"test_users"`
+	ACLFile         string   `yaml:"acl_file" env:"BROKER_ACL_FILE" flag:"acl_file"`
+}
+
+type DiaryConfig struct {
+	ClientID            string         `yaml:"client_id" env:"DIARY_CLIENT_ID" flag:"client_id"`
+	Sites               []string       `yaml:"sites" env:"DIARY_SITES" flag:"sites"`
+	SessionExpiry       time.Duration  `yaml:"session_expiry" env:"DIARY_SESSION_EXPIRY" flag:"session_expiry"`
+	CleanStart          bool           `yaml:"clean_start" env:"DIARY_CLEAN_START" flag:"clean_start"`
+	HTTPAddr            string         `yaml:"http_addr" env:"DIARY_HTTP_ADDR" flag:"http_addr"`
+	UnhealthyAfter      time.Duration  `yaml:"unhealthy_after" env:"DIARY_UNHEALTHY_AFTER" flag:"unhealthy_after"`
+	HealthCheckInterval time.Duration  `yaml:"health_check_interval" env:"DIARY_HEALTH_CHECK_INTERVAL" flag:"health_check_interval"`
+	CheckHealthInterval time.Duration  `yaml:"check_health_interval" env:"DIARY_CHECK_HEALTH_INTERVAL" flag:"check_health_interval"`
+	Dedup               DedupConfig    `yaml:"dedup"`
+	Log                 DiaryLogConfig `yaml:"log"`
+}
+
+type DedupConfig struct {
+	Window time.Duration `yaml:"window" env:"DIARY_DEDUP_WINDOW" flag:"dedup_window"`
+	Size   int           `yaml:"size" env:"DIARY_DEDUP_SIZE" flag:"dedup_size"`
+	Mode   string        `yaml:"mode" env:"DIARY_DEDUP_MODE" flag:"dedup_mode"`
+}
+
+type DiaryLogConfig struct {
+	File           string        `yaml:"file" env:"DIARY_LOG_FILE" flag:"log_file"`
+	FileLevel      string        `yaml:"file_level" env:"DIARY_LOG_FILE_LEVEL" flag:"log_file_level"`
+	FileMaxSize    int           `yaml:"file_max_size" env:"DIARY_LOG_FILE_MAX_SIZE" flag:"log_file_max_size"`
+	FileMaxAge     time.Duration `yaml:"file_max_age" env:"DIARY_LOG_FILE_MAX_AGE" flag:"log_file_max_age"`
+	FileMaxBackups int           `yaml:"file_max_backups" env:"DIARY_LOG_FILE_MAX_BACKUPS" flag:"log_file_max_backups"`
+	SyslogAddr     string        `yaml:"syslog_addr" env:"DIARY_SYSLOG_ADDR" flag:"syslog_addr"`
+	SyslogNetwork  string        `yaml:"syslog_network" env:"DIARY_SYSLOG_NETWORK" flag:"syslog_network"`
+	SyslogLevel    string        `yaml:"syslog_level" env:"DIARY_SYSLOG_LEVEL" flag:"syslog_level"`
+}
+
+// MimicConfig sets the starting state of mimic's options. Headless mimic
+// runs without a terminal, swiping each card in turn and writing a
+// transcript of everything it publishes and receives. The door stays
+// unlocked for UnlockDuration after a granted swipe and is held open once
+// it has been open for HeldOpenAfter. A card is locked out for PinLockout
+// after PinAttempts bad PINs in a row.
+type MimicConfig struct {
+	FailHealthCheck bool          `yaml:"fail_health_check" env:"MIMIC_FAIL_HEALTH_CHECK" flag:"fail_health_check"`
+	FailAccessList  bool          `yaml:"fail_access_list" env:"MIMIC_FAIL_ACCESS_LIST" flag:"fail_access_list"`
+	DoorMessage     string        `yaml:"door_message" env:"MIMIC_DOOR_MESSAGE" flag:"door_message"`
+	CardEncoding    string        `yaml:"card_encoding" env:"MIMIC_CARD_ENCODING" flag:"card_encoding"`
+	Headless        bool          `yaml:"headless" env:"MIMIC_HEADLESS" flag:"headless"`
+	Swipes          []string      `yaml:"swipes" env:"MIMIC_SWIPES" flag:"swipe"`
+	SwipeInterval   time.Duration `yaml:"swipe_interval" env:"MIMIC_SWIPE_INTERVAL" flag:"swipe_interval"`
+	SwipeRepeat     bool          `yaml:"swipe_repeat" env:"MIMIC_SWIPE_REPEAT" flag:"swipe_repeat"`
+	Transcript      string        `yaml:"transcript" env:"MIMIC_TRANSCRIPT" flag:"transcript"`
+	Duration        time.Duration `yaml:"duration" env:"MIMIC_DURATION" flag:"duration"`
+	UnlockDuration  time.Duration `yaml:"unlock_duration" env:"MIMIC_UNLOCK_DURATION" flag:"unlock_duration"`
+	HeldOpenAfter   time.Duration `yaml:"held_open_after" env:"MIMIC_HELD_OPEN_AFTER" flag:"held_open_after"`
+	PinAttempts     int           `yaml:"pin_attempts" env:"MIMIC_PIN_ATTEMPTS" flag:"pin_attempts"`
+	PinLockout      time.Duration `yaml:"pin_lockout" env:"MIMIC_PIN_LOCKOUT" flag:"pin_lockout"`
+	FavouritesFile  string        `yaml:"favourites_file" env:"MIMIC_FAVOURITES_FILE" flag:"favourites_file"`
+	Faults          FaultConfig   `yaml:"faults"`
+}
+
+// FaultConfig lists the faults mimic starts with, and how they behave
+// once they're switched on. DisconnectInterval is how often a sudden
+// disconnect happens, StormDelay how long each connection lasts during a
+// reconnect storm and HeldOpenInterval how often the alarm repeats.
+type FaultConfig struct {
+	Enabled            []string      `yaml:"enabled" env:"MIMIC_FAULTS" flag:"fault"`
+	Latency            time.Duration `yaml:"latency" env:"MIMIC_FAULT_LATENCY" flag:"fault_latency"`
+	ClockSkew          time.Duration `yaml:"clock_skew" env:"MIMIC_FAULT_CLOCK_SKEW" flag:"fault_clock_skew"`
+	DisconnectInterval time.Duration `yaml:"disconnect_interval" env:"MIMIC_FAULT_DISCONNECT_INTERVAL" flag:"fault_disconnect_interval"`
+	StormDelay         time.Duration `yaml:"storm_delay" env:"MIMIC_FAULT_STORM_DELAY" flag:"fault_storm_delay"`
+	HeldOpenInterval   time.Duration `yaml:"held_open_interval" env:"MIMIC_FAULT_HELD_OPEN_INTERVAL" flag:"fault_held_open_interval"`
+}
+
+type RPCConfig struct {
+	ClientID string        `yaml:"client_id" env:"RPC_CLIENT_ID" flag:"client_id"`
+	Timeout  time.Duration `yaml:"timeout" env:"RPC_TIMEOUT" flag:"timeout"`
+}
+
+// RecordConfig is used by record, a duration of 0 records until stopped
+type RecordConfig struct {
+	ClientID string        `yaml:"client_id" env:"RECORD_CLIENT_ID" flag:"client_id"`
+	Duration time.Duration `yaml:"duration" env:"RECORD_DURATION" flag:"duration"`
+}
+
+// ReplayConfig is used by replay. Rewrites are written as from=to, client
+// IDs are matched exactly and topics by their start.
+type ReplayConfig struct {
+	ClientID         string   `yaml:"client_id" env:"REPLAY_CLIENT_ID" flag:"client_id"`
+	Speed            float64  `yaml:"speed" env:"REPLAY_SPEED" flag:"speed"`
+	RewriteClientIDs []string `yaml:"rewrite_client_ids" env:"REPLAY_REWRITE_CLIENT_IDS" flag:"rewrite_client_id"`
+	RewriteTopics    []string `yaml:"rewrite_topics" env:"REPLAY_REWRITE_TOPICS" flag:"rewrite_topic"`
+}
+
+// ScenarioConfig is used by mimic run. The timeout applies to every step
+// that waits and doesn't set its own.
+type ScenarioConfig struct {
+	DiaryURL   string        `yaml:"diary_url" env:"SCENARIO_DIARY_URL" flag:"diary_url"`
+	Timeout    time.Duration `yaml:"timeout" env:"SCENARIO_TIMEOUT" flag:"timeout"`
+	Transcript string        `yaml:"transcript" env:"SCENARIO_TRANSCRIPT" flag:"transcript"`
+}
+
+// SimulateConfig describes the fleet of virtual controllers. The
+// intervals are means, each controller's actual timings are random.
+type SimulateConfig struct {
+	Doors              int           `yaml:"doors" env:"SIMULATE_DOORS" flag:"doors"`
+	ClientPrefix       string        `yaml:"client_prefix" env:"SIMULATE_CLIENT_PREFIX" flag:"client_prefix"`
+	SwipeInterval      time.Duration `yaml:"swipe_interval" env:"SIMULATE_SWIPE_INTERVAL" flag:"swipe_interval"`
+	DenyRatio          float64       `yaml:"deny_ratio" env:"SIMULATE_DENY_RATIO" flag:"deny_ratio"`
+	HealthCheckFailure float64       `yaml:"health_check_failure" env:"SIMULATE_HEALTH_CHECK_FAILURE" flag:"health_check_failure"`
+	DisconnectInterval time.Duration `yaml:"disconnect_interval" env:"SIMULATE_DISCONNECT_INTERVAL" flag:"disconnect_interval"`
+	ReconnectDelay     time.Duration `yaml:"reconnect_delay" env:"SIMULATE_RECONNECT_DELAY" flag:"reconnect_delay"`
+	ReportInterval     time.Duration `yaml:"report_interval" env:"SIMULATE_REPORT_INTERVAL" flag:"report_interval"`
+	Duration           time.Duration `yaml:"duration" env:"SIMULATE_DURATION" flag:"duration"`
+	Seed               int           `yaml:"seed" env:"SIMULATE_SEED" flag:"seed"`
+}
+
+type WatchConfig struct {
+	ClientID string `yaml:"client_id" env:"WATCH_CLIENT_ID" flag:"client_id"`
+}
+
+const (
+	DedupModeSuppress = "suppress"
+	DedupModeFlag     = "flag"
+)
+
+func Default() Config {
+	return Config{
+		CredentialHelper: "",
+		MQTT: MQTTConfig{
+			URIs:      []string{},
+			Namespace: mqtt.RootLevel,
+			Username:  "",
+			Password:  "",
+			TLS: TLSConfig{
+				CA:         "",
+				Cert:       "",
+				Key:        "",
+				ServerName: "",
+				MinVersion: "1.2",
+			},
+			WebSocket: WebSocketConfig{
+				Path:    "",
+				Headers: []string{},
+			},
+		},
+		AccessList: AccessListConfig{
+			DBUri:        "",
+			CardEncoding: "decimal10",
+		},
+		Broker: BrokerConfig{
+			Doors:           []string{},
+			AccessListUsers: []string{"access_list"},
+			PorterUsers:     []string{"porter"},
+			TestUsers:       []string{},
+			ACLFile:         "",
+		},
+		Diary: DiaryConfig{
+			ClientID:            "",
+			Sites:               []string{},
+			SessionExpiry:       time.Hour,
+			CleanStart:          false,
+			HTTPAddr:            "127.0.0.1:8080",
+			UnhealthyAfter:      time.Minute * 5,
+			HealthCheckInterval: time.Minute * 2,
+			CheckHealthInterval: time.Second * 15,
+			Dedup: DedupConfig{
+				Window: time.Minute * 5,
+				Size:   4096,
+				Mode:   DedupModeSuppress,
+			},
+			Log: DiaryLogConfig{
+				File:           "",
+				FileLevel:      "info",
+				FileMaxSize:    10,
+				FileMaxAge:     time.Hour * 24 * 14,
+				FileMaxBackups: 10,
+				SyslogAddr:     "",
+				SyslogNetwork:  "udp",
+				SyslogLevel:    "warn",
+			},
+		},
+		Mimic: MimicConfig{
+			FailHealthCheck: false,
+			FailAccessList:  false,
+			DoorMessage:     "card_list",
+			CardEncoding:    "decimal10",
+			Headless:        false,
+			Swipes:          []string{},
+			SwipeInterval:   time.Second * 10,
+			SwipeRepeat:     false,
+			Transcript:      "",
+			Duration:        0,
+			UnlockDuration:  time.Second * 8,
+			HeldOpenAfter:   time.Second * 30,
+			PinAttempts:     3,
+			PinLockout:      time.Minute * 5,
+			FavouritesFile:  "",
+			Faults: FaultConfig{
+				Enabled:            []string{},
+				Latency:            time.Second * 5,
+				ClockSkew:          -time.Minute * 10,
+				DisconnectInterval: time.Minute,
+				StormDelay:         time.Second,
+				HeldOpenInterval:   time.Second * 15,
+			},
+		},
+		Record: RecordConfig{
+			ClientID: "",
+			Duration: 0,
+		},
+		Replay: ReplayConfig{
+			ClientID:         "",
+			Speed:            1,
+			RewriteClientIDs: []string{},
+			RewriteTopics:    []string{},
+		},
+		RPC: RPCConfig{
+			ClientID: "",
+			Timeout:  time.Second * 5,
+		},
+		Scenario: ScenarioConfig{
+			DiaryURL:   "http://127.0.0.1:8080",
+			Timeout:    time.Second * 10,
+			Transcript: "",
+		},
+		Simulate: SimulateConfig{
+			Doors:              5,
+			ClientPrefix:       "sim_door_",
+			SwipeInterval:      time.Second * 30,
+			DenyRatio:          0.1,
+			HealthCheckFailure: 0,
+			DisconnectInterval: 0,
+			ReconnectDelay:     time.Second * 5,
+			ReportInterval:     time.Second * 10,
+			Duration:           0,
+			Seed:               0,
+		},
+		Watch: WatchConfig{
+			ClientID: "",
+		},
+	}
+}
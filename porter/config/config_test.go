@@ -0,0 +1,52 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// envNames lists the env tags of every field under value's type
+func envNames(value reflect.Type) []string {
+	names := make([]string, 0)
+	for index := 0; index < value.NumField(); index++ {
+		field := value.Field(index)
+		if field.Type.Kind() == reflect.Struct {
+			names = append(names, envNames(field.Type)...)
+			continue
+		}
+		if env := field.Tag.Get("env"); env != "" {
+			names = append(names, env)
+		}
+	}
+	return names
+}
+
+func TestCommandEnvPrefixes(t *testing.T) {
+	// Names kept from before the variables were prefixed
+	unprefixed := map[string]bool{"DB_CONNECTION_URI": true}
+
+	config := reflect.TypeOf(Config{})
+	for index := 0; index < config.NumField(); index++ {
+		section := config.Field(index)
+		if section.Tag.Get("command") == "" {
+			continue
+		}
+		prefix := strings.ToUpper(section.Tag.Get("yaml")) + "_"
+		for _, name := range envNames(section.Type) {
+			if !strings.HasPrefix(name, prefix) && !unprefixed[name] {
+				t.Errorf("%s: %s doesn't start with %s", section.Name, name, prefix)
+			}
+		}
+	}
+}
+
+func TestEnvNamesAreUnique(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, name := range envNames(reflect.TypeOf(Config{})) {
+		if seen[name] {
+			t.Errorf("%s is used more than once", name)
+		}
+		seen[name] = true
+	}
+}
@@ -0,0 +1,258 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+const fileName = "config.yaml"
+
+// setting is a single leaf value of the config along with the sources
+// it can be read from
+type setting struct {
+	value   reflect.Value
+	path    string
+	command string
+	env     string
+	flag    string
+	secret  bool
+}
+
+func walk(value reflect.Value, path string, command string, settings []setting) []setting {
+	for index := 0; index < value.NumField(); index++ {
+		field := value.Type().Field(index)
+		fieldValue := value.Field(index)
+
+		key := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		fieldPath := key
+		if path != "" {
+			fieldPath = path + "." + key
+		}
+
+		fieldCommand := command
+		if tagged := field.Tag.Get("command"); tagged != "" {
+			fieldCommand = tagged
+		}
+
+		if fieldValue.Kind() == reflect.Struct {
+			settings = walk(fieldValue, fieldPath, fieldCommand, settings)
+			continue
+		}
+
+		settings = append(settings, setting{
+			value:   fieldValue,
+			path:    fieldPath,
+			command: fieldCommand,
+			env:     field.Tag.Get("env"),
+			flag:    field.Tag.Get("flag"),
+			secret:  field.Tag.Get("secret") == "true",
+		})
+	}
+	return settings
+}
+
+func settingsOf(cfg *Config) []setting {
+	return walk(reflect.ValueOf(cfg).Elem(), "", "", make([]setting, 0))
+}
+
+func setFromString(value reflect.Value, raw string) error {
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(raw)
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		value.SetBool(parsed)
+	case reflect.Int, reflect.Int64:
+		if value.Type() == reflect.TypeOf(time.Duration(0)) {
+			parsed, err := time.ParseDuration(raw)
+			if err != nil {
+				return err
+			}
+			value.SetInt(int64(parsed))
+			return nil
+		}
+		parsed, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return err
+		}
+		value.SetInt(parsed)
+	case reflect.Float64:
+		parsed, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		value.SetFloat(parsed)
+	case reflect.Slice:
+		items := make([]string, 0)
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		value.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("Unsupported config type: %s", value.Type())
+	}
+	return nil
+}
+
+// SearchPaths lists where the config file is looked for, the first file
+// found is used
+func SearchPaths() []string {
+	paths := make([]string, 0)
+
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			configHome = filepath.Join(home, ".config")
+		}
+	}
+	if configHome != "" {
+		paths = append(paths, filepath.Join(configHome, "porter", fileName))
+	}
+
+	configDirs := os.Getenv("XDG_CONFIG_DIRS")
+	if configDirs == "" {
+		configDirs = "/etc/xdg"
+	}
+	for _, dir := range filepath.SplitList(configDirs) {
+		paths = append(paths, filepath.Join(dir, "porter", fileName))
+	}
+
+	return append(paths, filepath.Join("/etc/porter", fileName))
+}
+
+// DataPath is where porter keeps a file between runs, under
+// $XDG_DATA_HOME/porter. It's empty when there's no home directory.
+func DataPath(name string) string {
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dataHome = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dataHome, "porter", name)
+}
+
+func Find() string {
+	for _, path := range SearchPaths() {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+func readFile(cfg *Config, path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	// An empty file is fine, it just doesn't change anything
+	if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("Failed to parse %s: %w", path, err)
+	}
+	return nil
+}
+
+func applyEnv(cfg *Config) error {
+	for _, setting := range settingsOf(cfg) {
+		if setting.env == "" {
+			continue
+		}
+		if setting.secret {
+			secret, found, err := secretFromFiles(setting.env)
+			if err != nil {
+				return err
+			}
+			if found {
+				if err := setFromString(setting.value, secret); err != nil {
+					return fmt.Errorf("%s is invalid: %w", setting.env, err)
+				}
+				continue
+			}
+		}
+		if result, found := os.LookupEnv(setting.env); found {
+			if err := setFromString(setting.value, result); err != nil {
+				return fmt.Errorf("%s is invalid: %w", setting.env, err)
+			}
+		}
+	}
+	return nil
+}
+
+func applyFlags(cfg *Config, command string, flags *pflag.FlagSet) error {
+	if flags == nil {
+		return nil
+	}
+	for _, setting := range settingsOf(cfg) {
+		if setting.flag == "" || (setting.command != "" && setting.command != command) {
+			continue
+		}
+		flag := flags.Lookup(setting.flag)
+		if flag == nil || !flag.Changed {
+			continue
+		}
+		if sliceValue, ok := flag.Value.(pflag.SliceValue); ok {
+			setting.value.Set(reflect.ValueOf(sliceValue.GetSlice()))
+			continue
+		}
+		if err := setFromString(setting.value, flag.Value.String()); err != nil {
+			return fmt.Errorf("--%s is invalid: %w", setting.flag, err)
+		}
+	}
+	return nil
+}
+
+// Load builds the effective config for a command. Flags win over
+// environment variables, which win over the config file, which wins over
+// the defaults. Secrets that are still empty are then asked of the
+// credential helper. When path is empty the search paths are used, and it's not
+// an error for there to be no config file at all. The path of the file
+// that was read is returned along with the config.
+func Load(path string, command string, flags *pflag.FlagSet) (Config, string, error) {
+	cfg := Default()
+
+	if path == "" {
+		path = Find()
+	}
+
+	if path != "" {
+		if err := readFile(&cfg, path); err != nil {
+			return cfg, path, err
+		}
+	}
+
+	if err := applyEnv(&cfg); err != nil {
+		return cfg, path, err
+	}
+
+	if err := applyFlags(&cfg, command, flags); err != nil {
+		return cfg, path, err
+	}
+
+	if err := applyCredentialHelper(&cfg, command); err != nil {
+		return cfg, path, err
+	}
+
+	return cfg, path, nil
+}
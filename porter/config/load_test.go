@@ -0,0 +1,196 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// unsetEnv clears the variables for the test, they're put back after it
+func unsetEnv(t *testing.T, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	const file = `
+mqtt:
+  uris: [mqtt://file:1883]
+  username: file_user
+diary:
+  unhealthy_after: 2m
+`
+
+	tests := []struct {
+		name           string
+		file           string
+		env            map[string]string
+		args           []string
+		command        string
+		username       string
+		uris           []string
+		unhealthyAfter time.Duration
+	}{
+		{
+			name:           "defaults",
+			command:        "diary",
+			username:       "",
+			uris:           []string{},
+			unhealthyAfter: 5 * time.Minute,
+		},
+		{
+			name:           "file over defaults",
+			file:           file,
+			command:        "diary",
+			username:       "file_user",
+			uris:           []string{"mqtt://file:1883"},
+			unhealthyAfter: 2 * time.Minute,
+		},
+		{
+			name:           "env over file",
+			file:           file,
+			env:            map[string]string{"MQTT_USER": "env_user", "MQTT_URI": "mqtt://env:1883,mqtt://backup:1883", "DIARY_UNHEALTHY_AFTER": "3m"},
+			command:        "diary",
+			username:       "env_user",
+			uris:           []string{"mqtt://env:1883", "mqtt://backup:1883"},
+			unhealthyAfter: 3 * time.Minute,
+		},
+		{
+			name:           "flags over env",
+			file:           file,
+			env:            map[string]string{"MQTT_USER": "env_user", "MQTT_URI": "mqtt://env:1883", "DIARY_UNHEALTHY_AFTER": "3m"},
+			args:           []string{"--username", "flag_user", "--mqtt_uri", "mqtt://flag:1883", "--unhealthy_after", "4m"},
+			command:        "diary",
+			username:       "flag_user",
+			uris:           []string{"mqtt://flag:1883"},
+			unhealthyAfter: 4 * time.Minute,
+		},
+		{
+			name:           "flags left at their defaults don't override",
+			file:           file,
+			env:            map[string]string{"MQTT_USER": "env_user"},
+			command:        "diary",
+			username:       "env_user",
+			uris:           []string{"mqtt://file:1883"},
+			unhealthyAfter: 2 * time.Minute,
+		},
+		{
+			name:           "flags only apply to their own command",
+			file:           file,
+			args:           []string{"--username", "flag_user", "--unhealthy_after", "4m"},
+			command:        "watch",
+			username:       "flag_user",
+			uris:           []string{"mqtt://file:1883"},
+			unhealthyAfter: 2 * time.Minute,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			unsetEnv(t, "MQTT_USER", "MQTT_URI", "DIARY_UNHEALTHY_AFTER", "PORTER_CREDENTIAL_HELPER", credentialsDirectoryEnv)
+			for name, value := range test.env {
+				t.Setenv(name, value)
+			}
+
+			path := filepath.Join(t.TempDir(), fileName)
+			if err := os.WriteFile(path, []byte(test.file), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			defaults := Default()
+			flags := pflag.NewFlagSet(test.command, pflag.ContinueOnError)
+			flags.String("username", defaults.MQTT.Username, "")
+			flags.StringSlice("mqtt_uri", defaults.MQTT.URIs, "")
+			flags.Duration("unhealthy_after", defaults.Diary.UnhealthyAfter, "")
+			if err := flags.Parse(test.args); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg, loaded, err := Load(path, test.command, flags)
+			if err != nil {
+				t.Fatalf("Load failed: %v", err)
+			}
+			if loaded != path {
+				t.Errorf("loaded %s, want %s", loaded, path)
+			}
+			if cfg.MQTT.Username != test.username {
+				t.Errorf("username: got %q, want %q", cfg.MQTT.Username, test.username)
+			}
+			if !slices.Equal(cfg.MQTT.URIs, test.uris) {
+				t.Errorf("uris: got %v, want %v", cfg.MQTT.URIs, test.uris)
+			}
+			if cfg.Diary.UnhealthyAfter != test.unhealthyAfter {
+				t.Errorf("unhealthy_after: got %s, want %s", cfg.Diary.UnhealthyAfter, test.unhealthyAfter)
+			}
+		})
+	}
+}
+
+func TestLoadRejectsInvalidValues(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		env  map[string]string
+	}{
+		{name: "unknown key in the file", file: "mqtt:\n  user: someone\n"},
+		{name: "invalid duration in the environment", env: map[string]string{"DIARY_UNHEALTHY_AFTER": "soon"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			unsetEnv(t, "DIARY_UNHEALTHY_AFTER", "PORTER_CREDENTIAL_HELPER", credentialsDirectoryEnv)
+			for name, value := range test.env {
+				t.Setenv(name, value)
+			}
+			path := filepath.Join(t.TempDir(), fileName)
+			if err := os.WriteFile(path, []byte(test.file), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, _, err := Load(path, "diary", nil); err == nil {
+				t.Error("Load succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestLoadCredentialHelper(t *testing.T) {
+	unsetEnv(t, "MQTT_PASSWORD", "MQTT_WS_HEADERS", "DB_CONNECTION_URI", credentialsDirectoryEnv)
+
+	// The helper only knows the MQTT password and fails for anything else
+	helper := filepath.Join(t.TempDir(), "helper")
+	script := "#!/bin/sh\n[ \"$1\" = mqtt.password ] || exit 1\necho hunter2\n"
+	if err := os.WriteFile(helper, []byte(script), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PORTER_CREDENTIAL_HELPER", helper)
+
+	// Headers left empty in the file are still unset
+	path := filepath.Join(t.TempDir(), fileName)
+	if err := os.WriteFile(path, []byte("mqtt:\n  websocket:\n    headers:\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, _, err := Load(path, "watch", nil)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.MQTT.Password != "hunter2" {
+		t.Errorf("password: got %q, want %q", cfg.MQTT.Password, "hunter2")
+	}
+	if len(cfg.MQTT.WebSocket.Headers) != 0 {
+		t.Errorf("websocket headers: got %v, want none", cfg.MQTT.WebSocket.Headers)
+	}
+
+	// access_list's database URI is a secret the helper doesn't know
+	if _, _, err := Load(path, "access_list", nil); err == nil {
+		t.Error("Load succeeded for access_list, want the helper's error")
+	}
+}
@@ -0,0 +1,123 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Secrets passed as flags show up in ps and secrets in environment
+// variables end up in crash dumps, so every secret can also be read from
+// a file instead:
+//
+//   - <ENV>_FILE: path of a file holding the secret (docker/podman secrets)
+//   - $CREDENTIALS_DIRECTORY/<env>: a systemd LoadCredential= credential
+//     named after the lower cased environment variable
+//
+// Both sit at the same level of precedence as the environment variable
+// itself. Secrets that are still empty once every source has been applied
+// are asked of the credential helper, if one is configured.
+
+const credentialsDirectoryEnv = "CREDENTIALS_DIRECTORY"
+
+var credentialHelperTimeout = time.Second * 10
+
+func readSecretFile(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	// Files written by editors or echo almost always end with a new line
+	// that was never meant to be part of the secret
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
+
+// secretFromFiles looks up a secret in the *_FILE variable and the
+// systemd credentials directory. found is false when neither is set.
+func secretFromFiles(env string) (string, bool, error) {
+	if path, found := os.LookupEnv(env + "_FILE"); found {
+		if _, set := os.LookupEnv(env); set {
+			return "", false, fmt.Errorf("Only one of %s and %s_FILE can be set", env, env)
+		}
+		secret, err := readSecretFile(path)
+		if err != nil {
+			return "", false, fmt.Errorf("%s_FILE is invalid: %w", env, err)
+		}
+		return secret, true, nil
+	}
+
+	// The environment variable itself is more specific than a directory
+	// shared by every secret
+	if _, set := os.LookupEnv(env); set {
+		return "", false, nil
+	}
+
+	if directory := os.Getenv(credentialsDirectoryEnv); directory != "" {
+		path := filepath.Join(directory, strings.ToLower(env))
+		secret, err := readSecretFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			return "", false, nil
+		}
+		if err != nil {
+			return "", false, fmt.Errorf("Failed to read credential %s: %w", path, err)
+		}
+		return secret, true, nil
+	}
+
+	return "", false, nil
+}
+
+// runCredentialHelper runs the helper with the secret's config key (e.g.
+// mqtt.password) as its last argument and uses whatever it prints. The
+// helper is split on spaces rather than run through a shell.
+func runCredentialHelper(helper string, key string) (string, error) {
+	fields := strings.Fields(helper)
+	if len(fields) == 0 {
+		return "", nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), credentialHelperTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	command := exec.CommandContext(ctx, fields[0], append(fields[1:], key)...)
+	command.Stdout = &stdout
+	command.Stderr = &stderr
+	if err := command.Run(); err != nil {
+		return "", fmt.Errorf("Credential helper failed for %s: %w: %s", key, err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimRight(stdout.String(), "\r\n"), nil
+}
+
+// applyCredentialHelper fills the empty secrets used by the command. The
+// helper prints a single value, so lists like the websocket headers are
+// left alone, most setups don't have any and a helper shouldn't be asked
+// for them on every command.
+func applyCredentialHelper(cfg *Config, command string) error {
+	if cfg.CredentialHelper == "" {
+		return nil
+	}
+	for _, setting := range settingsOf(cfg) {
+		if !setting.secret || !setting.value.IsZero() || setting.value.Kind() == reflect.Slice {
+			continue
+		}
+		if setting.command != "" && setting.command != command {
+			continue
+		}
+		secret, err := runCredentialHelper(cfg.CredentialHelper, setting.path)
+		if err != nil {
+			return err
+		}
+		if err := setFromString(setting.value, secret); err != nil {
+			return err
+		}
+	}
+	return nil
+}
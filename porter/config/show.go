@@ -0,0 +1,22 @@
+package config
+
+import (
+	"gopkg.in/yaml.v3"
+)
+
+const redacted = "********"
+
+// Redacted returns a copy of the config with every secret that has been
+// set hidden
+func (cfg Config) Redacted() Config {
+	for _, setting := range settingsOf(&cfg) {
+		if setting.secret && !setting.value.IsZero() {
+			setFromString(setting.value, redacted)
+		}
+	}
+	return cfg
+}
+
+func (cfg Config) YAML() ([]byte, error) {
+	return yaml.Marshal(cfg)
+}
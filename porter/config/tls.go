@@ -0,0 +1,55 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// Build creates the tls.Config used to connect to the broker. The files are
+// read once here so a bad path is reported at start up rather than on
+// every reconnect.
+func (tlsConfig TLSConfig) Build() (*tls.Config, error) {
+	minVersion, found := tlsVersions[tlsConfig.MinVersion]
+	if !found {
+		return nil, fmt.Errorf("Unknown TLS version %s, expected 1.0, 1.1, 1.2 or 1.3", tlsConfig.MinVersion)
+	}
+
+	built := &tls.Config{
+		MinVersion: minVersion,
+		ServerName: tlsConfig.ServerName,
+	}
+
+	if tlsConfig.CA != "" {
+		bundle, err := os.ReadFile(tlsConfig.CA)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read CA bundle: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(bundle) {
+			return nil, fmt.Errorf("No certificates found in CA bundle %s", tlsConfig.CA)
+		}
+		built.RootCAs = pool
+	}
+
+	if (tlsConfig.Cert == "") != (tlsConfig.Key == "") {
+		return nil, fmt.Errorf("Both a client cert and key are needed for client certificate authentication")
+	}
+	if tlsConfig.Cert != "" {
+		certificate, err := tls.LoadX509KeyPair(tlsConfig.Cert, tlsConfig.Key)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to load client certificate: %w", err)
+		}
+		built.Certificates = []tls.Certificate{certificate}
+	}
+
+	return built, nil
+}
@@ -0,0 +1,234 @@
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type certificate struct {
+	cert     *x509.Certificate
+	key      *ecdsa.PrivateKey
+	certPath string
+	keyPath  string
+}
+
+// issue writes a certificate signed by parent, or a self-signed CA when
+// parent is nil, the same as gen_certs.sh does with openssl
+func issue(t *testing.T, name string, parent *certificate) certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	directory := t.TempDir()
+	issued := certificate{
+		cert:     cert,
+		key:      key,
+		certPath: filepath.Join(directory, name+".crt"),
+		keyPath:  filepath.Join(directory, name+".key"),
+	}
+	writePEM(t, issued.certPath, "CERTIFICATE", der)
+	writePEM(t, issued.keyPath, "EC PRIVATE KEY", keyDer)
+	return issued
+}
+
+func writePEM(t *testing.T, path string, blockType string, der []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTLSConfigBuild(t *testing.T) {
+	ca := issue(t, "ca", nil)
+	client := issue(t, "door_one", &ca)
+	other := issue(t, "door_two", &ca)
+
+	notPEM := filepath.Join(t.TempDir(), "ca.crt")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		config  TLSConfig
+		wantErr bool
+	}{
+		{name: "defaults", config: TLSConfig{MinVersion: "1.2"}},
+		{name: "private CA", config: TLSConfig{MinVersion: "1.2", CA: ca.certPath}},
+		{name: "client certificate", config: TLSConfig{MinVersion: "1.3", CA: ca.certPath, Cert: client.certPath, Key: client.keyPath, ServerName: "broker"}},
+		{name: "unknown TLS version", config: TLSConfig{MinVersion: "1.4"}, wantErr: true},
+		{name: "missing CA bundle", config: TLSConfig{MinVersion: "1.2", CA: filepath.Join(t.TempDir(), "missing.crt")}, wantErr: true},
+		{name: "CA bundle without certificates", config: TLSConfig{MinVersion: "1.2", CA: notPEM}, wantErr: true},
+		{name: "cert without a key", config: TLSConfig{MinVersion: "1.2", Cert: client.certPath}, wantErr: true},
+		{name: "key without a cert", config: TLSConfig{MinVersion: "1.2", Key: client.keyPath}, wantErr: true},
+		{name: "missing client cert", config: TLSConfig{MinVersion: "1.2", Cert: filepath.Join(t.TempDir(), "missing.crt"), Key: client.keyPath}, wantErr: true},
+		{name: "key of another cert", config: TLSConfig{MinVersion: "1.2", Cert: client.certPath, Key: other.keyPath}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			built, err := test.config.Build()
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("Build succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Build failed: %v", err)
+			}
+
+			// There's deliberately no way to turn verification off
+			if built.InsecureSkipVerify {
+				t.Error("InsecureSkipVerify is set")
+			}
+			if built.MinVersion != tlsVersions[test.config.MinVersion] {
+				t.Errorf("MinVersion: got %x, want %x", built.MinVersion, tlsVersions[test.config.MinVersion])
+			}
+			if built.ServerName != test.config.ServerName {
+				t.Errorf("ServerName: got %q, want %q", built.ServerName, test.config.ServerName)
+			}
+			if (built.RootCAs != nil) != (test.config.CA != "") {
+				t.Errorf("RootCAs set: got %t, want %t", built.RootCAs != nil, test.config.CA != "")
+			}
+			if wantCerts := len(test.config.Cert) > 0; (len(built.Certificates) == 1) != wantCerts {
+				t.Errorf("client certificates: got %d, want %t", len(built.Certificates), wantCerts)
+			}
+		})
+	}
+}
+
+// handshake connects with the built config to a server that requires a
+// client certificate signed by ca
+func handshake(t *testing.T, ca certificate, server certificate, config TLSConfig) error {
+	t.Helper()
+
+	serverCert, err := tls.LoadX509KeyPair(server.certPath, server.keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.cert)
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.(*tls.Conn).Handshake()
+		conn.Read(make([]byte, 1))
+	}()
+
+	built, err := config.Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	conn, err := tls.Dial("tcp", listener.Addr().String(), built)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	// The server only rejects the client certificate after the client's
+	// side of the handshake is done, reading shows whether it did
+	conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	if _, err := conn.Read(make([]byte, 1)); err != nil && !isTimeout(err) {
+		return err
+	}
+	return nil
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+func TestTLSConfigHandshake(t *testing.T) {
+	ca := issue(t, "ca", nil)
+	broker := issue(t, "broker", &ca)
+	client := issue(t, "door_one", &ca)
+	otherCA := issue(t, "other_ca", nil)
+	stranger := issue(t, "stranger", &otherCA)
+
+	tests := []struct {
+		name    string
+		config  TLSConfig
+		wantErr bool
+	}{
+		{name: "trusted broker and client", config: TLSConfig{MinVersion: "1.2", CA: ca.certPath, Cert: client.certPath, Key: client.keyPath, ServerName: "broker"}},
+		{name: "broker from another CA", config: TLSConfig{MinVersion: "1.2", CA: otherCA.certPath, Cert: client.certPath, Key: client.keyPath, ServerName: "broker"}, wantErr: true},
+		{name: "server name mismatch", config: TLSConfig{MinVersion: "1.2", CA: ca.certPath, Cert: client.certPath, Key: client.keyPath, ServerName: "elsewhere"}, wantErr: true},
+		{name: "no client certificate", config: TLSConfig{MinVersion: "1.2", CA: ca.certPath, ServerName: "broker"}, wantErr: true},
+		{name: "client from another CA", config: TLSConfig{MinVersion: "1.2", CA: ca.certPath, Cert: stranger.certPath, Key: stranger.keyPath, ServerName: "broker"}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := handshake(t, ca, broker, test.config)
+			if test.wantErr && err == nil {
+				t.Error("Handshake succeeded, want an error")
+			}
+			if !test.wantErr && err != nil {
+				t.Errorf("Handshake failed: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,22 @@
+package config
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Header parses the "Name: value" headers sent when connecting to the
+// broker over a websocket
+func (webSocketConfig WebSocketConfig) Header() (http.Header, error) {
+	header := make(http.Header, len(webSocketConfig.Headers))
+	for _, raw := range webSocketConfig.Headers {
+		name, value, found := strings.Cut(raw, ":")
+		name = strings.TrimSpace(name)
+		if !found || name == "" {
+			return nil, fmt.Errorf("Websocket header must look like \"Name: value\", got %q", raw)
+		}
+		header.Add(name, strings.TrimSpace(value))
+	}
+	return header, nil
+}
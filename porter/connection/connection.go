@@ -0,0 +1,253 @@
+package connection
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/eclipse/paho.golang/autopaho"
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// Every connection to the broker shares the same keep alive and
+// reconnect policy so the doors see porter's commands behave the same way
+const (
+	KeepAlive         uint16 = 20
+	ConnectTimeout           = time.Second * 10
+	DefaultRetryDelay        = time.Second * 5
+)
+
+var ErrServerDisconnect = errors.New("Disconnected from MQTT broker")
+
+// DisconnectError is passed to OnConnectionDown when the broker sends a
+// DISCONNECT, errors.Is matches it against ErrServerDisconnect
+type DisconnectError struct {
+	ReasonCode byte
+	Reason     string
+}
+
+func (err DisconnectError) Error() string {
+	if err.Reason == "" {
+		return fmt.Sprintf("%v (reason code %d)", ErrServerDisconnect, err.ReasonCode)
+	}
+	return fmt.Sprintf("%v: %s (reason code %d)", ErrServerDisconnect, err.Reason, err.ReasonCode)
+}
+
+func (err DisconnectError) Is(target error) bool {
+	return target == ErrServerDisconnect
+}
+
+type Options struct {
+	// URIs are tried in order whenever porter (re)connects, the first
+	// broker that accepts the connection is used. The backup brokers are
+	// only used while the ones before them are down.
+	URIs      []string
+	Username  string
+	Password  string
+	ClientID  string
+	Transport Transport
+
+	CleanStart    bool
+	SessionExpiry time.Duration
+	// RetryDelay is how long to wait after every broker has been tried,
+	// defaults to DefaultRetryDelay
+	RetryDelay time.Duration
+
+	// Subscriptions are made every time the connection comes up. The
+	// broker forgets them whenever it doesn't keep the session, so they
+	// can't just be made once.
+	Subscriptions []paho.SubscribeOptions
+
+	// OnConnect is called as soon as the broker accepts the connection,
+	// before the subscriptions are made. Messages the broker queued for
+	// the session can arrive from then on.
+	OnConnect func(*paho.Connack)
+	// OnConnectionUp is called after the subscriptions have been made
+	// along with the broker that was connected to
+	OnConnectionUp func(*autopaho.ConnectionManager, *paho.Connack, *url.URL)
+	// OnConnectionDown is called when a connection attempt fails, the
+	// client errors or the broker disconnects
+	OnConnectionDown  func(error)
+	OnPublishReceived func(*paho.Publish)
+
+	// Logger defaults to the global logger. The TUIs use a disabled logger
+	// as writing to stderr would draw over them.
+	Logger *zerolog.Logger
+}
+
+func ParseURIs(uris []string) ([]*url.URL, error) {
+	if len(uris) == 0 {
+		return nil, errors.New("No MQTT broker URI given")
+	}
+
+	serverUrls := make([]*url.URL, 0, len(uris))
+	for _, uri := range uris {
+		serverUrl, err := url.Parse(uri)
+		if err != nil {
+			return nil, err
+		}
+		serverUrls = append(serverUrls, serverUrl)
+	}
+	return serverUrls, nil
+}
+
+func (options Options) logger() *zerolog.Logger {
+	if options.Logger != nil {
+		return options.Logger
+	}
+	return &log.Logger
+}
+
+func (options Options) connectionDown(err error) {
+	if options.OnConnectionDown != nil {
+		options.OnConnectionDown(err)
+	}
+}
+
+func (options Options) subscribe(ctx context.Context, connectionManager *autopaho.ConnectionManager) {
+	if len(options.Subscriptions) == 0 {
+		return
+	}
+
+	logger := options.logger()
+	if _, err := connectionManager.Subscribe(ctx, &paho.Subscribe{
+		Subscriptions: options.Subscriptions,
+	}); err != nil {
+		logger.Error().
+			Str("error", err.Error()).
+			Str("event", "MQTTSubscribe").
+			Str("client_id", options.ClientID).
+			Msg(fmt.Sprintf("MQTT failed to subscribe: %v", err))
+		return
+	}
+
+	topics := make([]string, 0, len(options.Subscriptions))
+	for _, subscription := range options.Subscriptions {
+		topics = append(topics, subscription.Topic)
+	}
+	logger.Debug().
+		Str("event", "MQTTSubscribe").
+		Str("client_id", options.ClientID).
+		Strs("topics", topics).
+		Msg("Subscribed to topics")
+}
+
+// ClientConfig builds the autopaho config for the options
+func (options Options) ClientConfig(ctx context.Context) (autopaho.ClientConfig, error) {
+	serverUrls, err := ParseURIs(options.URIs)
+	if err != nil {
+		return autopaho.ClientConfig{}, err
+	}
+	options.Transport.applyPath(serverUrls)
+
+	retryDelay := options.RetryDelay
+	if retryDelay == 0 {
+		retryDelay = DefaultRetryDelay
+	}
+
+	logger := options.logger()
+
+	// autopaho doesn't say which of the brokers it connected to, but it
+	// builds the CONNECT packet as soon as it has a network connection
+	// to one of them
+	var brokerMu sync.Mutex
+	var broker *url.URL
+
+	onPublishReceived := make([]func(paho.PublishReceived) (bool, error), 0)
+	if options.OnPublishReceived != nil {
+		onPublishReceived = append(onPublishReceived, func(publishReceived paho.PublishReceived) (bool, error) {
+			options.OnPublishReceived(publishReceived.Packet)
+			return true, nil
+		})
+	}
+
+	return autopaho.ClientConfig{
+		ServerUrls:                    serverUrls,
+		TlsCfg:                        options.Transport.TLS,
+		WebSocketCfg:                  options.Transport.webSocketConfig(),
+		ConnectUsername:               options.Username,
+		ConnectPassword:               []byte(options.Password),
+		KeepAlive:                     KeepAlive,
+		CleanStartOnInitialConnection: options.CleanStart,
+		SessionExpiryInterval:         uint32(options.SessionExpiry.Seconds()),
+		ConnectRetryDelay:             retryDelay,
+		ConnectTimeout:                ConnectTimeout,
+		ConnectPacketBuilder: func(connect *paho.Connect, serverUrl *url.URL) *paho.Connect {
+			brokerMu.Lock()
+			broker = serverUrl
+			brokerMu.Unlock()
+
+			logger.Debug().
+				Str("event", "ConnectAttempt").
+				Str("broker", serverUrl.Redacted()).
+				Str("client_id", options.ClientID).
+				Msg("Connecting to MQTT broker")
+			return connect
+		},
+		OnConnectionUp: func(connectionManager *autopaho.ConnectionManager, connectionAck *paho.Connack) {
+			brokerMu.Lock()
+			connectedBroker := broker
+			brokerMu.Unlock()
+
+			responseInfo := ""
+			if connectionAck.Properties != nil {
+				responseInfo = connectionAck.Properties.ResponseInfo
+			}
+			logger.Info().
+				Str("event", "OnConnectionUp").
+				Str("response", responseInfo).
+				Str("broker", connectedBroker.Redacted()).
+				Str("client_id", options.ClientID).
+				Bool("session_present", connectionAck.SessionPresent).
+				Msg(fmt.Sprintf("Connected to MQTT broker %s", connectedBroker.Redacted()))
+
+			if options.OnConnect != nil {
+				options.OnConnect(connectionAck)
+			}
+			options.subscribe(ctx, connectionManager)
+
+			if options.OnConnectionUp != nil {
+				options.OnConnectionUp(connectionManager, connectionAck, connectedBroker)
+			}
+		},
+		OnConnectError: func(err error) {
+			logger.Error().
+				Str("error", err.Error()).
+				Str("event", "OnConnectError").
+				Str("client_id", options.ClientID).
+				Msg(fmt.Sprintf("MQTT Connection error: %v", err))
+			options.connectionDown(err)
+		},
+		ClientConfig: paho.ClientConfig{
+			ClientID:          options.ClientID,
+			OnPublishReceived: onPublishReceived,
+			OnClientError: func(err error) {
+				logger.Error().
+					Str("error", err.Error()).
+					Str("event", "OnClientError").
+					Str("client_id", options.ClientID).
+					Msg(fmt.Sprintf("MQTT Client error: %v", err))
+				options.connectionDown(err)
+			},
+			OnServerDisconnect: func(disconnect *paho.Disconnect) {
+				err := DisconnectError{ReasonCode: disconnect.ReasonCode}
+				if disconnect.Properties != nil {
+					err.Reason = disconnect.Properties.ReasonString
+				}
+				logger.Warn().
+					Str("error", err.Error()).
+					Str("reason", err.Reason).
+					Uint8("reason_code", err.ReasonCode).
+					Str("event", "OnServerDisconnect").
+					Str("client_id", options.ClientID).
+					Msg(fmt.Sprintf("MQTT client disconnect: %v", err))
+				options.connectionDown(err)
+			},
+		},
+	}, nil
+}
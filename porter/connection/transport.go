@@ -0,0 +1,49 @@
+package connection
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/eclipse/paho.golang/autopaho"
+)
+
+// Transport is how porter reaches the brokers, as opposed to who it
+// connects as
+type Transport struct {
+	TLS *tls.Config
+	// WebSocketPath is used by ws:// and wss:// URIs that don't have a
+	// path of their own
+	WebSocketPath string
+	// WebSocketHeaders are sent with every websocket upgrade request, e.g.
+	// the auth token a reverse proxy expects
+	WebSocketHeaders http.Header
+}
+
+func isWebSocket(serverUrl *url.URL) bool {
+	scheme := strings.ToLower(serverUrl.Scheme)
+	return scheme == "ws" || scheme == "wss"
+}
+
+func (transport Transport) applyPath(serverUrls []*url.URL) {
+	if transport.WebSocketPath == "" {
+		return
+	}
+	for _, serverUrl := range serverUrls {
+		if isWebSocket(serverUrl) && (serverUrl.Path == "" || serverUrl.Path == "/") {
+			serverUrl.Path = "/" + strings.TrimPrefix(transport.WebSocketPath, "/")
+		}
+	}
+}
+
+func (transport Transport) webSocketConfig() *autopaho.WebSocketConfig {
+	if len(transport.WebSocketHeaders) == 0 {
+		return nil
+	}
+	return &autopaho.WebSocketConfig{
+		Header: func(serverUrl *url.URL, tlsConfig *tls.Config) http.Header {
+			return transport.WebSocketHeaders.Clone()
+		},
+	}
+}
@@ -0,0 +1,135 @@
+package connection
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eclipse/paho.golang/autopaho"
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/rs/zerolog"
+
+	"metamakers.org/door-controller-mqtt/testbroker"
+)
+
+func TestApplyPath(t *testing.T) {
+	tests := []struct {
+		uri  string
+		path string
+		want string
+	}{
+		{uri: "ws://broker:8080", path: "/mqtt", want: "ws://broker:8080/mqtt"},
+		{uri: "wss://broker:8443/", path: "mqtt", want: "wss://broker:8443/mqtt"},
+		{uri: "WS://broker:8080", path: "/mqtt", want: "ws://broker:8080/mqtt"},
+		{uri: "ws://broker:8080/own", path: "/mqtt", want: "ws://broker:8080/own"},
+		{uri: "ws://broker:8080", path: "", want: "ws://broker:8080"},
+		{uri: "mqtt://broker:1883", path: "/mqtt", want: "mqtt://broker:1883"},
+		{uri: "mqtts://broker:8883", path: "/mqtt", want: "mqtts://broker:8883"},
+	}
+
+	for _, test := range tests {
+		serverUrls, err := ParseURIs([]string{test.uri})
+		if err != nil {
+			t.Fatalf("ParseURIs(%s) failed: %v", test.uri, err)
+		}
+		Transport{WebSocketPath: test.path}.applyPath(serverUrls)
+		if got := serverUrls[0].String(); got != test.want {
+			t.Errorf("%s with path %q: got %s, want %s", test.uri, test.path, got, test.want)
+		}
+	}
+}
+
+func TestWebSocketConfig(t *testing.T) {
+	if config := (Transport{}).webSocketConfig(); config != nil {
+		t.Errorf("got a websocket config without any headers")
+	}
+
+	headers := http.Header{"Authorization": []string{"Bearer token"}}
+	config := Transport{WebSocketHeaders: headers}.webSocketConfig()
+	if config == nil {
+		t.Fatal("got no websocket config with headers")
+	}
+	sent := config.Header(&url.URL{Scheme: "ws", Host: "broker"}, nil)
+	if got := sent.Get("Authorization"); got != "Bearer token" {
+		t.Errorf("Authorization: got %q, want %q", got, "Bearer token")
+	}
+	// Each upgrade request gets its own copy to change
+	sent.Set("Authorization", "changed")
+	if got := headers.Get("Authorization"); got != "Bearer token" {
+		t.Errorf("the transport's headers were changed to %q", got)
+	}
+}
+
+type upgradeRequest struct {
+	path          string
+	authorization string
+}
+
+func TestWebSocketConnection(t *testing.T) {
+	broker := testbroker.Start(t)
+
+	// A reverse proxy in front of the broker, like the one the path and
+	// headers are for, records each upgrade request
+	upgrades := make(chan upgradeRequest, 10)
+	proxy := httputil.NewSingleHostReverseProxy(&url.URL{Scheme: "http", Host: broker.WebSocketAddress})
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		upgrades <- upgradeRequest{path: request.URL.Path, authorization: request.Header.Get("Authorization")}
+		if request.Header.Get("Authorization") != "Bearer token" {
+			http.Error(writer, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		proxy.ServeHTTP(writer, request)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	uri := "ws://" + strings.TrimPrefix(server.URL, "http://")
+	connected := make(chan string, 1)
+	logger := zerolog.Nop()
+	clientConfig, err := Options{
+		URIs:     []string{uri},
+		ClientID: "websocket_test",
+		Transport: Transport{
+			WebSocketPath:    "mqtt",
+			WebSocketHeaders: http.Header{"Authorization": []string{"Bearer token"}},
+		},
+		CleanStart: true,
+		OnConnectionUp: func(connectionManager *autopaho.ConnectionManager, connectionAck *paho.Connack, broker *url.URL) {
+			connected <- broker.String()
+		},
+		Logger: &logger,
+	}.ClientConfig(ctx)
+	if err != nil {
+		t.Fatalf("Failed to build client config: %v", err)
+	}
+
+	connectionManager, err := autopaho.NewConnection(ctx, clientConfig)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer connectionManager.Disconnect(ctx)
+
+	select {
+	case got := <-connected:
+		if want := uri + "/mqtt"; got != want {
+			t.Errorf("connected to %s, want %s", got, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Didn't connect over the websocket")
+	}
+
+	upgrade := <-upgrades
+	if upgrade.path != "/mqtt" {
+		t.Errorf("upgrade path: got %s, want /mqtt", upgrade.path)
+	}
+	if upgrade.authorization != "Bearer token" {
+		t.Errorf("Authorization: got %q, want %q", upgrade.authorization, "Bearer token")
+	}
+}
@@ -0,0 +1,127 @@
+package diary
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+
+	"metamakers.org/door-controller-mqtt/mqtt"
+)
+
+type Delivery int
+
+const (
+	Fresh Delivery = iota
+	Duplicate
+	Retained
+)
+
+var deliveryNames = map[Delivery]string{
+	Fresh:     "fresh",
+	Duplicate: "duplicate",
+	Retained:  "retained",
+}
+
+func (delivery Delivery) String() string {
+	return deliveryNames[delivery]
+}
+
+func (delivery Delivery) MarshalText() ([]byte, error) {
+	return []byte(delivery.String()), nil
+}
+
+// hasControllerTimestamp reports whether the payload ends with the
+// timestamp door controllers add to card events (e.g. 0001234567|2024-03-21 02:06:14)
+func hasControllerTimestamp(payload []byte) bool {
+	chunks := strings.Split(string(payload), "|")
+	if len(chunks) < 2 {
+		return false
+	}
+	_, err := time.Parse(mqtt.TimestampFormat, chunks[len(chunks)-1])
+	return err == nil
+}
+
+type dedupEntry struct {
+	key  string
+	seen time.Time
+}
+
+// Deduplicator remembers the messages handled within the window so
+// redeliveries after a reconnect are not treated as new events. At most
+// size messages are remembered, the oldest are forgotten first. With
+// suppress set duplicate and retained messages are dropped, otherwise
+// they're kept and flagged.
+type Deduplicator struct {
+	mu       sync.Mutex
+	window   time.Duration
+	size     int
+	suppress bool
+	seen     map[string]time.Time
+	entries  []dedupEntry
+}
+
+func NewDeduplicator(window time.Duration, size int, suppress bool) *Deduplicator {
+	return &Deduplicator{
+		window:   window,
+		size:     size,
+		suppress: suppress,
+		seen:     make(map[string]time.Time, size),
+		entries:  make([]dedupEntry, 0, size),
+	}
+}
+
+func dedupKey(clientID string, topic string, payload []byte) string {
+	hash := sha256.Sum256(payload)
+	return clientID + "|" + topic + "|" + hex.EncodeToString(hash[:])
+}
+
+func (deduplicator *Deduplicator) evict(now time.Time) {
+	cursor := 0
+	for cursor < len(deduplicator.entries) {
+		entry := deduplicator.entries[cursor]
+		if now.Sub(entry.seen) <= deduplicator.window && len(deduplicator.entries)-cursor <= deduplicator.size {
+			break
+		}
+		if deduplicator.seen[entry.key] == entry.seen {
+			delete(deduplicator.seen, entry.key)
+		}
+		cursor += 1
+	}
+	deduplicator.entries = deduplicator.entries[cursor:]
+}
+
+// Classify works out whether a message is new. Messages replayed by the
+// broker because they were retained are always flagged. Card events carry
+// the controller's timestamp so a repeat of the same payload is a
+// duplicate. Other payloads (check ins, logs) legitimately repeat, so
+// they are only duplicates when the broker also set the DUP flag.
+func (deduplicator *Deduplicator) Classify(clientID string, topic string, payload []byte, duplicateFlag bool, retain bool) Delivery {
+	if retain {
+		return Retained
+	}
+
+	deduplicator.mu.Lock()
+	defer deduplicator.mu.Unlock()
+
+	now := time.Now()
+	deduplicator.evict(now)
+
+	key := dedupKey(clientID, topic, payload)
+	_, seen := deduplicator.seen[key]
+
+	deduplicator.seen[key] = now
+	deduplicator.entries = append(deduplicator.entries, dedupEntry{key: key, seen: now})
+	deduplicator.evict(now)
+
+	if seen && (duplicateFlag || hasControllerTimestamp(payload)) {
+		return Duplicate
+	}
+	return Fresh
+}
+
+// Keep reports whether a message classified as delivery is still handled
+func (deduplicator *Deduplicator) Keep(delivery Delivery) bool {
+	return delivery == Fresh || !deduplicator.suppress
+}
@@ -0,0 +1,128 @@
+package diary
+
+import (
+	"testing"
+	"time"
+)
+
+type delivery struct {
+	clientID      string
+	topic         string
+	payload       string
+	duplicateFlag bool
+	retain        bool
+	want          Delivery
+}
+
+func TestClassify(t *testing.T) {
+	const (
+		unlockTopic  = "door_controller/unlock/door_one"
+		checkInTopic = "door_controller/health_check/door_one"
+		unlock       = "0001234567|2026-10-19 10:00:00"
+	)
+
+	tests := []struct {
+		name       string
+		size       int
+		deliveries []delivery
+	}{
+		{
+			name: "card event redelivered after a reconnect",
+			size: 10,
+			deliveries: []delivery{
+				{clientID: "door_one", topic: unlockTopic, payload: unlock, want: Fresh},
+				{clientID: "door_one", topic: unlockTopic, payload: unlock, want: Duplicate},
+				{clientID: "door_one", topic: unlockTopic, payload: unlock, duplicateFlag: true, want: Duplicate},
+			},
+		},
+		{
+			name: "check ins repeat unless the broker flags them",
+			size: 10,
+			deliveries: []delivery{
+				{clientID: "door_one", topic: checkInTopic, payload: "ok", want: Fresh},
+				{clientID: "door_one", topic: checkInTopic, payload: "ok", want: Fresh},
+				{clientID: "door_one", topic: checkInTopic, payload: "ok", duplicateFlag: true, want: Duplicate},
+			},
+		},
+		{
+			name: "DUP flag on a message not seen before",
+			size: 10,
+			deliveries: []delivery{
+				{clientID: "door_one", topic: checkInTopic, payload: "ok", duplicateFlag: true, want: Fresh},
+			},
+		},
+		{
+			name: "retained messages are always flagged",
+			size: 10,
+			deliveries: []delivery{
+				{clientID: "door_one", topic: unlockTopic, payload: unlock, retain: true, want: Retained},
+				{clientID: "door_one", topic: unlockTopic, payload: unlock, want: Fresh},
+				{clientID: "door_one", topic: unlockTopic, payload: unlock, retain: true, want: Retained},
+			},
+		},
+		{
+			name: "the same card at another door",
+			size: 10,
+			deliveries: []delivery{
+				{clientID: "door_one", topic: unlockTopic, payload: unlock, want: Fresh},
+				{clientID: "door_two", topic: "door_controller/unlock/door_two", payload: unlock, want: Fresh},
+			},
+		},
+		{
+			name: "oldest messages are forgotten past the size",
+			size: 1,
+			deliveries: []delivery{
+				{clientID: "door_one", topic: unlockTopic, payload: unlock, want: Fresh},
+				{clientID: "door_one", topic: unlockTopic, payload: "0000000001|2026-10-19 10:00:01", want: Fresh},
+				{clientID: "door_one", topic: unlockTopic, payload: unlock, want: Fresh},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			deduplicator := NewDeduplicator(time.Minute, test.size, false)
+			for index, delivery := range test.deliveries {
+				got := deduplicator.Classify(delivery.clientID, delivery.topic, []byte(delivery.payload), delivery.duplicateFlag, delivery.retain)
+				if got != delivery.want {
+					t.Errorf("delivery %d of %s: got %s, want %s", index, delivery.payload, got, delivery.want)
+				}
+			}
+		})
+	}
+}
+
+func TestClassifyForgetsAfterWindow(t *testing.T) {
+	deduplicator := NewDeduplicator(10*time.Millisecond, 10, false)
+	payload := []byte("0001234567|2026-10-19 10:00:00")
+
+	if got := deduplicator.Classify("door_one", "door_controller/unlock/door_one", payload, false, false); got != Fresh {
+		t.Fatalf("first delivery: got %s, want %s", got, Fresh)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if got := deduplicator.Classify("door_one", "door_controller/unlock/door_one", payload, false, false); got != Fresh {
+		t.Errorf("delivery after the window: got %s, want %s", got, Fresh)
+	}
+}
+
+func TestKeep(t *testing.T) {
+	tests := []struct {
+		suppress bool
+		delivery Delivery
+		want     bool
+	}{
+		{suppress: true, delivery: Fresh, want: true},
+		{suppress: true, delivery: Duplicate, want: false},
+		{suppress: true, delivery: Retained, want: false},
+		{suppress: false, delivery: Fresh, want: true},
+		{suppress: false, delivery: Duplicate, want: true},
+		{suppress: false, delivery: Retained, want: true},
+	}
+
+	for _, test := range tests {
+		deduplicator := NewDeduplicator(time.Minute, 10, test.suppress)
+		if got := deduplicator.Keep(test.delivery); got != test.want {
+			t.Errorf("Keep(%s) with suppress %t: got %t, want %t", test.delivery, test.suppress, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package diary
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// QueueDrain counts the messages delivered straight after reconnecting to
+// a session the broker kept. Those are the messages queued while diary
+// was away, although live messages arriving during the drain are counted
+// as well.
+type QueueDrain struct {
+	mu      sync.Mutex
+	count   int
+	started time.Time
+	last    time.Time
+}
+
+func (drain *QueueDrain) Start() {
+	drain.mu.Lock()
+	defer drain.mu.Unlock()
+
+	drain.count = 0
+	drain.started = time.Now()
+	drain.last = drain.started
+}
+
+func (drain *QueueDrain) Received() {
+	drain.mu.Lock()
+	defer drain.mu.Unlock()
+
+	drain.count += 1
+	drain.last = time.Now()
+}
+
+// Wait blocks until no messages have been received for the idle duration
+// and returns how many were received and how long it took
+func (drain *QueueDrain) Wait(ctx context.Context, idle time.Duration) (int, time.Duration) {
+	ticker := time.NewTicker(idle / 4)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+		case <-ticker.C:
+			drain.mu.Lock()
+			idleFor := time.Since(drain.last)
+			drain.mu.Unlock()
+			if idleFor < idle {
+				continue
+			}
+		}
+
+		drain.mu.Lock()
+		defer drain.mu.Unlock()
+		return drain.count, drain.last.Sub(drain.started)
+	}
+}
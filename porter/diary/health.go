@@ -0,0 +1,65 @@
+package diary
+
+import "time"
+
+var UnhealthyDuration = time.Minute * 5
+
+type ClientState int
+
+const (
+	Healthy = iota
+	Unhealthy
+)
+
+var clientStateNames = map[ClientState]string{
+	Healthy:   "healthy",
+	Unhealthy: "unhealthy",
+}
+
+func (clientState ClientState) String() string {
+	return clientStateNames[clientState]
+}
+
+func (clientState ClientState) MarshalText() ([]byte, error) {
+	return []byte(clientState.String()), nil
+}
+
+type ClientHealth struct {
+	Site           string      `json:"site,omitempty"`
+	LastSeen       time.Time   `json:"last_seen"`
+	State          ClientState `json:"state"`
+	UnhealthyAfter time.Time   `json:"unhealthy_after"`
+}
+
+func NewClientHealth(site string) ClientHealth {
+	now := time.Now()
+	return ClientHealth{
+		site,
+		now,
+		Healthy,
+		now.Add(UnhealthyDuration),
+	}
+}
+
+func (clientHealth ClientHealth) Transitioned() (ClientHealth, bool) {
+	now := time.Now()
+	switch clientHealth.State {
+	case Healthy:
+		if clientHealth.UnhealthyAfter.Before(now) {
+			clientHealth.State = Unhealthy
+			return clientHealth, true
+		}
+	case Unhealthy:
+		if clientHealth.UnhealthyAfter.After(now) {
+			clientHealth.State = Healthy
+			return clientHealth, true
+		}
+	}
+	return clientHealth, false
+}
+
+func (clientHealth ClientHealth) BumpLastSeen() ClientHealth {
+	clientHealth.LastSeen = time.Now()
+	clientHealth.UnhealthyAfter = clientHealth.LastSeen.Add(UnhealthyDuration)
+	return clientHealth
+}
@@ -0,0 +1,96 @@
+package diary
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTransitioned(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name         string
+		state        ClientState
+		after        time.Duration
+		want         ClientState
+		transitioned bool
+	}{
+		{name: "healthy", state: Healthy, after: time.Minute, want: Healthy, transitioned: false},
+		{name: "goes quiet", state: Healthy, after: -time.Second, want: Unhealthy, transitioned: true},
+		{name: "still quiet", state: Unhealthy, after: -time.Second, want: Unhealthy, transitioned: false},
+		{name: "seen again", state: Unhealthy, after: time.Minute, want: Healthy, transitioned: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clientHealth := ClientHealth{Site: "hq", LastSeen: now, State: test.state, UnhealthyAfter: now.Add(test.after)}
+			got, transitioned := clientHealth.Transitioned()
+			if got.State != test.want || transitioned != test.transitioned {
+				t.Errorf("got %s transitioned %v, want %s transitioned %v", got.State, transitioned, test.want, test.transitioned)
+			}
+			if got.Site != "hq" || !got.UnhealthyAfter.Equal(clientHealth.UnhealthyAfter) {
+				t.Errorf("got %+v, want only the state changed", got)
+			}
+		})
+	}
+}
+
+func TestBumpLastSeen(t *testing.T) {
+	unhealthyDuration := UnhealthyDuration
+	UnhealthyDuration = time.Minute
+	defer func() { UnhealthyDuration = unhealthyDuration }()
+
+	clientHealth := ClientHealth{LastSeen: time.Now().Add(-time.Hour), UnhealthyAfter: time.Now().Add(-time.Minute)}
+	bumped := clientHealth.BumpLastSeen()
+	if since := time.Since(bumped.LastSeen); since > time.Second {
+		t.Errorf("last seen %s ago, want now", since)
+	}
+	if got := bumped.UnhealthyAfter.Sub(bumped.LastSeen); got != time.Minute {
+		t.Errorf("unhealthy after %s, want %s", got, time.Minute)
+	}
+}
+
+func TestCheckTransitions(t *testing.T) {
+	unhealthyDuration := UnhealthyDuration
+	defer func() { UnhealthyDuration = unhealthyDuration }()
+
+	// Clients seen with a negative duration are overdue straight away
+	UnhealthyDuration = -time.Second
+	store := NewStore(50)
+	store.Seen("hq", "door_one")
+	UnhealthyDuration = time.Minute
+	store.Seen("hq", "door_two")
+
+	transitions := store.CheckTransitions()
+	if len(transitions) != 1 || transitions[0].ClientID != "door_one" || transitions[0].From.State != Healthy || transitions[0].To.State != Unhealthy {
+		t.Fatalf("got %+v, want door_one to become unhealthy", transitions)
+	}
+	if client, _ := store.Client("door_one"); client.State != Unhealthy {
+		t.Errorf("got door_one %s, want the store to keep it unhealthy", client.State)
+	}
+	if transitions := store.CheckTransitions(); len(transitions) != 0 {
+		t.Errorf("got %+v, want each transition reported once", transitions)
+	}
+
+	store.Seen("hq", "door_one")
+	transitions = store.CheckTransitions()
+	if len(transitions) != 1 || transitions[0].ClientID != "door_one" || transitions[0].To.State != Healthy {
+		t.Fatalf("got %+v, want door_one to be healthy again", transitions)
+	}
+}
+
+func TestClientStateText(t *testing.T) {
+	tests := []struct {
+		state ClientState
+		want  string
+	}{
+		{state: Healthy, want: "healthy"},
+		{state: Unhealthy, want: "unhealthy"},
+	}
+
+	for _, test := range tests {
+		text, err := test.state.MarshalText()
+		if err != nil || string(text) != test.want {
+			t.Errorf("got %s %v, want %s", text, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package diary
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const defaultEventLimit = 100
+
+var keepAliveDuration = time.Second * 15
+
+// NewServer creates a read only JSON API on top of the store. Nothing
+// served here can change diary's state.
+func NewServer(addr string, store *Store) *http.Server {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /api/clients", func(writer http.ResponseWriter, request *http.Request) {
+		writeJSON(writer, http.StatusOK, store.Clients())
+	})
+
+	mux.HandleFunc("GET /api/clients/{client_id}", func(writer http.ResponseWriter, request *http.Request) {
+		clientHealth, found := store.Client(request.PathValue("client_id"))
+		if !found {
+			writeError(writer, http.StatusNotFound, "Client has not been seen")
+			return
+		}
+		writeJSON(writer, http.StatusOK, clientHealth)
+	})
+
+	mux.HandleFunc("GET /api/clients/{client_id}/events", func(writer http.ResponseWriter, request *http.Request) {
+		clientID := request.PathValue("client_id")
+		if _, found := store.Client(clientID); !found {
+			writeError(writer, http.StatusNotFound, "Client has not been seen")
+			return
+		}
+		writeJSON(writer, http.StatusOK, store.Events(clientID))
+	})
+
+	mux.HandleFunc("GET /api/counts", func(writer http.ResponseWriter, request *http.Request) {
+		writeJSON(writer, http.StatusOK, store.Counts())
+	})
+
+	mux.HandleFunc("GET /api/events", func(writer http.ResponseWriter, request *http.Request) {
+		limit := defaultEventLimit
+		if value := request.URL.Query().Get("limit"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 1 {
+				writeError(writer, http.StatusBadRequest, "limit must be a positive number")
+				return
+			}
+			limit = parsed
+		}
+		writeJSON(writer, http.StatusOK, store.RecentEvents(limit))
+	})
+
+	mux.HandleFunc("GET /api/events/stream", func(writer http.ResponseWriter, request *http.Request) {
+		streamEvents(writer, request, store)
+	})
+
+	mux.HandleFunc("GET /api/connection", func(writer http.ResponseWriter, request *http.Request) {
+		writeJSON(writer, http.StatusOK, store.Connection())
+	})
+
+	return &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: time.Second * 10,
+	}
+}
+
+func streamEvents(writer http.ResponseWriter, request *http.Request, store *Store) {
+	flusher, ok := writer.(http.Flusher)
+	if !ok {
+		writeError(writer, http.StatusInternalServerError, "Streaming is not supported")
+		return
+	}
+
+	events, unsubscribe := store.Subscribe()
+	defer unsubscribe()
+
+	writer.Header().Set("Content-Type", "text/event-stream")
+	writer.Header().Set("Cache-Control", "no-cache")
+	writer.Header().Set("Connection", "keep-alive")
+	writer.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAliveTicker := time.NewTicker(keepAliveDuration)
+	defer keepAliveTicker.Stop()
+
+	for {
+		select {
+		case <-request.Context().Done():
+			return
+		case <-keepAliveTicker.C:
+			if _, err := fmt.Fprint(writer, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case event := <-events:
+			data, err := json.Marshal(event)
+			if err != nil {
+				log.Error().
+					Str("error", err.Error()).
+					Str("event", "EventStream").
+					Msg(fmt.Sprintf("Failed to encode event: %v", err))
+				continue
+			}
+			if _, err := fmt.Fprintf(writer, "event: %s\ndata: %s\n\n", event.Level, data); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func writeJSON(writer http.ResponseWriter, status int, value any) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	if err := json.NewEncoder(writer).Encode(value); err != nil {
+		log.Error().
+			Str("error", err.Error()).
+			Str("event", "HTTPResponse").
+			Msg(fmt.Sprintf("Failed to encode response: %v", err))
+	}
+}
+
+func writeError(writer http.ResponseWriter, status int, message string) {
+	writeJSON(writer, status, map[string]string{"error": message})
+}
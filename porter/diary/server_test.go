@@ -0,0 +1,324 @@
+package diary
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestStore() *Store {
+	store := NewStore(50)
+	start := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	store.Seen("hq", "door_one")
+	store.Seen("hq", "door_two")
+	store.Record(Event{Time: start, Site: "hq", ClientID: "door_one", Level: "unlock", Payload: "0001234567|2026-10-19 10:00:00"})
+	store.Record(Event{Time: start.Add(2 * time.Second), Site: "hq", ClientID: "door_two", Level: "denied_access", Payload: "0007654321|2026-10-19 10:00:02"})
+	store.Record(Event{Time: start.Add(time.Second), Site: "hq", ClientID: "door_one", Level: "door_open", Payload: "0001234567|2026-10-19 10:00:01"})
+	store.Record(Event{Time: start.Add(3 * time.Second), Site: "hq", ClientID: "door_one", Level: "unlock", Payload: "0001234567|2026-10-19 10:00:00", Delivery: Duplicate})
+	return store
+}
+
+// apiEvent is what clients of the API see of an event
+type apiEvent struct {
+	ClientID string `json:"client_id"`
+	Level    string `json:"level"`
+	Payload  string `json:"payload"`
+	Delivery string `json:"delivery"`
+}
+
+func get(t *testing.T, server *httptest.Server, path string, value any) int {
+	t.Helper()
+	response, err := http.Get(server.URL + path)
+	if err != nil {
+		t.Fatalf("Failed to get %s: %v", path, err)
+	}
+	defer response.Body.Close()
+	if contentType := response.Header.Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("%s: got content type %s, want application/json", path, contentType)
+	}
+	if err := json.NewDecoder(response.Body).Decode(value); err != nil {
+		t.Fatalf("%s: failed to decode response: %v", path, err)
+	}
+	return response.StatusCode
+}
+
+func TestServerClients(t *testing.T) {
+	server := httptest.NewServer(NewServer("", newTestStore()).Handler)
+	defer server.Close()
+
+	clients := map[string]map[string]any{}
+	if status := get(t, server, "/api/clients", &clients); status != http.StatusOK {
+		t.Fatalf("got status %d, want %d", status, http.StatusOK)
+	}
+	if len(clients) != 2 || clients["door_one"]["site"] != "hq" || clients["door_two"]["state"] != "healthy" {
+		t.Errorf("got %+v, want door_one and door_two healthy at hq", clients)
+	}
+
+	client := map[string]any{}
+	if status := get(t, server, "/api/clients/door_one", &client); status != http.StatusOK {
+		t.Fatalf("got status %d, want %d", status, http.StatusOK)
+	}
+	if client["state"] != "healthy" || client["site"] != "hq" {
+		t.Errorf("got %v, want door_one healthy at hq", client)
+	}
+}
+
+func TestServerEvents(t *testing.T) {
+	server := httptest.NewServer(NewServer("", newTestStore()).Handler)
+	defer server.Close()
+
+	tests := []struct {
+		path   string
+		levels []string
+	}{
+		// A client's events are in the order they were recorded
+		{path: "/api/clients/door_one/events", levels: []string{"unlock", "door_open", "unlock"}},
+		{path: "/api/clients/door_two/events", levels: []string{"denied_access"}},
+		// Recent events are ordered by time across every client
+		{path: "/api/events", levels: []string{"unlock", "door_open", "denied_access", "unlock"}},
+		{path: "/api/events?limit=2", levels: []string{"denied_access", "unlock"}},
+		{path: "/api/events?limit=100", levels: []string{"unlock", "door_open", "denied_access", "unlock"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			events := []apiEvent{}
+			if status := get(t, server, test.path, &events); status != http.StatusOK {
+				t.Fatalf("got status %d, want %d", status, http.StatusOK)
+			}
+			levels := make([]string, 0, len(events))
+			for _, event := range events {
+				levels = append(levels, event.Level)
+			}
+			if strings.Join(levels, ",") != strings.Join(test.levels, ",") {
+				t.Errorf("got %v, want %v", levels, test.levels)
+			}
+		})
+	}
+}
+
+func TestServerCounts(t *testing.T) {
+	server := httptest.NewServer(NewServer("", newTestStore()).Handler)
+	defer server.Close()
+
+	counts := map[string]map[string]int{}
+	if status := get(t, server, "/api/counts", &counts); status != http.StatusOK {
+		t.Fatalf("got status %d, want %d", status, http.StatusOK)
+	}
+	// The duplicate unlock isn't counted
+	if counts["door_one"]["unlock"] != 1 || counts["door_one"]["door_open"] != 1 || counts["door_two"]["denied_access"] != 1 {
+		t.Errorf("got %v, want one of each fresh event", counts)
+	}
+}
+
+func TestServerConnection(t *testing.T) {
+	store := NewStore(50)
+	server := httptest.NewServer(NewServer("", store).Handler)
+	defer server.Close()
+
+	status := ConnectionStatus{}
+	get(t, server, "/api/connection", &status)
+	if status.Connected {
+		t.Errorf("got connected before connecting")
+	}
+
+	store.SetBroker("mqtt://localhost:1883")
+	store.SetConnected(true, nil)
+	store.SetConnected(false, errors.New("Connection reset"))
+	get(t, server, "/api/connection", &status)
+	if status.Connected || status.Broker != "mqtt://localhost:1883" || status.LastError != "Connection reset" {
+		t.Errorf("got %+v, want disconnected from localhost with the last error", status)
+	}
+}
+
+func TestServerErrors(t *testing.T) {
+	server := httptest.NewServer(NewServer("", newTestStore()).Handler)
+	defer server.Close()
+
+	tests := []struct {
+		method string
+		path   string
+		status int
+		err    string
+	}{
+		{method: http.MethodGet, path: "/api/clients/door_missing", status: http.StatusNotFound, err: "Client has not been seen"},
+		{method: http.MethodGet, path: "/api/clients/door_missing/events", status: http.StatusNotFound, err: "Client has not been seen"},
+		{method: http.MethodGet, path: "/api/events?limit=0", status: http.StatusBadRequest, err: "limit must be a positive number"},
+		{method: http.MethodGet, path: "/api/events?limit=-5", status: http.StatusBadRequest, err: "limit must be a positive number"},
+		{method: http.MethodGet, path: "/api/events?limit=ten", status: http.StatusBadRequest, err: "limit must be a positive number"},
+		// The API is read only
+		{method: http.MethodPost, path: "/api/clients", status: http.StatusMethodNotAllowed},
+		{method: http.MethodDelete, path: "/api/clients/door_one", status: http.StatusMethodNotAllowed},
+		{method: http.MethodGet, path: "/api/doors", status: http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		t.Run(test.method+" "+test.path, func(t *testing.T) {
+			request, err := http.NewRequest(test.method, server.URL+test.path, nil)
+			if err != nil {
+				t.Fatalf("Failed to build request: %v", err)
+			}
+			response, err := http.DefaultClient.Do(request)
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			defer response.Body.Close()
+			if response.StatusCode != test.status {
+				t.Errorf("got status %d, want %d", response.StatusCode, test.status)
+			}
+			if test.err == "" {
+				return
+			}
+			body := map[string]string{}
+			if err := json.NewDecoder(response.Body).Decode(&body); err != nil {
+				t.Fatalf("Failed to decode error: %v", err)
+			}
+			if body["error"] != test.err {
+				t.Errorf("got error %q, want %q", body["error"], test.err)
+			}
+		})
+	}
+}
+
+// unflushedWriter hides the recorder's Flush
+type unflushedWriter struct {
+	http.ResponseWriter
+}
+
+func TestServerStreamNeedsFlusher(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, "/api/events/stream", nil)
+	NewServer("", NewStore(50)).Handler.ServeHTTP(unflushedWriter{recorder}, request)
+
+	if recorder.Code != http.StatusInternalServerError {
+		t.Errorf("got status %d, want %d", recorder.Code, http.StatusInternalServerError)
+	}
+	if !strings.Contains(recorder.Body.String(), "Streaming is not supported") {
+		t.Errorf("got %s, want the streaming error", recorder.Body.String())
+	}
+}
+
+func TestServerStream(t *testing.T) {
+	keepAlive := keepAliveDuration
+	keepAliveDuration = 100 * time.Millisecond
+	defer func() { keepAliveDuration = keepAlive }()
+
+	store := NewStore(50)
+	server := httptest.NewServer(NewServer("", store).Handler)
+	defer server.Close()
+
+	response, err := http.Get(server.URL + "/api/events/stream")
+	if err != nil {
+		t.Fatalf("Failed to connect to the stream: %v", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d, want %d", response.StatusCode, http.StatusOK)
+	}
+	if contentType := response.Header.Get("Content-Type"); contentType != "text/event-stream" {
+		t.Errorf("got content type %s, want text/event-stream", contentType)
+	}
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(response.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+	next := func() string {
+		t.Helper()
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				t.Fatal("Stream ended")
+			}
+			return line
+		case <-time.After(5 * time.Second):
+			t.Fatal("Nothing was streamed")
+			return ""
+		}
+	}
+
+	// The headers are flushed before anything happens, so the stream is
+	// subscribed by now
+	store.Record(Event{ClientID: "door_one", Level: "forced_open", Payload: "0|2026-10-19 10:00:00"})
+	if line := next(); line != "event: forced_open" {
+		t.Errorf("got %q, want the event's level", line)
+	}
+	data, found := strings.CutPrefix(next(), "data: ")
+	if !found {
+		t.Fatalf("got %q, want the event's data", data)
+	}
+	event := apiEvent{}
+	if err := json.Unmarshal([]byte(data), &event); err != nil {
+		t.Fatalf("Failed to decode event: %v", err)
+	}
+	if event.ClientID != "door_one" || event.Payload != "0|2026-10-19 10:00:00" || event.Delivery != "fresh" {
+		t.Errorf("got %+v, want door_one's forced open", event)
+	}
+	if line := next(); line != "" {
+		t.Errorf("got %q, want the blank line ending the event", line)
+	}
+
+	// Nothing happening is kept alive with comments
+	if line := next(); line != ": keep-alive" {
+		t.Errorf("got %q, want a keep-alive", line)
+	}
+}
+
+func TestServerStreamUnsubscribes(t *testing.T) {
+	store := NewStore(50)
+	server := httptest.NewServer(NewServer("", store).Handler)
+	defer server.Close()
+
+	response, err := http.Get(server.URL + "/api/events/stream")
+	if err != nil {
+		t.Fatalf("Failed to connect to the stream: %v", err)
+	}
+	response.Body.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		store.mu.RLock()
+		subscribers := len(store.subscribers)
+		store.mu.RUnlock()
+		if subscribers == 0 {
+			return
+		}
+		// Writing to the closed connection is what ends the stream
+		store.Record(Event{ClientID: "door_one", Level: "log_info"})
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("The stream stayed subscribed after the client went away")
+}
+
+func TestServerStreamDoesNotBlock(t *testing.T) {
+	store := NewStore(50)
+	events, unsubscribe := store.Subscribe()
+	defer unsubscribe()
+
+	// A subscriber that isn't reading misses events rather than holding
+	// up the store
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 100; i++ {
+			store.Record(Event{ClientID: "door_one", Level: "log_info"})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Recording blocked on a slow subscriber")
+	}
+	if len(events) != cap(events) {
+		t.Errorf("got %d events buffered, want %d", len(events), cap(events))
+	}
+}
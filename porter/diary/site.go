@@ -0,0 +1,55 @@
+package diary
+
+import (
+	"fmt"
+	"strings"
+
+	"metamakers.org/door-controller-mqtt/mqtt"
+)
+
+// Site is a makerspace (or environment) diary watches, every door of a
+// site publishes under the site's namespace
+type Site struct {
+	Name      string
+	Namespace mqtt.Namespace
+}
+
+// ParseSites reads sites written as name=namespace, or just the namespace
+// in which case it's also the name. When there are none the fallback
+// namespace is watched on its own.
+func ParseSites(raw []string, fallback mqtt.Namespace) ([]Site, error) {
+	if len(raw) == 0 {
+		raw = []string{string(fallback)}
+	}
+
+	sites := make([]Site, 0, len(raw))
+	names := make(map[string]bool, len(raw))
+	for _, entry := range raw {
+		name, namespace, found := strings.Cut(entry, "=")
+		if !found {
+			namespace = name
+		}
+		site := Site{
+			Name:      strings.TrimSpace(name),
+			Namespace: mqtt.Namespace(strings.TrimSpace(namespace)),
+		}
+		if site.Name == "" {
+			return nil, fmt.Errorf("Site %s needs a name", entry)
+		}
+		if err := site.Namespace.Validate(); err != nil {
+			return nil, fmt.Errorf("Site %s is invalid: %w", entry, err)
+		}
+		if names[site.Name] {
+			return nil, fmt.Errorf("Site %s is listed more than once", site.Name)
+		}
+		// Each topic has to belong to exactly one site
+		for _, other := range sites {
+			if site.Namespace.Contains(other.Namespace) || other.Namespace.Contains(site.Namespace) {
+				return nil, fmt.Errorf("Sites %s and %s have overlapping namespaces", other.Name, site.Name)
+			}
+		}
+		names[site.Name] = true
+		sites = append(sites, site)
+	}
+	return sites, nil
+}
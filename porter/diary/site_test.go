@@ -0,0 +1,70 @@
+package diary
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"metamakers.org/door-controller-mqtt/mqtt"
+)
+
+func TestParseSites(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  []string
+		want []Site
+		err  string
+	}{
+		{
+			name: "fallback",
+			raw:  nil,
+			want: []Site{{Name: "door_controller", Namespace: mqtt.DefaultNamespace}},
+		},
+		{
+			name: "namespace as the name",
+			raw:  []string{"leeds/door_controller"},
+			want: []Site{{Name: "leeds/door_controller", Namespace: "leeds/door_controller"}},
+		},
+		{
+			name: "several sites",
+			raw:  []string{"leeds=leeds/door_controller", " york = york/door_controller ", "staging/door_controller"},
+			want: []Site{
+				{Name: "leeds", Namespace: "leeds/door_controller"},
+				{Name: "york", Namespace: "york/door_controller"},
+				{Name: "staging/door_controller", Namespace: "staging/door_controller"},
+			},
+		},
+		{
+			name: "namespaces sharing a prefix",
+			raw:  []string{"a=site/door", "b=site/door_controller"},
+			want: []Site{{Name: "a", Namespace: "site/door"}, {Name: "b", Namespace: "site/door_controller"}},
+		},
+		{name: "duplicate name", raw: []string{"leeds=leeds/door_controller", "leeds=york/door_controller"}, err: "listed more than once"},
+		{name: "same namespace twice", raw: []string{"leeds=site/door_controller", "york=site/door_controller"}, err: "overlapping"},
+		{name: "nested namespace", raw: []string{"all=site", "leeds=site/leeds"}, err: "overlapping"},
+		{name: "nested namespace listed first", raw: []string{"leeds=site/leeds", "all=site"}, err: "overlapping"},
+		{name: "empty namespace", raw: []string{"leeds="}, err: "empty"},
+		{name: "empty entry", raw: []string{""}, err: "needs a name"},
+		{name: "empty name", raw: []string{"=leeds/door_controller"}, err: "needs a name"},
+		{name: "wildcard", raw: []string{"leeds=leeds/+"}, err: "wildcards"},
+		{name: "trailing slash", raw: []string{"leeds=leeds/"}, err: "start or end with /"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sites, err := ParseSites(test.raw, mqtt.DefaultNamespace)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("got %v, want an error containing %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseSites failed: %v", err)
+			}
+			if !slices.Equal(sites, test.want) {
+				t.Errorf("got %v, want %v", sites, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,227 @@
+package diary
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+type Event struct {
+	Time      time.Time `json:"time"`
+	Site      string    `json:"site,omitempty"`
+	ClientID  string    `json:"client_id"`
+	Level     string    `json:"level"`
+	Topic     string    `json:"topic"`
+	Payload   string    `json:"payload"`
+	QoS       byte      `json:"qos"`
+	Retain    bool      `json:"retain"`
+	Duplicate bool      `json:"duplicate"`
+	Delivery  Delivery  `json:"delivery"`
+}
+
+type ConnectionStatus struct {
+	Connected bool      `json:"connected"`
+	Broker    string    `json:"broker,omitempty"`
+	Since     time.Time `json:"since"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+type Transition struct {
+	ClientID string
+	From     ClientHealth
+	To       ClientHealth
+}
+
+// Store holds everything diary knows about the door controllers. It is
+// shared between the MQTT router, the health check loop and the HTTP API
+// so every access goes through the mutex.
+type Store struct {
+	mu          sync.RWMutex
+	clients     map[string]ClientHealth
+	events      map[string][]Event
+	counts      map[string]map[string]int
+	eventLimit  int
+	connection  ConnectionStatus
+	subscribers map[chan Event]struct{}
+}
+
+func NewStore(eventLimit int) *Store {
+	return &Store{
+		clients:     make(map[string]ClientHealth, 0),
+		events:      make(map[string][]Event, 0),
+		counts:      make(map[string]map[string]int, 0),
+		eventLimit:  eventLimit,
+		connection:  ConnectionStatus{Connected: false, Since: time.Now()},
+		subscribers: make(map[chan Event]struct{}, 0),
+	}
+}
+
+// Seen bumps the last seen value of a client, adding the client if it has
+// not been seen before. Client IDs are unique on a broker so they're not
+// namespaced by site.
+func (store *Store) Seen(site string, clientID string) ClientHealth {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if client, found := store.clients[clientID]; found {
+		client = client.BumpLastSeen()
+		client.Site = site
+		store.clients[clientID] = client
+	} else {
+		store.clients[clientID] = NewClientHealth(site)
+	}
+	return store.clients[clientID]
+}
+
+// Record keeps the event in the client's history and forwards it to every
+// subscriber. Subscribers that are not keeping up will miss events rather
+// than block the MQTT router. Only fresh events are counted.
+func (store *Store) Record(event Event) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if event.Delivery == Fresh {
+		if _, found := store.counts[event.ClientID]; !found {
+			store.counts[event.ClientID] = make(map[string]int, 0)
+		}
+		store.counts[event.ClientID][event.Level] += 1
+	}
+
+	events := append(store.events[event.ClientID], event)
+	if len(events) > store.eventLimit {
+		events = events[len(events)-store.eventLimit:]
+	}
+	store.events[event.ClientID] = events
+
+	for subscriber := range store.subscribers {
+		select {
+		case subscriber <- event:
+		default:
+		}
+	}
+}
+
+func (store *Store) CheckTransitions() []Transition {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	transitions := make([]Transition, 0)
+	for key, clientHealth := range store.clients {
+		newClientHealth, transitioned := clientHealth.Transitioned()
+		if transitioned {
+			store.clients[key] = newClientHealth
+			transitions = append(transitions, Transition{
+				ClientID: key,
+				From:     clientHealth,
+				To:       newClientHealth,
+			})
+		}
+	}
+	return transitions
+}
+
+func (store *Store) Clients() map[string]ClientHealth {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	clients := make(map[string]ClientHealth, len(store.clients))
+	for key, clientHealth := range store.clients {
+		clients[key] = clientHealth
+	}
+	return clients
+}
+
+func (store *Store) Client(clientID string) (ClientHealth, bool) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	clientHealth, found := store.clients[clientID]
+	return clientHealth, found
+}
+
+// Counts returns how many fresh events each client has published
+// grouped by level
+func (store *Store) Counts() map[string]map[string]int {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	counts := make(map[string]map[string]int, len(store.counts))
+	for clientID, levels := range store.counts {
+		counts[clientID] = make(map[string]int, len(levels))
+		for level, count := range levels {
+			counts[clientID][level] = count
+		}
+	}
+	return counts
+}
+
+func (store *Store) Events(clientID string) []Event {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	events := make([]Event, len(store.events[clientID]))
+	copy(events, store.events[clientID])
+	return events
+}
+
+// RecentEvents returns the latest events from every client ordered from
+// oldest to newest
+func (store *Store) RecentEvents(limit int) []Event {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	events := make([]Event, 0)
+	for _, clientEvents := range store.events {
+		events = append(events, clientEvents...)
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Time.Before(events[j].Time)
+	})
+	if limit > 0 && len(events) > limit {
+		events = events[len(events)-limit:]
+	}
+	return events
+}
+
+func (store *Store) SetConnected(connected bool, err error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if store.connection.Connected != connected {
+		store.connection.Since = time.Now()
+	}
+	store.connection.Connected = connected
+	if err != nil {
+		store.connection.LastError = err.Error()
+	}
+}
+
+// SetBroker records which of the brokers diary is connected to
+func (store *Store) SetBroker(broker string) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.connection.Broker = broker
+}
+
+func (store *Store) Connection() ConnectionStatus {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	return store.connection
+}
+
+// Subscribe returns a channel of new events. The returned function must be
+// called once the subscriber is no longer reading from the channel.
+func (store *Store) Subscribe() (<-chan Event, func()) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	subscriber := make(chan Event, 32)
+	store.subscribers[subscriber] = struct{}{}
+	return subscriber, func() {
+		store.mu.Lock()
+		defer store.mu.Unlock()
+		delete(store.subscribers, subscriber)
+	}
+}
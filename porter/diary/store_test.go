@@ -0,0 +1,28 @@
+package diary
+
+import (
+	"testing"
+)
+
+func TestStoreEventLimit(t *testing.T) {
+	store := NewStore(3)
+	for _, payload := range []string{"1", "2", "3", "4", "5"} {
+		store.Record(Event{ClientID: "door_one", Level: "log_info", Payload: payload})
+	}
+	store.Record(Event{ClientID: "door_two", Level: "log_info", Payload: "6"})
+
+	events := store.Events("door_one")
+	if len(events) != 3 || events[0].Payload != "3" || events[2].Payload != "5" {
+		t.Errorf("got %+v, want door_one's last three events", events)
+	}
+	// Every event is counted even once it's no longer kept
+	if got := store.Counts()["door_one"]["log_info"]; got != 5 {
+		t.Errorf("got %d counted, want 5", got)
+	}
+
+	// Changing what was returned doesn't change the store
+	events[0].Payload = "changed"
+	if got := store.Events("door_one")[0].Payload; got != "3" {
+		t.Errorf("got %s, want the store's copy unchanged", got)
+	}
+}
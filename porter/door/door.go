@@ -0,0 +1,122 @@
+package door
+
+import "metamakers.org/door-controller-mqtt/mqtt"
+
+type State int
+
+const (
+	// Locked is closed with the strike locked
+	Locked State = iota
+	// Unlocked is closed with the strike released after a granted swipe
+	Unlocked
+	// Open was opened while unlocked
+	Open
+	// HeldOpen has stayed open for longer than it should
+	HeldOpen
+	// Forced was opened while locked
+	Forced
+)
+
+func (state State) String() string {
+	switch state {
+	case Unlocked:
+		return "unlocked"
+	case Open:
+		return "open"
+	case HeldOpen:
+		return "held open"
+	case Forced:
+		return "forced open"
+	default:
+		return "locked"
+	}
+}
+
+// IsOpen reports whether the reed switch sees the door open
+func (state State) IsOpen() bool {
+	return state == Open || state == HeldOpen || state == Forced
+}
+
+// Door follows a physical door through its states. Each transition
+// returns the levels the controller publishes, in order. The strike is
+// released by Unlock and thrown again by Relock, but only once the door
+// is closed.
+type Door struct {
+	state    State
+	released bool
+	card     string
+}
+
+func (door Door) State() State {
+	return door.state
+}
+
+// Card is the card the door was last unlocked with, it's cleared when
+// the door locks again
+func (door Door) Card() string {
+	return door.card
+}
+
+// Unlock releases the strike for a granted card
+func (door *Door) Unlock(card string) []string {
+	door.released = true
+	door.card = card
+	if door.state == Locked {
+		door.state = Unlocked
+	}
+	return []string{mqtt.UnlockLevel}
+}
+
+// Relock is called once the unlock duration is over. An open door locks
+// when it's closed.
+func (door *Door) Relock() []string {
+	door.released = false
+	if door.state != Unlocked {
+		return nil
+	}
+	door.state = Locked
+	door.card = ""
+	return []string{mqtt.LockLevel}
+}
+
+// Open is the reed switch opening
+func (door *Door) Open() []string {
+	switch door.state {
+	case Locked:
+		door.state = Forced
+		return []string{mqtt.ForcedOpenLevel}
+	case Unlocked:
+		door.state = Open
+		return []string{mqtt.DoorOpenLevel}
+	}
+	return nil
+}
+
+// HoldOpen is called once the door has been open for too long
+func (door *Door) HoldOpen() []string {
+	if door.state != Open {
+		return nil
+	}
+	door.state = HeldOpen
+	return []string{mqtt.HeldOpenLevel}
+}
+
+// Close is the reed switch closing, the strike locks straight away if the
+// unlock duration is already over
+func (door *Door) Close() []string {
+	if !door.state.IsOpen() {
+		return nil
+	}
+	if door.released {
+		door.state = Unlocked
+		return []string{mqtt.DoorClosedLevel}
+	}
+	// A forced door was never unlocked, so there's nothing to lock
+	forced := door.state == Forced
+	door.state = Locked
+	door.card = ""
+	if forced {
+		return []string{mqtt.DoorClosedLevel}
+	}
+	return []string{mqtt.DoorClosedLevel, mqtt.LockLevel}
+}
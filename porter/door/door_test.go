@@ -0,0 +1,169 @@
+package door
+
+import (
+	"slices"
+	"testing"
+
+	"metamakers.org/door-controller-mqtt/mqtt"
+)
+
+type step struct {
+	action string
+	levels []string
+	state  State
+}
+
+func (step step) apply(door *Door) []string {
+	switch step.action {
+	case "unlock":
+		return door.Unlock("0001234567")
+	case "relock":
+		return door.Relock()
+	case "open":
+		return door.Open()
+	case "hold open":
+		return door.HoldOpen()
+	case "close":
+		return door.Close()
+	}
+	panic("unknown action " + step.action)
+}
+
+func TestTransitions(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "unlocked and relocked without opening",
+			steps: []step{
+				{action: "unlock", levels: []string{mqtt.UnlockLevel}, state: Unlocked},
+				{action: "relock", levels: []string{mqtt.LockLevel}, state: Locked},
+			},
+		},
+		{
+			name: "closed before the unlock duration is over",
+			steps: []step{
+				{action: "unlock", levels: []string{mqtt.UnlockLevel}, state: Unlocked},
+				{action: "open", levels: []string{mqtt.DoorOpenLevel}, state: Open},
+				{action: "close", levels: []string{mqtt.DoorClosedLevel}, state: Unlocked},
+				{action: "relock", levels: []string{mqtt.LockLevel}, state: Locked},
+			},
+		},
+		{
+			name: "closed after the unlock duration is over",
+			steps: []step{
+				{action: "unlock", levels: []string{mqtt.UnlockLevel}, state: Unlocked},
+				{action: "open", levels: []string{mqtt.DoorOpenLevel}, state: Open},
+				{action: "relock", levels: nil, state: Open},
+				{action: "close", levels: []string{mqtt.DoorClosedLevel, mqtt.LockLevel}, state: Locked},
+			},
+		},
+		{
+			name: "held open",
+			steps: []step{
+				{action: "unlock", levels: []string{mqtt.UnlockLevel}, state: Unlocked},
+				{action: "open", levels: []string{mqtt.DoorOpenLevel}, state: Open},
+				{action: "relock", levels: nil, state: Open},
+				{action: "hold open", levels: []string{mqtt.HeldOpenLevel}, state: HeldOpen},
+				{action: "hold open", levels: nil, state: HeldOpen},
+				{action: "close", levels: []string{mqtt.DoorClosedLevel, mqtt.LockLevel}, state: Locked},
+			},
+		},
+		{
+			name: "held open and closed while still unlocked",
+			steps: []step{
+				{action: "unlock", levels: []string{mqtt.UnlockLevel}, state: Unlocked},
+				{action: "open", levels: []string{mqtt.DoorOpenLevel}, state: Open},
+				{action: "hold open", levels: []string{mqtt.HeldOpenLevel}, state: HeldOpen},
+				{action: "close", levels: []string{mqtt.DoorClosedLevel}, state: Unlocked},
+			},
+		},
+		{
+			name: "forced",
+			steps: []step{
+				{action: "open", levels: []string{mqtt.ForcedOpenLevel}, state: Forced},
+				{action: "open", levels: nil, state: Forced},
+				{action: "hold open", levels: nil, state: Forced},
+				{action: "close", levels: []string{mqtt.DoorClosedLevel}, state: Locked},
+			},
+		},
+		{
+			name: "unlocked while forced open",
+			steps: []step{
+				{action: "open", levels: []string{mqtt.ForcedOpenLevel}, state: Forced},
+				{action: "unlock", levels: []string{mqtt.UnlockLevel}, state: Forced},
+				{action: "close", levels: []string{mqtt.DoorClosedLevel}, state: Unlocked},
+				{action: "relock", levels: []string{mqtt.LockLevel}, state: Locked},
+			},
+		},
+		{
+			name: "unlocked again while open",
+			steps: []step{
+				{action: "unlock", levels: []string{mqtt.UnlockLevel}, state: Unlocked},
+				{action: "open", levels: []string{mqtt.DoorOpenLevel}, state: Open},
+				{action: "unlock", levels: []string{mqtt.UnlockLevel}, state: Open},
+				{action: "close", levels: []string{mqtt.DoorClosedLevel}, state: Unlocked},
+			},
+		},
+		{
+			name: "nothing happens to a locked door",
+			steps: []step{
+				{action: "close", levels: nil, state: Locked},
+				{action: "relock", levels: nil, state: Locked},
+				{action: "hold open", levels: nil, state: Locked},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			door := Door{}
+			for index, step := range test.steps {
+				levels := step.apply(&door)
+				if !slices.Equal(levels, step.levels) {
+					t.Errorf("step %d %s: got levels %v, want %v", index+1, step.action, levels, step.levels)
+				}
+				if door.State() != step.state {
+					t.Errorf("step %d %s: got state %s, want %s", index+1, step.action, door.State(), step.state)
+				}
+			}
+		})
+	}
+}
+
+func TestCard(t *testing.T) {
+	door := Door{}
+	door.Unlock("0001234567")
+	door.Open()
+	if got := door.Card(); got != "0001234567" {
+		t.Errorf("open: got card %q, want 0001234567", got)
+	}
+	door.Relock()
+	if got := door.Card(); got != "0001234567" {
+		t.Errorf("relocked while open: got card %q, want 0001234567", got)
+	}
+	door.Close()
+	if got := door.Card(); got != "" {
+		t.Errorf("locked: got card %q, want none", got)
+	}
+}
+
+func TestIsOpen(t *testing.T) {
+	tests := []struct {
+		state State
+		want  bool
+	}{
+		{state: Locked, want: false},
+		{state: Unlocked, want: false},
+		{state: Open, want: true},
+		{state: HeldOpen, want: true},
+		{state: Forced, want: true},
+	}
+
+	for _, test := range tests {
+		if got := test.state.IsOpen(); got != test.want {
+			t.Errorf("%s: got %t, want %t", test.state, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package logging
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const rotatedTimeFormat = "20060102T150405.000"
+
+// RotatingFile writes JSON lines to a file, moving it aside once it grows
+// past MaxSize. Rotated files older than MaxAge, or past the newest
+// MaxBackups, are removed. A zero MaxAge or MaxBackups keeps them all.
+type RotatingFile struct {
+	Path       string
+	MaxSize    int64
+	MaxAge     time.Duration
+	MaxBackups int
+	file       *os.File
+	size       int64
+	mu         sync.Mutex
+}
+
+func NewRotatingFile(path string, maxSize int64, maxAge time.Duration, maxBackups int) (*RotatingFile, error) {
+	rotatingFile := &RotatingFile{
+		Path:       path,
+		MaxSize:    maxSize,
+		MaxAge:     maxAge,
+		MaxBackups: maxBackups,
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+
+	if err := rotatingFile.open(); err != nil {
+		return nil, err
+	}
+
+	return rotatingFile, nil
+}
+
+func (rotatingFile *RotatingFile) open() error {
+	file, err := os.OpenFile(rotatingFile.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	rotatingFile.file = file
+	rotatingFile.size = info.Size()
+	return nil
+}
+
+func (rotatingFile *RotatingFile) Write(p []byte) (int, error) {
+	rotatingFile.mu.Lock()
+	defer rotatingFile.mu.Unlock()
+
+	if rotatingFile.file == nil {
+		if err := rotatingFile.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	if rotatingFile.MaxSize > 0 && rotatingFile.size > 0 && rotatingFile.size+int64(len(p)) > rotatingFile.MaxSize {
+		if err := rotatingFile.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	written, err := rotatingFile.file.Write(p)
+	rotatingFile.size += int64(written)
+	return written, err
+}
+
+func (rotatingFile *RotatingFile) backupPrefix() (string, string) {
+	extension := filepath.Ext(rotatingFile.Path)
+	return strings.TrimSuffix(rotatingFile.Path, extension) + "-", extension
+}
+
+func (rotatingFile *RotatingFile) rotate() error {
+	if err := rotatingFile.file.Close(); err != nil {
+		return err
+	}
+	rotatingFile.file = nil
+
+	prefix, extension := rotatingFile.backupPrefix()
+	backup := fmt.Sprintf("%s%s%s", prefix, time.Now().UTC().Format(rotatedTimeFormat), extension)
+	if err := os.Rename(rotatingFile.Path, backup); err != nil {
+		return err
+	}
+
+	if err := rotatingFile.open(); err != nil {
+		return err
+	}
+
+	return rotatingFile.removeOldBackups()
+}
+
+func (rotatingFile *RotatingFile) removeOldBackups() error {
+	prefix, extension := rotatingFile.backupPrefix()
+	backups, err := filepath.Glob(prefix + "*" + extension)
+	if err != nil {
+		return err
+	}
+
+	// The timestamp in the name sorts the same way as the time
+	// the file was rotated so the newest backups end up first
+	sort.Sort(sort.Reverse(sort.StringSlice(backups)))
+
+	kept := 0
+	for _, backup := range backups {
+		rotatedAt, err := time.Parse(
+			rotatedTimeFormat,
+			strings.TrimSuffix(strings.TrimPrefix(backup, prefix), extension),
+		)
+		if err != nil {
+			// Not one of ours
+			continue
+		}
+
+		kept += 1
+		tooMany := rotatingFile.MaxBackups > 0 && kept > rotatingFile.MaxBackups
+		tooOld := rotatingFile.MaxAge > 0 && time.Since(rotatedAt) > rotatingFile.MaxAge
+		if tooMany || tooOld {
+			if err := os.Remove(backup); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (rotatingFile *RotatingFile) Close() error {
+	rotatingFile.mu.Lock()
+	defer rotatingFile.mu.Unlock()
+
+	if rotatingFile.file == nil {
+		return nil
+	}
+	err := rotatingFile.file.Close()
+	rotatingFile.file = nil
+	return err
+}
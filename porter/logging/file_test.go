@@ -0,0 +1,206 @@
+package logging
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func backups(t *testing.T, directory string) []string {
+	t.Helper()
+	matches, err := filepath.Glob(filepath.Join(directory, "diary-*.log"))
+	if err != nil {
+		t.Fatalf("Failed to list backups: %v", err)
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+func read(t *testing.T, path string) string {
+	t.Helper()
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", path, err)
+	}
+	return string(contents)
+}
+
+func TestRotatingFileRotatesBySize(t *testing.T) {
+	directory := t.TempDir()
+	path := filepath.Join(directory, "logs", "diary.log")
+	file, err := NewRotatingFile(path, 20, 0, 0)
+	if err != nil {
+		t.Fatalf("Failed to open: %v", err)
+	}
+	defer file.Close()
+
+	for _, line := range []string{"0123456789\n", "abcdefgh\n", "next file\n"} {
+		if _, err := file.Write([]byte(line)); err != nil {
+			t.Fatalf("Failed to write: %v", err)
+		}
+	}
+
+	// The third line would have taken the file past 20 bytes
+	rotated := backups(t, filepath.Join(directory, "logs"))
+	if len(rotated) != 1 {
+		t.Fatalf("got %v, want one backup", rotated)
+	}
+	if got := read(t, rotated[0]); got != "0123456789\nabcdefgh\n" {
+		t.Errorf("backup: got %q, want the first two lines", got)
+	}
+	if got := read(t, path); got != "next file\n" {
+		t.Errorf("current: got %q, want the third line", got)
+	}
+	name := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(rotated[0]), "diary-"), ".log")
+	if _, err := time.Parse(rotatedTimeFormat, name); err != nil {
+		t.Errorf("got backup %s, want it named by the time: %v", rotated[0], err)
+	}
+}
+
+func TestRotatingFileLongLine(t *testing.T) {
+	directory := t.TempDir()
+	path := filepath.Join(directory, "diary.log")
+	file, err := NewRotatingFile(path, 10, 0, 0)
+	if err != nil {
+		t.Fatalf("Failed to open: %v", err)
+	}
+	defer file.Close()
+
+	// A line longer than MaxSize still goes into an empty file rather
+	// than leaving an empty backup behind
+	line := strings.Repeat("x", 25) + "\n"
+	if _, err := file.Write([]byte(line)); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	if rotated := backups(t, directory); len(rotated) != 0 {
+		t.Errorf("got %v, want no backups", rotated)
+	}
+	if got := read(t, path); got != line {
+		t.Errorf("got %q, want %q", got, line)
+	}
+}
+
+func TestRotatingFileKeepsMaxBackups(t *testing.T) {
+	directory := t.TempDir()
+	path := filepath.Join(directory, "diary.log")
+	file, err := NewRotatingFile(path, 5, 0, 2)
+	if err != nil {
+		t.Fatalf("Failed to open: %v", err)
+	}
+	defer file.Close()
+
+	for _, line := range []string{"one\n", "two\n", "three\n", "four\n", "five\n"} {
+		// Backups are named to the millisecond
+		time.Sleep(5 * time.Millisecond)
+		if _, err := file.Write([]byte(line)); err != nil {
+			t.Fatalf("Failed to write: %v", err)
+		}
+	}
+
+	rotated := backups(t, directory)
+	if len(rotated) != 2 {
+		t.Fatalf("got %v, want two backups", rotated)
+	}
+	// The newest backups are the ones kept
+	if got := read(t, rotated[0]) + read(t, rotated[1]); got != "three\nfour\n" {
+		t.Errorf("got %q, want the third and fourth lines", got)
+	}
+	if got := read(t, path); got != "five\n" {
+		t.Errorf("current: got %q, want the fifth line", got)
+	}
+}
+
+func TestRotatingFileRemovesOldBackups(t *testing.T) {
+	directory := t.TempDir()
+	path := filepath.Join(directory, "diary.log")
+
+	old := filepath.Join(directory, "diary-"+time.Now().Add(-48*time.Hour).UTC().Format(rotatedTimeFormat)+".log")
+	recent := filepath.Join(directory, "diary-"+time.Now().Add(-time.Hour).UTC().Format(rotatedTimeFormat)+".log")
+	foreign := filepath.Join(directory, "diary-notes.log")
+	for _, name := range []string{old, recent, foreign} {
+		if err := os.WriteFile(name, []byte("kept?\n"), 0o640); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	file, err := NewRotatingFile(path, 5, 24*time.Hour, 0)
+	if err != nil {
+		t.Fatalf("Failed to open: %v", err)
+	}
+	defer file.Close()
+	for _, line := range []string{"one\n", "two\n"} {
+		if _, err := file.Write([]byte(line)); err != nil {
+			t.Fatalf("Failed to write: %v", err)
+		}
+	}
+
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Errorf("got %v, want the backup from two days ago removed", err)
+	}
+	for _, name := range []string{recent, foreign} {
+		if _, err := os.Stat(name); err != nil {
+			t.Errorf("got %v, want %s kept", err, filepath.Base(name))
+		}
+	}
+	// The recent backup, the one just rotated and a file that isn't a backup
+	if rotated := backups(t, directory); len(rotated) != 3 {
+		t.Errorf("got %v, want three files", rotated)
+	}
+}
+
+func TestRotatingFileAppends(t *testing.T) {
+	directory := t.TempDir()
+	path := filepath.Join(directory, "diary.log")
+	if err := os.WriteFile(path, []byte("before restart\n"), 0o640); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+
+	// What was already there counts towards MaxSize
+	file, err := NewRotatingFile(path, 20, 0, 0)
+	if err != nil {
+		t.Fatalf("Failed to open: %v", err)
+	}
+	defer file.Close()
+	if _, err := file.Write([]byte("after restart\n")); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+
+	rotated := backups(t, directory)
+	if len(rotated) != 1 || read(t, rotated[0]) != "before restart\n" {
+		t.Errorf("got %v, want the old lines rotated away", rotated)
+	}
+	if got := read(t, path); got != "after restart\n" {
+		t.Errorf("got %q, want the new line", got)
+	}
+}
+
+func TestRotatingFileWriteAfterClose(t *testing.T) {
+	directory := t.TempDir()
+	path := filepath.Join(directory, "diary.log")
+	file, err := NewRotatingFile(path, 0, 0, 0)
+	if err != nil {
+		t.Fatalf("Failed to open: %v", err)
+	}
+
+	if _, err := file.Write([]byte("one\n")); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		t.Errorf("got %v closing twice, want no error", err)
+	}
+	// Log lines written while shutting down aren't lost
+	if _, err := file.Write([]byte("two\n")); err != nil {
+		t.Fatalf("Failed to write after closing: %v", err)
+	}
+	file.Close()
+
+	if got := read(t, path); got != "one\ntwo\n" {
+		t.Errorf("got %q, want both lines", got)
+	}
+}
@@ -0,0 +1,28 @@
+package logging
+
+import (
+	"io"
+
+	"github.com/rs/zerolog"
+)
+
+// LevelFilter only passes on log lines at or above its level so each
+// sink can decide how chatty it wants to be
+type LevelFilter struct {
+	Writer io.Writer
+	Level  zerolog.Level
+}
+
+func (filter LevelFilter) Write(p []byte) (int, error) {
+	return filter.Writer.Write(p)
+}
+
+func (filter LevelFilter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	if level < filter.Level {
+		return len(p), nil
+	}
+	if levelWriter, ok := filter.Writer.(zerolog.LevelWriter); ok {
+		return levelWriter.WriteLevel(level, p)
+	}
+	return filter.Writer.Write(p)
+}
@@ -0,0 +1,96 @@
+package logging
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+// levelRecorder remembers the level of every line it's given
+type levelRecorder struct {
+	levels []zerolog.Level
+}
+
+func (recorder *levelRecorder) Write(p []byte) (int, error) {
+	recorder.levels = append(recorder.levels, zerolog.NoLevel)
+	return len(p), nil
+}
+
+func (recorder *levelRecorder) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	recorder.levels = append(recorder.levels, level)
+	return len(p), nil
+}
+
+func TestLevelFilterPerSink(t *testing.T) {
+	var console, file bytes.Buffer
+	logger := zerolog.New(zerolog.MultiLevelWriter(
+		LevelFilter{Writer: &console, Level: zerolog.WarnLevel},
+		LevelFilter{Writer: &file, Level: zerolog.DebugLevel},
+	)).Level(zerolog.TraceLevel)
+
+	logger.Trace().Msg("trace")
+	logger.Debug().Msg("debug")
+	logger.Info().Msg("info")
+	logger.Warn().Msg("warn")
+	logger.Error().Msg("error")
+
+	tests := []struct {
+		sink string
+		got  string
+		want []string
+	}{
+		{sink: "console", got: console.String(), want: []string{"warn", "error"}},
+		{sink: "file", got: file.String(), want: []string{"debug", "info", "warn", "error"}},
+	}
+
+	for _, test := range tests {
+		lines := strings.Split(strings.TrimSpace(test.got), "\n")
+		if len(lines) != len(test.want) {
+			t.Fatalf("%s: got %d lines, want %d: %s", test.sink, len(lines), len(test.want), test.got)
+		}
+		for index, line := range lines {
+			if !strings.Contains(line, `"message":"`+test.want[index]+`"`) {
+				t.Errorf("%s line %d: got %s, want %s", test.sink, index+1, line, test.want[index])
+			}
+		}
+	}
+}
+
+func TestLevelFilterPassesLevelOn(t *testing.T) {
+	recorder := &levelRecorder{}
+	filter := LevelFilter{Writer: recorder, Level: zerolog.InfoLevel}
+
+	filter.WriteLevel(zerolog.DebugLevel, []byte("dropped\n"))
+	written, err := filter.WriteLevel(zerolog.ErrorLevel, []byte("kept\n"))
+	if err != nil || written != len("kept\n") {
+		t.Errorf("got %d, %v, want %d, nil", written, err, len("kept\n"))
+	}
+	// Lines without a level aren't filtered
+	filter.Write([]byte("plain\n"))
+
+	want := []zerolog.Level{zerolog.ErrorLevel, zerolog.NoLevel}
+	if len(recorder.levels) != len(want) {
+		t.Fatalf("got %v, want %v", recorder.levels, want)
+	}
+	for index := range want {
+		if recorder.levels[index] != want[index] {
+			t.Errorf("got %v, want %v", recorder.levels, want)
+		}
+	}
+}
+
+func TestLevelFilterDropsQuietly(t *testing.T) {
+	var buffer bytes.Buffer
+	filter := LevelFilter{Writer: &buffer, Level: zerolog.ErrorLevel}
+
+	// Dropping a line isn't a short write, so the other sinks still get it
+	written, err := filter.WriteLevel(zerolog.InfoLevel, []byte("dropped\n"))
+	if err != nil || written != len("dropped\n") {
+		t.Errorf("got %d, %v, want %d, nil", written, err, len("dropped\n"))
+	}
+	if buffer.Len() != 0 {
+		t.Errorf("got %q, want nothing written", buffer.String())
+	}
+}
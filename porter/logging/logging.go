@@ -0,0 +1,24 @@
+package logging
+
+import (
+	"io"
+	"os"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+type Sink struct {
+	Writer io.Writer
+	Level  zerolog.Level
+}
+
+// Init replaces the global logger so every line goes to stderr, as it
+// always has, and to each of the provided sinks
+func Init(sinks ...Sink) {
+	writers := []io.Writer{os.Stderr}
+	for _, sink := range sinks {
+		writers = append(writers, LevelFilter{Writer: sink.Writer, Level: sink.Level})
+	}
+	log.Logger = zerolog.New(zerolog.MultiLevelWriter(writers...)).With().Timestamp().Logger()
+}
@@ -0,0 +1,154 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+const syslogFacilityDaemon = 3
+
+var syslogSeverities = map[zerolog.Level]int{
+	zerolog.TraceLevel: 7,
+	zerolog.DebugLevel: 7,
+	zerolog.InfoLevel:  6,
+	zerolog.WarnLevel:  4,
+	zerolog.ErrorLevel: 3,
+	zerolog.FatalLevel: 2,
+	zerolog.PanicLevel: 1,
+	zerolog.NoLevel:    5,
+}
+
+// SyslogWriter sends every log line as an RFC 5424 message. The zerolog
+// JSON line is used as the message so nothing is lost along the way.
+type SyslogWriter struct {
+	network  string
+	address  string
+	appName  string
+	hostname string
+	conn     net.Conn
+	mu       sync.Mutex
+}
+
+func NewSyslogWriter(network string, address string, appName string) (*SyslogWriter, error) {
+	switch network {
+	case "udp", "tcp", "unix", "unixgram":
+	default:
+		return nil, fmt.Errorf("Unsupported syslog network: %s", network)
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "-"
+	}
+
+	writer := &SyslogWriter{
+		network:  network,
+		address:  address,
+		appName:  appName,
+		hostname: hostname,
+	}
+
+	if err := writer.connect(); err != nil {
+		return nil, err
+	}
+
+	return writer, nil
+}
+
+func (writer *SyslogWriter) connect() error {
+	if writer.conn != nil {
+		writer.conn.Close()
+		writer.conn = nil
+	}
+
+	conn, err := net.DialTimeout(writer.network, writer.address, time.Second*5)
+	if err != nil {
+		return err
+	}
+	writer.conn = conn
+	return nil
+}
+
+func (writer *SyslogWriter) format(level zerolog.Level, p []byte) []byte {
+	severity, found := syslogSeverities[level]
+	if !found {
+		severity = syslogSeverities[zerolog.NoLevel]
+	}
+
+	msgID := "-"
+	var fields struct {
+		Event string `json:"event"`
+	}
+	if err := json.Unmarshal(p, &fields); err == nil && fields.Event != "" {
+		msgID = fields.Event
+	}
+
+	message := fmt.Sprintf(
+		"<%d>1 %s %s %s %d %s - %s",
+		syslogFacilityDaemon*8+severity,
+		time.Now().Format(time.RFC3339Nano),
+		writer.hostname,
+		writer.appName,
+		os.Getpid(),
+		msgID,
+		strings.TrimRight(string(p), "\n"),
+	)
+
+	// Stream transports need framing so the receiver knows where each
+	// message ends. TCP uses RFC 6587 octet counting, local stream sockets
+	// are read a line at a time. Datagrams are a message each.
+	switch writer.network {
+	case "tcp":
+		message = fmt.Sprintf("%d %s", len(message), message)
+	case "unix":
+		message += "\n"
+	}
+
+	return []byte(message)
+}
+
+func (writer *SyslogWriter) Write(p []byte) (int, error) {
+	return writer.WriteLevel(zerolog.NoLevel, p)
+}
+
+func (writer *SyslogWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	writer.mu.Lock()
+	defer writer.mu.Unlock()
+
+	message := writer.format(level, p)
+
+	if writer.conn != nil {
+		if _, err := writer.conn.Write(message); err == nil {
+			return len(p), nil
+		}
+	}
+
+	// The syslog daemon may have restarted, try once more with a new
+	// connection before giving up on this line
+	if err := writer.connect(); err != nil {
+		return 0, err
+	}
+	if _, err := writer.conn.Write(message); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (writer *SyslogWriter) Close() error {
+	writer.mu.Lock()
+	defer writer.mu.Unlock()
+
+	if writer.conn == nil {
+		return nil
+	}
+	err := writer.conn.Close()
+	writer.conn = nil
+	return err
+}
@@ -0,0 +1,281 @@
+package logging
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// rfc5424 splits a message into PRI, timestamp, hostname, app name, proc
+// ID, message ID, structured data and the message itself
+var rfc5424 = regexp.MustCompile(`^<(\d+)>1 (\S+) (\S+) (\S+) (\d+) (\S+) (-) (.*)$`)
+
+// collector is a fake syslog server, every message it reads is sent on
+type collector struct {
+	messages chan string
+}
+
+func (collector *collector) next(t *testing.T) string {
+	t.Helper()
+	select {
+	case message := <-collector.messages:
+		return message
+	case <-time.After(5 * time.Second):
+		t.Fatal("The collector received nothing")
+		return ""
+	}
+}
+
+// listenTCP reads octet counted messages from every connection
+func listenTCP(t *testing.T) (*collector, net.Listener) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	collector := &collector{messages: make(chan string, 10)}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				for {
+					length, err := reader.ReadString(' ')
+					if err != nil {
+						return
+					}
+					count, err := strconv.Atoi(strings.TrimSuffix(length, " "))
+					if err != nil {
+						collector.messages <- fmt.Sprintf("bad octet count %q", length)
+						return
+					}
+					message := make([]byte, count)
+					if _, err := io.ReadFull(reader, message); err != nil {
+						return
+					}
+					collector.messages <- string(message)
+				}
+			}()
+		}
+	}()
+	return collector, listener
+}
+
+// listenUnix reads a message per line from every connection
+func listenUnix(t *testing.T, path string) *collector {
+	t.Helper()
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	collector := &collector{messages: make(chan string, 10)}
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			collector.messages <- scanner.Text()
+		}
+	}()
+	return collector
+}
+
+// listenPacket reads a message per datagram
+func listenPacket(t *testing.T, network string, address string) (*collector, string) {
+	t.Helper()
+	conn, err := net.ListenPacket(network, address)
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	collector := &collector{messages: make(chan string, 10)}
+	go func() {
+		buffer := make([]byte, 64*1024)
+		for {
+			read, _, err := conn.ReadFrom(buffer)
+			if err != nil {
+				return
+			}
+			collector.messages <- string(buffer[:read])
+		}
+	}()
+	return collector, conn.LocalAddr().String()
+}
+
+func TestSyslogFraming(t *testing.T) {
+	// Unix socket paths have to be short
+	directory, err := os.MkdirTemp("", "syslog")
+	if err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(directory) })
+
+	tests := []struct {
+		network string
+		listen  func(t *testing.T) (*collector, string)
+	}{
+		{network: "tcp", listen: func(t *testing.T) (*collector, string) {
+			collector, listener := listenTCP(t)
+			return collector, listener.Addr().String()
+		}},
+		{network: "udp", listen: func(t *testing.T) (*collector, string) {
+			return listenPacket(t, "udp", "127.0.0.1:0")
+		}},
+		{network: "unix", listen: func(t *testing.T) (*collector, string) {
+			path := filepath.Join(directory, "stream.sock")
+			return listenUnix(t, path), path
+		}},
+		{network: "unixgram", listen: func(t *testing.T) (*collector, string) {
+			return listenPacket(t, "unixgram", filepath.Join(directory, "dgram.sock"))
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.network, func(t *testing.T) {
+			collector, address := test.listen(t)
+			writer, err := NewSyslogWriter(test.network, address, "porter-diary")
+			if err != nil {
+				t.Fatalf("Failed to connect: %v", err)
+			}
+			defer writer.Close()
+
+			for _, line := range []string{`{"level":"warn","event":"Unhealthy"}` + "\n", `{"level":"error","event":"ForcedEntry"}` + "\n"} {
+				if _, err := writer.WriteLevel(zerolog.WarnLevel, []byte(line)); err != nil {
+					t.Fatalf("Failed to write: %v", err)
+				}
+			}
+			// Both messages arrive whole and apart
+			for _, want := range []string{`{"level":"warn","event":"Unhealthy"}`, `{"level":"error","event":"ForcedEntry"}`} {
+				message := collector.next(t)
+				if !strings.HasPrefix(message, "<") || !strings.HasSuffix(message, " - "+want) {
+					t.Errorf("got %q, want it to end with %s", message, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSyslogFormat(t *testing.T) {
+	collector, address := listenPacket(t, "udp", "127.0.0.1:0")
+	writer, err := NewSyslogWriter("udp", address, "porter-diary")
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer writer.Close()
+	hostname, _ := os.Hostname()
+
+	tests := []struct {
+		name  string
+		level zerolog.Level
+		line  string
+		pri   int
+		msgID string
+	}{
+		{name: "error", level: zerolog.ErrorLevel, line: `{"level":"error","event":"ForcedEntry","message":"Door door_one was forced open"}`, pri: 27, msgID: "ForcedEntry"},
+		{name: "warn", level: zerolog.WarnLevel, line: `{"level":"warn","event":"Unhealthy"}`, pri: 28, msgID: "Unhealthy"},
+		{name: "info", level: zerolog.InfoLevel, line: `{"level":"info"}`, pri: 30, msgID: "-"},
+		{name: "debug", level: zerolog.DebugLevel, line: `{"level":"debug","event":""}`, pri: 31, msgID: "-"},
+		{name: "fatal", level: zerolog.FatalLevel, line: `{"level":"fatal","event":"Start"}`, pri: 26, msgID: "Start"},
+		{name: "no level", level: zerolog.NoLevel, line: `not json`, pri: 29, msgID: "-"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			before := time.Now()
+			if _, err := writer.WriteLevel(test.level, []byte(test.line+"\n")); err != nil {
+				t.Fatalf("Failed to write: %v", err)
+			}
+			message := collector.next(t)
+
+			parts := rfc5424.FindStringSubmatch(message)
+			if parts == nil {
+				t.Fatalf("got %q, want an RFC 5424 message", message)
+			}
+			if pri, _ := strconv.Atoi(parts[1]); pri != test.pri {
+				t.Errorf("PRI: got %d, want %d", pri, test.pri)
+			}
+			timestamp, err := time.Parse(time.RFC3339Nano, parts[2])
+			if err != nil {
+				t.Errorf("timestamp: got %s, want RFC 3339: %v", parts[2], err)
+			} else if timestamp.Before(before.Truncate(time.Second)) || time.Since(timestamp) > 5*time.Second {
+				t.Errorf("timestamp: got %s, want now", timestamp)
+			}
+			if parts[3] != hostname || parts[4] != "porter-diary" || parts[5] != strconv.Itoa(os.Getpid()) {
+				t.Errorf("got host %s app %s pid %s, want %s porter-diary %d", parts[3], parts[4], parts[5], hostname, os.Getpid())
+			}
+			if parts[6] != test.msgID {
+				t.Errorf("MSGID: got %s, want %s", parts[6], test.msgID)
+			}
+			if parts[8] != test.line {
+				t.Errorf("message: got %s, want %s", parts[8], test.line)
+			}
+		})
+	}
+}
+
+func TestSyslogOctetCount(t *testing.T) {
+	writer := &SyslogWriter{network: "tcp", appName: "porter-diary", hostname: "door-host"}
+	// The count is in bytes, not characters
+	framed := string(writer.format(zerolog.InfoLevel, []byte(`{"message":"Café"}`)))
+	length, message, _ := strings.Cut(framed, " ")
+	if count, _ := strconv.Atoi(length); count != len(message) {
+		t.Errorf("got a count of %s for %d bytes", length, len(message))
+	}
+}
+
+func TestSyslogReconnects(t *testing.T) {
+	collector, listener := listenTCP(t)
+	writer, err := NewSyslogWriter("tcp", listener.Addr().String(), "porter-diary")
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer writer.Close()
+
+	// Writing to a connection the server has gone from eventually fails,
+	// and the writer connects again for the next line
+	writer.conn.Close()
+	if _, err := writer.Write([]byte(`{"event":"AfterRestart"}`)); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	if message := collector.next(t); !strings.Contains(message, "AfterRestart") {
+		t.Errorf("got %q, want the line after reconnecting", message)
+	}
+}
+
+func TestSyslogErrors(t *testing.T) {
+	if _, err := NewSyslogWriter("sctp", "localhost:514", "porter-diary"); err == nil || !strings.Contains(err.Error(), "Unsupported syslog network: sctp") {
+		t.Errorf("got %v, want the network rejected", err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+	if _, err := NewSyslogWriter("tcp", address, "porter-diary"); err == nil {
+		t.Error("got no error connecting to a closed port")
+	}
+}
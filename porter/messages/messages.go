@@ -1,15 +1,25 @@
 package messages
 
-import "github.com/eclipse/paho.golang/autopaho"
+import (
+	"time"
+
+	"github.com/eclipse/paho.golang/autopaho"
+	"github.com/eclipse/paho.golang/paho"
+
+	"metamakers.org/door-controller-mqtt/connection"
+	"metamakers.org/door-controller-mqtt/mqtt"
+)
 
 type Init int
 
 type MqttMessage struct {
-	Topic   string
-	Payload string
+	Topic      string
+	Payload    string
+	Properties *paho.PublishProperties
 }
 
 type MqttStatus struct {
+	Broker    string
 	Reason    string
 	Code      byte
 	Err       error
@@ -27,9 +37,12 @@ type MqttServerConnection struct {
 }
 
 type MqttCredentials struct {
-	URI      string
-	Username string
-	Password string
+	URIs      []string
+	Namespace mqtt.Namespace
+	Username  string
+	Password  string
+	ClientID  string
+	Transport connection.Transport
 }
 
 type PublishMessage struct {
@@ -46,3 +59,65 @@ type SubscribeMessage struct {
 type DoorTopicSelectionMessage map[string]bool
 type ResponseOptionsSelectionMessage map[string]bool
 type DoorCodeTextMessage string
+
+// ResendCodeMessage swipes a code from the swipe history again, any card
+// waiting for a PIN is given up on
+type ResendCodeMessage string
+
+// EditCodeMessage puts a code from the swipe history in the text input
+type EditCodeMessage string
+
+// FavouritesSavedMessage is sent once the swipe history's favourites have
+// been written
+type FavouritesSavedMessage struct {
+	Path string
+	Err  error
+}
+
+// PinTextMessage is a PIN entered at the keypad after a card that needs one
+type PinTextMessage string
+type Tick time.Time
+
+// CardListMessage is sent once mimic has checked a received access list,
+// Count is the number of cards kept
+type CardListMessage struct {
+	Count int
+	Err   error
+}
+
+// FaultTimerMessage is sent when a timed fault is due. Generation stops
+// timers from before the faults last changed from firing.
+type FaultTimerMessage struct {
+	Fault      string
+	Generation int
+}
+
+// FaultInjectedMessage describes a fault mimic injected that isn't seen
+// in what it publishes
+type FaultInjectedMessage struct {
+	Fault  string
+	Detail string
+}
+
+// InvalidCardMessage is a code entered at the door that isn't a card in
+// the reader's encoding
+type InvalidCardMessage struct {
+	Code string
+	Err  error
+}
+
+// DoorSensorMessage is the door's reed switch opening or closing
+type DoorSensorMessage struct {
+	Open bool
+}
+
+// RelockMessage is sent once the unlock duration is over. Generation
+// stops the timer from an earlier unlock relocking the door.
+type RelockMessage struct {
+	Generation int
+}
+
+// HeldOpenMessage is sent once the door has been open for too long
+type HeldOpenMessage struct {
+	Generation int
+}
@@ -0,0 +1,126 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"metamakers.org/door-controller-mqtt/messages"
+)
+
+// CardListWindow shows the cards mimic decides swipes with. The cards
+// live in the device so the rpc methods see the same list.
+type CardListWindow struct {
+	device      *mimicDevice
+	filtering   bool
+	FilterInput textinput.Model
+	Viewport    viewport.Model
+	Window
+}
+
+func NewCardListWindow(device *mimicDevice, focused bool) CardListWindow {
+	filterInput := textinput.New()
+	filterInput.Prompt = "/"
+	filterInput.Placeholder = "search cards"
+	filterInput.CharLimit = device.Encoding().MaxLength()
+
+	return CardListWindow{
+		device:      device,
+		filtering:   false,
+		FilterInput: filterInput,
+		Viewport:    viewport.New(0, 0),
+		Window: Window{
+			focused: focused,
+			Width:   0,
+			Height:  0,
+			Margin:  Orientation{0, 1, 0, 0},
+			Padding: Orientation{0, 2, 0, 2},
+			Border:  Border{true, true, true, true},
+		},
+	}
+}
+
+func (cardListWindow CardListWindow) Update(msg tea.Msg) (CardListWindow, tea.Cmd) {
+	cmds := make([]tea.Cmd, 0)
+
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		if !cardListWindow.IsFocused() {
+			break
+		}
+		if cardListWindow.filtering {
+			if msg.Type == tea.KeyEnter || msg.Type == tea.KeyEsc {
+				cardListWindow.filtering = false
+				cardListWindow.FilterInput.Blur()
+				break
+			}
+			var filterCmd tea.Cmd
+			cardListWindow.FilterInput, filterCmd = cardListWindow.FilterInput.Update(msg)
+			cmds = append(cmds, filterCmd)
+			break
+		}
+		if msg.String() == "/" {
+			cardListWindow.filtering = true
+			cmds = append(cmds, cardListWindow.FilterInput.Focus())
+			break
+		}
+		var viewportCmd tea.Cmd
+		cardListWindow.Viewport, viewportCmd = cardListWindow.Viewport.Update(msg)
+		cmds = append(cmds, viewportCmd)
+	case messages.CardListMessage:
+		cardListWindow.Viewport.GotoTop()
+	}
+
+	cardListWindow.Viewport.SetContent(strings.Join(cardListWindow.device.SearchCards(cardListWindow.FilterInput.Value()), "\n"))
+
+	return cardListWindow, tea.Batch(cmds...)
+}
+
+// IsFiltering lets the other windows ignore keys typed into the search
+func (cardListWindow CardListWindow) IsFiltering() bool {
+	return cardListWindow.filtering
+}
+
+func (cardListWindow CardListWindow) UpdateDimensions(width int, height int) CardListWindow {
+	cardListWindow.SetWidth(width)
+	cardListWindow.SetHeight(height)
+
+	// Leave room for the header, count and search lines
+	cardListWindow.Viewport.Width = cardListWindow.GetInnerWidth()
+	cardListWindow.Viewport.Height = max(cardListWindow.GetInnerHeight()-4, 1)
+	cardListWindow.FilterInput.Width = max(cardListWindow.GetInnerWidth()-4, 1)
+
+	return cardListWindow
+}
+
+func (cardListWindow CardListWindow) renderCount() string {
+	count := cardListWindow.device.CardCount()
+	summary := fmt.Sprintf("%d cards", count)
+	if query := cardListWindow.FilterInput.Value(); query != "" {
+		summary = fmt.Sprintf("%d of %d cards match", len(cardListWindow.device.SearchCards(query)), count)
+	}
+
+	updated, err := cardListWindow.device.ListStatus()
+	switch {
+	case updated.IsZero():
+		summary += ", waiting for an access list"
+	case err != nil:
+		summary += fmt.Sprintf(", list rejected at %s", updated.Format("15:04:05"))
+	default:
+		summary += fmt.Sprintf(", updated at %s", updated.Format("15:04:05"))
+	}
+	return summary
+}
+
+func (cardListWindow CardListWindow) Render() string {
+	return cardListWindow.Window.Render(lipgloss.JoinVertical(
+		lipgloss.Left,
+		header.Render("Card List"),
+		text.Render(cardListWindow.renderCount()),
+		cardListWindow.Viewport.View(),
+		cardListWindow.FilterInput.View(),
+	))
+}
@@ -6,18 +6,25 @@ import (
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"metamakers.org/door-controller-mqtt/config"
+	"metamakers.org/door-controller-mqtt/messages"
 )
 
 type DocumentWindow struct {
-	logWindow    LogWindow
-	statusWindow StatusWindow
+	logWindow          LogWindow
+	statusWindow       StatusWindow
+	cardListWindow     CardListWindow
+	swipeHistoryWindow SwipeHistoryWindow
 	Window
 }
 
-func NewDocumentWindow(ctx context.Context, width int, height int) DocumentWindow {
+func NewDocumentWindow(ctx context.Context, width int, height int, mimicConfig config.MimicConfig) DocumentWindow {
+	statusWindow := NewStatusWindow(ctx, false, mimicConfig)
 	documentWindow := DocumentWindow{
-		logWindow:    NewLogWindow(true),
-		statusWindow: NewStatusWindow(ctx, false),
+		logWindow:          NewLogWindow(true),
+		statusWindow:       statusWindow,
+		cardListWindow:     NewCardListWindow(statusWindow.device, false),
+		swipeHistoryWindow: NewSwipeHistoryWindow(false, mimicConfig),
 		Window: Window{
 			focused: true,
 			Width:   width,
@@ -36,13 +43,34 @@ func (documentWindow DocumentWindow) Update(msg tea.Msg) (DocumentWindow, tea.Cm
 
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
-		if msg.Type == tea.KeyCtrlRight {
+		if msg.Type == tea.KeyCtrlRight || msg.Type == tea.KeyCtrlUp {
 			documentWindow.logWindow.Focus()
 			documentWindow.statusWindow.Blur()
+			documentWindow.cardListWindow.Blur()
+			documentWindow.swipeHistoryWindow.Blur()
 		} else if msg.Type == tea.KeyCtrlLeft {
 			documentWindow.logWindow.Blur()
 			documentWindow.statusWindow.Focus()
+			documentWindow.cardListWindow.Blur()
+			documentWindow.swipeHistoryWindow.Blur()
+		} else if msg.Type == tea.KeyCtrlDown {
+			// ctrl+down moves between the card list and the swipe history
+			toHistory := documentWindow.cardListWindow.IsFocused()
+			documentWindow.logWindow.Blur()
+			documentWindow.statusWindow.Blur()
+			documentWindow.cardListWindow.Blur()
+			documentWindow.swipeHistoryWindow.Blur()
+			if toHistory {
+				documentWindow.swipeHistoryWindow.Focus()
+			} else {
+				documentWindow.cardListWindow.Focus()
+			}
 		}
+	case messages.EditCodeMessage:
+		documentWindow.logWindow.Blur()
+		documentWindow.statusWindow.Focus()
+		documentWindow.cardListWindow.Blur()
+		documentWindow.swipeHistoryWindow.Blur()
 	}
 
 	var logWindowCmd tea.Cmd
@@ -53,6 +81,14 @@ func (documentWindow DocumentWindow) Update(msg tea.Msg) (DocumentWindow, tea.Cm
 	documentWindow.statusWindow, statusWindowCmd = documentWindow.statusWindow.Update(msg)
 	cmds = append(cmds, statusWindowCmd)
 
+	var cardListWindowCmd tea.Cmd
+	documentWindow.cardListWindow, cardListWindowCmd = documentWindow.cardListWindow.Update(msg)
+	cmds = append(cmds, cardListWindowCmd)
+
+	var swipeHistoryWindowCmd tea.Cmd
+	documentWindow.swipeHistoryWindow, swipeHistoryWindowCmd = documentWindow.swipeHistoryWindow.Update(msg)
+	cmds = append(cmds, swipeHistoryWindowCmd)
+
 	return documentWindow, tea.Batch(cmds...)
 }
 
@@ -64,9 +100,21 @@ func (documentWindow DocumentWindow) UpdateDimensions(width int, height int) Doc
 		35,
 		documentWindow.GetInnerHeight(),
 	)
+	// The card list sits under the log and gets a third of the height
+	cardListHeight := max(documentWindow.GetInnerHeight()/3, 8)
 	documentWindow.logWindow = documentWindow.logWindow.UpdateDimensions(
 		documentWindow.GetInnerWidth()-35,
-		documentWindow.GetInnerHeight(),
+		documentWindow.GetInnerHeight()-cardListHeight,
+	)
+	// The swipe history sits beside the card list, each taking half
+	cardListWidth := (documentWindow.GetInnerWidth() - 35) / 2
+	documentWindow.cardListWindow = documentWindow.cardListWindow.UpdateDimensions(
+		cardListWidth,
+		cardListHeight,
+	)
+	documentWindow.swipeHistoryWindow = documentWindow.swipeHistoryWindow.UpdateDimensions(
+		documentWindow.GetInnerWidth()-35-cardListWidth,
+		cardListHeight,
 	)
 	return documentWindow
 }
@@ -94,7 +142,15 @@ func (documentWindow DocumentWindow) Render() string {
 	doc.WriteString(lipgloss.JoinHorizontal(
 		lipgloss.Top,
 		documentWindow.statusWindow.Render(),
-		documentWindow.logWindow.Render(),
+		lipgloss.JoinVertical(
+			lipgloss.Left,
+			documentWindow.logWindow.Render(),
+			lipgloss.JoinHorizontal(
+				lipgloss.Top,
+				documentWindow.cardListWindow.Render(),
+				documentWindow.swipeHistoryWindow.Render(),
+			),
+		),
 	))
 
 	doc.WriteString("\n\n")
@@ -0,0 +1,82 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/reflow/truncate"
+	"metamakers.org/door-controller-mqtt/diary"
+)
+
+type DoorDetailWindow struct {
+	store *diary.Store
+	Window
+}
+
+func NewDoorDetailWindow(store *diary.Store) DoorDetailWindow {
+	return DoorDetailWindow{
+		store: store,
+		Window: Window{
+			focused: false,
+			Width:   0,
+			Height:  0,
+			Margin:  Orientation{1, 1, 0, 0},
+			Padding: Orientation{1, 2, 1, 2},
+			Border:  Border{true, true, true, true},
+		},
+	}
+}
+
+func (doorDetailWindow DoorDetailWindow) UpdateDimensions(width int, height int) DoorDetailWindow {
+	doorDetailWindow.SetWidth(width)
+	doorDetailWindow.SetHeight(height)
+	return doorDetailWindow
+}
+
+func (doorDetailWindow DoorDetailWindow) Render(clientID string) string {
+	clientHealth, found := doorDetailWindow.store.Client(clientID)
+	if !found {
+		return doorDetailWindow.Window.Render(
+			header.Render("Door Details"),
+			statusText.Render("No door selected"),
+		)
+	}
+
+	color := healthyColor
+	if clientHealth.State == diary.Unhealthy {
+		color = unhealthyColor
+	}
+
+	// Headers, health and spacing take up ten lines
+	eventLines := doorDetailWindow.GetInnerHeight() - 10
+	events := doorDetailWindow.store.Events(clientID)
+	if eventLines > 0 && len(events) > eventLines {
+		events = events[len(events)-eventLines:]
+	}
+
+	eventTexts := make([]string, 0)
+	for index := len(events) - 1; index >= 0; index-- {
+		event := events[index]
+		eventTexts = append(eventTexts, truncate.StringWithTail(
+			fmt.Sprintf("%s %-13s %s", event.Time.Format("15:04:05"), event.Level, event.Payload),
+			uint(doorDetailWindow.GetInnerWidth()),
+			"…",
+		))
+	}
+	lines := strings.Join(eventTexts, "\n")
+
+	return doorDetailWindow.Window.Render(lipgloss.JoinVertical(
+		lipgloss.Left,
+		header.Render("Door Details"),
+		statusText.Render(lipgloss.JoinVertical(
+			lipgloss.Left,
+			fmt.Sprintf("Client ID:       %s", clientID),
+			lipgloss.NewStyle().Foreground(color).Render(fmt.Sprintf("State:           %s", clientHealth.State)),
+			fmt.Sprintf("Last seen:       %s", clientHealth.LastSeen.Format("2006-01-02 15:04:05")),
+			fmt.Sprintf("Unhealthy after: %s", clientHealth.UnhealthyAfter.Format("2006-01-02 15:04:05")),
+		)),
+		header.Copy().MarginTop(1).Render("Recent Events"),
+		lines,
+	))
+}
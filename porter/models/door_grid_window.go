@@ -0,0 +1,155 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"metamakers.org/door-controller-mqtt/diary"
+)
+
+const doorCellWidth = 22
+
+type DoorGridWindow struct {
+	store    *diary.Store
+	selected string
+	previous key.Binding
+	next     key.Binding
+	Window
+}
+
+func NewDoorGridWindow(store *diary.Store, focused bool) DoorGridWindow {
+	return DoorGridWindow{
+		store:    store,
+		selected: "",
+		previous: key.NewBinding(key.WithKeys("k", "up", "h", "left")),
+		next:     key.NewBinding(key.WithKeys("j", "down", "l", "right")),
+		Window: Window{
+			focused: focused,
+			Width:   0,
+			Height:  0,
+			Margin:  Orientation{1, 1, 0, 0},
+			Padding: Orientation{1, 2, 1, 2},
+			Border:  Border{true, true, true, true},
+		},
+	}
+}
+
+func (doorGridWindow DoorGridWindow) Doors() []string {
+	doors := make([]string, 0)
+	for clientID := range doorGridWindow.store.Clients() {
+		doors = append(doors, clientID)
+	}
+	sort.Strings(doors)
+	return doors
+}
+
+// Selected returns the selected door, falling back to the first door
+// once one has been seen
+func (doorGridWindow DoorGridWindow) Selected() string {
+	doors := doorGridWindow.Doors()
+	for _, door := range doors {
+		if door == doorGridWindow.selected {
+			return door
+		}
+	}
+	if len(doors) > 0 {
+		return doors[0]
+	}
+	return ""
+}
+
+func (doorGridWindow DoorGridWindow) Update(msg tea.Msg) (DoorGridWindow, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		if !doorGridWindow.IsFocused() {
+			break
+		}
+		doors := doorGridWindow.Doors()
+		if len(doors) == 0 {
+			break
+		}
+		index := 0
+		for position, door := range doors {
+			if door == doorGridWindow.Selected() {
+				index = position
+			}
+		}
+		switch {
+		case key.Matches(msg, doorGridWindow.previous):
+			if index-1 >= 0 {
+				index -= 1
+			}
+		case key.Matches(msg, doorGridWindow.next):
+			if index+1 < len(doors) {
+				index += 1
+			}
+		}
+		doorGridWindow.selected = doors[index]
+	}
+	return doorGridWindow, nil
+}
+
+func (doorGridWindow DoorGridWindow) UpdateDimensions(width int, height int) DoorGridWindow {
+	doorGridWindow.SetWidth(width)
+	doorGridWindow.SetHeight(height)
+	return doorGridWindow
+}
+
+func renderDoorCell(clientID string, clientHealth diary.ClientHealth, selected bool) string {
+	color := healthyColor
+	if clientHealth.State == diary.Unhealthy {
+		color = unhealthyColor
+	}
+
+	style := doorCellStyle.Copy().Width(doorCellWidth).BorderForeground(color)
+	if selected {
+		style = style.Border(lipgloss.ThickBorder()).Bold(true)
+	}
+
+	return style.Render(lipgloss.JoinVertical(
+		lipgloss.Left,
+		clientID,
+		lipgloss.NewStyle().Foreground(color).Render("● "+clientHealth.State.String()),
+		fmt.Sprintf("seen %s ago", time.Since(clientHealth.LastSeen).Truncate(time.Second)),
+	))
+}
+
+func (doorGridWindow DoorGridWindow) Render() string {
+	clients := doorGridWindow.store.Clients()
+	doors := doorGridWindow.Doors()
+	if len(doors) == 0 {
+		return doorGridWindow.Window.Render(
+			header.Render("Doors"),
+			statusText.Render("Waiting for door controllers to publish"),
+		)
+	}
+
+	perRow := doorGridWindow.GetInnerWidth() / (doorCellWidth + 5)
+	if perRow < 1 {
+		perRow = 1
+	}
+
+	selected := doorGridWindow.Selected()
+	rows := make([]string, 0)
+	cells := make([]string, 0)
+	for _, door := range doors {
+		cells = append(cells, renderDoorCell(door, clients[door], door == selected))
+		if len(cells) == perRow {
+			rows = append(rows, lipgloss.JoinHorizontal(lipgloss.Top, cells...))
+			cells = make([]string, 0)
+		}
+	}
+	if len(cells) > 0 {
+		rows = append(rows, lipgloss.JoinHorizontal(lipgloss.Top, cells...))
+	}
+
+	return doorGridWindow.Window.Render(lipgloss.JoinVertical(
+		lipgloss.Left,
+		header.Render("Doors"),
+		lipgloss.JoinVertical(lipgloss.Left, rows...),
+	))
+}
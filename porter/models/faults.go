@@ -0,0 +1,96 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/eclipse/paho.golang/paho"
+
+	"metamakers.org/door-controller-mqtt/commands"
+	"metamakers.org/door-controller-mqtt/mqtt"
+)
+
+const (
+	DelayResponsesKey     = "delay_responses"
+	ClockSkewKey          = "clock_skew"
+	MalformedPayloadsKey  = "malformed_payloads"
+	DuplicatePublishesKey = "duplicate_publishes"
+	SuddenDisconnectKey   = "sudden_disconnect"
+	ReconnectStormKey     = "reconnect_storm"
+	DoorHeldOpenKey       = "door_held_open"
+)
+
+// Faults are shown after the response options in the order they're listed
+var Faults = []KeyLabelPair{
+	{Key: DelayResponsesKey, Label: "Delay responses"},
+	{Key: ClockSkewKey, Label: "Skew clock"},
+	{Key: MalformedPayloadsKey, Label: "Malformed payloads"},
+	{Key: DuplicatePublishesKey, Label: "Duplicate publishes"},
+	{Key: SuddenDisconnectKey, Label: "Sudden disconnects"},
+	{Key: ReconnectStormKey, Label: "Reconnect storm"},
+	{Key: DoorHeldOpenKey, Label: "Door held open alarm"},
+}
+
+func ValidateFault(fault string) error {
+	keys := make([]string, 0, len(Faults))
+	for _, pair := range Faults {
+		if pair.Key == fault {
+			return nil
+		}
+		keys = append(keys, pair.Key)
+	}
+	return fmt.Errorf("Unknown fault %s, expected one of %s", fault, strings.Join(keys, ", "))
+}
+
+// faultyPublisher changes payloads on their way to the broker. It's
+// built for each command so a fault switched off part way through doesn't
+// affect publishes already made.
+type faultyPublisher struct {
+	publisher commands.Publisher
+	clockSkew time.Duration
+	malformed bool
+	duplicate bool
+}
+
+func (publisher faultyPublisher) Publish(ctx context.Context, publish *paho.Publish) (*paho.PublishResponse, error) {
+	if publisher.clockSkew != 0 {
+		publish.Payload = skewTimestamp(publish.Payload, publisher.clockSkew)
+	}
+	if publisher.malformed {
+		publish.Payload = malform(publish.Payload)
+	}
+
+	response, err := publisher.publisher.Publish(ctx, publish)
+	if err != nil || !publisher.duplicate {
+		return response, err
+	}
+	// A new packet rather than a redelivery, like a controller that
+	// published the same event twice
+	duplicate := *publish
+	duplicate.PacketID = 0
+	return publisher.publisher.Publish(ctx, &duplicate)
+}
+
+// skewTimestamp moves the timestamp at the end of card events, other
+// payloads are left alone
+func skewTimestamp(payload []byte, skew time.Duration) []byte {
+	prefix, raw, found := strings.Cut(string(payload), "|")
+	if !found {
+		return payload
+	}
+	timestamp, err := time.Parse(mqtt.TimestampFormat, raw)
+	if err != nil {
+		return payload
+	}
+	return []byte(prefix + "|" + timestamp.Add(skew).Format(mqtt.TimestampFormat))
+}
+
+// malform cuts the payload short and ends it with bytes that aren't
+// valid UTF-8
+func malform(payload []byte) []byte {
+	malformed := make([]byte, 0, len(payload)/2+2)
+	malformed = append(malformed, payload[:len(payload)/2]...)
+	return append(malformed, 0xff, 0xfe)
+}
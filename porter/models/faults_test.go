@@ -0,0 +1,154 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/eclipse/paho.golang/paho"
+
+	"metamakers.org/door-controller-mqtt/config"
+)
+
+func TestSkewTimestamp(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		skew    time.Duration
+		want    string
+	}{
+		{name: "forward", payload: "0001234567|2024-03-01 12:00:00", skew: time.Hour, want: "0001234567|2024-03-01 13:00:00"},
+		{name: "back over midnight", payload: "0001234567|2024-03-01 00:10:00", skew: -15 * time.Minute, want: "0001234567|2024-02-29 23:55:00"},
+		{name: "seconds", payload: "0|2024-03-01 12:00:00", skew: 90 * time.Second, want: "0|2024-03-01 12:01:30"},
+		{name: "no timestamp", payload: "0001234567", skew: time.Hour, want: "0001234567"},
+		{name: "other format", payload: "0001234567|2024-03-01T12:00:00Z", skew: time.Hour, want: "0001234567|2024-03-01T12:00:00Z"},
+		{name: "json", payload: `{"state":"locked"}`, skew: time.Hour, want: `{"state":"locked"}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := string(skewTimestamp([]byte(test.payload), test.skew)); got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestMalform(t *testing.T) {
+	tests := []string{
+		"",
+		"a",
+		"0001234567|2024-03-01 12:00:00",
+		`{"clients":["door_one","door_two"]}`,
+	}
+
+	for _, payload := range tests {
+		t.Run(payload, func(t *testing.T) {
+			got := malform([]byte(payload))
+			if bytes.Equal(got, []byte(payload)) {
+				t.Errorf("got %q, want it to differ from the payload", got)
+			}
+			if utf8.Valid(got) {
+				t.Errorf("got %q, want invalid UTF-8", got)
+			}
+			if want := len(payload)/2 + 2; len(got) != want {
+				t.Errorf("length: got %d, want %d", len(got), want)
+			}
+		})
+	}
+}
+
+type recordingPublisher struct {
+	publishes []paho.Publish
+	err       error
+}
+
+func (publisher *recordingPublisher) Publish(ctx context.Context, publish *paho.Publish) (*paho.PublishResponse, error) {
+	publisher.publishes = append(publisher.publishes, *publish)
+	return &paho.PublishResponse{}, publisher.err
+}
+
+func TestFaultyPublisherDuplicates(t *testing.T) {
+	tests := []struct {
+		name      string
+		duplicate bool
+		err       error
+		want      int
+	}{
+		{name: "off", duplicate: false, want: 1},
+		{name: "on", duplicate: true, want: 2},
+		{name: "failed publish", duplicate: true, err: errors.New("Not connected"), want: 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := &recordingPublisher{err: test.err}
+			publisher := faultyPublisher{publisher: recorder, duplicate: test.duplicate}
+			_, err := publisher.Publish(context.Background(), &paho.Publish{Topic: "door_controller/unlock/door_one", PacketID: 7, Payload: []byte("0001234567")})
+			if !errors.Is(err, test.err) {
+				t.Errorf("error: got %v, want %v", err, test.err)
+			}
+			if len(recorder.publishes) != test.want {
+				t.Fatalf("got %d publishes, want %d", len(recorder.publishes), test.want)
+			}
+			if test.want == 2 {
+				duplicate := recorder.publishes[1]
+				if duplicate.PacketID != 0 {
+					t.Errorf("duplicate packet ID: got %d, want 0", duplicate.PacketID)
+				}
+				if duplicate.Topic != recorder.publishes[0].Topic || !bytes.Equal(duplicate.Payload, recorder.publishes[0].Payload) {
+					t.Errorf("got duplicate %s %s, want %s %s", duplicate.Topic, duplicate.Payload, recorder.publishes[0].Topic, recorder.publishes[0].Payload)
+				}
+			}
+		})
+	}
+}
+
+func TestFaultyPublisherChangesPayloadOnce(t *testing.T) {
+	recorder := &recordingPublisher{}
+	publisher := faultyPublisher{publisher: recorder, clockSkew: time.Hour, duplicate: true}
+	publisher.Publish(context.Background(), &paho.Publish{Payload: []byte("0001234567|2024-03-01 12:00:00")})
+
+	// The duplicate is the skewed payload, not skewed a second time
+	want := "0001234567|2024-03-01 13:00:00"
+	for i, publish := range recorder.publishes {
+		if string(publish.Payload) != want {
+			t.Errorf("publish %d: got %s, want %s", i, publish.Payload, want)
+		}
+	}
+}
+
+func TestRespondDelay(t *testing.T) {
+	tests := []struct {
+		name    string
+		delayed bool
+		latency time.Duration
+		want    time.Duration
+	}{
+		{name: "off", delayed: false, latency: 200 * time.Millisecond, want: 0},
+		{name: "on", delayed: true, latency: 200 * time.Millisecond, want: 200 * time.Millisecond},
+		{name: "no latency", delayed: true, latency: 0, want: 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			statusWindow := StatusWindow{
+				faults:      map[string]bool{DelayResponsesKey: test.delayed},
+				faultConfig: config.FaultConfig{Latency: test.latency},
+			}
+			started := time.Now()
+			msg := statusWindow.respond(func() tea.Msg { return "responded" })()
+			elapsed := time.Since(started)
+			if msg != "responded" {
+				t.Errorf("got %v, want the response", msg)
+			}
+			if elapsed < test.want || elapsed > test.want+100*time.Millisecond {
+				t.Errorf("responded after %s, want %s", elapsed, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"metamakers.org/door-controller-mqtt/config"
+	"metamakers.org/door-controller-mqtt/messages"
+)
+
+const favouritesFileName = "mimic_favourites.json"
+
+// Favourites are the codes marked in the swipe history, kept per card
+// encoding so switching encodings doesn't lose any
+type Favourites map[string][]string
+
+// FavouritesPath is the favourites file, empty when there's nowhere to
+// keep it
+func FavouritesPath(mimicConfig config.MimicConfig) string {
+	if mimicConfig.FavouritesFile != "" {
+		return mimicConfig.FavouritesFile
+	}
+	return config.DataPath(favouritesFileName)
+}
+
+// LoadFavourites reads the favourites file, a missing file has none
+func LoadFavourites(path string) (Favourites, error) {
+	favourites := make(Favourites)
+	if path == "" {
+		return favourites, nil
+	}
+	content, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return favourites, nil
+	}
+	if err != nil {
+		return favourites, err
+	}
+	if err := json.Unmarshal(content, &favourites); err != nil {
+		return make(Favourites), err
+	}
+	// The file may have been edited by hand, and Toggle only removes one
+	// of a code
+	for encoding, codes := range favourites {
+		slices.Sort(codes)
+		favourites[encoding] = slices.Compact(codes)
+	}
+	return favourites, nil
+}
+
+// Toggle returns a copy with the code marked or unmarked, the copy can be
+// saved while the model keeps changing
+func (favourites Favourites) Toggle(encoding string, code string) Favourites {
+	toggled := make(Favourites, len(favourites)+1)
+	for name, codes := range favourites {
+		toggled[name] = slices.Clone(codes)
+	}
+	if index := slices.Index(toggled[encoding], code); index >= 0 {
+		toggled[encoding] = slices.Delete(toggled[encoding], index, index+1)
+	} else {
+		toggled[encoding] = append(toggled[encoding], code)
+	}
+	slices.Sort(toggled[encoding])
+	return toggled
+}
+
+func (favourites Favourites) Contains(encoding string, code string) bool {
+	return slices.Contains(favourites[encoding], code)
+}
+
+// SaveFavourites writes the file through a temporary file, so a crash
+// can't leave half of it behind
+func SaveFavourites(path string, favourites Favourites) tea.Cmd {
+	return func() tea.Msg {
+		if path == "" {
+			return messages.FavouritesSavedMessage{Err: errors.New("No favourites file, set --favourites_file")}
+		}
+		content, err := json.MarshalIndent(favourites, "", "  ")
+		if err != nil {
+			return messages.FavouritesSavedMessage{Path: path, Err: err}
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			return messages.FavouritesSavedMessage{Path: path, Err: err}
+		}
+		temporary := path + ".tmp"
+		if err := os.WriteFile(temporary, append(content, '\n'), 0o600); err != nil {
+			return messages.FavouritesSavedMessage{Path: path, Err: err}
+		}
+		if err := os.Rename(temporary, path); err != nil {
+			return messages.FavouritesSavedMessage{Path: path, Err: err}
+		}
+		return messages.FavouritesSavedMessage{Path: path}
+	}
+}
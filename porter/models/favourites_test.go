@@ -0,0 +1,129 @@
+package models
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"metamakers.org/door-controller-mqtt/messages"
+)
+
+func TestLoadFavourites(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    Favourites
+		err     bool
+	}{
+		{name: "codes", content: `{"decimal10":["0001234567","0007654321"],"hexuid":["04A23B1C5D6E80"]}`, want: Favourites{"decimal10": {"0001234567", "0007654321"}, "hexuid": {"04A23B1C5D6E80"}}},
+		{name: "duplicates", content: `{"decimal10":["0007654321","0001234567","0007654321"]}`, want: Favourites{"decimal10": {"0001234567", "0007654321"}}},
+		{name: "empty", content: `{}`, want: Favourites{}},
+		{name: "corrupt", content: `{"decimal10":["0001234567"`, want: Favourites{}, err: true},
+		{name: "wrong shape", content: `["0001234567"]`, want: Favourites{}, err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "mimic_favourites.json")
+			if err := os.WriteFile(path, []byte(test.content), 0o600); err != nil {
+				t.Fatalf("Failed to write: %v", err)
+			}
+			got, err := LoadFavourites(path)
+			if (err != nil) != test.err {
+				t.Fatalf("got %v, want error %v", err, test.err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestLoadFavouritesMissing(t *testing.T) {
+	for _, path := range []string{"", filepath.Join(t.TempDir(), "missing", "mimic_favourites.json")} {
+		favourites, err := LoadFavourites(path)
+		if err != nil {
+			t.Errorf("%q: got %v, want no error", path, err)
+		}
+		// Favourites can be toggled straight away
+		if favourites == nil || len(favourites) != 0 {
+			t.Errorf("%q: got %v, want none", path, favourites)
+		}
+	}
+}
+
+func TestToggleFavourites(t *testing.T) {
+	favourites := Favourites{"decimal10": {"0007654321"}}
+
+	added := favourites.Toggle("decimal10", "0001234567")
+	if want := (Favourites{"decimal10": {"0001234567", "0007654321"}}); !reflect.DeepEqual(added, want) {
+		t.Errorf("got %v, want %v", added, want)
+	}
+	// The original is left alone so a save in flight isn't changed
+	if want := (Favourites{"decimal10": {"0007654321"}}); !reflect.DeepEqual(favourites, want) {
+		t.Errorf("got %v after toggling a copy, want %v", favourites, want)
+	}
+
+	removed := added.Toggle("decimal10", "0007654321")
+	if !removed.Contains("decimal10", "0001234567") || removed.Contains("decimal10", "0007654321") {
+		t.Errorf("got %v, want only 0001234567", removed)
+	}
+	// Each encoding keeps its own
+	other := removed.Toggle("hexuid", "04A23B1C5D6E80")
+	if other.Contains("decimal10", "04A23B1C5D6E80") || !other.Contains("hexuid", "04A23B1C5D6E80") {
+		t.Errorf("got %v, want the UID under hexuid", other)
+	}
+}
+
+func TestSaveFavourites(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "porter", "mimic_favourites.json")
+	favourites := Favourites{}.Toggle("decimal10", "0007654321").Toggle("decimal10", "0001234567")
+
+	saved, ok := SaveFavourites(path, favourites)().(messages.FavouritesSavedMessage)
+	if !ok || saved.Err != nil || saved.Path != path {
+		t.Fatalf("got %+v, want saved to %s", saved, path)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("got %v, want the temporary file gone", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat: %v", err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("got mode %v, want 0600", info.Mode().Perm())
+	}
+
+	loaded, err := LoadFavourites(path)
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	if !reflect.DeepEqual(loaded, favourites) {
+		t.Errorf("got %v, want %v", loaded, favourites)
+	}
+
+	// Saving again replaces what was there
+	if saved := SaveFavourites(path, favourites.Toggle("decimal10", "0001234567"))().(messages.FavouritesSavedMessage); saved.Err != nil {
+		t.Fatalf("Failed to save: %v", saved.Err)
+	}
+	if loaded, _ := LoadFavourites(path); !reflect.DeepEqual(loaded, Favourites{"decimal10": {"0007654321"}}) {
+		t.Errorf("got %v, want only 0007654321", loaded)
+	}
+}
+
+func TestSaveFavouritesErrors(t *testing.T) {
+	if saved := SaveFavourites("", Favourites{})().(messages.FavouritesSavedMessage); saved.Err == nil {
+		t.Error("got no error, want one without a favourites file")
+	}
+
+	// A file where the directory should be
+	blocker := filepath.Join(t.TempDir(), "blocker")
+	if err := os.WriteFile(blocker, nil, 0o600); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	path := filepath.Join(blocker, "mimic_favourites.json")
+	if saved := SaveFavourites(path, Favourites{})().(messages.FavouritesSavedMessage); saved.Err == nil || saved.Path != path {
+		t.Errorf("got %+v, want an error for %s", saved, path)
+	}
+}
@@ -0,0 +1,177 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"metamakers.org/door-controller-mqtt/cards"
+	"metamakers.org/door-controller-mqtt/messages"
+)
+
+// TranscriptEntry is a single line of headless mimic's transcript
+type TranscriptEntry struct {
+	Time      time.Time `json:"time"`
+	Event     string    `json:"event"`
+	Topic     string    `json:"topic,omitempty"`
+	Payload   string    `json:"payload,omitempty"`
+	Broker    string    `json:"broker,omitempty"`
+	Connected *bool     `json:"connected,omitempty"`
+	Fault     string    `json:"fault,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+const (
+	TranscriptReceived   = "received"
+	TranscriptPublished  = "published"
+	TranscriptSubscribed = "subscribed"
+	TranscriptStatus     = "status"
+	TranscriptFault      = "fault"
+)
+
+// TranscriptWriter writes each entry as a line of JSON. Entries can be
+// recorded from the program's filter and other goroutines at once.
+type TranscriptWriter struct {
+	encoder *json.Encoder
+	mu      sync.Mutex
+}
+
+func NewTranscriptWriter(writer io.Writer) *TranscriptWriter {
+	return &TranscriptWriter{encoder: json.NewEncoder(writer)}
+}
+
+func (transcript *TranscriptWriter) Record(entry TranscriptEntry) error {
+	transcript.mu.Lock()
+	defer transcript.mu.Unlock()
+	return transcript.encoder.Encode(entry)
+}
+
+// Swipe is a card entered at the door, the message decides whether the
+// door checks its card list, unlocks or denies access. PIN is typed at the
+// keypad after the card when it's set.
+type Swipe struct {
+	Card    string
+	PIN     string
+	Message string
+}
+
+// ValidateDoorMessage checks the message is one the door topic window
+// can select
+func ValidateDoorMessage(message string) error {
+	switch message {
+	case CardListKey, UnlockKey, DeniedAccessKey:
+		return nil
+	}
+	return fmt.Errorf("Door message must be %s, %s or %s, got %s", CardListKey, UnlockKey, DeniedAccessKey, message)
+}
+
+// DoorMessageSelection selects the door message like the door topic
+// window does
+func DoorMessageSelection(message string) messages.DoorTopicSelectionMessage {
+	return messages.DoorTopicSelectionMessage{
+		CardListKey:     message == CardListKey,
+		UnlockKey:       message == UnlockKey,
+		DeniedAccessKey: message == DeniedAccessKey,
+	}
+}
+
+// ParseSwipe reads a swipe written as <card>[#<pin>][:<message>], the
+// door message is used when no message is given. Cards can contain colons
+// themselves, so only a door message after the last one is split off.
+func ParseSwipe(raw string, doorMessage string, encoding cards.Encoding) (Swipe, error) {
+	card, message := raw, doorMessage
+	if index := strings.LastIndex(raw, ":"); index >= 0 && ValidateDoorMessage(raw[index+1:]) == nil {
+		card, message = raw[:index], raw[index+1:]
+	}
+	if err := ValidateDoorMessage(message); err != nil {
+		return Swipe{}, err
+	}
+	card, pin, hasPIN := strings.Cut(card, "#")
+	if hasPIN {
+		if err := cards.ValidatePIN(pin); err != nil {
+			return Swipe{}, err
+		}
+	}
+	card, err := encoding.Normalize(card)
+	if err != nil {
+		return Swipe{}, err
+	}
+	return Swipe{Card: card, PIN: pin, Message: message}, nil
+}
+
+// Messages are sent to the mimic to swipe the card. The door message is
+// selected before the code is entered, just like in the TUI.
+func (swipe Swipe) Messages() []tea.Msg {
+	msgs := []tea.Msg{
+		DoorMessageSelection(swipe.Message),
+		messages.DoorCodeTextMessage(swipe.Card),
+	}
+	if swipe.PIN != "" {
+		msgs = append(msgs, messages.PinTextMessage(swipe.PIN))
+	}
+	return msgs
+}
+
+// TranscriptFilter is passed to tea.WithFilter to record every message
+// the mimic publishes or receives as it's handled
+func TranscriptFilter(record func(TranscriptEntry)) func(tea.Model, tea.Msg) tea.Msg {
+	return func(model tea.Model, msg tea.Msg) tea.Msg {
+		if entry, ok := transcriptEntry(msg); ok {
+			entry.Time = time.Now()
+			record(entry)
+		}
+		return msg
+	}
+}
+
+func transcriptEntry(msg tea.Msg) (TranscriptEntry, bool) {
+	entry := TranscriptEntry{}
+	switch msg := msg.(type) {
+	case messages.MqttMessage:
+		entry.Event = TranscriptReceived
+		entry.Topic = msg.Topic
+		entry.Payload = msg.Payload
+	case messages.PublishMessage:
+		entry.Event = TranscriptPublished
+		entry.Topic = msg.Topic
+		entry.Payload = msg.Payload
+		if msg.Err != nil {
+			entry.Error = msg.Err.Error()
+		}
+	case messages.SubscribeMessage:
+		entry.Event = TranscriptSubscribed
+		entry.Topic = msg.Topic
+		if msg.Err != nil {
+			entry.Error = msg.Err.Error()
+		}
+	case messages.MqttStatus:
+		connected := msg.Connected
+		entry.Event = TranscriptStatus
+		entry.Broker = msg.Broker
+		entry.Connected = &connected
+		if msg.Err != nil {
+			entry.Error = msg.Err.Error()
+		}
+	case messages.MqttServerConnection:
+		if msg.Err == nil {
+			return entry, false
+		}
+		entry.Event = TranscriptStatus
+		entry.Error = msg.Err.Error()
+	case messages.FaultInjectedMessage:
+		entry.Event = TranscriptFault
+		entry.Fault = msg.Fault
+		entry.Payload = msg.Detail
+	case messages.UrlParseError:
+		entry.Event = TranscriptStatus
+		entry.Error = msg.Err.Error()
+	default:
+		return entry, false
+	}
+	return entry, true
+}
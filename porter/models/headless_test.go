@@ -0,0 +1,205 @@
+package models
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"metamakers.org/door-controller-mqtt/cards"
+	"metamakers.org/door-controller-mqtt/messages"
+)
+
+func TestParseSwipe(t *testing.T) {
+	tests := []struct {
+		raw         string
+		doorMessage string
+		encoding    cards.Encoding
+		want        Swipe
+		err         string
+	}{
+		{raw: "1234567", doorMessage: CardListKey, encoding: cards.Decimal10{}, want: Swipe{Card: "0001234567", Message: CardListKey}},
+		{raw: "0001234567:unlock", doorMessage: CardListKey, encoding: cards.Decimal10{}, want: Swipe{Card: "0001234567", Message: UnlockKey}},
+		{raw: "0001234567#1234", doorMessage: CardListKey, encoding: cards.Decimal10{}, want: Swipe{Card: "0001234567", PIN: "1234", Message: CardListKey}},
+		{raw: "0001234567#12345678:denied_access", doorMessage: UnlockKey, encoding: cards.Decimal10{}, want: Swipe{Card: "0001234567", PIN: "12345678", Message: DeniedAccessKey}},
+		// The colon in a Wiegand card isn't taken for a door message
+		{raw: "12:3456", doorMessage: UnlockKey, encoding: cards.Wiegand26{}, want: Swipe{Card: "012:03456", Message: UnlockKey}},
+		{raw: "012:03456:card_list", doorMessage: UnlockKey, encoding: cards.Wiegand26{}, want: Swipe{Card: "012:03456", Message: CardListKey}},
+		{raw: "04:a2:3b:1c:5d:6e:80#0000", doorMessage: CardListKey, encoding: cards.HexUID{}, want: Swipe{Card: "04A23B1C5D6E80", PIN: "0000", Message: CardListKey}},
+		{raw: "04a23b1c5d6e80:unlock", doorMessage: CardListKey, encoding: cards.HexUID{}, want: Swipe{Card: "04A23B1C5D6E80", Message: UnlockKey}},
+
+		{raw: "0001234567", doorMessage: "open", encoding: cards.Decimal10{}, err: "Door message must be card_list, unlock or denied_access, got open"},
+		{raw: "0001234567:open", doorMessage: CardListKey, encoding: cards.Decimal10{}, err: "must be up to 10 digits"},
+		{raw: "0001234567#12", doorMessage: CardListKey, encoding: cards.Decimal10{}, err: "PIN must be 4 to 8 digits"},
+		{raw: "0001234567#12ab", doorMessage: CardListKey, encoding: cards.Decimal10{}, err: "PIN must be 4 to 8 digits"},
+		{raw: "#1234", doorMessage: CardListKey, encoding: cards.Decimal10{}, err: "must be up to 10 digits"},
+		{raw: "12345678901", doorMessage: CardListKey, encoding: cards.Decimal10{}, err: "must be up to 10 digits"},
+		{raw: "3456", doorMessage: CardListKey, encoding: cards.Wiegand26{}, err: "must be written as facility:card"},
+		{raw: "256:3456", doorMessage: CardListKey, encoding: cards.Wiegand26{}, err: "facility code from 0 to 255"},
+		{raw: "12:65536", doorMessage: CardListKey, encoding: cards.Wiegand26{}, err: "card number from 0 to 65535"},
+		{raw: "04A23B1C5D6E", doorMessage: CardListKey, encoding: cards.HexUID{}, err: "must be a 7 byte UID in hex"},
+		{raw: "04A23B1C5D6EZZ", doorMessage: CardListKey, encoding: cards.HexUID{}, err: "must be a 7 byte UID in hex"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.encoding.Name()+" "+test.raw, func(t *testing.T) {
+			got, err := ParseSwipe(test.raw, test.doorMessage, test.encoding)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("got %v, want an error containing %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("got %v, want no error", err)
+			}
+			if got != test.want {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSwipeMessages(t *testing.T) {
+	tests := []struct {
+		name  string
+		swipe Swipe
+		want  []tea.Msg
+	}{
+		{
+			name:  "card",
+			swipe: Swipe{Card: "0001234567", Message: UnlockKey},
+			want: []tea.Msg{
+				messages.DoorTopicSelectionMessage{CardListKey: false, UnlockKey: true, DeniedAccessKey: false},
+				messages.DoorCodeTextMessage("0001234567"),
+			},
+		},
+		{
+			name:  "card with PIN",
+			swipe: Swipe{Card: "0001234567", PIN: "1234", Message: CardListKey},
+			want: []tea.Msg{
+				messages.DoorTopicSelectionMessage{CardListKey: true, UnlockKey: false, DeniedAccessKey: false},
+				messages.DoorCodeTextMessage("0001234567"),
+				messages.PinTextMessage("1234"),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.swipe.Messages(); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %#v, want %#v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestTranscriptFilter(t *testing.T) {
+	connected := true
+	tests := []struct {
+		name string
+		msg  tea.Msg
+		want *TranscriptEntry
+	}{
+		{name: "received", msg: messages.MqttMessage{Topic: "door_controller/health_check", Payload: "ping"}, want: &TranscriptEntry{Event: TranscriptReceived, Topic: "door_controller/health_check", Payload: "ping"}},
+		{name: "published", msg: messages.PublishMessage{Topic: "door_controller/unlock/door_one", Payload: "0001234567", Err: errors.New("Not authorised")}, want: &TranscriptEntry{Event: TranscriptPublished, Topic: "door_controller/unlock/door_one", Payload: "0001234567", Error: "Not authorised"}},
+		{name: "subscribed", msg: messages.SubscribeMessage{Topic: "door_controller/access_list"}, want: &TranscriptEntry{Event: TranscriptSubscribed, Topic: "door_controller/access_list"}},
+		{name: "status", msg: messages.MqttStatus{Broker: "mqtt://localhost:1883", Connected: true}, want: &TranscriptEntry{Event: TranscriptStatus, Broker: "mqtt://localhost:1883", Connected: &connected}},
+		{name: "connection error", msg: messages.MqttServerConnection{Err: errors.New("Connection refused")}, want: &TranscriptEntry{Event: TranscriptStatus, Error: "Connection refused"}},
+		{name: "connection", msg: messages.MqttServerConnection{}},
+		{name: "fault", msg: messages.FaultInjectedMessage{Fault: "drop", Detail: "Dropped the connection"}, want: &TranscriptEntry{Event: TranscriptFault, Fault: "drop", Payload: "Dropped the connection"}},
+		{name: "key press", msg: tea.KeyMsg{Type: tea.KeyEnter}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var recorded []TranscriptEntry
+			filter := TranscriptFilter(func(entry TranscriptEntry) {
+				recorded = append(recorded, entry)
+			})
+			if msg := filter(nil, test.msg); !reflect.DeepEqual(msg, test.msg) {
+				t.Errorf("got %#v, want the message passed on", msg)
+			}
+
+			if test.want == nil {
+				if len(recorded) != 0 {
+					t.Errorf("got %+v, want nothing recorded", recorded)
+				}
+				return
+			}
+			if len(recorded) != 1 {
+				t.Fatalf("got %d entries, want 1", len(recorded))
+			}
+			if time.Since(recorded[0].Time) > 5*time.Second {
+				t.Errorf("got time %s, want now", recorded[0].Time)
+			}
+			recorded[0].Time = time.Time{}
+			if !reflect.DeepEqual(recorded[0], *test.want) {
+				t.Errorf("got %+v, want %+v", recorded[0], *test.want)
+			}
+		})
+	}
+}
+
+func TestTranscriptWriter(t *testing.T) {
+	var buffer bytes.Buffer
+	transcript := NewTranscriptWriter(&buffer)
+	connected := false
+	at := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+
+	entries := []TranscriptEntry{
+		{Time: at, Event: TranscriptStatus, Broker: "mqtt://localhost:1883", Connected: &connected},
+		{Time: at, Event: TranscriptReceived, Topic: "door_controller/access_list", Payload: "0001234567\n0007654321"},
+	}
+	for _, entry := range entries {
+		if err := transcript.Record(entry); err != nil {
+			t.Fatalf("Failed to record: %v", err)
+		}
+	}
+
+	// One JSON object a line, with the empty fields left out and the
+	// payload's own new line escaped
+	want := `{"time":"2026-10-19T10:00:00Z","event":"status","broker":"mqtt://localhost:1883","connected":false}` + "\n" +
+		`{"time":"2026-10-19T10:00:00Z","event":"received","topic":"door_controller/access_list","payload":"0001234567\n0007654321"}` + "\n"
+	if buffer.String() != want {
+		t.Errorf("got %s, want %s", buffer.String(), want)
+	}
+}
+
+func TestTranscriptWriterConcurrent(t *testing.T) {
+	var buffer bytes.Buffer
+	transcript := NewTranscriptWriter(&buffer)
+
+	var wait sync.WaitGroup
+	for writer := 0; writer < 4; writer++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			for i := 0; i < 50; i++ {
+				transcript.Record(TranscriptEntry{Event: TranscriptPublished, Topic: "door_controller/unlock/door_one", Payload: strings.Repeat("x", 100)})
+			}
+		}()
+	}
+	wait.Wait()
+
+	// Lines aren't interleaved
+	lines := 0
+	scanner := bufio.NewScanner(&buffer)
+	for scanner.Scan() {
+		entry := TranscriptEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("line %d: %v", lines+1, err)
+		}
+		lines += 1
+	}
+	if lines != 200 {
+		t.Errorf("got %d lines, want 200", lines)
+	}
+}
@@ -1,18 +1,22 @@
 package models
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/muesli/reflow/wordwrap"
 	"github.com/muesli/reflow/wrap"
+	"metamakers.org/door-controller-mqtt/connection"
 	"metamakers.org/door-controller-mqtt/messages"
 )
 
 type LogWindow struct {
 	logs     []string
+	filter   string
 	err      error
 	Viewport viewport.Model
 	Window
@@ -48,25 +52,38 @@ func (logWindow LogWindow) Update(msg tea.Msg) (LogWindow, tea.Cmd) {
 		}
 	case messages.MqttStatus:
 		if msg.Err == nil && msg.Connected {
-			logWindow.Info("Connected to MQTT Broker")
+			logWindow.Info("Connected to MQTT Broker %s", msg.Broker)
 			break
 		}
-		if msg.Code == 254 {
-			logWindow.Error("Failed to connect to MQTT Broker: %v", msg.Err)
-		} else if msg.Code == 255 {
-			logWindow.Error("MQTT Client error: %v", msg.Err)
-		} else {
+		if errors.Is(msg.Err, connection.ErrServerDisconnect) {
 			logWindow.Error("MQTT disconnect with reason: %s - code: %d", msg.Reason, msg.Code)
+		} else {
+			logWindow.Error("MQTT connection error: %v", msg.Err)
 		}
 	case messages.MqttMessage:
-		logWindow.Info("Received message from: %s", msg.Topic)
-		logWindow.Info("Payload is: %s", msg.Payload)
+		logWindow.Info("Received message from: %s - Payload: %s", msg.Topic, msg.Payload)
 	case messages.PublishMessage:
 		if msg.Err != nil {
 			logWindow.Error("Failed to publish to: %s - Error: %v", msg.Topic, msg.Err)
 		} else {
 			logWindow.Info("Published to topic: %s - Payload: %s", msg.Topic, msg.Payload)
 		}
+	case messages.CardListMessage:
+		if msg.Err != nil {
+			logWindow.Error("Rejected access list, keeping %d cards - Error: %v", msg.Count, msg.Err)
+		} else {
+			logWindow.Info("Loaded access list with %d cards", msg.Count)
+		}
+	case messages.InvalidCardMessage:
+		logWindow.Error("Ignored code %s: %v", msg.Code, msg.Err)
+	case messages.FavouritesSavedMessage:
+		if msg.Err != nil {
+			logWindow.Error("Failed to save favourites: %v", msg.Err)
+		} else {
+			logWindow.Info("Saved favourites to %s", msg.Path)
+		}
+	case messages.FaultInjectedMessage:
+		logWindow.Warn("Injected %s: %s", msg.Fault, msg.Detail)
 	case messages.SubscribeMessage:
 		if msg.Err != nil {
 			logWindow.Error("Failed to subscribe to: %s - Error: %v", msg.Topic, msg.Err)
@@ -118,10 +135,20 @@ func (logWindow *LogWindow) Error(format string, args ...any) {
 	logWindow.Log("ERROR", format, args...)
 }
 
+// SetFilter only shows log lines containing the filter, ignoring case.
+// An empty filter shows every line.
+func (logWindow *LogWindow) SetFilter(filter string) {
+	logWindow.filter = strings.ToLower(filter)
+}
+
 func (logWindow *LogWindow) RenderContent() string {
 	cursor := 0
 	text := ""
 	for cursor < len(logWindow.logs) {
+		if logWindow.filter != "" && !strings.Contains(strings.ToLower(logWindow.logs[cursor]), logWindow.filter) {
+			cursor += 1
+			continue
+		}
 		text += wrap.String(
 			wordwrap.String(logWindow.logs[cursor], logWindow.GetInnerWidth()),
 			logWindow.GetInnerWidth(),
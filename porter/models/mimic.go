@@ -8,27 +8,36 @@ import (
 	"golang.org/x/term"
 
 	"metamakers.org/door-controller-mqtt/commands"
+	"metamakers.org/door-controller-mqtt/config"
+	"metamakers.org/door-controller-mqtt/connection"
 	"metamakers.org/door-controller-mqtt/messages"
+	"metamakers.org/door-controller-mqtt/mqtt"
 )
 
 type MimicModel struct {
 	username       string
 	password       string
-	mqttUri        string
+	mqttUris       []string
+	namespace      mqtt.Namespace
+	transport      connection.Transport
 	DocumentWindow DocumentWindow
 }
 
-func InitMinicModel(ctx context.Context, mqttUri string, username string, password string) MimicModel {
+func InitMinicModel(ctx context.Context, mqttUris []string, namespace mqtt.Namespace, username string, password string, transport connection.Transport, mimicConfig config.MimicConfig) MimicModel {
+	// Bubbletea sends the real size once the program starts, and headless
+	// mimic has no terminal at all
 	physicalWidth, physicalHeight, err := term.GetSize(int(os.Stdout.Fd()))
 	if err != nil {
-		panic(err)
+		physicalWidth, physicalHeight = 80, 24
 	}
 
 	return MimicModel{
-		mqttUri:        mqttUri,
+		mqttUris:       mqttUris,
+		namespace:      namespace,
 		username:       username,
 		password:       password,
-		DocumentWindow: NewDocumentWindow(ctx, physicalWidth, physicalHeight),
+		transport:      transport,
+		DocumentWindow: NewDocumentWindow(ctx, physicalWidth, physicalHeight, mimicConfig),
 	}
 }
 
@@ -41,9 +50,12 @@ func (model MimicModel) Init() tea.Cmd {
 	return tea.Batch(
 		func() tea.Msg { return messages.Init(1) },
 		commands.Init(
-			model.mqttUri,
+			model.mqttUris,
+			model.namespace,
 			model.username,
 			model.password,
+			model.username,
+			model.transport,
 		),
 	)
 }
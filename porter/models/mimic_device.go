@@ -0,0 +1,172 @@
+package models
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"metamakers.org/door-controller-mqtt/cards"
+	"metamakers.org/door-controller-mqtt/config"
+	"metamakers.org/door-controller-mqtt/door"
+	"metamakers.org/door-controller-mqtt/rpc"
+)
+
+// mimicDevice is the state a real door controller would report through
+// its rpc methods. The methods run in tea commands, outside of Update, so
+// the state is shared by pointer and locked.
+type mimicDevice struct {
+	mu      sync.Mutex
+	started time.Time
+	cards   cards.Set
+	// listUpdated and listErr describe the last access list received,
+	// a rejected list leaves the previous cards in place
+	listUpdated time.Time
+	listErr     error
+	encoding    cards.Encoding
+	doorState   door.State
+	config      config.MimicConfig
+}
+
+// CardEncoding is the encoding the mimic's reader uses. The mimic command
+// has already checked it exists, decimal10 is used if it doesn't.
+func CardEncoding(mimicConfig config.MimicConfig) cards.Encoding {
+	encoding, err := cards.LookupEncoding(mimicConfig.CardEncoding)
+	if err != nil {
+		return cards.Decimal10{}
+	}
+	return encoding
+}
+
+func newMimicDevice(mimicConfig config.MimicConfig) *mimicDevice {
+	return &mimicDevice{
+		started:  time.Now(),
+		cards:    cards.NewSet(),
+		encoding: CardEncoding(mimicConfig),
+		config:   mimicConfig,
+	}
+}
+
+// Encoding never changes, so it's read without the lock
+func (device *mimicDevice) Encoding() cards.Encoding {
+	return device.encoding
+}
+
+// SetAccessList replaces the cards when the list is valid
+func (device *mimicDevice) SetAccessList(list string) (int, error) {
+	device.mu.Lock()
+	defer device.mu.Unlock()
+
+	set, err := cards.Parse(list, device.encoding)
+	device.listUpdated = time.Now()
+	device.listErr = err
+	if err != nil {
+		return device.cards.Len(), err
+	}
+	device.cards = set
+	return set.Len(), nil
+}
+
+// Allowed decides whether a card, in its canonical form, unlocks the door
+func (device *mimicDevice) Allowed(card string) bool {
+	device.mu.Lock()
+	defer device.mu.Unlock()
+	return device.cards.Contains(card)
+}
+
+// Verifier is the PIN verifier of a card that needs a PIN
+func (device *mimicDevice) Verifier(card string) (cards.Verifier, bool) {
+	device.mu.Lock()
+	defer device.mu.Unlock()
+	return device.cards.Verifier(card)
+}
+
+func (device *mimicDevice) SearchCards(query string) []string {
+	device.mu.Lock()
+	defer device.mu.Unlock()
+	return device.cards.Search(query)
+}
+
+func (device *mimicDevice) CardCount() int {
+	device.mu.Lock()
+	defer device.mu.Unlock()
+	return device.cards.Len()
+}
+
+func (device *mimicDevice) ListStatus() (time.Time, error) {
+	device.mu.Lock()
+	defer device.mu.Unlock()
+	return device.listUpdated, device.listErr
+}
+
+func (device *mimicDevice) SetResponseOptions(failAccessList bool, failHealthCheck bool, faults []string) {
+	device.mu.Lock()
+	defer device.mu.Unlock()
+
+	device.config.FailAccessList = failAccessList
+	device.config.FailHealthCheck = failHealthCheck
+	device.config.Faults.Enabled = faults
+}
+
+func (device *mimicDevice) SetDoorMessage(doorMessage string) {
+	device.mu.Lock()
+	defer device.mu.Unlock()
+
+	device.config.DoorMessage = doorMessage
+}
+
+func (device *mimicDevice) SetDoorState(state door.State) {
+	device.mu.Lock()
+	defer device.mu.Unlock()
+
+	device.doorState = state
+}
+
+func (device *mimicDevice) Register(responder *rpc.Responder) {
+	responder.Handle("ping", func(params json.RawMessage) (any, error) {
+		device.mu.Lock()
+		defer device.mu.Unlock()
+		return map[string]string{
+			"reply":  "pong",
+			"uptime": time.Since(device.started).Round(time.Second).String(),
+		}, nil
+	})
+	responder.Handle("card_count", func(params json.RawMessage) (any, error) {
+		device.mu.Lock()
+		defer device.mu.Unlock()
+		return map[string]int{"cards": device.cards.Len()}, nil
+	})
+	responder.Handle("dump_config", func(params json.RawMessage) (any, error) {
+		device.mu.Lock()
+		defer device.mu.Unlock()
+		return map[string]any{
+			"fail_health_check": device.config.FailHealthCheck,
+			"fail_access_list":  device.config.FailAccessList,
+			"door_message":      device.config.DoorMessage,
+			"card_encoding":     device.encoding.Name(),
+			"faults":            device.config.Faults.Enabled,
+			"unlock_duration":   device.config.UnlockDuration.String(),
+			"held_open_after":   device.config.HeldOpenAfter.String(),
+			"pin_attempts":      device.config.PinAttempts,
+			"pin_lockout":       device.config.PinLockout.String(),
+		}, nil
+	})
+	responder.Handle("door_state", func(params json.RawMessage) (any, error) {
+		device.mu.Lock()
+		defer device.mu.Unlock()
+		return map[string]string{"state": device.doorState.String()}, nil
+	})
+	// A real controller forgets its access list when it reboots and
+	// waits for the next one to be published
+	responder.Handle("reboot", func(params json.RawMessage) (any, error) {
+		device.mu.Lock()
+		defer device.mu.Unlock()
+		device.started = time.Now()
+		device.cards = cards.NewSet()
+		device.listUpdated = time.Time{}
+		device.listErr = nil
+		return map[string]bool{"rebooting": true}, nil
+	})
+	responder.Handle("methods", func(params json.RawMessage) (any, error) {
+		return responder.Methods(), nil
+	})
+}
@@ -0,0 +1,138 @@
+package models
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/charmbracelet/bubbles/spinner"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/eclipse/paho.golang/autopaho"
+	"metamakers.org/door-controller-mqtt/commands"
+	"metamakers.org/door-controller-mqtt/messages"
+)
+
+// MqttConnection is the connection to the broker shared by the mimic's
+// status window and the watch dashboard. It starts the connection manager
+// once the credentials arrive and keeps waiting on its status and
+// messages, the windows it's part of only have to subscribe once
+// Connected is sent.
+type MqttConnection struct {
+	ctx                  context.Context
+	serverConnection     *autopaho.ConnectionManager
+	credentials          messages.MqttCredentials
+	mqttMessages         chan messages.MqttMessage
+	mqttConnectionStatus chan messages.MqttStatus
+	// waitingForMessage is set while a WaitForMessage is outstanding, so
+	// every reconnect doesn't start another one
+	waitingForMessage bool
+	Err               error
+	Spinner           spinner.Model
+	IsConnected       bool
+	Broker            string
+	Initialized       bool
+}
+
+func NewMqttConnection(ctx context.Context) MqttConnection {
+	statusSpinner := spinner.New()
+	statusSpinner.Spinner = spinner.Dot
+	statusSpinner.Style = spinnerStyle
+
+	return MqttConnection{
+		ctx:                  ctx,
+		serverConnection:     nil,
+		mqttMessages:         make(chan messages.MqttMessage),
+		mqttConnectionStatus: make(chan messages.MqttStatus),
+		Err:                  nil,
+		Spinner:              statusSpinner,
+		IsConnected:          false,
+		Initialized:          false,
+	}
+}
+
+// Connected reports whether msg is the connection coming up, which is
+// when the windows make their subscriptions
+func (mqttConnection MqttConnection) Connected(msg tea.Msg) bool {
+	status, isStatus := msg.(messages.MqttStatus)
+	return isStatus && status.Err == nil && status.Connected
+}
+
+func (mqttConnection MqttConnection) Update(msg tea.Msg) (MqttConnection, tea.Cmd) {
+	cmds := make([]tea.Cmd, 0)
+
+	switch msg := msg.(type) {
+	case messages.UrlParseError:
+		mqttConnection.Err = msg.Err
+	case messages.MqttCredentials:
+		mqttConnection.credentials = msg
+		cmds = append(cmds,
+			mqttConnection.initConnection(),
+			commands.WaitForStatus(mqttConnection.mqttConnectionStatus),
+			mqttConnection.Spinner.Tick,
+		)
+	case messages.MqttServerConnection:
+		if msg.Err != nil {
+			mqttConnection.Initialized = false
+			mqttConnection.Err = msg.Err
+			cmds = append(cmds, commands.WaitForStatus(mqttConnection.mqttConnectionStatus))
+			break
+		}
+		mqttConnection.Initialized = true
+		mqttConnection.serverConnection = msg.Connnection
+	case messages.MqttStatus:
+		mqttConnection.IsConnected = msg.Connected
+		mqttConnection.Broker = msg.Broker
+		if mqttConnection.Connected(msg) && !mqttConnection.waitingForMessage {
+			mqttConnection.waitingForMessage = true
+			cmds = append(cmds, commands.WaitForMessage(mqttConnection.mqttMessages))
+		}
+		cmds = append(cmds, commands.WaitForStatus(mqttConnection.mqttConnectionStatus))
+	case messages.MqttMessage:
+		cmds = append(cmds, commands.WaitForMessage(mqttConnection.mqttMessages))
+	case spinner.TickMsg:
+		var spinnerCmd tea.Cmd
+		mqttConnection.Spinner, spinnerCmd = mqttConnection.Spinner.Update(msg)
+		cmds = append(cmds, spinnerCmd)
+	case tea.KeyMsg:
+		if msg.Type == tea.KeyCtrlC && mqttConnection.serverConnection != nil {
+			mqttConnection.serverConnection.Disconnect(mqttConnection.ctx)
+		}
+	}
+
+	return mqttConnection, tea.Batch(cmds...)
+}
+
+func (mqttConnection MqttConnection) initConnection() tea.Cmd {
+	return commands.InitConnection(
+		mqttConnection.ctx,
+		mqttConnection.mqttConnectionStatus,
+		mqttConnection.mqttMessages,
+		mqttConnection.credentials.URIs,
+		mqttConnection.credentials.Username,
+		mqttConnection.credentials.Password,
+		mqttConnection.credentials.ClientID,
+		mqttConnection.credentials.Transport,
+	)
+}
+
+// DropConnection closes the network connection without sending DISCONNECT,
+// the way a door losing power or its network does. The connection manager
+// reports the connection going down and reconnects by itself.
+func (mqttConnection MqttConnection) DropConnection() tea.Cmd {
+	serverConnection := mqttConnection.serverConnection
+	return func() tea.Msg {
+		serverConnection.TerminateConnectionForTest()
+		return nil
+	}
+}
+
+// Status describes the connection, connected is shown once it's up
+func (mqttConnection MqttConnection) Status(connected string) string {
+	if mqttConnection.Err != nil && !mqttConnection.Initialized {
+		return fmt.Sprintf("%s Failed to start connection manager: %v", mqttConnection.Spinner.View(), mqttConnection.Err)
+	} else if !mqttConnection.Initialized {
+		return fmt.Sprintf("%s Starting connected manager", mqttConnection.Spinner.View())
+	} else if !mqttConnection.IsConnected {
+		return fmt.Sprintf("%s Attempting to connect", mqttConnection.Spinner.View())
+	}
+	return fmt.Sprintf("%s %s", mqttConnection.Spinner.View(), connected)
+}
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"metamakers.org/door-controller-mqtt/messages"
+	"metamakers.org/door-controller-mqtt/testbroker"
+)
+
+func waitForStatus(t *testing.T, statuses chan messages.MqttStatus, connected bool) {
+	t.Helper()
+	for {
+		select {
+		case status := <-statuses:
+			if status.Connected == connected {
+				return
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("Connected never became %v", connected)
+		}
+	}
+}
+
+func TestDropConnection(t *testing.T) {
+	broker := testbroker.Start(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mqttConnection := NewMqttConnection(ctx)
+	mqttConnection, _ = mqttConnection.Update(messages.MqttCredentials{URIs: []string{broker.URI}, ClientID: "door_one"})
+	mqttConnection, _ = mqttConnection.Update(mqttConnection.initConnection()())
+	if mqttConnection.Err != nil {
+		t.Fatalf("Failed to start connection manager: %v", mqttConnection.Err)
+	}
+	waitForStatus(t, mqttConnection.mqttConnectionStatus, true)
+
+	mqttConnection.DropConnection()()
+
+	select {
+	case disconnect := <-broker.Disconnects:
+		if disconnect.ClientID != "door_one" {
+			t.Fatalf("got a disconnect from %s, want door_one", disconnect.ClientID)
+		}
+		if disconnect.Err == nil {
+			t.Errorf("door_one sent DISCONNECT, want the connection dropped")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Broker never saw door_one disconnect")
+	}
+
+	// The connection manager notices and connects again by itself
+	waitForStatus(t, mqttConnection.mqttConnectionStatus, false)
+	waitForStatus(t, mqttConnection.mqttConnectionStatus, true)
+}
@@ -7,8 +7,9 @@ import (
 )
 
 type KeyLabelPair struct {
-	Key   string
-	Label string
+	Key     string
+	Label   string
+	Checked bool
 }
 
 type Options struct {
@@ -31,19 +32,29 @@ type keyBindings struct {
 func NewOptions(isRadio bool, changeMessage func(state map[string]bool) tea.Msg, pairs ...KeyLabelPair) Options {
 	options := make(map[string]Checkbox, 0)
 	order := make([]string, 0)
+	// Radio options always have one option checked, the first
+	// one unless another has been asked for
+	lastToggled := 0
 	for index, pair := range pairs {
 		options[pair.Key] = Checkbox{Label: pair.Label, IsRadio: isRadio}
 		order = append(order, pair.Key)
-		if isRadio && index == 0 {
-			options[pair.Key] = options[pair.Key].Toggle()
+		if pair.Checked {
+			if !isRadio {
+				options[pair.Key] = options[pair.Key].Toggle()
+			} else if lastToggled == 0 {
+				lastToggled = index
+			}
 		}
 	}
+	if isRadio && len(order) > 0 {
+		options[order[lastToggled]] = options[order[lastToggled]].Toggle()
+	}
 
 	return Options{
 		options:       options,
 		order:         order,
 		active:        0,
-		lastToggled:   0,
+		lastToggled:   lastToggled,
 		focused:       false,
 		isRadio:       isRadio,
 		changeMessage: changeMessage,
@@ -93,12 +104,14 @@ func (options Options) ToggleFocus() Options {
 	return options
 }
 
+// changeStateMessage copies the state straight away, the options are
+// changed by the next Update while the command runs
 func changeStateMessage(options Options) tea.Cmd {
+	state := make(map[string]bool, len(options.options))
+	for key, item := range options.options {
+		state[key] = item.checked
+	}
 	return func() tea.Msg {
-		state := make(map[string]bool, 0)
-		for key, item := range options.options {
-			state[key] = item.checked
-		}
 		return options.changeMessage(state)
 	}
 }
@@ -3,36 +3,48 @@ package models
 import (
 	"context"
 	"fmt"
+	"slices"
 	"time"
 
-	"github.com/charmbracelet/bubbles/spinner"
 	tea "github.com/charmbracelet/bubbletea"
-	"github.com/eclipse/paho.golang/autopaho"
 	"metamakers.org/door-controller-mqtt/commands"
+	"metamakers.org/door-controller-mqtt/config"
+	"metamakers.org/door-controller-mqtt/door"
 	"metamakers.org/door-controller-mqtt/messages"
 	"metamakers.org/door-controller-mqtt/mqtt"
+	"metamakers.org/door-controller-mqtt/rpc"
 )
 
 type StatusWindow struct {
-	serverConnection      *autopaho.ConnectionManager
-	ctx                   context.Context
-	mqttMessages          chan messages.MqttMessage
-	mqttConnectionStatus  chan messages.MqttStatus
 	clientID              string
+	namespace             mqtt.Namespace
+	device                *mimicDevice
+	responder             *rpc.Responder
 	tabIndex              int
 	maxTabIndex           int
 	accessListState       bool
 	failHealthCheckState  bool
+	faults                map[string]bool
+	faultConfig           config.FaultConfig
+	faultGeneration       int
+	door                  door.Door
+	unlockDuration        time.Duration
+	heldOpenAfter         time.Duration
+	relockGeneration      int
+	heldOpenGeneration    int
+	pinCard               string
+	pinFailures           map[string]int
+	lockedOut             map[string]time.Time
+	pinAttempts           int
+	pinLockout            time.Duration
+	cardListState         bool
 	unluckState           bool
 	deniedAccessState     bool
 	code                  string
-	Err                   error
-	Spinner               spinner.Model
-	IsConnected           bool
-	Initialized           bool
 	ResponseOptionsWindow ResponseOptionsWindow
 	DoorTopicWindow       DoorTopicWindow
 	TextInputWindow       TextInputWindow
+	MqttConnection
 	Window
 }
 
@@ -41,38 +53,37 @@ const (
 	FailHealthCheckKey = "fail_health_check"
 	DeniedAccessKey    = "denied_access"
 	UnlockKey          = "unlock"
+	CardListKey        = "card_list"
 )
 
-func NewStatusWindow(ctx context.Context, focused bool) StatusWindow {
-	statusSpinnger := spinner.New()
-	statusSpinnger.Spinner = spinner.Dot
-	statusSpinnger.Style = spinnerStyle
-
+func NewStatusWindow(ctx context.Context, focused bool, mimicConfig config.MimicConfig) StatusWindow {
 	return StatusWindow{
-		ctx:                  ctx,
-		mqttConnectionStatus: make(chan messages.MqttStatus),
-		mqttMessages:         make(chan messages.MqttMessage),
 		clientID:             "",
-		serverConnection:     nil,
+		device:               newMimicDevice(mimicConfig),
 		tabIndex:             0,
 		maxTabIndex:          2,
 		accessListState:      false,
 		failHealthCheckState: false,
-		Err:                  nil,
-		Spinner:              statusSpinnger,
-		IsConnected:          false,
-		Initialized:          false,
+		faults:               make(map[string]bool),
+		faultConfig:          mimicConfig.Faults,
+		faultGeneration:      0,
+		unlockDuration:       mimicConfig.UnlockDuration,
+		heldOpenAfter:        mimicConfig.HeldOpenAfter,
+		pinFailures:          make(map[string]int),
+		lockedOut:            make(map[string]time.Time),
+		pinAttempts:          mimicConfig.PinAttempts,
+		pinLockout:           mimicConfig.PinLockout,
 		ResponseOptionsWindow: NewResponseOptionsWindow(
 			false,
 			0,
-			KeyLabelPair{Key: AccessListKey, Label: "Error on access list"},
-			KeyLabelPair{Key: FailHealthCheckKey, Label: "Fail health check"},
+			responseOptions(mimicConfig)...,
 		),
 		DoorTopicWindow: NewDoorTopicWindow(
 			false,
 			0,
-			KeyLabelPair{Key: "unlock", Label: "Send unlock success"},
-			KeyLabelPair{Key: "denied_access", Label: "Send unlock denied"},
+			KeyLabelPair{Key: CardListKey, Label: "Check card list", Checked: mimicConfig.DoorMessage == CardListKey},
+			KeyLabelPair{Key: UnlockKey, Label: "Send unlock success", Checked: mimicConfig.DoorMessage == UnlockKey},
+			KeyLabelPair{Key: DeniedAccessKey, Label: "Send unlock denied", Checked: mimicConfig.DoorMessage == DeniedAccessKey},
 		),
 		TextInputWindow: NewTextInputWindow(
 			false,
@@ -80,7 +91,9 @@ func NewStatusWindow(ctx context.Context, focused bool) StatusWindow {
 				return messages.DoorCodeTextMessage(value)
 			},
 			0,
+			CardEncoding(mimicConfig),
 		),
+		MqttConnection: NewMqttConnection(ctx),
 		Window: Window{
 			focused: focused,
 			Width:   0,
@@ -92,65 +105,215 @@ func NewStatusWindow(ctx context.Context, focused bool) StatusWindow {
 	}
 }
 
+func responseOptions(mimicConfig config.MimicConfig) []KeyLabelPair {
+	pairs := []KeyLabelPair{
+		{Key: AccessListKey, Label: "Error on access list", Checked: mimicConfig.FailAccessList},
+		{Key: FailHealthCheckKey, Label: "Fail health check", Checked: mimicConfig.FailHealthCheck},
+	}
+	for _, fault := range Faults {
+		fault.Checked = slices.Contains(mimicConfig.Faults.Enabled, fault.Key)
+		pairs = append(pairs, fault)
+	}
+	return pairs
+}
+
+// publisher injects the faults that change payloads, it's used for
+// everything the mimic publishes
+func (statusWindow StatusWindow) publisher() commands.Publisher {
+	publisher := faultyPublisher{
+		publisher: statusWindow.serverConnection,
+		malformed: statusWindow.faults[MalformedPayloadsKey],
+		duplicate: statusWindow.faults[DuplicatePublishesKey],
+	}
+	if statusWindow.faults[ClockSkewKey] {
+		publisher.clockSkew = statusWindow.faultConfig.ClockSkew
+	}
+	if publisher.clockSkew == 0 && !publisher.malformed && !publisher.duplicate {
+		return statusWindow.serverConnection
+	}
+	return publisher
+}
+
+// respond delays the responses to porter's messages while responses are
+// set to be delayed
+func (statusWindow StatusWindow) respond(cmd tea.Cmd) tea.Cmd {
+	if statusWindow.faults[DelayResponsesKey] && statusWindow.faultConfig.Latency > 0 {
+		return commands.DelayCommandBy(statusWindow.faultConfig.Latency, cmd)
+	}
+	return cmd
+}
+
+// scheduleFaults starts the timers for the timed faults that are on. Any
+// timers already running are made stale by the new generation.
+func (statusWindow *StatusWindow) scheduleFaults() []tea.Cmd {
+	statusWindow.faultGeneration += 1
+	if !statusWindow.IsConnected {
+		return nil
+	}
+
+	delays := map[string]time.Duration{
+		SuddenDisconnectKey: statusWindow.faultConfig.DisconnectInterval,
+		ReconnectStormKey:   statusWindow.faultConfig.StormDelay,
+		DoorHeldOpenKey:     statusWindow.faultConfig.HeldOpenInterval,
+	}
+	cmds := make([]tea.Cmd, 0)
+	for fault, delay := range delays {
+		if statusWindow.faults[fault] {
+			cmds = append(cmds, statusWindow.faultTimer(fault, delay))
+		}
+	}
+	return cmds
+}
+
+func (statusWindow StatusWindow) faultTimer(fault string, delay time.Duration) tea.Cmd {
+	msg := messages.FaultTimerMessage{Fault: fault, Generation: statusWindow.faultGeneration}
+	return commands.DelayCommandBy(delay, func() tea.Msg { return msg })
+}
+
+// publishDoor publishes the levels returned by a door transition in
+// order, card is who the door was unlocked by before the transition
+func (statusWindow *StatusWindow) publishDoor(card string, levels []string) tea.Cmd {
+	statusWindow.device.SetDoorState(statusWindow.door.State())
+	if card == "" {
+		// Nobody unlocked a forced door, it's published as card zero
+		card, _ = statusWindow.device.Encoding().Format(0)
+	}
+	cmds := make([]tea.Cmd, 0, len(levels))
+	for _, level := range levels {
+		cmds = append(cmds, commands.PublishDoorEvent(statusWindow.publisher(), statusWindow.ctx, statusWindow.namespace, statusWindow.clientID, level, card))
+	}
+	return tea.Sequence(cmds...)
+}
+
+// unlock lets the card in, another swipe while unlocked starts the unlock
+// duration over
+func (statusWindow *StatusWindow) unlock(card string) tea.Cmd {
+	return tea.Batch(
+		statusWindow.publishDoor(card, statusWindow.door.Unlock(card)),
+		statusWindow.relockTimer(),
+	)
+}
+
+// relockTimer starts the unlock duration over
+func (statusWindow *StatusWindow) relockTimer() tea.Cmd {
+	statusWindow.relockGeneration += 1
+	relock := messages.RelockMessage{Generation: statusWindow.relockGeneration}
+	return commands.DelayCommandBy(statusWindow.unlockDuration, func() tea.Msg { return relock })
+}
+
+// holdDoorOpen props the door open for the held open fault, the alarm is
+// published again for as long as it's held open
+func (statusWindow *StatusWindow) holdDoorOpen() tea.Cmd {
+	card := statusWindow.door.Card()
+	switch statusWindow.door.State() {
+	case door.HeldOpen:
+		return statusWindow.publishDoor(card, []string{mqtt.HeldOpenLevel})
+	case door.Forced:
+		// A forced door has already raised its own alarm
+		return nil
+	}
+
+	// The levels are published in one sequence so they stay in order
+	levels := make([]string, 0)
+	var relock tea.Cmd
+	if statusWindow.door.State() == door.Locked {
+		// Nobody swiped, so it's unlocked as card zero
+		levels = append(levels, statusWindow.door.Unlock("")...)
+		relock = statusWindow.relockTimer()
+	}
+	// Any held open timer belongs to the door's last opening
+	statusWindow.heldOpenGeneration += 1
+	levels = append(levels, statusWindow.door.Open()...)
+	levels = append(levels, statusWindow.door.HoldOpen()...)
+	return tea.Batch(statusWindow.publishDoor(card, levels), relock)
+}
+
+func (statusWindow *StatusWindow) askForPIN(card string) {
+	statusWindow.pinCard = card
+	statusWindow.TextInputWindow = statusWindow.TextInputWindow.AskForPIN(card != "")
+}
+
+// enterPIN checks the PIN for pinCard, the card waiting for one. The card
+// is locked out until the time in lockedOut once pinFailures counts
+// pinAttempts bad PINs in a row.
+func (statusWindow *StatusWindow) enterPIN(pin string) tea.Cmd {
+	card := statusWindow.pinCard
+	statusWindow.askForPIN("")
+
+	// The list can change while the PIN is typed, the card has to be
+	// swiped again then
+	verifier, found := statusWindow.device.Verifier(card)
+	if !found {
+		return commands.PublishDeniedAccess(statusWindow.publisher(), statusWindow.ctx, statusWindow.namespace, statusWindow.clientID, card)
+	}
+	if verifier.Check(pin) {
+		delete(statusWindow.pinFailures, card)
+		return statusWindow.unlock(card)
+	}
+
+	failed := commands.PublishDoorEvent(statusWindow.publisher(), statusWindow.ctx, statusWindow.namespace, statusWindow.clientID, mqtt.PinFailedLevel, card)
+	statusWindow.pinFailures[card] += 1
+	if statusWindow.pinFailures[card] < statusWindow.pinAttempts {
+		return failed
+	}
+	delete(statusWindow.pinFailures, card)
+	statusWindow.lockedOut[card] = time.Now().Add(statusWindow.pinLockout)
+	return tea.Sequence(
+		failed,
+		commands.PublishDoorEvent(statusWindow.publisher(), statusWindow.ctx, statusWindow.namespace, statusWindow.clientID, mqtt.PinLockoutLevel, card),
+	)
+}
+
 func (statusWindow StatusWindow) Update(msg tea.Msg) (StatusWindow, tea.Cmd) {
 	cmds := make([]tea.Cmd, 0)
 
+	var connectionCmd tea.Cmd
+	statusWindow.MqttConnection, connectionCmd = statusWindow.MqttConnection.Update(msg)
+	cmds = append(cmds, connectionCmd)
+
 	switch msg := msg.(type) {
-	case messages.UrlParseError:
-		statusWindow.Err = msg.Err
-	case messages.MqttServerConnection:
-		if msg.Err != nil {
-			statusWindow.Initialized = false
-			statusWindow.Err = msg.Err
-			cmds = append(cmds, commands.WaitForStatus(statusWindow.mqttConnectionStatus))
-			break
-		}
-		statusWindow.Initialized = true
-		statusWindow.serverConnection = msg.Connnection
-		cmds = append(cmds, statusWindow.Spinner.Tick)
 	case messages.MqttStatus:
-		statusWindow.IsConnected = msg.Connected
-		if msg.Err == nil && msg.Connected {
+		if statusWindow.Connected(msg) {
+			cmds = append(cmds, statusWindow.scheduleFaults()...)
 			cmds = append(
 				cmds,
-				commands.SubscribeToAccessList(statusWindow.serverConnection, statusWindow.ctx),
-				commands.SubscribeToHealthCheck(statusWindow.serverConnection, statusWindow.ctx),
-				commands.WaitForStatus(statusWindow.mqttConnectionStatus),
-				commands.WaitForMessage(statusWindow.mqttMessages),
+				commands.SubscribeToAccessList(statusWindow.serverConnection, statusWindow.ctx, statusWindow.namespace),
+				commands.SubscribeToHealthCheck(statusWindow.serverConnection, statusWindow.ctx, statusWindow.namespace),
+				commands.SubscribeToRequests(statusWindow.serverConnection, statusWindow.ctx, statusWindow.responder),
 			)
-			break
 		}
-		cmds = append(cmds, commands.WaitForStatus(statusWindow.mqttConnectionStatus))
 	case messages.MqttMessage:
 		switch msg.Topic {
-		case mqtt.HealthCheckTopic:
+		case mqtt.Topic{Namespace: statusWindow.namespace, Level: mqtt.HealthCheckLevel}.Build():
 			if !statusWindow.failHealthCheckState {
-				cmds = append(cmds, commands.HealthCheckHandler(statusWindow.serverConnection, statusWindow.ctx, statusWindow.clientID))
+				cmds = append(cmds, statusWindow.respond(commands.HealthCheckHandler(statusWindow.publisher(), statusWindow.ctx, statusWindow.namespace, statusWindow.clientID)))
 			} else {
-				cmds = append(cmds, commands.FailHealthCheckHandler(statusWindow.clientID))
+				cmds = append(cmds, commands.FailHealthCheckHandler(statusWindow.namespace, statusWindow.clientID))
 			}
-		case mqtt.AccessListTopic:
+		case mqtt.Topic{Namespace: statusWindow.namespace, Level: mqtt.AccessListLevel}.Build():
 			if !statusWindow.accessListState {
-				cmds = append(cmds, commands.AccessListHandler(statusWindow.serverConnection, statusWindow.ctx, statusWindow.clientID))
+				count, err := statusWindow.device.SetAccessList(msg.Payload)
+				cmds = append(cmds, func() tea.Msg {
+					return messages.CardListMessage{Count: count, Err: err}
+				})
+				if err != nil {
+					cmds = append(cmds, statusWindow.respond(commands.InvalidAccessListHandler(statusWindow.publisher(), statusWindow.ctx, statusWindow.namespace, statusWindow.clientID, err)))
+				} else {
+					cmds = append(cmds, statusWindow.respond(commands.AccessListHandler(statusWindow.publisher(), statusWindow.ctx, statusWindow.namespace, statusWindow.clientID)))
+				}
 			} else {
-				cmds = append(cmds, commands.FailAccessListHandler(statusWindow.serverConnection, statusWindow.ctx, statusWindow.clientID))
+				cmds = append(cmds, statusWindow.respond(commands.FailAccessListHandler(statusWindow.publisher(), statusWindow.ctx, statusWindow.namespace, statusWindow.clientID)))
+			}
+		default:
+			if statusWindow.responder != nil && statusWindow.responder.IsRequest(msg.Topic) {
+				cmds = append(cmds, statusWindow.respond(commands.RespondToRequest(statusWindow.publisher(), statusWindow.ctx, statusWindow.responder, msg)))
 			}
 		}
-		cmds = append(cmds, commands.WaitForMessage(statusWindow.mqttMessages))
 	case messages.MqttCredentials:
 		statusWindow.clientID = msg.Username
-		cmds = append(cmds,
-			commands.InitConnection(
-				statusWindow.ctx,
-				statusWindow.mqttConnectionStatus,
-				statusWindow.mqttMessages,
-				msg.URI,
-				msg.Username,
-				msg.Password,
-			),
-			commands.WaitForStatus(statusWindow.mqttConnectionStatus),
-			statusWindow.Spinner.Tick,
-		)
+		statusWindow.namespace = msg.Namespace
+		statusWindow.responder = rpc.NewResponder(msg.Namespace, msg.Username)
+		statusWindow.device.Register(statusWindow.responder)
 	case messages.ResponseOptionsSelectionMessage:
 		var exists bool
 		if statusWindow.accessListState, exists = msg[AccessListKey]; !exists {
@@ -159,36 +322,130 @@ func (statusWindow StatusWindow) Update(msg tea.Msg) (StatusWindow, tea.Cmd) {
 		if statusWindow.failHealthCheckState, exists = msg[FailHealthCheckKey]; !exists {
 			statusWindow.failHealthCheckState = false
 		}
+		faults := make(map[string]bool, len(Faults))
+		enabled := make([]string, 0)
+		for _, fault := range Faults {
+			faults[fault.Key] = msg[fault.Key]
+			if msg[fault.Key] {
+				enabled = append(enabled, fault.Key)
+			}
+		}
+		statusWindow.faults = faults
+		statusWindow.device.SetResponseOptions(statusWindow.accessListState, statusWindow.failHealthCheckState, enabled)
+		cmds = append(cmds, statusWindow.scheduleFaults()...)
+	case messages.FaultTimerMessage:
+		if msg.Generation != statusWindow.faultGeneration || !statusWindow.faults[msg.Fault] || !statusWindow.IsConnected {
+			break
+		}
+		switch msg.Fault {
+		case SuddenDisconnectKey, ReconnectStormKey:
+			// The timers start again once the new connection is up
+			injected := messages.FaultInjectedMessage{Fault: msg.Fault, Detail: "Dropped the connection without disconnecting"}
+			cmds = append(cmds, statusWindow.DropConnection(), func() tea.Msg { return injected })
+		case DoorHeldOpenKey:
+			cmds = append(
+				cmds,
+				statusWindow.holdDoorOpen(),
+				statusWindow.faultTimer(DoorHeldOpenKey, statusWindow.faultConfig.HeldOpenInterval),
+			)
+		}
 	case messages.DoorTopicSelectionMessage:
 		var exists bool
+		if statusWindow.cardListState, exists = msg[CardListKey]; !exists {
+			statusWindow.cardListState = false
+		}
 		if statusWindow.unluckState, exists = msg[UnlockKey]; !exists {
 			statusWindow.unluckState = false
 		}
 		if statusWindow.deniedAccessState, exists = msg[DeniedAccessKey]; !exists {
 			statusWindow.deniedAccessState = false
 		}
+		switch {
+		case statusWindow.cardListState:
+			statusWindow.device.SetDoorMessage(CardListKey)
+		case statusWindow.unluckState:
+			statusWindow.device.SetDoorMessage(UnlockKey)
+		case statusWindow.deniedAccessState:
+			statusWindow.device.SetDoorMessage(DeniedAccessKey)
+		default:
+			statusWindow.device.SetDoorMessage("")
+		}
 	case messages.DoorCodeTextMessage:
-		statusWindow.code = string(msg)
-		if statusWindow.unluckState {
-			cmds = append(
-				cmds,
-				commands.PublishUnlock(statusWindow.serverConnection, statusWindow.ctx, statusWindow.clientID, statusWindow.code),
-				commands.DelayCommandBy(
-					time.Second*8,
-					commands.PublishLock(statusWindow.serverConnection, statusWindow.ctx, statusWindow.clientID, statusWindow.code),
-				),
-			)
-		} else if statusWindow.deniedAccessState {
+		// The keypad takes the PIN once a card that needs one is swiped
+		if statusWindow.pinCard != "" {
+			cmds = append(cmds, statusWindow.enterPIN(string(msg)))
+			break
+		}
+		code, err := statusWindow.device.Encoding().Normalize(string(msg))
+		if err != nil {
+			invalid := messages.InvalidCardMessage{Code: string(msg), Err: err}
+			cmds = append(cmds, func() tea.Msg { return invalid })
+			break
+		}
+		statusWindow.code = code
+		// A real controller decides from its card list, the other door
+		// messages force the outcome
+		unlock, denied := statusWindow.unluckState, statusWindow.deniedAccessState
+		if statusWindow.cardListState {
+			unlock = statusWindow.device.Allowed(statusWindow.code)
+			if time.Now().Before(statusWindow.lockedOut[statusWindow.code]) {
+				unlock = false
+			} else if _, needsPIN := statusWindow.device.Verifier(statusWindow.code); unlock && needsPIN {
+				statusWindow.askForPIN(statusWindow.code)
+				break
+			}
+			denied = !unlock
+		}
+		if unlock {
+			cmds = append(cmds, statusWindow.unlock(statusWindow.code))
+		} else if denied {
 			cmds = append(
 				cmds,
-				commands.PublishDeniedAccess(statusWindow.serverConnection, statusWindow.ctx, statusWindow.clientID, statusWindow.code),
+				commands.PublishDeniedAccess(statusWindow.publisher(), statusWindow.ctx, statusWindow.namespace, statusWindow.clientID, statusWindow.code),
 			)
 		}
+	case messages.ResendCodeMessage:
+		statusWindow.askForPIN("")
+		cmds = append(cmds, func() tea.Msg { return messages.DoorCodeTextMessage(msg) })
+	case messages.EditCodeMessage:
+		statusWindow.askForPIN("")
+		statusWindow.TextInputWindow.TextInput.SetValue(string(msg))
+		statusWindow.TextInputWindow.TextInput.CursorEnd()
+		statusWindow.tabIndex = 2
+	case messages.PinTextMessage:
+		if statusWindow.pinCard != "" {
+			cmds = append(cmds, statusWindow.enterPIN(string(msg)))
+		}
+	case messages.RelockMessage:
+		if msg.Generation != statusWindow.relockGeneration {
+			break
+		}
+		card := statusWindow.door.Card()
+		cmds = append(cmds, statusWindow.publishDoor(card, statusWindow.door.Relock()))
+	case messages.DoorSensorMessage:
+		card := statusWindow.door.Card()
+		// Any held open timer belongs to the door's last opening
+		statusWindow.heldOpenGeneration += 1
+		if !msg.Open {
+			cmds = append(cmds, statusWindow.publishDoor(card, statusWindow.door.Close()))
+			break
+		}
+		cmds = append(cmds, statusWindow.publishDoor(card, statusWindow.door.Open()))
+		if statusWindow.door.State() == door.Open {
+			heldOpen := messages.HeldOpenMessage{Generation: statusWindow.heldOpenGeneration}
+			cmds = append(cmds, commands.DelayCommandBy(statusWindow.heldOpenAfter, func() tea.Msg { return heldOpen }))
+		}
+	case messages.HeldOpenMessage:
+		if msg.Generation != statusWindow.heldOpenGeneration {
+			break
+		}
+		card := statusWindow.door.Card()
+		cmds = append(cmds, statusWindow.publishDoor(card, statusWindow.door.HoldOpen()))
 	case tea.KeyMsg:
-		if msg.Type == tea.KeyCtrlC {
-			if statusWindow.serverConnection != nil {
-				statusWindow.serverConnection.Disconnect(statusWindow.ctx)
-			}
+		if msg.Type == tea.KeyCtrlO {
+			// The reed switch, ctrl+o opens the door and closes it again
+			open := !statusWindow.door.State().IsOpen()
+			cmds = append(cmds, func() tea.Msg { return messages.DoorSensorMessage{Open: open} })
 		} else if msg.Type == tea.KeyTab {
 			if statusWindow.IsFocused() {
 				if statusWindow.tabIndex+1 > statusWindow.maxTabIndex {
@@ -198,10 +455,6 @@ func (statusWindow StatusWindow) Update(msg tea.Msg) (StatusWindow, tea.Cmd) {
 				}
 			}
 		}
-	case spinner.TickMsg:
-		var spinnerCmd tea.Cmd
-		statusWindow.Spinner, spinnerCmd = statusWindow.Spinner.Update(msg)
-		cmds = append(cmds, spinnerCmd)
 	}
 
 	if statusWindow.Window.IsFocused() {
@@ -254,22 +507,12 @@ func (statusWindow StatusWindow) UpdateDimensions(width int, height int) StatusW
 }
 
 func (statusWindow *StatusWindow) Render() string {
-	var status string
-	if statusWindow.Err != nil && !statusWindow.Initialized {
-		status = fmt.Sprintf("%s Failed to start connection manager", statusWindow.Spinner.View())
-	} else if !statusWindow.Initialized {
-		status = fmt.Sprintf("%s Starting connected manager", statusWindow.Spinner.View())
-	} else if statusWindow.Initialized && !statusWindow.IsConnected {
-		status = fmt.Sprintf("%s Attempting to connect", statusWindow.Spinner.View())
-	} else if statusWindow.Initialized && statusWindow.IsConnected {
-		status = fmt.Sprintf("%s Connected to MQTT Broker", statusWindow.Spinner.View())
-	} else {
-		status = fmt.Sprintf("%s Unknown status", statusWindow.Spinner.View())
-	}
+	status := statusWindow.Status(fmt.Sprintf("Connected to MQTT Broker %s", statusWindow.Broker))
 
 	return statusWindow.Window.Render(
 		header.Render("Connection Status"),
 		statusText.Render(status),
+		statusText.Render(fmt.Sprintf("Door %s (ctrl+o)", statusWindow.door.State())),
 		header.Copy().MarginTop(2).Render("Options"),
 		statusWindow.ResponseOptionsWindow.Render(),
 		header.Copy().MarginTop(2).Render("Send Door Message"),
@@ -32,6 +32,16 @@ var (
 	text = lipgloss.NewStyle().
 		Foreground(lipgloss.Color("#FAFAFA"))
 
+	healthyColor   = lipgloss.Color("#04B575")
+	unhealthyColor = lipgloss.Color("#FF4672")
+
+	doorCellStyle = lipgloss.NewStyle().
+			Align(lipgloss.Left).
+			Foreground(lipgloss.Color("#FAFAFA")).
+			Border(lipgloss.RoundedBorder()).
+			Padding(0, 1).
+			MarginRight(1)
+
 	header = lipgloss.NewStyle().
 		Foreground(lipgloss.Color("#FAFAFA")).
 		BorderStyle(lipgloss.NormalBorder()).
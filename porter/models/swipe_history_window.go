@@ -0,0 +1,249 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/reflow/truncate"
+
+	"metamakers.org/door-controller-mqtt/cards"
+	"metamakers.org/door-controller-mqtt/config"
+	"metamakers.org/door-controller-mqtt/messages"
+	"metamakers.org/door-controller-mqtt/mqtt"
+)
+
+// maxSwipeRecords keeps the history from growing for as long as mimic runs
+const maxSwipeRecords = 100
+
+const invalidOutcome = "invalid"
+
+// swipeOutcomes are the levels a swipe ends with, and how they're shown
+var swipeOutcomes = map[string]string{
+	mqtt.UnlockLevel:       "unlocked",
+	mqtt.DeniedAccessLevel: "denied",
+	mqtt.PinFailedLevel:    "bad PIN",
+	mqtt.PinLockoutLevel:   "locked out",
+	invalidOutcome:         "invalid",
+}
+
+type swipeRecord struct {
+	time    time.Time
+	code    string
+	outcome string
+	err     error
+}
+
+// SwipeHistoryWindow lists the favourite codes followed by every code
+// swiped, newest first. Outcomes are taken from what mimic publishes so a
+// failed publish shows up against its swipe.
+type SwipeHistoryWindow struct {
+	namespace  mqtt.Namespace
+	encoding   cards.Encoding
+	path       string
+	favourites Favourites
+	loadErr    error
+	records    []swipeRecord
+	selected   int
+	previous   key.Binding
+	next       key.Binding
+	resend     key.Binding
+	edit       key.Binding
+	favourite  key.Binding
+	Viewport   viewport.Model
+	Window
+}
+
+func NewSwipeHistoryWindow(focused bool, mimicConfig config.MimicConfig) SwipeHistoryWindow {
+	path := FavouritesPath(mimicConfig)
+	favourites, err := LoadFavourites(path)
+
+	return SwipeHistoryWindow{
+		encoding:   CardEncoding(mimicConfig),
+		path:       path,
+		favourites: favourites,
+		loadErr:    err,
+		records:    make([]swipeRecord, 0),
+		previous:   key.NewBinding(key.WithKeys("k", "up")),
+		next:       key.NewBinding(key.WithKeys("j", "down")),
+		resend:     key.NewBinding(key.WithKeys("enter")),
+		edit:       key.NewBinding(key.WithKeys("e")),
+		favourite:  key.NewBinding(key.WithKeys("f")),
+		Viewport:   viewport.New(0, 0),
+		Window: Window{
+			focused: focused,
+			Width:   0,
+			Height:  0,
+			Margin:  Orientation{0, 1, 0, 0},
+			Padding: Orientation{0, 2, 0, 2},
+			Border:  Border{true, true, true, true},
+		},
+	}
+}
+
+// codes are the rows of the history, favourites first
+func (swipeHistoryWindow SwipeHistoryWindow) codes() []string {
+	codes := make([]string, 0)
+	codes = append(codes, swipeHistoryWindow.favourites[swipeHistoryWindow.encoding.Name()]...)
+	for _, record := range swipeHistoryWindow.records {
+		codes = append(codes, record.code)
+	}
+	return codes
+}
+
+func (swipeHistoryWindow SwipeHistoryWindow) record(record swipeRecord) SwipeHistoryWindow {
+	swipeHistoryWindow.records = append([]swipeRecord{record}, swipeHistoryWindow.records...)
+	if len(swipeHistoryWindow.records) > maxSwipeRecords {
+		swipeHistoryWindow.records = swipeHistoryWindow.records[:maxSwipeRecords]
+	}
+	// While the history is being used the same row stays selected as the
+	// rows move down, otherwise the newest swipe is
+	if swipeHistoryWindow.IsFocused() && swipeHistoryWindow.selected >= len(swipeHistoryWindow.favourites[swipeHistoryWindow.encoding.Name()]) {
+		swipeHistoryWindow.selected += 1
+	}
+	return swipeHistoryWindow
+}
+
+func (swipeHistoryWindow SwipeHistoryWindow) Update(msg tea.Msg) (SwipeHistoryWindow, tea.Cmd) {
+	cmds := make([]tea.Cmd, 0)
+
+	switch msg := msg.(type) {
+	case messages.MqttCredentials:
+		swipeHistoryWindow.namespace = msg.Namespace
+	case messages.PublishMessage:
+		topic, err := mqtt.ParseTopic(swipeHistoryWindow.namespace, msg.Topic)
+		if _, found := swipeOutcomes[topic.Level]; err != nil || !found {
+			break
+		}
+		code, _, _ := strings.Cut(msg.Payload, "|")
+		swipeHistoryWindow = swipeHistoryWindow.record(swipeRecord{
+			time:    time.Now(),
+			code:    code,
+			outcome: topic.Level,
+			err:     msg.Err,
+		})
+	case messages.InvalidCardMessage:
+		if msg.Code == "" {
+			break
+		}
+		swipeHistoryWindow = swipeHistoryWindow.record(swipeRecord{
+			time:    time.Now(),
+			code:    msg.Code,
+			outcome: invalidOutcome,
+		})
+	case tea.KeyMsg:
+		if !swipeHistoryWindow.IsFocused() {
+			break
+		}
+		codes := swipeHistoryWindow.codes()
+		if len(codes) == 0 {
+			break
+		}
+		swipeHistoryWindow.selected = min(swipeHistoryWindow.selected, len(codes)-1)
+		code := codes[swipeHistoryWindow.selected]
+
+		switch {
+		case key.Matches(msg, swipeHistoryWindow.previous):
+			swipeHistoryWindow.selected = max(swipeHistoryWindow.selected-1, 0)
+		case key.Matches(msg, swipeHistoryWindow.next):
+			swipeHistoryWindow.selected = min(swipeHistoryWindow.selected+1, len(codes)-1)
+		case key.Matches(msg, swipeHistoryWindow.resend):
+			cmds = append(cmds, func() tea.Msg { return messages.ResendCodeMessage(code) })
+		case key.Matches(msg, swipeHistoryWindow.edit):
+			cmds = append(cmds, func() tea.Msg { return messages.EditCodeMessage(code) })
+		case key.Matches(msg, swipeHistoryWindow.favourite):
+			// An invalid code can't be swiped, so there's no point keeping it
+			if _, err := swipeHistoryWindow.encoding.Normalize(code); err != nil {
+				break
+			}
+			encoding := swipeHistoryWindow.encoding.Name()
+			before := len(swipeHistoryWindow.favourites[encoding])
+			swipeHistoryWindow.favourites = swipeHistoryWindow.favourites.Toggle(encoding, code)
+			// A history row stays selected as favourites come and go above it
+			if swipeHistoryWindow.selected >= before {
+				swipeHistoryWindow.selected += len(swipeHistoryWindow.favourites[encoding]) - before
+			}
+			cmds = append(cmds, SaveFavourites(swipeHistoryWindow.path, swipeHistoryWindow.favourites))
+		}
+	}
+
+	swipeHistoryWindow.Viewport.SetContent(swipeHistoryWindow.renderRows())
+	// Scroll just enough to keep the selected row in view
+	if swipeHistoryWindow.selected < swipeHistoryWindow.Viewport.YOffset {
+		swipeHistoryWindow.Viewport.SetYOffset(swipeHistoryWindow.selected)
+	} else if bottom := swipeHistoryWindow.Viewport.YOffset + swipeHistoryWindow.Viewport.Height; swipeHistoryWindow.selected >= bottom {
+		swipeHistoryWindow.Viewport.SetYOffset(swipeHistoryWindow.selected - swipeHistoryWindow.Viewport.Height + 1)
+	}
+
+	return swipeHistoryWindow, tea.Batch(cmds...)
+}
+
+func (swipeHistoryWindow SwipeHistoryWindow) UpdateDimensions(width int, height int) SwipeHistoryWindow {
+	swipeHistoryWindow.SetWidth(width)
+	swipeHistoryWindow.SetHeight(height)
+
+	// Leave room for the header and key help lines
+	swipeHistoryWindow.Viewport.Width = swipeHistoryWindow.GetInnerWidth()
+	swipeHistoryWindow.Viewport.Height = max(swipeHistoryWindow.GetInnerHeight()-4, 1)
+	swipeHistoryWindow.Viewport.SetContent(swipeHistoryWindow.renderRows())
+
+	return swipeHistoryWindow
+}
+
+func (swipeHistoryWindow SwipeHistoryWindow) renderRows() string {
+	encoding := swipeHistoryWindow.encoding.Name()
+	rows := make([]string, 0)
+	for _, code := range swipeHistoryWindow.favourites[encoding] {
+		rows = append(rows, fmt.Sprintf("★ %s", code))
+	}
+	for _, record := range swipeHistoryWindow.records {
+		mark := " "
+		if swipeHistoryWindow.favourites.Contains(encoding, record.code) {
+			mark = "★"
+		}
+		result := "sent"
+		if record.err != nil {
+			result = fmt.Sprintf("failed: %v", record.err)
+		} else if record.outcome == invalidOutcome {
+			result = "not sent"
+		}
+		rows = append(rows, fmt.Sprintf(
+			"%s %s %s %s, %s",
+			mark,
+			record.time.Format("15:04:05"),
+			record.code,
+			swipeOutcomes[record.outcome],
+			result,
+		))
+	}
+
+	for index, row := range rows {
+		row = truncate.StringWithTail(row, uint(max(swipeHistoryWindow.Viewport.Width, 0)), "…")
+		if index == swipeHistoryWindow.selected && swipeHistoryWindow.IsFocused() {
+			row = checkboxHighlightStyle.Render(row)
+		}
+		rows[index] = row
+	}
+	return strings.Join(rows, "\n")
+}
+
+func (swipeHistoryWindow SwipeHistoryWindow) Render() string {
+	summary := "No swipes yet"
+	if count := len(swipeHistoryWindow.records); count > 0 {
+		summary = fmt.Sprintf("%d swipes", count)
+	}
+	if swipeHistoryWindow.loadErr != nil {
+		summary = fmt.Sprintf("Failed to load favourites: %v", swipeHistoryWindow.loadErr)
+	}
+	return swipeHistoryWindow.Window.Render(lipgloss.JoinVertical(
+		lipgloss.Left,
+		header.Render("Swipe History"),
+		text.Render(truncate.StringWithTail(summary, uint(max(swipeHistoryWindow.GetInnerWidth(), 0)), "…")),
+		swipeHistoryWindow.Viewport.View(),
+		text.Render(truncate.StringWithTail("enter resend · e edit · f favourite", uint(max(swipeHistoryWindow.GetInnerWidth(), 0)), "…")),
+	))
+}
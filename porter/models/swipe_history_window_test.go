@@ -0,0 +1,166 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"metamakers.org/door-controller-mqtt/config"
+	"metamakers.org/door-controller-mqtt/messages"
+	"metamakers.org/door-controller-mqtt/mqtt"
+)
+
+// runCmd runs the command and any it batches, returning every message
+func runCmd(cmd tea.Cmd) []tea.Msg {
+	if cmd == nil {
+		return nil
+	}
+	msg := cmd()
+	batch, ok := msg.(tea.BatchMsg)
+	if !ok {
+		return []tea.Msg{msg}
+	}
+	msgs := make([]tea.Msg, 0)
+	for _, cmd := range batch {
+		msgs = append(msgs, runCmd(cmd)...)
+	}
+	return msgs
+}
+
+func newTestSwipeHistory(t *testing.T) SwipeHistoryWindow {
+	t.Helper()
+	mimicConfig := config.Default().Mimic
+	mimicConfig.FavouritesFile = filepath.Join(t.TempDir(), "mimic_favourites.json")
+	swipeHistoryWindow := NewSwipeHistoryWindow(true, mimicConfig)
+	swipeHistoryWindow, _ = swipeHistoryWindow.Update(messages.MqttCredentials{Namespace: mqtt.DefaultNamespace})
+	return swipeHistoryWindow.UpdateDimensions(80, 20)
+}
+
+func press(swipeHistoryWindow SwipeHistoryWindow, keys ...string) (SwipeHistoryWindow, []tea.Msg) {
+	msgs := make([]tea.Msg, 0)
+	for _, pressed := range keys {
+		msg := tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(pressed)}
+		if pressed == "enter" {
+			msg = tea.KeyMsg{Type: tea.KeyEnter}
+		}
+		var cmd tea.Cmd
+		swipeHistoryWindow, cmd = swipeHistoryWindow.Update(msg)
+		msgs = append(msgs, runCmd(cmd)...)
+	}
+	return swipeHistoryWindow, msgs
+}
+
+func TestSwipeHistoryResend(t *testing.T) {
+	swipeHistoryWindow := newTestSwipeHistory(t)
+	for _, msg := range []tea.Msg{
+		messages.PublishMessage{Topic: "door_controller/unlock/door_one", Payload: "0001234567|2026-10-19 10:00:00"},
+		messages.PublishMessage{Topic: "door_controller/denied_access/door_one", Payload: "0007654321|2026-10-19 10:00:01", Err: errors.New("Not authorised")},
+		messages.InvalidCardMessage{Code: "12ab"},
+		// Only swipes make it into the history
+		messages.PublishMessage{Topic: "door_controller/door_open/door_one", Payload: "0001234567|2026-10-19 10:00:02"},
+		messages.InvalidCardMessage{},
+	} {
+		swipeHistoryWindow, _ = swipeHistoryWindow.Update(msg)
+	}
+
+	tests := []struct {
+		keys []string
+		want messages.ResendCodeMessage
+	}{
+		{keys: []string{"enter"}, want: "12ab"},
+		{keys: []string{"j", "enter"}, want: "0007654321"},
+		{keys: []string{"j", "j", "j", "enter"}, want: "0001234567"},
+		{keys: []string{"j", "k", "k", "enter"}, want: "12ab"},
+	}
+
+	for _, test := range tests {
+		window := swipeHistoryWindow
+		// The newest swipe starts at the top
+		window.selected = 0
+		_, msgs := press(window, test.keys...)
+		if len(msgs) != 1 || msgs[0] != test.want {
+			t.Errorf("%v: got %v, want %s resent", test.keys, msgs, test.want)
+		}
+	}
+}
+
+func TestSwipeHistoryResendKeepsSelection(t *testing.T) {
+	swipeHistoryWindow := newTestSwipeHistory(t)
+	swipeHistoryWindow, _ = swipeHistoryWindow.Update(messages.PublishMessage{Topic: "door_controller/unlock/door_one", Payload: "0001234567|2026-10-19 10:00:00"})
+	swipeHistoryWindow, _ = press(swipeHistoryWindow, "f")
+
+	// Resending the favourite records a new swipe below it, which moves the
+	// history down but leaves the favourite selected
+	swipeHistoryWindow, msgs := press(swipeHistoryWindow, "enter")
+	if len(msgs) != 1 || msgs[0] != messages.ResendCodeMessage("0001234567") {
+		t.Fatalf("got %v, want the favourite resent", msgs)
+	}
+	swipeHistoryWindow, _ = swipeHistoryWindow.Update(messages.PublishMessage{Topic: "door_controller/unlock/door_one", Payload: "0001234567|2026-10-19 10:00:05"})
+	if _, msgs := press(swipeHistoryWindow, "enter"); len(msgs) != 1 || msgs[0] != messages.ResendCodeMessage("0001234567") {
+		t.Errorf("got %v, want the favourite still selected", msgs)
+	}
+
+	// A history row stays selected as newer swipes push it down
+	swipeHistoryWindow, _ = press(swipeHistoryWindow, "j", "j")
+	swipeHistoryWindow, _ = swipeHistoryWindow.Update(messages.InvalidCardMessage{Code: "99"})
+	if _, msgs := press(swipeHistoryWindow, "e"); len(msgs) != 1 || msgs[0] != messages.EditCodeMessage("0001234567") {
+		t.Errorf("got %v, want the older swipe still selected", msgs)
+	}
+	if got := len(swipeHistoryWindow.codes()); got != 4 {
+		t.Errorf("got %d rows, want the favourite and three swipes", got)
+	}
+}
+
+func TestSwipeHistoryNotFocused(t *testing.T) {
+	swipeHistoryWindow := newTestSwipeHistory(t)
+	swipeHistoryWindow.Blur()
+	swipeHistoryWindow, _ = swipeHistoryWindow.Update(messages.PublishMessage{Topic: "door_controller/unlock/door_one", Payload: "0001234567|2026-10-19 10:00:00"})
+
+	if _, msgs := press(swipeHistoryWindow, "enter"); len(msgs) != 0 {
+		t.Errorf("got %v, want nothing resent without focus", msgs)
+	}
+	empty := newTestSwipeHistory(t)
+	if _, msgs := press(empty, "enter"); len(msgs) != 0 {
+		t.Errorf("got %v, want nothing resent from an empty history", msgs)
+	}
+}
+
+func TestSwipeHistoryFavouriteSaves(t *testing.T) {
+	swipeHistoryWindow := newTestSwipeHistory(t)
+	swipeHistoryWindow, _ = swipeHistoryWindow.Update(messages.InvalidCardMessage{Code: "12ab"})
+	swipeHistoryWindow, _ = swipeHistoryWindow.Update(messages.PublishMessage{Topic: "door_controller/unlock/door_one", Payload: "0001234567|2026-10-19 10:00:00"})
+	swipeHistoryWindow.selected = 0
+
+	swipeHistoryWindow, msgs := press(swipeHistoryWindow, "f")
+	if len(msgs) != 1 {
+		t.Fatalf("got %v, want the favourites saved", msgs)
+	}
+	if saved := msgs[0].(messages.FavouritesSavedMessage); saved.Err != nil || saved.Path != swipeHistoryWindow.path {
+		t.Errorf("got %+v, want saved to %s", saved, swipeHistoryWindow.path)
+	}
+	if loaded, _ := LoadFavourites(swipeHistoryWindow.path); !loaded.Contains("decimal10", "0001234567") {
+		t.Errorf("got %v, want 0001234567 saved", loaded)
+	}
+
+	// The swipe stays selected below its new favourite, the invalid code
+	// is the row after it
+	if _, msgs := press(swipeHistoryWindow, "j", "f"); len(msgs) != 0 {
+		t.Errorf("got %v, want an invalid code left out of the favourites", msgs)
+	}
+}
+
+func TestStatusWindowResendsCode(t *testing.T) {
+	statusWindow := NewStatusWindow(context.Background(), true, config.Default().Mimic)
+	_, cmd := statusWindow.Update(messages.ResendCodeMessage("0001234567"))
+
+	// The code goes through the text input's path, as if it had been typed
+	for _, msg := range runCmd(cmd) {
+		if msg == messages.DoorCodeTextMessage("0001234567") {
+			return
+		}
+	}
+	t.Error("got no door code, want the resent code swiped")
+}
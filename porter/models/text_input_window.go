@@ -1,28 +1,30 @@
 package models
 
 import (
-	"errors"
-	"regexp"
+	"fmt"
+	"strings"
 
 	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
+
+	"metamakers.org/door-controller-mqtt/cards"
 )
 
 type TextInputWindow struct {
 	TextInput     textinput.Model
 	submitMessage func(value string) tea.Msg
+	encoding      cards.Encoding
 	Window
 }
 
-func NewTextInputWindow(focused bool, submitMessage func(value string) tea.Msg, width int) TextInputWindow {
+func NewTextInputWindow(focused bool, submitMessage func(value string) tea.Msg, width int, encoding cards.Encoding) TextInputWindow {
 	textInput := textinput.New()
-	textInput.Placeholder = "0001234567"
-	textInput.CharLimit = 10
-	textInput.Width = 10
+	textInput.Placeholder = encoding.Placeholder()
+	textInput.CharLimit = encoding.MaxLength()
+	textInput.Width = encoding.MaxLength()
 	textInput.Validate = func(value string) error {
-		matched, _ := regexp.Match(`^[0-9]+$`, []byte(value))
-		if !matched && len(value) > 0 {
-			return errors.New("Numbers only!")
+		if strings.Trim(value, encoding.Characters()) != "" {
+			return fmt.Errorf("Only %s allowed!", encoding.Characters())
 		}
 		return nil
 	}
@@ -30,6 +32,7 @@ func NewTextInputWindow(focused bool, submitMessage func(value string) tea.Msg,
 	textInputWindow := TextInputWindow{
 		TextInput:     textInput,
 		submitMessage: submitMessage,
+		encoding:      encoding,
 		Window: Window{
 			focused: focused,
 			Width:   width,
@@ -44,6 +47,20 @@ func NewTextInputWindow(focused bool, submitMessage func(value string) tea.Msg,
 	return textInputWindow
 }
 
+// AskForPIN switches the input between card codes and a hidden PIN
+func (textInputWindow TextInputWindow) AskForPIN(ask bool) TextInputWindow {
+	if ask {
+		textInputWindow.TextInput.Placeholder = "PIN"
+		textInputWindow.TextInput.EchoMode = textinput.EchoPassword
+		textInputWindow.TextInput.CharLimit = cards.MaxPINLength
+	} else {
+		textInputWindow.TextInput.Placeholder = textInputWindow.encoding.Placeholder()
+		textInputWindow.TextInput.EchoMode = textinput.EchoNormal
+		textInputWindow.TextInput.CharLimit = textInputWindow.encoding.MaxLength()
+	}
+	return textInputWindow
+}
+
 func (textInputWindow TextInputWindow) Focus() TextInputWindow {
 	textInputWindow.Window.Focus()
 	textInputWindow.TextInput.Focus()
@@ -0,0 +1,76 @@
+package models
+
+import (
+	"context"
+	"os"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"golang.org/x/term"
+
+	"metamakers.org/door-controller-mqtt/commands"
+	"metamakers.org/door-controller-mqtt/connection"
+	"metamakers.org/door-controller-mqtt/mqtt"
+)
+
+type WatchModel struct {
+	username    string
+	password    string
+	mqttUris    []string
+	namespace   mqtt.Namespace
+	clientID    string
+	transport   connection.Transport
+	WatchWindow WatchWindow
+}
+
+func InitWatchModel(ctx context.Context, mqttUris []string, namespace mqtt.Namespace, username string, password string, clientID string, transport connection.Transport) WatchModel {
+	// Bubbletea sends the real size once the program starts so
+	// there is no need to give up when it can't be read here
+	physicalWidth, physicalHeight, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		physicalWidth, physicalHeight = 80, 24
+	}
+
+	return WatchModel{
+		mqttUris:    mqttUris,
+		namespace:   namespace,
+		username:    username,
+		password:    password,
+		clientID:    clientID,
+		transport:   transport,
+		WatchWindow: NewWatchWindow(ctx, physicalWidth, physicalHeight),
+	}
+}
+
+func (model WatchModel) Init() tea.Cmd {
+	return commands.Init(
+		model.mqttUris,
+		model.namespace,
+		model.username,
+		model.password,
+		model.clientID,
+		model.transport,
+	)
+}
+
+func (model WatchModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	cmds := make([]tea.Cmd, 0)
+
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		model.WatchWindow = model.WatchWindow.UpdateDimensions(msg.Width, msg.Height)
+	case tea.KeyMsg:
+		if msg.Type == tea.KeyCtrlC {
+			cmds = append(cmds, tea.Quit)
+		}
+	}
+
+	var watchWindowCmd tea.Cmd
+	model.WatchWindow, watchWindowCmd = model.WatchWindow.Update(msg)
+	cmds = append(cmds, watchWindowCmd)
+
+	return model, tea.Batch(cmds...)
+}
+
+func (model WatchModel) View() string {
+	return model.WatchWindow.Render()
+}
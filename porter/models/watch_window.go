@@ -0,0 +1,217 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"metamakers.org/door-controller-mqtt/commands"
+	"metamakers.org/door-controller-mqtt/diary"
+	"metamakers.org/door-controller-mqtt/messages"
+	"metamakers.org/door-controller-mqtt/mqtt"
+)
+
+// WatchWindow puts the door grid, door detail and event log on the same
+// connection handling as the mimic's status window
+type WatchWindow struct {
+	store            *diary.Store
+	namespace        mqtt.Namespace
+	tabIndex         int
+	filtering        bool
+	doorGridWindow   DoorGridWindow
+	doorDetailWindow DoorDetailWindow
+	logWindow        LogWindow
+	FilterInput      textinput.Model
+	MqttConnection
+	Window
+}
+
+func NewWatchWindow(ctx context.Context, width int, height int) WatchWindow {
+	filterInput := textinput.New()
+	filterInput.Prompt = "/"
+	filterInput.Placeholder = "filter events"
+	filterInput.CharLimit = 64
+
+	store := diary.NewStore(50)
+
+	watchWindow := WatchWindow{
+		store:            store,
+		tabIndex:         0,
+		filtering:        false,
+		doorGridWindow:   NewDoorGridWindow(store, true),
+		doorDetailWindow: NewDoorDetailWindow(store),
+		logWindow:        NewLogWindow(false),
+		FilterInput:      filterInput,
+		MqttConnection:   NewMqttConnection(ctx),
+		Window: Window{
+			focused: true,
+			Width:   width,
+			Height:  height,
+			Margin:  Orientation{0, 0, 0, 0},
+			Padding: Orientation{1, 2, 1, 2},
+			Border:  Border{false, false, false, false},
+		},
+	}
+
+	return watchWindow.UpdateDimensions(width, height)
+}
+
+// recordMessage turns a message published under the namespace into a
+// diary event. Topics without a client ID, like the health check sent by
+// diary, are only shown in the event log.
+func (watchWindow WatchWindow) recordMessage(msg messages.MqttMessage) {
+	topic, err := mqtt.ParseTopic(watchWindow.namespace, msg.Topic)
+	if err != nil || topic.ClientID == "" {
+		return
+	}
+
+	watchWindow.store.Seen(string(watchWindow.namespace), topic.ClientID)
+	watchWindow.store.Record(diary.Event{
+		Time:     time.Now(),
+		Site:     string(watchWindow.namespace),
+		ClientID: topic.ClientID,
+		Level:    topic.Level,
+		Topic:    msg.Topic,
+		Payload:  msg.Payload,
+	})
+}
+
+func (watchWindow WatchWindow) Update(msg tea.Msg) (WatchWindow, tea.Cmd) {
+	cmds := make([]tea.Cmd, 0)
+	forwardKeys := true
+
+	var connectionCmd tea.Cmd
+	watchWindow.MqttConnection, connectionCmd = watchWindow.MqttConnection.Update(msg)
+	cmds = append(cmds, connectionCmd)
+
+	switch msg := msg.(type) {
+	case messages.MqttCredentials:
+		watchWindow.namespace = msg.Namespace
+		cmds = append(cmds, commands.TickEvery(time.Second))
+	case messages.MqttStatus:
+		if watchWindow.Connected(msg) {
+			cmds = append(cmds, commands.SubscribeToAll(watchWindow.serverConnection, watchWindow.ctx, watchWindow.namespace))
+		}
+	case messages.MqttMessage:
+		watchWindow.recordMessage(msg)
+	case messages.Tick:
+		for _, transition := range watchWindow.store.CheckTransitions() {
+			switch transition.To.State {
+			case diary.Unhealthy:
+				watchWindow.logWindow.Error("Client %s is now unhealthy", transition.ClientID)
+			case diary.Healthy:
+				watchWindow.logWindow.Info("Client %s is now healthy", transition.ClientID)
+			}
+		}
+		cmds = append(cmds, commands.TickEvery(time.Second))
+	case tea.KeyMsg:
+		if msg.Type == tea.KeyCtrlC {
+			break
+		}
+
+		if watchWindow.filtering {
+			forwardKeys = false
+			if msg.Type == tea.KeyEnter || msg.Type == tea.KeyEsc {
+				watchWindow.filtering = false
+				watchWindow.FilterInput.Blur()
+				break
+			}
+			var filterCmd tea.Cmd
+			watchWindow.FilterInput, filterCmd = watchWindow.FilterInput.Update(msg)
+			watchWindow.logWindow.SetFilter(watchWindow.FilterInput.Value())
+			cmds = append(cmds, filterCmd)
+			break
+		}
+
+		if msg.String() == "/" {
+			forwardKeys = false
+			watchWindow.filtering = true
+			cmds = append(cmds, watchWindow.FilterInput.Focus())
+		} else if msg.Type == tea.KeyTab {
+			watchWindow.tabIndex = (watchWindow.tabIndex + 1) % 2
+			if watchWindow.tabIndex == 0 {
+				watchWindow.doorGridWindow.Focus()
+				watchWindow.logWindow.Blur()
+			} else {
+				watchWindow.doorGridWindow.Blur()
+				watchWindow.logWindow.Focus()
+			}
+		}
+	}
+
+	if _, isKey := msg.(tea.KeyMsg); isKey && !forwardKeys {
+		// The log still needs to be re-rendered so filter changes
+		// show up straight away
+		msg = nil
+	}
+
+	var doorGridCmd tea.Cmd
+	watchWindow.doorGridWindow, doorGridCmd = watchWindow.doorGridWindow.Update(msg)
+	var logWindowCmd tea.Cmd
+	watchWindow.logWindow, logWindowCmd = watchWindow.logWindow.Update(msg)
+	cmds = append(cmds, doorGridCmd, logWindowCmd)
+
+	return watchWindow, tea.Batch(cmds...)
+}
+
+func (watchWindow WatchWindow) UpdateDimensions(width int, height int) WatchWindow {
+	watchWindow.SetWidth(width)
+	watchWindow.SetHeight(height)
+
+	// Leave room for the status and filter lines
+	innerHeight := watchWindow.GetInnerHeight() - 4
+	innerWidth := watchWindow.GetInnerWidth()
+	topHeight := innerHeight / 2
+	gridWidth := innerWidth * 3 / 5
+
+	watchWindow.doorGridWindow = watchWindow.doorGridWindow.UpdateDimensions(gridWidth, topHeight)
+	watchWindow.doorDetailWindow = watchWindow.doorDetailWindow.UpdateDimensions(innerWidth-gridWidth, topHeight)
+	watchWindow.logWindow = watchWindow.logWindow.UpdateDimensions(innerWidth, innerHeight-topHeight)
+	watchWindow.FilterInput.Width = innerWidth - 4
+
+	return watchWindow
+}
+
+func (watchWindow WatchWindow) renderStatus() string {
+	return watchWindow.Status(fmt.Sprintf(
+		"Watching %s on %s - tab switches panes, / filters events",
+		watchWindow.namespace.Wildcard(),
+		watchWindow.Broker,
+	))
+}
+
+func (watchWindow WatchWindow) Render() string {
+	if watchWindow.Height < 20 || watchWindow.Width < 80 {
+		return lipgloss.NewStyle().
+			Foreground(highlight).
+			Render(
+				"Terminal window needs to be larger than 80x20 to show information",
+			)
+	}
+
+	docStyle := lipgloss.NewStyle().
+		PaddingTop(watchWindow.Padding.Top).
+		PaddingLeft(watchWindow.Padding.Left).
+		PaddingBottom(watchWindow.Padding.Bottom).
+		PaddingRight(watchWindow.Padding.Right)
+
+	doc := strings.Builder{}
+
+	doc.WriteString(text.Render(watchWindow.renderStatus()))
+	doc.WriteString("\n")
+	doc.WriteString(lipgloss.JoinHorizontal(
+		lipgloss.Top,
+		watchWindow.doorGridWindow.Render(),
+		watchWindow.doorDetailWindow.Render(watchWindow.doorGridWindow.Selected()),
+	))
+	doc.WriteString("\n")
+	doc.WriteString(watchWindow.logWindow.Render())
+	doc.WriteString("\n")
+	doc.WriteString(watchWindow.FilterInput.View())
+
+	return docStyle.Render(doc.String())
+}
@@ -1,7 +1,17 @@
 package mqtt
 
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
 const RootLevel string = "door_controller"
 
+// TimestampFormat is how door controllers timestamp card events, always
+// in UTC
+const TimestampFormat = "2006-01-02 15:04:05"
+
 const (
 	AccessListLevel   = "access_list"
 	CheckInLevel      = "check_in"
@@ -9,17 +19,150 @@ const (
 	UnlockLevel       = "unlock"
 	LockLevel         = "lock"
 	DeniedAccessLevel = "denied_access"
+	DoorOpenLevel     = "door_open"
+	DoorClosedLevel   = "door_closed"
+	HeldOpenLevel     = "held_open"
+	ForcedOpenLevel   = "forced_open"
+	PinFailedLevel    = "pin_failed"
+	PinLockoutLevel   = "pin_lockout"
 	LogInfoLevel      = "log_info"
 	LogWarnLevel      = "log_warn"
 	LogFatalLevel     = "log_fatal"
+	RequestLevel      = "request"
+	ResponseLevel     = "response"
 )
 
-const AccessListTopic = RootLevel + "/" + AccessListLevel
-const CheckInTopic = RootLevel + "/" + CheckInLevel
-const HealthCheckTopic = RootLevel + "/" + HealthCheckLevel
-const UnlockTopic = RootLevel + "/" + UnlockLevel
-const LockTopic = RootLevel + "/" + LockLevel
-const DeniedAccessTopic = RootLevel + "/" + DeniedAccessLevel
-const LogInfoTopic = RootLevel + "/" + LogInfoLevel
-const LogWarnTopic = RootLevel + "/" + LogWarnLevel
-const LogFatalTopic = RootLevel + "/" + LogFatalLevel
+// DoorLevels are the levels each door publishes under its own client ID
+var DoorLevels = []string{
+	LogInfoLevel,
+	LogWarnLevel,
+	LogFatalLevel,
+	LockLevel,
+	UnlockLevel,
+	DeniedAccessLevel,
+	DoorOpenLevel,
+	DoorClosedLevel,
+	HeldOpenLevel,
+	ForcedOpenLevel,
+	PinFailedLevel,
+	PinLockoutLevel,
+	CheckInLevel,
+}
+
+// Namespace is the prefix every door controller topic is published under.
+// Giving each site its own namespace (e.g. site/m2c/door_controller) lets
+// several sites share a broker.
+type Namespace string
+
+const DefaultNamespace = Namespace(RootLevel)
+
+func (namespace Namespace) Validate() error {
+	switch {
+	case namespace == "":
+		return errors.New("Topic namespace can't be empty")
+	case strings.ContainsAny(string(namespace), "#+"):
+		return errors.New("Topic namespace can't contain wildcards")
+	case strings.HasPrefix(string(namespace), "/") || strings.HasSuffix(string(namespace), "/"):
+		return errors.New("Topic namespace can't start or end with /")
+	}
+	return nil
+}
+
+// Wildcard matches every topic within the namespace
+func (namespace Namespace) Wildcard() string {
+	return string(namespace) + "/#"
+}
+
+// LevelWildcard matches a level published by every door
+func (namespace Namespace) LevelWildcard(level string) string {
+	return Topic{Namespace: namespace, Level: level, ClientID: "+"}.Build()
+}
+
+// Contains reports whether the other namespace is the same as or within
+// this one
+func (namespace Namespace) Contains(other Namespace) bool {
+	return other == namespace || strings.HasPrefix(string(other), string(namespace)+"/")
+}
+
+// ValidateClientID checks a client ID can be used as a single topic level
+func ValidateClientID(clientID string) error {
+	switch {
+	case clientID == "":
+		return errors.New("Client ID can't be empty")
+	case strings.ContainsAny(clientID, "/+#"):
+		return fmt.Errorf("Client ID %q can't contain /, + or #", clientID)
+	}
+	return nil
+}
+
+var ErrNotInNamespace = errors.New("Topic is not within the namespace")
+
+// Topic is the single definition of the door controller topic grammar:
+//
+//	<namespace>/<level>            shared by every door, e.g. access_list
+//	<namespace>/<level>/<clientID> published by or for a single door
+type Topic struct {
+	Namespace Namespace
+	Level     string
+	ClientID  string
+}
+
+func (topic Topic) Build() string {
+	built := string(topic.Namespace) + "/" + topic.Level
+	if topic.ClientID != "" {
+		built += "/" + topic.ClientID
+	}
+	return built
+}
+
+func (topic Topic) Validate() error {
+	if err := topic.Namespace.Validate(); err != nil {
+		return err
+	}
+	if topic.Level == "" || strings.ContainsAny(topic.Level, "/+#") {
+		return fmt.Errorf("Topic level %q must be a single level without wildcards", topic.Level)
+	}
+	if topic.ClientID != "" {
+		return ValidateClientID(topic.ClientID)
+	}
+	return nil
+}
+
+// ParseTopic splits a topic published within the namespace into its level
+// and client ID
+func ParseTopic(namespace Namespace, raw string) (Topic, error) {
+	rest, found := strings.CutPrefix(raw, string(namespace)+"/")
+	if !found {
+		return Topic{}, fmt.Errorf("%w %s: %s", ErrNotInNamespace, namespace, raw)
+	}
+
+	level, clientID, _ := strings.Cut(rest, "/")
+	topic := Topic{Namespace: namespace, Level: level, ClientID: clientID}
+	if err := topic.Validate(); err != nil {
+		return Topic{}, fmt.Errorf("Invalid topic %s: %w", raw, err)
+	}
+	return topic, nil
+}
+
+// MatchFilter reports whether the topic matches a subscription filter
+// that can contain + and # wildcards. As with the broker, a wildcard at the
+// first level doesn't match the broker's own $ topics.
+func MatchFilter(filter string, topic string) bool {
+	filterLevels := strings.Split(filter, "/")
+	topicLevels := strings.Split(topic, "/")
+	if strings.HasPrefix(topic, "$") && (filterLevels[0] == "+" || filterLevels[0] == "#") {
+		return false
+	}
+	for idx, filterLevel := range filterLevels {
+		if filterLevel == "#" {
+			return idx == len(filterLevels)-1
+		}
+		if idx >= len(topicLevels) {
+			return false
+		}
+		if filterLevel != "+" && filterLevel != topicLevels[idx] {
+			return false
+		}
+	}
+	return len(filterLevels) == len(topicLevels)
+}
@@ -0,0 +1,185 @@
+package mqtt
+
+import (
+	"errors"
+	"testing"
+)
+
+// serverLevels are published by porter rather than by a door
+var serverLevels = []string{AccessListLevel, HealthCheckLevel, RequestLevel, ResponseLevel}
+
+func TestTopicRoundTrip(t *testing.T) {
+	namespaces := []Namespace{DefaultNamespace, "site/m2c/door_controller", "a/b/c/d"}
+	topics := make([]Topic, 0)
+	for _, namespace := range namespaces {
+		for _, level := range DoorLevels {
+			topics = append(topics, Topic{Namespace: namespace, Level: level, ClientID: "door_one"})
+		}
+		for _, level := range serverLevels {
+			topics = append(topics,
+				Topic{Namespace: namespace, Level: level},
+				Topic{Namespace: namespace, Level: level, ClientID: "door-two.front"},
+			)
+		}
+	}
+
+	for _, topic := range topics {
+		built := topic.Build()
+		parsed, err := ParseTopic(topic.Namespace, built)
+		if err != nil {
+			t.Errorf("ParseTopic(%s) failed: %v", built, err)
+			continue
+		}
+		if parsed != topic {
+			t.Errorf("ParseTopic(%s): got %+v, want %+v", built, parsed, topic)
+		}
+	}
+}
+
+func TestTopicBuild(t *testing.T) {
+	tests := []struct {
+		topic Topic
+		want  string
+	}{
+		{topic: Topic{Namespace: DefaultNamespace, Level: AccessListLevel}, want: "door_controller/access_list"},
+		{topic: Topic{Namespace: DefaultNamespace, Level: UnlockLevel, ClientID: "door_one"}, want: "door_controller/unlock/door_one"},
+		{topic: Topic{Namespace: "site/m2c/door_controller", Level: UnlockLevel, ClientID: "door_one"}, want: "site/m2c/door_controller/unlock/door_one"},
+	}
+
+	for _, test := range tests {
+		if got := test.topic.Build(); got != test.want {
+			t.Errorf("Build(%+v): got %s, want %s", test.topic, got, test.want)
+		}
+	}
+}
+
+func TestParseTopicRejects(t *testing.T) {
+	tests := []struct {
+		name      string
+		namespace Namespace
+		raw       string
+	}{
+		{name: "other namespace", namespace: DefaultNamespace, raw: "other/unlock/door_one"},
+		{name: "namespace prefix without a separator", namespace: DefaultNamespace, raw: "door_controllers/unlock/door_one"},
+		{name: "parent of a nested namespace", namespace: "site/m2c/door_controller", raw: "site/m2c/unlock/door_one"},
+		{name: "namespace alone", namespace: DefaultNamespace, raw: "door_controller"},
+		{name: "empty level", namespace: DefaultNamespace, raw: "door_controller//door_one"},
+		{name: "extra level in the client ID", namespace: DefaultNamespace, raw: "door_controller/unlock/door_one/extra"},
+		{name: "+ in the client ID", namespace: DefaultNamespace, raw: "door_controller/unlock/+"},
+		{name: "# in the client ID", namespace: DefaultNamespace, raw: "door_controller/unlock/door#one"},
+		{name: "wildcard level", namespace: DefaultNamespace, raw: "door_controller/+/door_one"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if topic, err := ParseTopic(test.namespace, test.raw); err == nil {
+				t.Errorf("ParseTopic(%s) = %+v, want an error", test.raw, topic)
+			}
+		})
+	}
+
+	if _, err := ParseTopic(DefaultNamespace, "other/unlock/door_one"); !errors.Is(err, ErrNotInNamespace) {
+		t.Errorf("got %v, want ErrNotInNamespace", err)
+	}
+}
+
+func TestValidateClientID(t *testing.T) {
+	tests := []struct {
+		clientID string
+		valid    bool
+	}{
+		{clientID: "door_one", valid: true},
+		{clientID: "door-two.front", valid: true},
+		{clientID: "", valid: false},
+		{clientID: "door/one", valid: false},
+		{clientID: "door+one", valid: false},
+		{clientID: "+", valid: false},
+		{clientID: "door#", valid: false},
+		{clientID: "#", valid: false},
+	}
+
+	for _, test := range tests {
+		err := ValidateClientID(test.clientID)
+		if (err == nil) != test.valid {
+			t.Errorf("ValidateClientID(%q): got %v, want valid %t", test.clientID, err, test.valid)
+		}
+		topic := Topic{Namespace: DefaultNamespace, Level: UnlockLevel, ClientID: test.clientID}
+		// An empty client ID is a topic shared by every door
+		if err := topic.Validate(); (err == nil) != (test.valid || test.clientID == "") {
+			t.Errorf("Topic with client ID %q: got %v", test.clientID, err)
+		}
+	}
+}
+
+func TestNamespaceValidate(t *testing.T) {
+	tests := []struct {
+		namespace Namespace
+		valid     bool
+	}{
+		{namespace: DefaultNamespace, valid: true},
+		{namespace: "site/m2c/door_controller", valid: true},
+		{namespace: "", valid: false},
+		{namespace: "site/+/door_controller", valid: false},
+		{namespace: "site/#", valid: false},
+		{namespace: "/door_controller", valid: false},
+		{namespace: "door_controller/", valid: false},
+	}
+
+	for _, test := range tests {
+		if err := test.namespace.Validate(); (err == nil) != test.valid {
+			t.Errorf("Validate(%q): got %v, want valid %t", test.namespace, err, test.valid)
+		}
+	}
+}
+
+func TestNamespaceContains(t *testing.T) {
+	tests := []struct {
+		namespace Namespace
+		other     Namespace
+		want      bool
+	}{
+		{namespace: "site", other: "site", want: true},
+		{namespace: "site", other: "site/m2c/door_controller", want: true},
+		{namespace: "site", other: "sites/m2c", want: false},
+		{namespace: "site/m2c", other: "site", want: false},
+	}
+
+	for _, test := range tests {
+		if got := test.namespace.Contains(test.other); got != test.want {
+			t.Errorf("%s contains %s: got %t, want %t", test.namespace, test.other, got, test.want)
+		}
+	}
+}
+
+func TestMatchFilter(t *testing.T) {
+	tests := []struct {
+		filter string
+		topic  string
+		want   bool
+	}{
+		{filter: "door_controller/unlock/door_one", topic: "door_controller/unlock/door_one", want: true},
+		{filter: "door_controller/unlock/door_one", topic: "door_controller/unlock/door_two", want: false},
+		{filter: "door_controller/unlock/+", topic: "door_controller/unlock/door_one", want: true},
+		{filter: "door_controller/unlock/+", topic: "door_controller/unlock", want: false},
+		{filter: "door_controller/unlock/+", topic: "door_controller/unlock/door_one/extra", want: false},
+		{filter: "door_controller/unlock/+", topic: "door_controller/unlock/", want: true},
+		{filter: "door_controller/+/door_one", topic: "door_controller/lock/door_one", want: true},
+		{filter: "+/+", topic: "/door_controller", want: true},
+		{filter: "door_controller/#", topic: "door_controller/unlock/door_one", want: true},
+		{filter: "door_controller/#", topic: "door_controller", want: true},
+		{filter: "door_controller/#", topic: "door_controllers/unlock", want: false},
+		{filter: "#", topic: "door_controller/unlock/door_one", want: true},
+		{filter: "door_controller/#/door_one", topic: "door_controller/unlock/door_one", want: false},
+		{filter: "door_controller/unlock", topic: "door_controller/unlock/door_one", want: false},
+		{filter: "door_controller/unlock/door_one", topic: "door_controller/unlock", want: false},
+		{filter: "#", topic: "$SYS/broker/uptime", want: false},
+		{filter: "+/broker/uptime", topic: "$SYS/broker/uptime", want: false},
+		{filter: "$SYS/#", topic: "$SYS/broker/uptime", want: true},
+	}
+
+	for _, test := range tests {
+		if got := MatchFilter(test.filter, test.topic); got != test.want {
+			t.Errorf("MatchFilter(%s, %s): got %t, want %t", test.filter, test.topic, got, test.want)
+		}
+	}
+}
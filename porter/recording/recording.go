@@ -0,0 +1,164 @@
+package recording
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/eclipse/paho.golang/paho"
+)
+
+// Base64 is the encoding of payloads that aren't valid UTF-8, the rest
+// are written as they are so a recording can be read and edited by hand
+const Base64 = "base64"
+
+// Message is a single line of a recording
+type Message struct {
+	Time       time.Time   `json:"time"`
+	Topic      string      `json:"topic"`
+	Payload    string      `json:"payload"`
+	Encoding   string      `json:"encoding,omitempty"`
+	QoS        byte        `json:"qos"`
+	Retain     bool        `json:"retain,omitempty"`
+	Properties *Properties `json:"properties,omitempty"`
+}
+
+// Properties are the MQTT v5 properties a publisher sets. Topic aliases
+// and subscription identifiers only mean something on the connection the
+// message was received on, so they aren't recorded.
+type Properties struct {
+	ContentType     string              `json:"content_type,omitempty"`
+	ResponseTopic   string              `json:"response_topic,omitempty"`
+	CorrelationData []byte              `json:"correlation_data,omitempty"`
+	PayloadFormat   *byte               `json:"payload_format,omitempty"`
+	MessageExpiry   *uint32             `json:"message_expiry,omitempty"`
+	User            []paho.UserProperty `json:"user,omitempty"`
+}
+
+func FromPublish(publish *paho.Publish, received time.Time) Message {
+	message := Message{
+		Time:   received,
+		Topic:  publish.Topic,
+		QoS:    publish.QoS,
+		Retain: publish.Retain,
+	}
+	if utf8.Valid(publish.Payload) {
+		message.Payload = string(publish.Payload)
+	} else {
+		message.Payload = base64.StdEncoding.EncodeToString(publish.Payload)
+		message.Encoding = Base64
+	}
+
+	if properties := publish.Properties; properties != nil {
+		recorded := Properties{
+			ContentType:     properties.ContentType,
+			ResponseTopic:   properties.ResponseTopic,
+			CorrelationData: properties.CorrelationData,
+			PayloadFormat:   properties.PayloadFormat,
+			MessageExpiry:   properties.MessageExpiry,
+			User:            properties.User,
+		}
+		if recorded.ContentType != "" || recorded.ResponseTopic != "" || recorded.CorrelationData != nil ||
+			recorded.PayloadFormat != nil || recorded.MessageExpiry != nil || len(recorded.User) > 0 {
+			message.Properties = &recorded
+		}
+	}
+	return message
+}
+
+// Publish builds the publish that republishes the message to topic
+func (message Message) Publish(topic string) (*paho.Publish, error) {
+	payload := []byte(message.Payload)
+	if message.Encoding == Base64 {
+		decoded, err := base64.StdEncoding.DecodeString(message.Payload)
+		if err != nil {
+			return nil, fmt.Errorf("Payload isn't valid base64: %w", err)
+		}
+		payload = decoded
+	}
+
+	publish := &paho.Publish{
+		QoS:     message.QoS,
+		Retain:  message.Retain,
+		Topic:   topic,
+		Payload: payload,
+	}
+	if properties := message.Properties; properties != nil {
+		publish.Properties = &paho.PublishProperties{
+			ContentType:     properties.ContentType,
+			ResponseTopic:   properties.ResponseTopic,
+			CorrelationData: properties.CorrelationData,
+			PayloadFormat:   properties.PayloadFormat,
+			MessageExpiry:   properties.MessageExpiry,
+			User:            properties.User,
+		}
+	}
+	return publish, nil
+}
+
+// Writer writes a recording as JSON lines, it's safe to use from the
+// router's handlers
+type Writer struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+	count   int
+}
+
+func NewWriter(writer io.Writer) *Writer {
+	return &Writer{encoder: json.NewEncoder(writer)}
+}
+
+func (writer *Writer) Write(message Message) error {
+	writer.mu.Lock()
+	defer writer.mu.Unlock()
+
+	if err := writer.encoder.Encode(message); err != nil {
+		return err
+	}
+	writer.count += 1
+	return nil
+}
+
+// Count is the number of messages written so far
+func (writer *Writer) Count() int {
+	writer.mu.Lock()
+	defer writer.mu.Unlock()
+	return writer.count
+}
+
+// Read loads every message of a recording, in the order they were
+// recorded. Blank lines are skipped.
+func Read(reader io.Reader) ([]Message, error) {
+	messages := make([]Message, 0)
+	scanner := bufio.NewScanner(reader)
+	// Payloads can be much longer than the scanner's default line limit
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	line := 0
+	for scanner.Scan() {
+		line += 1
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		message := Message{}
+		if err := json.Unmarshal(scanner.Bytes(), &message); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if message.Topic == "" {
+			return nil, fmt.Errorf("line %d: Message has no topic", line)
+		}
+		if message.QoS > 2 {
+			return nil, fmt.Errorf("line %d: QoS must be 0, 1 or 2, got %d", line, message.QoS)
+		}
+		messages = append(messages, message)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
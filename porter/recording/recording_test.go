@@ -0,0 +1,143 @@
+package recording
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eclipse/paho.golang/paho"
+)
+
+func TestRoundTrip(t *testing.T) {
+	payloadFormat := byte(1)
+	messageExpiry := uint32(60)
+	received := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		publish  *paho.Publish
+		encoding string
+	}{
+		{name: "text", publish: &paho.Publish{Topic: "door_controller/unlock/door_one", QoS: 1, Payload: []byte("0001234567|2026-10-19 10:00:00")}},
+		{name: "retained", publish: &paho.Publish{Topic: "door_controller/access_list", QoS: 2, Retain: true, Payload: []byte("0001234567\n0007654321")}},
+		{name: "empty", publish: &paho.Publish{Topic: "door_controller/health_check", Payload: []byte{}}},
+		{name: "binary", publish: &paho.Publish{Topic: "door_controller/log_info/door_one", QoS: 1, Payload: []byte{0x00, 0xff, 0xfe, 'h', 'i'}}, encoding: Base64},
+		{
+			name: "properties",
+			publish: &paho.Publish{
+				Topic:   "door_controller/request/door_one",
+				QoS:     1,
+				Payload: []byte(`{"method":"door_state"}`),
+				Properties: &paho.PublishProperties{
+					ContentType:     "application/json",
+					ResponseTopic:   "door_controller/response",
+					CorrelationData: []byte{0x01, 0x02},
+					PayloadFormat:   &payloadFormat,
+					MessageExpiry:   &messageExpiry,
+					User:            []paho.UserProperty{{Key: "site", Value: "hq"}},
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			message := FromPublish(test.publish, received)
+			if message.Encoding != test.encoding {
+				t.Errorf("encoding: got %q, want %q", message.Encoding, test.encoding)
+			}
+
+			var buffer bytes.Buffer
+			writer := NewWriter(&buffer)
+			if err := writer.Write(message); err != nil {
+				t.Fatalf("Failed to write: %v", err)
+			}
+			if writer.Count() != 1 {
+				t.Errorf("count: got %d, want 1", writer.Count())
+			}
+			if lines := strings.Count(buffer.String(), "\n"); lines != 1 {
+				t.Errorf("got %d lines, want 1", lines)
+			}
+
+			read, err := Read(&buffer)
+			if err != nil {
+				t.Fatalf("Failed to read: %v", err)
+			}
+			if len(read) != 1 {
+				t.Fatalf("got %d messages, want 1", len(read))
+			}
+			if !read[0].Time.Equal(received) {
+				t.Errorf("time: got %s, want %s", read[0].Time, received)
+			}
+
+			publish, err := read[0].Publish(test.publish.Topic)
+			if err != nil {
+				t.Fatalf("Failed to build publish: %v", err)
+			}
+			if !bytes.Equal(publish.Payload, test.publish.Payload) {
+				t.Errorf("payload: got %v, want %v", publish.Payload, test.publish.Payload)
+			}
+			if publish.Topic != test.publish.Topic || publish.QoS != test.publish.QoS || publish.Retain != test.publish.Retain {
+				t.Errorf("got %s QoS %d retain %v, want %s QoS %d retain %v", publish.Topic, publish.QoS, publish.Retain, test.publish.Topic, test.publish.QoS, test.publish.Retain)
+			}
+			if !reflect.DeepEqual(publish.Properties, test.publish.Properties) {
+				t.Errorf("properties: got %+v, want %+v", publish.Properties, test.publish.Properties)
+			}
+		})
+	}
+}
+
+func TestBase64Payload(t *testing.T) {
+	message := FromPublish(&paho.Publish{Topic: "door_controller/log_info/door_one", Payload: []byte{0xff, 0xfe}}, time.Now())
+	if message.Payload != "//4=" {
+		t.Errorf("got %s, want //4=", message.Payload)
+	}
+
+	message.Payload = "not base64!"
+	if _, err := message.Publish(message.Topic); err == nil || !strings.Contains(err.Error(), "isn't valid base64") {
+		t.Errorf("got %v, want a base64 error", err)
+	}
+}
+
+func TestEmptyPropertiesAreLeftOut(t *testing.T) {
+	message := FromPublish(&paho.Publish{Topic: "door_controller/health_check", Properties: &paho.PublishProperties{TopicAlias: new(uint16)}}, time.Now())
+	if message.Properties != nil {
+		t.Errorf("got %+v, want no properties", message.Properties)
+	}
+}
+
+func TestRead(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines string
+		count int
+		err   string
+	}{
+		{name: "blank lines", lines: "\n{\"topic\":\"a\"}\n\n{\"topic\":\"b\",\"qos\":2}\n", count: 2},
+		{name: "empty", lines: "", count: 0},
+		{name: "bad json", lines: "{\"topic\":\"a\"}\n{\"topic\":\n", err: "line 2"},
+		{name: "no topic", lines: "{\"payload\":\"a\"}\n", err: "line 1: Message has no topic"},
+		{name: "bad qos", lines: "{\"topic\":\"a\"}\n\n{\"topic\":\"a\",\"qos\":3}\n", err: "line 3: QoS must be 0, 1 or 2, got 3"},
+		{name: "long payload", lines: "{\"topic\":\"a\",\"payload\":\"" + strings.Repeat("x", 128*1024) + "\"}\n", count: 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			messages, err := Read(strings.NewReader(test.lines))
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("got %v, want an error containing %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("got %v, want no error", err)
+			}
+			if len(messages) != test.count {
+				t.Errorf("got %d messages, want %d", len(messages), test.count)
+			}
+		})
+	}
+}
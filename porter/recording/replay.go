@@ -0,0 +1,128 @@
+package recording
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/eclipse/paho.golang/paho"
+
+	"metamakers.org/door-controller-mqtt/mqtt"
+)
+
+type Publisher interface {
+	Publish(ctx context.Context, publish *paho.Publish) (*paho.PublishResponse, error)
+}
+
+// Replacement swaps From for To, From is a prefix for topics and the
+// whole client ID for client IDs
+type Replacement struct {
+	From string
+	To   string
+}
+
+// ParseReplacements reads replacements written as from=to
+func ParseReplacements(raw []string) ([]Replacement, error) {
+	replacements := make([]Replacement, 0, len(raw))
+	for _, pair := range raw {
+		from, to, found := strings.Cut(pair, "=")
+		if !found || from == "" {
+			return nil, fmt.Errorf("Rewrite %q must be written as from=to", pair)
+		}
+		replacements = append(replacements, Replacement{From: from, To: to})
+	}
+	return replacements, nil
+}
+
+// Rewrite changes where messages are republished. The client ID of topics
+// within the namespace is swapped first, then the first topic replacement
+// matching the start of the topic is applied.
+type Rewrite struct {
+	Namespace mqtt.Namespace
+	ClientIDs []Replacement
+	Topics    []Replacement
+}
+
+func (rewrite Rewrite) Topic(raw string) string {
+	if topic, err := mqtt.ParseTopic(rewrite.Namespace, raw); err == nil && topic.ClientID != "" {
+		for _, replacement := range rewrite.ClientIDs {
+			if topic.ClientID == replacement.From {
+				topic.ClientID = replacement.To
+				raw = topic.Build()
+				break
+			}
+		}
+	}
+
+	for _, replacement := range rewrite.Topics {
+		if rest, found := strings.CutPrefix(raw, replacement.From); found {
+			return replacement.To + rest
+		}
+	}
+	return raw
+}
+
+// Replayer republishes a recording. Speed scales the time between
+// messages, 2 replays twice as fast and 0 doesn't wait at all.
+type Replayer struct {
+	Publisher Publisher
+	Speed     float64
+	Rewrite   Rewrite
+	// Published is called after each message, with the topic it was
+	// republished to
+	Published func(message Message, topic string, err error)
+}
+
+// Replay stops early when the context is done, a message that fails to
+// publish is reported and skipped. It returns how many messages were
+// published.
+func (replayer Replayer) Replay(ctx context.Context, messages []Message) (int, error) {
+	published := 0
+	for index, message := range messages {
+		if index > 0 {
+			if err := wait(ctx, replayer.gap(messages[index-1], message)); err != nil {
+				return published, err
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return published, err
+		}
+
+		topic := replayer.Rewrite.Topic(message.Topic)
+		publish, err := message.Publish(topic)
+		if err == nil {
+			_, err = replayer.Publisher.Publish(ctx, publish)
+		}
+		if err == nil {
+			published += 1
+		}
+		if replayer.Published != nil {
+			replayer.Published(message, topic, err)
+		}
+	}
+	return published, nil
+}
+
+// gap is how long to wait between republishing two messages. Messages
+// recorded out of order are republished straight away.
+func (replayer Replayer) gap(previous Message, next Message) time.Duration {
+	if replayer.Speed <= 0 {
+		return 0
+	}
+	return time.Duration(float64(next.Time.Sub(previous.Time)) / replayer.Speed)
+}
+
+func wait(ctx context.Context, duration time.Duration) error {
+	if duration <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
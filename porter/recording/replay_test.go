@@ -0,0 +1,217 @@
+package recording
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eclipse/paho.golang/paho"
+
+	"metamakers.org/door-controller-mqtt/mqtt"
+)
+
+func TestParseReplacements(t *testing.T) {
+	tests := []struct {
+		raw  []string
+		want []Replacement
+		err  bool
+	}{
+		{raw: nil, want: []Replacement{}},
+		{raw: []string{"door_one=door_two"}, want: []Replacement{{From: "door_one", To: "door_two"}}},
+		{raw: []string{"site_a/=site_b/", "a=b=c"}, want: []Replacement{{From: "site_a/", To: "site_b/"}, {From: "a", To: "b=c"}}},
+		{raw: []string{"door_one="}, want: []Replacement{{From: "door_one", To: ""}}},
+		{raw: []string{"door_one"}, err: true},
+		{raw: []string{"=door_two"}, err: true},
+	}
+
+	for _, test := range tests {
+		got, err := ParseReplacements(test.raw)
+		if (err != nil) != test.err {
+			t.Errorf("%v: got %v, want error %v", test.raw, err, test.err)
+			continue
+		}
+		if !test.err && !slices.Equal(got, test.want) {
+			t.Errorf("%v: got %v, want %v", test.raw, got, test.want)
+		}
+	}
+}
+
+func TestRewriteTopic(t *testing.T) {
+	rewrite := Rewrite{
+		Namespace: mqtt.DefaultNamespace,
+		ClientIDs: []Replacement{{From: "door_one", To: "door_two"}},
+		Topics: []Replacement{
+			{From: "door_controller/", To: "staging/door_controller/"},
+			{From: "door_controller/unlock/", To: "never_used/"},
+		},
+	}
+	tests := []struct {
+		topic string
+		want  string
+	}{
+		{topic: "door_controller/unlock/door_one", want: "staging/door_controller/unlock/door_two"},
+		{topic: "door_controller/unlock/door_three", want: "staging/door_controller/unlock/door_three"},
+		{topic: "door_controller/access_list", want: "staging/door_controller/access_list"},
+		// Only whole client IDs are swapped
+		{topic: "door_controller/unlock/door_one_b", want: "staging/door_controller/unlock/door_one_b"},
+		{topic: "other/unlock/door_one", want: "other/unlock/door_one"},
+	}
+
+	for _, test := range tests {
+		if got := rewrite.Topic(test.topic); got != test.want {
+			t.Errorf("%s: got %s, want %s", test.topic, got, test.want)
+		}
+	}
+}
+
+func TestRewriteBetweenNamespaces(t *testing.T) {
+	rewrite := Rewrite{
+		Namespace: mqtt.Namespace("site_a/door_controller"),
+		ClientIDs: []Replacement{{From: "front", To: "back"}},
+		Topics:    []Replacement{{From: "site_a/", To: "site_b/"}},
+	}
+	tests := []struct {
+		topic string
+		want  string
+	}{
+		{topic: "site_a/door_controller/unlock/front", want: "site_b/door_controller/unlock/back"},
+		{topic: "site_a/door_controller/health_check", want: "site_b/door_controller/health_check"},
+		// Client IDs are only swapped inside the recorded namespace
+		{topic: "door_controller/unlock/front", want: "door_controller/unlock/front"},
+	}
+
+	for _, test := range tests {
+		if got := rewrite.Topic(test.topic); got != test.want {
+			t.Errorf("%s: got %s, want %s", test.topic, got, test.want)
+		}
+	}
+}
+
+func TestGap(t *testing.T) {
+	start := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		speed float64
+		after time.Duration
+		want  time.Duration
+	}{
+		{name: "real time", speed: 1, after: 3 * time.Second, want: 3 * time.Second},
+		{name: "twice as fast", speed: 2, after: 3 * time.Second, want: 1500 * time.Millisecond},
+		{name: "half speed", speed: 0.5, after: 3 * time.Second, want: 6 * time.Second},
+		{name: "as fast as possible", speed: 0, after: 3 * time.Second, want: 0},
+		{name: "negative speed", speed: -1, after: 3 * time.Second, want: 0},
+		{name: "same time", speed: 1, after: 0, want: 0},
+		{name: "out of order", speed: 1, after: -time.Second, want: -time.Second},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			replayer := Replayer{Speed: test.speed}
+			got := replayer.gap(Message{Time: start}, Message{Time: start.Add(test.after)})
+			if got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+type timedPublisher struct {
+	mu        sync.Mutex
+	topics    []string
+	times     []time.Time
+	failTopic string
+}
+
+func (publisher *timedPublisher) Publish(ctx context.Context, publish *paho.Publish) (*paho.PublishResponse, error) {
+	publisher.mu.Lock()
+	defer publisher.mu.Unlock()
+	if publish.Topic == publisher.failTopic {
+		return nil, errors.New("Not authorised")
+	}
+	publisher.topics = append(publisher.topics, publish.Topic)
+	publisher.times = append(publisher.times, time.Now())
+	return &paho.PublishResponse{}, nil
+}
+
+func TestReplayPacing(t *testing.T) {
+	start := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	messages := []Message{
+		{Time: start, Topic: "door_controller/unlock/door_one"},
+		{Time: start.Add(200 * time.Millisecond), Topic: "door_controller/door_open/door_one"},
+		{Time: start.Add(100 * time.Millisecond), Topic: "door_controller/door_closed/door_one"},
+		{Time: start.Add(400 * time.Millisecond), Topic: "door_controller/lock/door_one"},
+	}
+
+	publisher := &timedPublisher{}
+	started := time.Now()
+	published, err := Replayer{Publisher: publisher, Speed: 2}.Replay(context.Background(), messages)
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	if published != len(messages) {
+		t.Errorf("got %d published, want %d", published, len(messages))
+	}
+
+	// 100ms, nothing for the message recorded out of order, then 150ms
+	want := []time.Duration{0, 100 * time.Millisecond, 100 * time.Millisecond, 250 * time.Millisecond}
+	for index, publishedAt := range publisher.times {
+		elapsed := publishedAt.Sub(started)
+		if elapsed < want[index] || elapsed > want[index]+80*time.Millisecond {
+			t.Errorf("message %d published after %s, want %s", index+1, elapsed, want[index])
+		}
+	}
+}
+
+func TestReplayReportsFailures(t *testing.T) {
+	messages := []Message{
+		{Topic: "door_controller/unlock/door_one"},
+		{Topic: "door_controller/log_info/door_one", Payload: "not base64!", Encoding: Base64},
+		{Topic: "door_controller/forbidden"},
+		{Topic: "door_controller/lock/door_one"},
+	}
+	publisher := &timedPublisher{failTopic: "staging/door_controller/forbidden"}
+
+	failed := make([]string, 0)
+	published, err := Replayer{
+		Publisher: publisher,
+		Rewrite:   Rewrite{Topics: []Replacement{{From: "door_controller/", To: "staging/door_controller/"}}},
+		Published: func(message Message, topic string, err error) {
+			if err != nil {
+				failed = append(failed, topic)
+			}
+		},
+	}.Replay(context.Background(), messages)
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	if published != 2 {
+		t.Errorf("got %d published, want 2", published)
+	}
+	if want := []string{"staging/door_controller/log_info/door_one", "staging/door_controller/forbidden"}; !slices.Equal(failed, want) {
+		t.Errorf("got failures for %v, want %v", failed, want)
+	}
+	if want := []string{"staging/door_controller/unlock/door_one", "staging/door_controller/lock/door_one"}; !slices.Equal(publisher.topics, want) {
+		t.Errorf("got %v published, want %v", publisher.topics, want)
+	}
+}
+
+func TestReplayStopsWhenCancelled(t *testing.T) {
+	start := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	messages := []Message{
+		{Time: start, Topic: "door_controller/unlock/door_one"},
+		{Time: start.Add(time.Hour), Topic: "door_controller/lock/door_one"},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	published, err := Replayer{Publisher: &timedPublisher{}, Speed: 1}.Replay(ctx, messages)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want the deadline", err)
+	}
+	if published != 1 {
+		t.Errorf("got %d published, want 1", published)
+	}
+}
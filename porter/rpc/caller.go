@@ -0,0 +1,147 @@
+package rpc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/eclipse/paho.golang/autopaho"
+	"github.com/eclipse/paho.golang/paho"
+
+	"metamakers.org/door-controller-mqtt/mqtt"
+)
+
+// Call is a single request. When a client ID is given the call returns as
+// soon as that door replies, otherwise replies from every door are
+// collected until the timeout.
+type Call struct {
+	ClientID string
+	Method   string
+	Params   json.RawMessage
+	Timeout  time.Duration
+}
+
+// Caller sends requests and routes the replies published to the response
+// topics back to the call waiting on them
+type Caller struct {
+	namespace mqtt.Namespace
+	mu        sync.Mutex
+	pending   map[string]chan Response
+}
+
+func NewCaller(namespace mqtt.Namespace) *Caller {
+	return &Caller{
+		namespace: namespace,
+		pending:   make(map[string]chan Response),
+	}
+}
+
+// ResponseFilter matches every door's response topic, it needs to be
+// subscribed to before making any calls
+func (caller *Caller) ResponseFilter() string {
+	return caller.namespace.LevelWildcard(mqtt.ResponseLevel)
+}
+
+// HandleResponse passes a reply on to the call it belongs to. Replies
+// for calls that have already returned are dropped. The door is the one
+// the reply was published by, whatever the payload says.
+func (caller *Caller) HandleResponse(publish *paho.Publish) {
+	if publish.Properties == nil || len(publish.Properties.CorrelationData) == 0 {
+		return
+	}
+	topic, err := mqtt.ParseTopic(caller.namespace, publish.Topic)
+	if err != nil || topic.Level != mqtt.ResponseLevel || topic.ClientID == "" {
+		return
+	}
+
+	var response Response
+	if err := json.Unmarshal(publish.Payload, &response); err != nil {
+		response = Response{Error: fmt.Sprintf("Invalid response: %v", err)}
+	}
+	response.ClientID = topic.ClientID
+
+	caller.mu.Lock()
+	replies, exists := caller.pending[string(publish.Properties.CorrelationData)]
+	caller.mu.Unlock()
+	if !exists {
+		return
+	}
+
+	select {
+	case replies <- response:
+	default:
+	}
+}
+
+func (caller *Caller) Call(ctx context.Context, connectionManager *autopaho.ConnectionManager, call Call) ([]Response, error) {
+	correlationData, err := newCorrelationData()
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := json.Marshal(Request{Method: call.Method, Params: call.Params})
+	if err != nil {
+		return nil, err
+	}
+
+	replies := make(chan Response, 64)
+	caller.mu.Lock()
+	caller.pending[string(correlationData)] = replies
+	caller.mu.Unlock()
+	defer func() {
+		caller.mu.Lock()
+		delete(caller.pending, string(correlationData))
+		caller.mu.Unlock()
+	}()
+
+	if _, err := connectionManager.Publish(ctx, &paho.Publish{
+		QoS:     1,
+		Topic:   RequestTopic(caller.namespace, call.ClientID),
+		Payload: payload,
+		Properties: &paho.PublishProperties{
+			ContentType:     "application/json",
+			ResponseTopic:   ResponseTopic(caller.namespace, ""),
+			CorrelationData: correlationData,
+		},
+	}); err != nil {
+		return nil, err
+	}
+
+	timeout := time.NewTimer(call.Timeout)
+	defer timeout.Stop()
+
+	responses := make([]Response, 0)
+	for {
+		select {
+		case response := <-replies:
+			// Only the door that was called can answer a call to a
+			// single door
+			if call.ClientID != "" && response.ClientID != call.ClientID {
+				continue
+			}
+			responses = append(responses, response)
+			if call.ClientID != "" {
+				return responses, nil
+			}
+		case <-timeout.C:
+			if len(responses) == 0 {
+				return responses, ErrTimeout
+			}
+			return responses, nil
+		case <-ctx.Done():
+			return responses, ctx.Err()
+		}
+	}
+}
+
+func newCorrelationData() ([]byte, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	return []byte(hex.EncodeToString(id)), nil
+}
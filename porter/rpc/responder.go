@@ -0,0 +1,120 @@
+package rpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/eclipse/paho.golang/paho"
+
+	"metamakers.org/door-controller-mqtt/mqtt"
+)
+
+// Handler runs a method and returns a result that can be marshalled to
+// JSON
+type Handler func(params json.RawMessage) (any, error)
+
+// Responder answers the requests sent to a single door
+type Responder struct {
+	namespace mqtt.Namespace
+	clientID  string
+	mu        sync.RWMutex
+	handlers  map[string]Handler
+}
+
+func NewResponder(namespace mqtt.Namespace, clientID string) *Responder {
+	return &Responder{
+		namespace: namespace,
+		clientID:  clientID,
+		handlers:  make(map[string]Handler),
+	}
+}
+
+func (responder *Responder) Handle(method string, handler Handler) {
+	responder.mu.Lock()
+	defer responder.mu.Unlock()
+	responder.handlers[method] = handler
+}
+
+func (responder *Responder) Methods() []string {
+	responder.mu.RLock()
+	defer responder.mu.RUnlock()
+
+	methods := make([]string, 0, len(responder.handlers))
+	for method := range responder.handlers {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// Topics are the request topics the door needs to subscribe to
+func (responder *Responder) Topics() []string {
+	return []string{
+		RequestTopic(responder.namespace, responder.clientID),
+		RequestTopic(responder.namespace, ""),
+	}
+}
+
+// IsRequest reports whether the topic is one of the door's request topics
+func (responder *Responder) IsRequest(topic string) bool {
+	for _, requestTopic := range responder.Topics() {
+		if topic == requestTopic {
+			return true
+		}
+	}
+	return false
+}
+
+// Respond runs the requested method and builds the reply to publish on
+// the door's own response topic. No reply is built for requests without
+// a response topic, as the caller didn't ask for one.
+func (responder *Responder) Respond(publish *paho.Publish) (*paho.Publish, bool) {
+	if publish.Properties == nil || publish.Properties.ResponseTopic == "" {
+		return nil, false
+	}
+
+	response := Response{ClientID: responder.clientID}
+	var request Request
+	if err := json.Unmarshal(publish.Payload, &request); err != nil {
+		response.Error = fmt.Sprintf("Invalid request: %v", err)
+	} else {
+		response.Result, response.Error = responder.call(request)
+	}
+
+	payload, err := json.Marshal(response)
+	if err != nil {
+		payload = []byte(fmt.Sprintf(`{"client_id":%q,"error":%q}`, responder.clientID, err.Error()))
+	}
+
+	return &paho.Publish{
+		QoS:     1,
+		Topic:   ResponseTopic(responder.namespace, responder.clientID),
+		Payload: payload,
+		Properties: &paho.PublishProperties{
+			ContentType:     "application/json",
+			CorrelationData: publish.Properties.CorrelationData,
+		},
+	}, true
+}
+
+func (responder *Responder) call(request Request) (json.RawMessage, string) {
+	responder.mu.RLock()
+	handler, exists := responder.handlers[request.Method]
+	responder.mu.RUnlock()
+	if !exists {
+		return nil, fmt.Sprintf("%v: %s", ErrUnknownMethod, request.Method)
+	}
+
+	result, err := handler(request.Params)
+	if err != nil {
+		return nil, err.Error()
+	}
+
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		return nil, fmt.Sprintf("Unable to encode result: %v", err)
+	}
+	return encoded, ""
+}
@@ -0,0 +1,43 @@
+package rpc
+
+import (
+	"encoding/json"
+	"errors"
+
+	"metamakers.org/door-controller-mqtt/mqtt"
+)
+
+// Requests are published to <namespace>/request/<client ID> for a single
+// door, or <namespace>/request for every door. Each door replies on
+// <namespace>/response/<its client ID>, so the broker's ACL can stop a door
+// replying as another one. The MQTT v5 ResponseTopic property asks for a
+// reply and CorrelationData lets the caller match it to its request.
+type Request struct {
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// Response is published back by every door that handled the request. An
+// unknown method or a failed handler is reported through Error.
+type Response struct {
+	ClientID string          `json:"client_id"`
+	Result   json.RawMessage `json:"result,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+var (
+	ErrTimeout       = errors.New("Timed out waiting for a response")
+	ErrUnknownMethod = errors.New("Unknown method")
+)
+
+// RequestTopic is where requests for the client are published, an empty
+// client ID addresses every door
+func RequestTopic(namespace mqtt.Namespace, clientID string) string {
+	return mqtt.Topic{Namespace: namespace, Level: mqtt.RequestLevel, ClientID: clientID}.Build()
+}
+
+// ResponseTopic is where the door with the client ID replies, an empty
+// client ID is the response level callers ask for replies on
+func ResponseTopic(namespace mqtt.Namespace, clientID string) string {
+	return mqtt.Topic{Namespace: namespace, Level: mqtt.ResponseLevel, ClientID: clientID}.Build()
+}
@@ -0,0 +1,287 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eclipse/paho.golang/autopaho"
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/rs/zerolog"
+
+	"metamakers.org/door-controller-mqtt/connection"
+	"metamakers.org/door-controller-mqtt/mqtt"
+	"metamakers.org/door-controller-mqtt/testbroker"
+)
+
+// connect waits until the client is connected and subscribed
+func connect(t *testing.T, ctx context.Context, uri string, clientID string, topics []string, onPublish func(*paho.Publish)) *autopaho.ConnectionManager {
+	t.Helper()
+
+	subscriptions := make([]paho.SubscribeOptions, 0, len(topics))
+	for _, topic := range topics {
+		subscriptions = append(subscriptions, paho.SubscribeOptions{Topic: topic, QoS: 1})
+	}
+	connected := make(chan struct{}, 1)
+	logger := zerolog.Nop()
+	clientConfig, err := connection.Options{
+		URIs:          []string{uri},
+		ClientID:      clientID,
+		CleanStart:    true,
+		Subscriptions: subscriptions,
+		OnConnectionUp: func(connectionManager *autopaho.ConnectionManager, connectionAck *paho.Connack, broker *url.URL) {
+			connected <- struct{}{}
+		},
+		OnPublishReceived: onPublish,
+		Logger:            &logger,
+	}.ClientConfig(ctx)
+	if err != nil {
+		t.Fatalf("Failed to build client config: %v", err)
+	}
+
+	connectionManager, err := autopaho.NewConnection(ctx, clientConfig)
+	if err != nil {
+		t.Fatalf("Failed to connect %s: %v", clientID, err)
+	}
+	select {
+	case <-connected:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("%s didn't connect", clientID)
+	}
+	return connectionManager
+}
+
+// startDoor answers requests the way mimic does, publishing whatever the
+// responder builds
+func startDoor(t *testing.T, ctx context.Context, uri string, responder *Responder) {
+	t.Helper()
+
+	requests := make(chan *paho.Publish, 10)
+	connectionManager := connect(t, ctx, uri, responder.clientID, responder.Topics(), func(publish *paho.Publish) {
+		requests <- publish
+	})
+	go func() {
+		for {
+			select {
+			case request := <-requests:
+				if reply, ok := responder.Respond(request); ok {
+					connectionManager.Publish(ctx, reply)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+func newDoor(clientID string, delay time.Duration) *Responder {
+	responder := NewResponder(mqtt.DefaultNamespace, clientID)
+	responder.Handle("door_state", func(params json.RawMessage) (any, error) {
+		time.Sleep(delay)
+		return map[string]string{"state": "locked"}, nil
+	})
+	responder.Handle("fail", func(params json.RawMessage) (any, error) {
+		return nil, errors.New("Reader offline")
+	})
+	return responder
+}
+
+func startCaller(t *testing.T, ctx context.Context, uri string) (*Caller, *autopaho.ConnectionManager) {
+	t.Helper()
+
+	caller := NewCaller(mqtt.DefaultNamespace)
+	connectionManager := connect(t, ctx, uri, "porter_rpc_test", []string{caller.ResponseFilter()}, caller.HandleResponse)
+	return caller, connectionManager
+}
+
+func clientIDs(responses []Response) []string {
+	ids := make([]string, 0, len(responses))
+	for _, response := range responses {
+		ids = append(ids, response.ClientID)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func TestCallSingleDoor(t *testing.T) {
+	broker := testbroker.Start(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	startDoor(t, ctx, broker.URI, newDoor("door_one", 0))
+	startDoor(t, ctx, broker.URI, newDoor("door_two", 0))
+	caller, connectionManager := startCaller(t, ctx, broker.URI)
+
+	tests := []struct {
+		name     string
+		call     Call
+		clientID string
+		result   string
+		err      string
+	}{
+		{name: "result", call: Call{ClientID: "door_one", Method: "door_state"}, clientID: "door_one", result: `{"state":"locked"}`},
+		{name: "other door", call: Call{ClientID: "door_two", Method: "door_state"}, clientID: "door_two", result: `{"state":"locked"}`},
+		{name: "handler error", call: Call{ClientID: "door_one", Method: "fail"}, clientID: "door_one", err: "Reader offline"},
+		{name: "unknown method", call: Call{ClientID: "door_one", Method: "open_sesame"}, clientID: "door_one", err: ErrUnknownMethod.Error()},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.call.Timeout = 5 * time.Second
+			started := time.Now()
+			responses, err := caller.Call(ctx, connectionManager, test.call)
+			if err != nil {
+				t.Fatalf("Call failed: %v", err)
+			}
+			// A call to a single door doesn't wait for the timeout
+			if elapsed := time.Since(started); elapsed > 2*time.Second {
+				t.Errorf("Call took %s", elapsed)
+			}
+			if len(responses) != 1 {
+				t.Fatalf("got %d responses, want 1", len(responses))
+			}
+			response := responses[0]
+			if response.ClientID != test.clientID {
+				t.Errorf("client ID: got %s, want %s", response.ClientID, test.clientID)
+			}
+			if string(response.Result) != test.result {
+				t.Errorf("result: got %s, want %s", response.Result, test.result)
+			}
+			if !strings.Contains(response.Error, test.err) || (test.err == "") != (response.Error == "") {
+				t.Errorf("error: got %q, want %q", response.Error, test.err)
+			}
+		})
+	}
+}
+
+func TestCallCollectsEveryDoor(t *testing.T) {
+	broker := testbroker.Start(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for _, clientID := range []string{"door_one", "door_two", "door_three"} {
+		startDoor(t, ctx, broker.URI, newDoor(clientID, 0))
+	}
+	caller, connectionManager := startCaller(t, ctx, broker.URI)
+
+	responses, err := caller.Call(ctx, connectionManager, Call{Method: "door_state", Timeout: 500 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Call failed: %v", err)
+	}
+	if got, want := clientIDs(responses), []string{"door_one", "door_three", "door_two"}; !slices.Equal(got, want) {
+		t.Errorf("got responses from %v, want %v", got, want)
+	}
+}
+
+func TestCallTimeout(t *testing.T) {
+	broker := testbroker.Start(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	startDoor(t, ctx, broker.URI, newDoor("door_one", 0))
+	caller, connectionManager := startCaller(t, ctx, broker.URI)
+
+	responses, err := caller.Call(ctx, connectionManager, Call{ClientID: "door_missing", Method: "door_state", Timeout: 200 * time.Millisecond})
+	if !errors.Is(err, ErrTimeout) {
+		t.Errorf("got %v, want ErrTimeout", err)
+	}
+	if len(responses) != 0 {
+		t.Errorf("got %d responses, want none", len(responses))
+	}
+
+	// A door that answers too slowly is a timeout as well
+	startDoor(t, ctx, broker.URI, newDoor("door_slow", time.Second))
+	if _, err := caller.Call(ctx, connectionManager, Call{ClientID: "door_slow", Method: "door_state", Timeout: 200 * time.Millisecond}); !errors.Is(err, ErrTimeout) {
+		t.Errorf("slow door: got %v, want ErrTimeout", err)
+	}
+}
+
+func TestCallMatchesCorrelationData(t *testing.T) {
+	broker := testbroker.Start(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	startDoor(t, ctx, broker.URI, newDoor("door_one", 200*time.Millisecond))
+	caller, connectionManager := startCaller(t, ctx, broker.URI)
+
+	// Answers every request to door_one straight away, but for a request
+	// the caller never made
+	requests := make(chan *paho.Publish, 10)
+	impostor := connect(t, ctx, broker.URI, "impostor", []string{RequestTopic(mqtt.DefaultNamespace, "door_one")}, func(publish *paho.Publish) {
+		requests <- publish
+	})
+	go func() {
+		for {
+			select {
+			case request := <-requests:
+				impostor.Publish(ctx, &paho.Publish{
+					QoS:     1,
+					Topic:   ResponseTopic(mqtt.DefaultNamespace, "door_one"),
+					Payload: []byte(`{"client_id":"door_one","result":{"state":"unlocked"}}`),
+					Properties: &paho.PublishProperties{
+						CorrelationData: []byte("not-" + string(request.Properties.CorrelationData)),
+					},
+				})
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	responses, err := caller.Call(ctx, connectionManager, Call{ClientID: "door_one", Method: "door_state", Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("Call failed: %v", err)
+	}
+	if got := clientIDs(responses); !slices.Equal(got, []string{"door_one"}) {
+		t.Errorf("got responses from %v, want door_one", got)
+	}
+}
+
+func TestCallIgnoresRepliesFromOtherDoors(t *testing.T) {
+	broker := testbroker.Start(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	startDoor(t, ctx, broker.URI, newDoor("door_one", 200*time.Millisecond))
+	caller, connectionManager := startCaller(t, ctx, broker.URI)
+
+	// Answers door_one's requests with the right correlation data, but on
+	// its own response topic, so it can't pass itself off as door_one
+	requests := make(chan *paho.Publish, 10)
+	impostor := connect(t, ctx, broker.URI, "impostor", []string{RequestTopic(mqtt.DefaultNamespace, "door_one")}, func(publish *paho.Publish) {
+		requests <- publish
+	})
+	go func() {
+		for {
+			select {
+			case request := <-requests:
+				impostor.Publish(ctx, &paho.Publish{
+					QoS:     1,
+					Topic:   ResponseTopic(mqtt.DefaultNamespace, "impostor"),
+					Payload: []byte(`{"client_id":"door_one","result":{"state":"unlocked"}}`),
+					Properties: &paho.PublishProperties{
+						CorrelationData: request.Properties.CorrelationData,
+					},
+				})
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	responses, err := caller.Call(ctx, connectionManager, Call{ClientID: "door_one", Method: "door_state", Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("Call failed: %v", err)
+	}
+	if len(responses) != 1 {
+		t.Fatalf("got %d responses, want 1", len(responses))
+	}
+	if got, want := string(responses[0].Result), `{"state":"locked"}`; got != want {
+		t.Errorf("result: got %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,326 @@
+package scenario
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/eclipse/paho.golang/autopaho"
+
+	"metamakers.org/door-controller-mqtt/cards"
+	"metamakers.org/door-controller-mqtt/commands"
+	"metamakers.org/door-controller-mqtt/config"
+	"metamakers.org/door-controller-mqtt/messages"
+	"metamakers.org/door-controller-mqtt/models"
+	"metamakers.org/door-controller-mqtt/mqtt"
+)
+
+const diaryPollInterval = time.Millisecond * 250
+
+// Runner drives a headless mimic through a scenario. Observe has to see
+// every message the mimic handles, it's meant to be called from the
+// program's filter.
+type Runner struct {
+	namespace mqtt.Namespace
+	clientID  string
+	diaryURL  string
+	timeout   time.Duration
+	send      func(tea.Msg)
+	client    *http.Client
+
+	mu         sync.Mutex
+	changed    chan bool
+	connection *autopaho.ConnectionManager
+	connected  bool
+	subscribed map[string]bool
+	received   []messages.MqttMessage
+	// waitedFor and diarySince stop one message or event from meeting two
+	// expectations
+	waitedFor  int
+	diarySince time.Time
+
+	options  config.MimicConfig
+	encoding cards.Encoding
+	faults   map[string]bool
+}
+
+// NewRunner starts from the same options as the mimic, send is usually
+// the program's Send
+func NewRunner(namespace mqtt.Namespace, clientID string, options config.MimicConfig, scenarioConfig config.ScenarioConfig, send func(tea.Msg)) *Runner {
+	return &Runner{
+		namespace:  namespace,
+		clientID:   clientID,
+		diaryURL:   scenarioConfig.DiaryURL,
+		timeout:    scenarioConfig.Timeout,
+		send:       send,
+		client:     &http.Client{Timeout: time.Second * 5},
+		changed:    make(chan bool),
+		subscribed: make(map[string]bool),
+		diarySince: time.Now(),
+		options:    options,
+		encoding:   models.CardEncoding(options),
+		faults:     enabledFaults(options.Faults.Enabled),
+	}
+}
+
+func enabledFaults(enabled []string) map[string]bool {
+	faults := make(map[string]bool, len(enabled))
+	for _, fault := range enabled {
+		faults[fault] = true
+	}
+	return faults
+}
+
+func (runner *Runner) Observe(msg tea.Msg) {
+	runner.mu.Lock()
+	defer runner.mu.Unlock()
+
+	switch msg := msg.(type) {
+	case messages.MqttServerConnection:
+		if msg.Err == nil {
+			runner.connection = msg.Connnection
+		}
+	case messages.MqttStatus:
+		runner.connected = msg.Connected
+	case messages.SubscribeMessage:
+		if msg.Err != nil {
+			return
+		}
+		runner.subscribed[msg.Topic] = true
+	case messages.MqttMessage:
+		runner.received = append(runner.received, msg)
+	default:
+		return
+	}
+
+	close(runner.changed)
+	runner.changed = make(chan bool)
+}
+
+// Run stops at the first step that fails, the error names the step
+func (runner *Runner) Run(ctx context.Context, scenario Scenario, started func(index int, step Step)) error {
+	if scenario.DiaryURL != "" {
+		runner.diaryURL = scenario.DiaryURL
+	}
+	if scenario.Timeout > 0 {
+		runner.timeout = scenario.Timeout
+	}
+
+	// Scenarios often start by publishing to the mimic, which it would
+	// miss if it hadn't subscribed yet
+	subscriptions := []string{
+		mqtt.Topic{Namespace: runner.namespace, Level: mqtt.HealthCheckLevel}.Build(),
+		mqtt.Topic{Namespace: runner.namespace, Level: mqtt.AccessListLevel}.Build(),
+	}
+	if err := runner.waitUntil(ctx, runner.timeout, func() bool {
+		return runner.connected && runner.connection != nil && runner.subscribed[subscriptions[0]] && runner.subscribed[subscriptions[1]]
+	}); err != nil {
+		return fmt.Errorf("Mimic didn't connect: %w", err)
+	}
+
+	for index, step := range scenario.Steps {
+		started(index, step)
+		if err := runner.step(ctx, step); err != nil {
+			return fmt.Errorf("Step %d (%s) failed: %w", index+1, step, err)
+		}
+	}
+	return nil
+}
+
+func (runner *Runner) step(ctx context.Context, step Step) error {
+	timeout := runner.timeout
+	if step.Timeout > 0 {
+		timeout = step.Timeout
+	}
+
+	switch {
+	case step.WaitFor != "":
+		return runner.waitFor(ctx, step.WaitFor, step.Contains, timeout)
+	case step.Publish != nil:
+		return runner.publish(ctx, *step.Publish)
+	case step.Set != nil:
+		runner.set(*step.Set)
+	case step.Swipe != nil:
+		message := step.Swipe.Message
+		if message == "" {
+			message = runner.options.DoorMessage
+		}
+		swipe, err := models.ParseSwipe(step.Swipe.Card, message, runner.encoding)
+		if err != nil {
+			return err
+		}
+		runner.options.DoorMessage = swipe.Message
+		for _, msg := range swipe.Messages() {
+			runner.send(msg)
+		}
+	case step.Door != "":
+		runner.send(messages.DoorSensorMessage{Open: step.Door == DoorOpen})
+	case step.ExpectLogFrom != "":
+		return runner.expectDiary(ctx, step.Level, step.Contains, timeout)
+	case step.Sleep > 0:
+		timer := time.NewTimer(step.Sleep)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// waitFor looks for a message the mimic received since the last one that
+// was waited for
+func (runner *Runner) waitFor(ctx context.Context, topic string, contains string, timeout time.Duration) error {
+	filter := fmt.Sprintf("%s/%s", runner.namespace, topic)
+	return runner.waitUntil(ctx, timeout, func() bool {
+		for index := runner.waitedFor; index < len(runner.received); index++ {
+			msg := runner.received[index]
+			if mqtt.MatchFilter(filter, msg.Topic) && strings.Contains(msg.Payload, contains) {
+				runner.waitedFor = index + 1
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func (runner *Runner) publish(ctx context.Context, publish Publish) error {
+	runner.mu.Lock()
+	connection := runner.connection
+	runner.mu.Unlock()
+
+	topic := fmt.Sprintf("%s/%s", runner.namespace, publish.Topic)
+	msg := commands.Publish(connection, ctx, topic, publish.Payload)()
+	// Sent on so the transcript and the mimic's log show it
+	runner.send(msg)
+	if published, ok := msg.(messages.PublishMessage); ok && published.Err != nil {
+		return published.Err
+	}
+	return nil
+}
+
+// set sends every option because the mimic treats a missing one as
+// unchecked
+func (runner *Runner) set(set Set) {
+	if set.FailHealthCheck != nil {
+		runner.options.FailHealthCheck = *set.FailHealthCheck
+	}
+	if set.FailAccessList != nil {
+		runner.options.FailAccessList = *set.FailAccessList
+	}
+	for fault, enabled := range set.Faults {
+		runner.faults[fault] = enabled
+	}
+	if set.FailHealthCheck != nil || set.FailAccessList != nil || len(set.Faults) > 0 {
+		selection := messages.ResponseOptionsSelectionMessage{
+			models.AccessListKey:      runner.options.FailAccessList,
+			models.FailHealthCheckKey: runner.options.FailHealthCheck,
+		}
+		for _, fault := range models.Faults {
+			selection[fault.Key] = runner.faults[fault.Key]
+		}
+		runner.send(selection)
+	}
+
+	if set.DoorMessage != "" {
+		runner.options.DoorMessage = set.DoorMessage
+		runner.send(models.DoorMessageSelection(set.DoorMessage))
+	}
+}
+
+// diaryEvent is the part of diary's events the expectations look at
+type diaryEvent struct {
+	Time    time.Time `json:"time"`
+	Level   string    `json:"level"`
+	Payload string    `json:"payload"`
+}
+
+// expectDiary polls diary until it has logged an event from the mimic
+// newer than the last one expected
+func (runner *Runner) expectDiary(ctx context.Context, level string, contains string, timeout time.Duration) error {
+	endpoint := fmt.Sprintf("%s/api/clients/%s/events", strings.TrimSuffix(runner.diaryURL, "/"), url.PathEscape(runner.clientID))
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var lastErr error
+	for {
+		events, err := runner.diaryEvents(ctx, endpoint)
+		lastErr = err
+		for _, event := range events {
+			if event.Time.After(runner.diarySince) && event.Level == level && strings.Contains(event.Payload, contains) {
+				runner.diarySince = event.Time
+				return nil
+			}
+		}
+
+		timer := time.NewTimer(diaryPollInterval)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			if lastErr != nil {
+				return fmt.Errorf("Diary didn't log %s: %w", level, lastErr)
+			}
+			return fmt.Errorf("Diary didn't log %s within %s", level, timeout)
+		}
+	}
+}
+
+func (runner *Runner) diaryEvents(ctx context.Context, endpoint string) ([]diaryEvent, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := runner.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	// Diary hasn't seen the mimic yet
+	if response.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Diary responded with %s", response.Status)
+	}
+
+	events := make([]diaryEvent, 0)
+	if err := json.NewDecoder(response.Body).Decode(&events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// waitUntil checks the condition every time the runner observes a change,
+// holding the lock while it does
+func (runner *Runner) waitUntil(ctx context.Context, timeout time.Duration, condition func() bool) error {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		runner.mu.Lock()
+		met := condition()
+		changed := runner.changed
+		runner.mu.Unlock()
+		if met {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-timer.C:
+			return fmt.Errorf("Timed out after %s", timeout)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package scenario
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/eclipse/paho.golang/autopaho"
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/rs/zerolog"
+
+	"metamakers.org/door-controller-mqtt/cards"
+	"metamakers.org/door-controller-mqtt/config"
+	"metamakers.org/door-controller-mqtt/connection"
+	"metamakers.org/door-controller-mqtt/diary"
+	"metamakers.org/door-controller-mqtt/messages"
+	"metamakers.org/door-controller-mqtt/models"
+	"metamakers.org/door-controller-mqtt/mqtt"
+	"metamakers.org/door-controller-mqtt/testbroker"
+)
+
+func newTestRunner(diaryURL string) *Runner {
+	return NewRunner(mqtt.DefaultNamespace, "door_one", config.Default().Mimic, config.ScenarioConfig{DiaryURL: diaryURL, Timeout: time.Second}, func(tea.Msg) {})
+}
+
+func TestWaitForMatchesOnce(t *testing.T) {
+	runner := newTestRunner("")
+	runner.Observe(messages.MqttMessage{Topic: "door_controller/health_check", Payload: "first"})
+	runner.Observe(messages.MqttMessage{Topic: "door_controller/access_list", Payload: "0001234567"})
+	runner.Observe(messages.MqttMessage{Topic: "door_controller/health_check", Payload: "second"})
+
+	tests := []struct {
+		topic    string
+		contains string
+		err      bool
+	}{
+		{topic: "health_check", contains: ""},
+		{topic: "health_check", contains: ""},
+		// Both health checks have been waited for
+		{topic: "health_check", contains: "", err: true},
+		// Messages before the last one waited for are skipped
+		{topic: "access_list", contains: "", err: true},
+	}
+
+	for index, test := range tests {
+		err := runner.waitFor(context.Background(), test.topic, test.contains, 50*time.Millisecond)
+		if (err != nil) != test.err {
+			t.Errorf("wait %d for %s: got %v, want error %v", index+1, test.topic, err, test.err)
+		}
+	}
+}
+
+func TestWaitForContains(t *testing.T) {
+	runner := newTestRunner("")
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		runner.Observe(messages.MqttMessage{Topic: "door_controller/health_check", Payload: "first"})
+		runner.Observe(messages.MqttMessage{Topic: "door_controller/health_check", Payload: "second"})
+	}()
+
+	if err := runner.waitFor(context.Background(), "health_check", "second", time.Second); err != nil {
+		t.Fatalf("got %v, want the second health check", err)
+	}
+	// The first health check was passed over on the way
+	if err := runner.waitFor(context.Background(), "health_check", "first", 50*time.Millisecond); err == nil {
+		t.Error("got the first health check after waiting past it")
+	}
+}
+
+func TestExpectDiary(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		level    string
+		contains string
+		err      string
+	}{
+		{name: "found", status: http.StatusOK, body: `[{"time":"2100-01-01T00:00:00Z","level":"unlock","payload":"0001234567|2100-01-01 00:00:00"}]`, level: "unlock", contains: "0001234567"},
+		{name: "wrong level", status: http.StatusOK, body: `[{"time":"2100-01-01T00:00:00Z","level":"lock","payload":"0001234567"}]`, level: "unlock", err: "within"},
+		{name: "wrong payload", status: http.StatusOK, body: `[{"time":"2100-01-01T00:00:00Z","level":"unlock","payload":"0007654321"}]`, level: "unlock", contains: "0001234567", err: "within"},
+		{name: "before the runner started", status: http.StatusOK, body: `[{"time":"2000-01-01T00:00:00Z","level":"unlock","payload":"0001234567"}]`, level: "unlock", err: "within"},
+		{name: "not seen yet", status: http.StatusNotFound, body: `{"error":"Client has not been seen"}`, level: "unlock", err: "within"},
+		{name: "diary error", status: http.StatusInternalServerError, body: `{"error":"Broken"}`, level: "unlock", err: "Diary responded with 500"},
+		{name: "bad json", status: http.StatusOK, body: `{"events":`, level: "unlock", err: "Diary didn't log unlock"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var requests atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				requests.Add(1)
+				if request.URL.Path != "/api/clients/door_one/events" {
+					t.Errorf("got a request for %s", request.URL.Path)
+				}
+				writer.WriteHeader(test.status)
+				writer.Write([]byte(test.body))
+			}))
+			defer server.Close()
+
+			runner := newTestRunner(server.URL + "/")
+			err := runner.expectDiary(context.Background(), test.level, test.contains, 300*time.Millisecond)
+			if test.err == "" {
+				if err != nil {
+					t.Errorf("got %v, want no error", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("got %v, want an error containing %q", err, test.err)
+			}
+			// Diary is polled until the timeout, not just once
+			if requests.Load() < 2 {
+				t.Errorf("got %d requests, want diary polled", requests.Load())
+			}
+		})
+	}
+}
+
+func TestExpectDiaryMatchesOnce(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Write([]byte(`[{"time":"2100-01-01T00:00:00Z","level":"unlock","payload":"0001234567"}]`))
+	}))
+	defer server.Close()
+
+	runner := newTestRunner(server.URL)
+	if err := runner.expectDiary(context.Background(), "unlock", "", time.Second); err != nil {
+		t.Fatalf("got %v, want the unlock", err)
+	}
+	if err := runner.expectDiary(context.Background(), "unlock", "", 300*time.Millisecond); err == nil {
+		t.Error("got the same unlock twice")
+	}
+}
+
+func TestExpectDiaryCancelled(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	runner := newTestRunner(server.URL)
+	if err := runner.expectDiary(ctx, "unlock", "", time.Minute); err == nil {
+		t.Error("got no error, want the cancelled context to stop polling")
+	}
+}
+
+// recordDiary stands in for diary, recording everything published under
+// a client ID in the store the diary server reads
+func recordDiary(t *testing.T, ctx context.Context, uri string, store *diary.Store) {
+	t.Helper()
+
+	connected := make(chan struct{}, 1)
+	logger := zerolog.Nop()
+	clientConfig, err := connection.Options{
+		URIs:          []string{uri},
+		ClientID:      "diary_test",
+		CleanStart:    true,
+		Subscriptions: []paho.SubscribeOptions{{Topic: mqtt.DefaultNamespace.Wildcard(), QoS: 1}},
+		OnConnectionUp: func(connectionManager *autopaho.ConnectionManager, connectionAck *paho.Connack, broker *url.URL) {
+			connected <- struct{}{}
+		},
+		OnPublishReceived: func(publish *paho.Publish) {
+			topic, err := mqtt.ParseTopic(mqtt.DefaultNamespace, publish.Topic)
+			if err != nil || topic.ClientID == "" {
+				return
+			}
+			store.Seen("test", topic.ClientID)
+			store.Record(diary.Event{Time: time.Now(), ClientID: topic.ClientID, Level: topic.Level, Topic: publish.Topic, Payload: string(publish.Payload)})
+		},
+		Logger: &logger,
+	}.ClientConfig(ctx)
+	if err != nil {
+		t.Fatalf("Failed to build client config: %v", err)
+	}
+	if _, err := autopaho.NewConnection(ctx, clientConfig); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	select {
+	case <-connected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Diary didn't connect")
+	}
+}
+
+func TestRunnerDrivesMimic(t *testing.T) {
+	broker := testbroker.Start(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := diary.NewStore(50)
+	recordDiary(t, ctx, broker.URI, store)
+	diaryServer := httptest.NewServer(diary.NewServer("", store).Handler)
+	defer diaryServer.Close()
+
+	loaded, err := Parse(strings.NewReader(`
+name: unlock and open
+timeout: 5s
+steps:
+  - publish health_check ping
+  - wait_for health_check ping
+  - swipe 0001234567 unlock
+  - expect_log_from diary unlock 0001234567
+  - door open
+  - expect_log_from diary door_open
+  - set fail_health_check true
+`), cards.Decimal10{})
+	if err != nil {
+		t.Fatalf("Failed to parse scenario: %v", err)
+	}
+
+	mimicConfig := config.Default().Mimic
+	var program *tea.Program
+	runner := NewRunner(mqtt.DefaultNamespace, "door_one", mimicConfig, config.ScenarioConfig{DiaryURL: diaryServer.URL, Timeout: 5 * time.Second}, func(msg tea.Msg) {
+		program.Send(msg)
+	})
+	program = tea.NewProgram(
+		models.InitMinicModel(ctx, []string{broker.URI}, mqtt.DefaultNamespace, "door_one", "", connection.Transport{}, mimicConfig),
+		tea.WithContext(ctx),
+		tea.WithInput(nil),
+		tea.WithoutRenderer(),
+		tea.WithoutSignalHandler(),
+		tea.WithFilter(func(model tea.Model, msg tea.Msg) tea.Msg {
+			runner.Observe(msg)
+			return msg
+		}),
+	)
+
+	started := make([]string, 0, len(loaded.Steps))
+	result := make(chan error, 1)
+	go func() {
+		result <- runner.Run(ctx, loaded, func(index int, step Step) {
+			started = append(started, step.String())
+		})
+		program.Quit()
+	}()
+	if _, err := program.Run(); err != nil && !errors.Is(err, tea.ErrProgramKilled) {
+		t.Fatalf("Mimic failed: %v", err)
+	}
+
+	if err := <-result; err != nil {
+		t.Fatalf("Scenario failed: %v", err)
+	}
+	if len(started) != len(loaded.Steps) {
+		t.Errorf("got %d steps started, want %d", len(started), len(loaded.Steps))
+	}
+}
+
+func TestRunnerStopsAtFailedStep(t *testing.T) {
+	broker := testbroker.Start(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mimicConfig := config.Default().Mimic
+	var program *tea.Program
+	runner := NewRunner(mqtt.DefaultNamespace, "door_one", mimicConfig, config.ScenarioConfig{Timeout: time.Second}, func(msg tea.Msg) {
+		program.Send(msg)
+	})
+	program = tea.NewProgram(
+		models.InitMinicModel(ctx, []string{broker.URI}, mqtt.DefaultNamespace, "door_one", "", connection.Transport{}, mimicConfig),
+		tea.WithContext(ctx),
+		tea.WithInput(nil),
+		tea.WithoutRenderer(),
+		tea.WithoutSignalHandler(),
+		tea.WithFilter(func(model tea.Model, msg tea.Msg) tea.Msg {
+			runner.Observe(msg)
+			return msg
+		}),
+	)
+
+	loaded := Scenario{Timeout: 200 * time.Millisecond, Steps: []Step{{Sleep: time.Millisecond}, {WaitFor: "access_list"}, {Sleep: time.Millisecond}}}
+	started := 0
+	result := make(chan error, 1)
+	go func() {
+		result <- runner.Run(ctx, loaded, func(index int, step Step) {
+			started += 1
+		})
+		program.Quit()
+	}()
+	if _, err := program.Run(); err != nil && !errors.Is(err, tea.ErrProgramKilled) {
+		t.Fatalf("Mimic failed: %v", err)
+	}
+
+	err := <-result
+	if err == nil || !strings.Contains(err.Error(), "Step 2 (wait_for access_list) failed") {
+		t.Errorf("got %v, want step 2 to fail", err)
+	}
+	if started != 2 {
+		t.Errorf("got %d steps started, want 2", started)
+	}
+}
@@ -0,0 +1,320 @@
+package scenario
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"metamakers.org/door-controller-mqtt/cards"
+	"metamakers.org/door-controller-mqtt/models"
+)
+
+// DiarySource is the only place expect_log_from can read logs from
+const DiarySource = "diary"
+
+// DoorOpen and DoorClose are what the door step does to the reed switch
+const (
+	DoorOpen  = "open"
+	DoorClose = "close"
+)
+
+// Scenario is a list of steps run in order against a headless mimic.
+// Timeout and DiaryURL override the config for this scenario.
+type Scenario struct {
+	Name     string        `yaml:"name"`
+	Timeout  time.Duration `yaml:"timeout"`
+	DiaryURL string        `yaml:"diary_url"`
+	Steps    []Step        `yaml:"steps"`
+}
+
+// Step does exactly one thing. Contains and Timeout are used by the steps
+// that wait, and Level by expect_log_from.
+type Step struct {
+	WaitFor       string        `yaml:"wait_for"`
+	Publish       *Publish      `yaml:"publish"`
+	Set           *Set          `yaml:"set"`
+	Swipe         *Swipe        `yaml:"swipe"`
+	Door          string        `yaml:"door"`
+	ExpectLogFrom string        `yaml:"expect_log_from"`
+	Sleep         time.Duration `yaml:"sleep"`
+
+	Level    string        `yaml:"level"`
+	Contains string        `yaml:"contains"`
+	Timeout  time.Duration `yaml:"timeout"`
+}
+
+// Publish topics are relative to the namespace, like log_info/door_one
+type Publish struct {
+	Topic   string `yaml:"topic"`
+	Payload string `yaml:"payload"`
+}
+
+// Set changes mimic's options, the ones left out are kept as they are.
+// Faults switches faults on or off by name.
+type Set struct {
+	FailHealthCheck *bool           `yaml:"fail_health_check"`
+	FailAccessList  *bool           `yaml:"fail_access_list"`
+	DoorMessage     string          `yaml:"door_message"`
+	Faults          map[string]bool `yaml:"faults"`
+}
+
+// Swipe uses the current door message when Message is empty
+type Swipe struct {
+	Card    string `yaml:"card"`
+	Message string `yaml:"message"`
+}
+
+// Parse checks swipes are cards in the mimic's encoding
+func Parse(reader io.Reader, encoding cards.Encoding) (Scenario, error) {
+	scenario := Scenario{}
+	decoder := yaml.NewDecoder(reader)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&scenario); err != nil {
+		return scenario, err
+	}
+
+	if len(scenario.Steps) == 0 {
+		return scenario, fmt.Errorf("Scenario has no steps")
+	}
+	for index, step := range scenario.Steps {
+		if err := step.Validate(encoding); err != nil {
+			return scenario, fmt.Errorf("Step %d: %w", index+1, err)
+		}
+	}
+	return scenario, nil
+}
+
+// UnmarshalYAML also accepts the one line form of a step, like
+// "swipe 0001234567 denied_access" or "set fail_health_check true"
+func (step *Step) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		parsed, err := parseLine(node.Value)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", node.Line, err)
+		}
+		*step = parsed
+		return nil
+	}
+
+	// node.Decode doesn't know about KnownFields, so typos are looked
+	// for separately
+	if err := knownFields(node, reflect.TypeOf(*step)); err != nil {
+		return err
+	}
+	type plain Step
+	return node.Decode((*plain)(step))
+}
+
+// knownFields checks every key in the mapping, and the mappings inside
+// it, is one of the struct's yaml fields
+func knownFields(node *yaml.Node, structType reflect.Type) error {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	fields := make(map[string]reflect.Type, structType.NumField())
+	for index := 0; index < structType.NumField(); index++ {
+		field := structType.Field(index)
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		fields[name] = field.Type
+	}
+
+	for index := 0; index+1 < len(node.Content); index += 2 {
+		key, value := node.Content[index], node.Content[index+1]
+		fieldType, found := fields[key.Value]
+		if !found {
+			return fmt.Errorf("line %d: Unknown field %s", key.Line, key.Value)
+		}
+		if fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+		if fieldType.Kind() == reflect.Struct {
+			if err := knownFields(value, fieldType); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (step Step) Validate(encoding cards.Encoding) error {
+	actions := 0
+	for _, set := range []bool{step.WaitFor != "", step.Publish != nil, step.Set != nil, step.Swipe != nil, step.Door != "", step.ExpectLogFrom != "", step.Sleep != 0} {
+		if set {
+			actions += 1
+		}
+	}
+	if actions != 1 {
+		return fmt.Errorf("Needs exactly one of wait_for, publish, set, swipe, door, expect_log_from or sleep, got %d", actions)
+	}
+
+	switch {
+	case step.Publish != nil && step.Publish.Topic == "":
+		return fmt.Errorf("Publish needs a topic")
+	case step.Set != nil && step.Set.FailHealthCheck == nil && step.Set.FailAccessList == nil && step.Set.DoorMessage == "" && len(step.Set.Faults) == 0:
+		return fmt.Errorf("Set needs fail_health_check, fail_access_list, door_message or faults")
+	case step.Door != "" && step.Door != DoorOpen && step.Door != DoorClose:
+		return fmt.Errorf("Door must be %s or %s, got %s", DoorOpen, DoorClose, step.Door)
+	case step.ExpectLogFrom != "" && step.ExpectLogFrom != DiarySource:
+		return fmt.Errorf("Logs can only be expected from %s, got %s", DiarySource, step.ExpectLogFrom)
+	case step.Sleep < 0 || step.Timeout < 0:
+		return fmt.Errorf("Durations can't be negative")
+	}
+
+	if step.Set != nil && step.Set.DoorMessage != "" {
+		if err := models.ValidateDoorMessage(step.Set.DoorMessage); err != nil {
+			return err
+		}
+	}
+	if step.Set != nil {
+		for fault := range step.Set.Faults {
+			if err := models.ValidateFault(fault); err != nil {
+				return err
+			}
+		}
+	}
+	if step.Swipe != nil {
+		message := step.Swipe.Message
+		if message == "" {
+			message = models.CardListKey
+		}
+		if _, err := models.ParseSwipe(step.Swipe.Card, message, encoding); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// String describes the step in its one line form for logs
+func (step Step) String() string {
+	switch {
+	case step.WaitFor != "":
+		return strings.TrimSpace(fmt.Sprintf("wait_for %s %s", step.WaitFor, step.Contains))
+	case step.Publish != nil:
+		return strings.TrimSpace(fmt.Sprintf("publish %s %s", step.Publish.Topic, step.Publish.Payload))
+	case step.Set != nil:
+		parts := []string{"set"}
+		if step.Set.FailHealthCheck != nil {
+			parts = append(parts, models.FailHealthCheckKey, strconv.FormatBool(*step.Set.FailHealthCheck))
+		}
+		if step.Set.FailAccessList != nil {
+			parts = append(parts, "fail_access_list", strconv.FormatBool(*step.Set.FailAccessList))
+		}
+		if step.Set.DoorMessage != "" {
+			parts = append(parts, "door_message", step.Set.DoorMessage)
+		}
+		for _, fault := range models.Faults {
+			if enabled, found := step.Set.Faults[fault.Key]; found {
+				parts = append(parts, fault.Key, strconv.FormatBool(enabled))
+			}
+		}
+		return strings.Join(parts, " ")
+	case step.Swipe != nil:
+		return strings.TrimSpace(fmt.Sprintf("swipe %s %s", step.Swipe.Card, step.Swipe.Message))
+	case step.Door != "":
+		return fmt.Sprintf("door %s", step.Door)
+	case step.ExpectLogFrom != "":
+		return strings.TrimSpace(fmt.Sprintf("expect_log_from %s %s %s", step.ExpectLogFrom, step.Level, step.Contains))
+	default:
+		return fmt.Sprintf("sleep %s", step.Sleep)
+	}
+}
+
+// parseLine reads the one line form of a step:
+//
+//	wait_for <topic> [contains]
+//	publish <topic> [payload]
+//	set <fail_health_check|fail_access_list> <true|false>
+//	set door_message <card_list|unlock|denied_access>
+//	set <fault> <true|false>
+//	swipe [card] <card> [card_list|unlock|denied_access]
+//	door <open|close>
+//	expect_log_from diary <level> [contains]
+//	sleep <duration>
+func parseLine(line string) (Step, error) {
+	action, rest, _ := strings.Cut(strings.TrimSpace(line), " ")
+	rest = strings.TrimSpace(rest)
+	fields := strings.Fields(rest)
+
+	step := Step{}
+	switch action {
+	case "wait_for":
+		if len(fields) == 0 {
+			return step, fmt.Errorf("wait_for needs a topic")
+		}
+		step.WaitFor = fields[0]
+		step.Contains = strings.TrimSpace(strings.TrimPrefix(rest, fields[0]))
+	case "publish":
+		if len(fields) == 0 {
+			return step, fmt.Errorf("publish needs a topic")
+		}
+		step.Publish = &Publish{
+			Topic:   fields[0],
+			Payload: strings.TrimSpace(strings.TrimPrefix(rest, fields[0])),
+		}
+	case "set":
+		if len(fields) != 2 {
+			return step, fmt.Errorf("set needs an option and a value, got %q", rest)
+		}
+		step.Set = &Set{}
+		switch fields[0] {
+		case "door_message":
+			step.Set.DoorMessage = fields[1]
+		case models.FailHealthCheckKey, "fail_access_list":
+			value, err := strconv.ParseBool(fields[1])
+			if err != nil {
+				return step, fmt.Errorf("%s must be true or false, got %s", fields[0], fields[1])
+			}
+			if fields[0] == models.FailHealthCheckKey {
+				step.Set.FailHealthCheck = &value
+			} else {
+				step.Set.FailAccessList = &value
+			}
+		default:
+			if models.ValidateFault(fields[0]) != nil {
+				return step, fmt.Errorf("Unknown option %s", fields[0])
+			}
+			value, err := strconv.ParseBool(fields[1])
+			if err != nil {
+				return step, fmt.Errorf("%s must be true or false, got %s", fields[0], fields[1])
+			}
+			step.Set.Faults = map[string]bool{fields[0]: value}
+		}
+	case "swipe":
+		if len(fields) > 0 && fields[0] == "card" {
+			fields = fields[1:]
+		}
+		if len(fields) == 0 || len(fields) > 2 {
+			return step, fmt.Errorf("swipe needs a card and optionally a door message, got %q", rest)
+		}
+		step.Swipe = &Swipe{Card: fields[0]}
+		if len(fields) == 2 {
+			step.Swipe.Message = fields[1]
+		}
+	case "door":
+		if len(fields) != 1 {
+			return step, fmt.Errorf("door needs open or close, got %q", rest)
+		}
+		step.Door = fields[0]
+	case "expect_log_from":
+		if len(fields) < 2 {
+			return step, fmt.Errorf("expect_log_from needs a source and a level, got %q", rest)
+		}
+		step.ExpectLogFrom = fields[0]
+		step.Level = fields[1]
+		step.Contains = strings.Join(fields[2:], " ")
+	case "sleep":
+		duration, err := time.ParseDuration(rest)
+		if err != nil {
+			return step, fmt.Errorf("sleep needs a duration: %w", err)
+		}
+		step.Sleep = duration
+	default:
+		return step, fmt.Errorf("Unknown step %q", action)
+	}
+	return step, nil
+}
@@ -0,0 +1,201 @@
+package scenario
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"metamakers.org/door-controller-mqtt/cards"
+	"metamakers.org/door-controller-mqtt/models"
+)
+
+func boolPointer(value bool) *bool {
+	return &value
+}
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want Step
+		err  string
+	}{
+		{line: "wait_for health_check", want: Step{WaitFor: "health_check"}},
+		{line: "wait_for log_info/door_one  access granted ", want: Step{WaitFor: "log_info/door_one", Contains: "access granted"}},
+		{line: "wait_for", err: "wait_for needs a topic"},
+		{line: "publish health_check", want: Step{Publish: &Publish{Topic: "health_check"}}},
+		{line: "publish access_list 0001234567 0007654321", want: Step{Publish: &Publish{Topic: "access_list", Payload: "0001234567 0007654321"}}},
+		{line: "publish", err: "publish needs a topic"},
+		{line: "set fail_health_check true", want: Step{Set: &Set{FailHealthCheck: boolPointer(true)}}},
+		{line: "set fail_access_list false", want: Step{Set: &Set{FailAccessList: boolPointer(false)}}},
+		{line: "set door_message unlock", want: Step{Set: &Set{DoorMessage: "unlock"}}},
+		{line: "set clock_skew true", want: Step{Set: &Set{Faults: map[string]bool{models.ClockSkewKey: true}}}},
+		{line: "set fail_health_check", err: "set needs an option and a value"},
+		{line: "set fail_health_check maybe", err: "fail_health_check must be true or false"},
+		{line: "set clock_skew sometimes", err: "clock_skew must be true or false"},
+		{line: "set colour red", err: "Unknown option colour"},
+		{line: "swipe 0001234567", want: Step{Swipe: &Swipe{Card: "0001234567"}}},
+		{line: "swipe card 0001234567 denied_access", want: Step{Swipe: &Swipe{Card: "0001234567", Message: "denied_access"}}},
+		{line: "swipe", err: "swipe needs a card"},
+		{line: "swipe card", err: "swipe needs a card"},
+		{line: "swipe 0001234567 unlock twice", err: "swipe needs a card"},
+		{line: "door open", want: Step{Door: DoorOpen}},
+		{line: "door close", want: Step{Door: DoorClose}},
+		{line: "door", err: "door needs open or close"},
+		{line: "expect_log_from diary info", want: Step{ExpectLogFrom: DiarySource, Level: "info"}},
+		{line: "expect_log_from diary error door one  forced", want: Step{ExpectLogFrom: DiarySource, Level: "error", Contains: "door one forced"}},
+		{line: "expect_log_from diary", err: "expect_log_from needs a source and a level"},
+		{line: "sleep 1.5s", want: Step{Sleep: 1500 * time.Millisecond}},
+		{line: "sleep soon", err: "sleep needs a duration"},
+		{line: "sleep", err: "sleep needs a duration"},
+		{line: "dance", err: `Unknown step "dance"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.line, func(t *testing.T) {
+			got, err := parseLine(test.line)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("got %v, want an error containing %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("got %v, want no error", err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestStepValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		step Step
+		err  string
+	}{
+		{name: "wait for", step: Step{WaitFor: "health_check", Timeout: time.Second}},
+		{name: "set fault", step: Step{Set: &Set{Faults: map[string]bool{models.DuplicatePublishesKey: true}}}},
+		{name: "swipe with pin", step: Step{Swipe: &Swipe{Card: "0001234567#1234"}}},
+		{name: "no action", step: Step{}, err: "got 0"},
+		{name: "two actions", step: Step{WaitFor: "health_check", Sleep: time.Second}, err: "got 2"},
+		{name: "every action", step: Step{WaitFor: "a", Publish: &Publish{Topic: "a"}, Set: &Set{DoorMessage: "unlock"}, Swipe: &Swipe{Card: "1"}, Door: DoorOpen, ExpectLogFrom: DiarySource, Sleep: time.Second}, err: "got 7"},
+		{name: "only a timeout", step: Step{Timeout: time.Second}, err: "got 0"},
+		{name: "negative sleep", step: Step{Sleep: -time.Second}, err: "Durations can't be negative"},
+		{name: "negative timeout", step: Step{WaitFor: "health_check", Timeout: -time.Second}, err: "Durations can't be negative"},
+		{name: "publish without topic", step: Step{Publish: &Publish{Payload: "hello"}}, err: "Publish needs a topic"},
+		{name: "empty set", step: Step{Set: &Set{}}, err: "Set needs"},
+		{name: "bad fault", step: Step{Set: &Set{Faults: map[string]bool{"gremlins": true}}}, err: "Unknown fault gremlins"},
+		{name: "bad door message", step: Step{Set: &Set{DoorMessage: "open_sesame"}}, err: "Door message must be"},
+		{name: "bad swipe door message", step: Step{Swipe: &Swipe{Card: "0001234567", Message: "open_sesame"}}, err: "Door message must be"},
+		{name: "bad card", step: Step{Swipe: &Swipe{Card: "not a card"}}, err: "not a card"},
+		{name: "bad door", step: Step{Door: "ajar"}, err: "Door must be open or close"},
+		{name: "bad log source", step: Step{ExpectLogFrom: "porter", Level: "info"}, err: "Logs can only be expected from diary"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.step.Validate(cards.Decimal10{})
+			if test.err == "" {
+				if err != nil {
+					t.Errorf("got %v, want no error", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("got %v, want an error containing %q", err, test.err)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		yaml  string
+		steps int
+		err   string
+	}{
+		{
+			name: "both forms",
+			yaml: `
+name: unlock
+timeout: 5s
+steps:
+  - swipe 0001234567 unlock
+  - wait_for: log_info/door_one
+    contains: unlocked
+    timeout: 2s
+  - set:
+      faults:
+        clock_skew: true
+`,
+			steps: 3,
+		},
+		{name: "typo in scenario", yaml: "name: unlock\nstep:\n  - sleep 1s\n", err: "field step not found"},
+		{name: "typo in step", yaml: "steps:\n  - wait_fro: health_check\n", err: "line 2: Unknown field wait_fro"},
+		{name: "typo in set", yaml: "steps:\n  - set:\n      fail_healthcheck: true\n", err: "line 3: Unknown field fail_healthcheck"},
+		{name: "no steps", yaml: "name: empty\n", err: "Scenario has no steps"},
+		{name: "bad line", yaml: "steps:\n  - sleep 1s\n  - dance\n", err: "line 3"},
+		{name: "invalid step", yaml: "steps:\n  - sleep 1s\n  - door ajar\n", err: "Step 2"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			scenario, err := Parse(strings.NewReader(test.yaml), cards.Decimal10{})
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("got %v, want an error containing %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("got %v, want no error", err)
+			}
+			if len(scenario.Steps) != test.steps {
+				t.Errorf("got %d steps, want %d", len(scenario.Steps), test.steps)
+			}
+		})
+	}
+}
+
+func TestStepStringRoundTrip(t *testing.T) {
+	tests := []string{
+		"wait_for health_check",
+		"wait_for log_info/door_one access granted",
+		"publish health_check",
+		"publish access_list 0001234567 0007654321",
+		"set fail_health_check true",
+		"set fail_access_list false",
+		"set door_message denied_access",
+		"set reconnect_storm false",
+		"swipe 0001234567",
+		"swipe 0001234567#1234 unlock",
+		"door open",
+		"door close",
+		"expect_log_from diary info",
+		"expect_log_from diary error door_one was forced open",
+		"sleep 1.5s",
+	}
+
+	for _, line := range tests {
+		t.Run(line, func(t *testing.T) {
+			step, err := parseLine(line)
+			if err != nil {
+				t.Fatalf("Failed to parse: %v", err)
+			}
+			if got := step.String(); got != line {
+				t.Errorf("got %q, want %q", got, line)
+			}
+			again, err := parseLine(step.String())
+			if err != nil {
+				t.Fatalf("Failed to parse %q: %v", step.String(), err)
+			}
+			if !reflect.DeepEqual(again, step) {
+				t.Errorf("got %+v, want %+v", again, step)
+			}
+		})
+	}
+}
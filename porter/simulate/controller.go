@@ -0,0 +1,269 @@
+package simulate
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/eclipse/paho.golang/autopaho"
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"metamakers.org/door-controller-mqtt/commands"
+	"metamakers.org/door-controller-mqtt/connection"
+	"metamakers.org/door-controller-mqtt/messages"
+	"metamakers.org/door-controller-mqtt/mqtt"
+)
+
+// Options are shared by every virtual controller. The intervals are
+// means, the actual times are random so the controllers don't all
+// publish in lockstep.
+type Options struct {
+	Count        int
+	ClientPrefix string
+	Namespace    mqtt.Namespace
+	// Connection is copied for each controller, which is given its own
+	// client ID, subscriptions and callbacks
+	Connection connection.Options
+
+	SwipeInterval      time.Duration
+	DenyRatio          float64
+	HealthCheckFailure float64
+	// DisconnectInterval is how long a controller stays connected before
+	// dropping off, 0 keeps them connected
+	DisconnectInterval time.Duration
+	ReconnectDelay     time.Duration
+	// LockDelay is how long a door stays unlocked after a swipe
+	LockDelay time.Duration
+	Seed      int64
+}
+
+func (options Options) ClientID(index int) string {
+	return fmt.Sprintf("%s%d", options.ClientPrefix, index+1)
+}
+
+// Run starts the fleet and blocks until the context is done and every
+// controller has disconnected
+func Run(ctx context.Context, options Options, stats *Stats) {
+	seed := options.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	var wait sync.WaitGroup
+	for index := 0; index < options.Count; index++ {
+		controller := &controller{
+			clientID: options.ClientID(index),
+			options:  options,
+			stats:    stats,
+			random:   rand.New(rand.NewSource(seed + int64(index))),
+		}
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			controller.run(ctx)
+		}()
+	}
+	wait.Wait()
+}
+
+type controller struct {
+	clientID string
+	options  Options
+	stats    *Stats
+	current  atomic.Pointer[autopaho.ConnectionManager]
+	randomMu sync.Mutex
+	random   *rand.Rand
+}
+
+func (controller *controller) run(ctx context.Context) {
+	for ctx.Err() == nil {
+		controller.session(ctx)
+
+		timer := time.NewTimer(controller.options.ReconnectDelay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+		}
+	}
+}
+
+// session stays connected until the context is done or it's time for a
+// random disconnect
+func (controller *controller) session(ctx context.Context) {
+	sessionCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Every controller logging each connection would drown out the
+	// reports, only problems are logged
+	logger := log.Logger.Level(zerolog.WarnLevel)
+
+	options := controller.options.Connection
+	options.ClientID = controller.clientID
+	options.CleanStart = true
+	options.SessionExpiry = 0
+	options.Logger = &logger
+	options.Subscriptions = []paho.SubscribeOptions{
+		{Topic: mqtt.Topic{Namespace: controller.options.Namespace, Level: mqtt.HealthCheckLevel}.Build(), QoS: 1},
+		{Topic: mqtt.Topic{Namespace: controller.options.Namespace, Level: mqtt.AccessListLevel}.Build(), QoS: 1},
+	}
+	options.OnConnectionUp = func(connectionManager *autopaho.ConnectionManager, connectionAck *paho.Connack, broker *url.URL) {
+		controller.current.Store(connectionManager)
+		controller.stats.SetConnected(controller.clientID, true)
+	}
+	options.OnConnectionDown = func(err error) {
+		controller.stats.SetConnected(controller.clientID, false)
+	}
+	options.OnPublishReceived = func(publish *paho.Publish) {
+		go controller.handle(sessionCtx, publish)
+	}
+
+	clientConfig, err := options.ClientConfig(sessionCtx)
+	if err != nil {
+		logger.Error().
+			Str("error", err.Error()).
+			Str("event", "URLParse").
+			Str("client_id", controller.clientID).
+			Msg(fmt.Sprintf("Url parse Error: %v", err))
+		return
+	}
+
+	connectionManager, err := autopaho.NewConnection(sessionCtx, clientConfig)
+	if err != nil {
+		return
+	}
+
+	go controller.swipe(sessionCtx)
+
+	var disconnectAfter <-chan time.Time
+	if controller.options.DisconnectInterval > 0 {
+		timer := time.NewTimer(controller.exponential(controller.options.DisconnectInterval))
+		defer timer.Stop()
+		disconnectAfter = timer.C
+	}
+
+	select {
+	case <-disconnectAfter:
+	case <-ctx.Done():
+	}
+
+	controller.current.Store(nil)
+	disconnectCtx, cancelDisconnect := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancelDisconnect()
+	connectionManager.Disconnect(disconnectCtx)
+	controller.stats.SetConnected(controller.clientID, false)
+}
+
+// handle answers the broker's messages the same way mimic does
+func (controller *controller) handle(ctx context.Context, publish *paho.Publish) {
+	connectionManager := controller.current.Load()
+	if connectionManager == nil {
+		return
+	}
+
+	namespace := controller.options.Namespace
+	switch publish.Topic {
+	case mqtt.Topic{Namespace: namespace, Level: mqtt.HealthCheckLevel}.Build():
+		if controller.chance(controller.options.HealthCheckFailure) {
+			controller.drop(commands.FailHealthCheckHandler(namespace, controller.clientID))
+			return
+		}
+		controller.execute(ctx, commands.HealthCheckHandler(connectionManager, ctx, namespace, controller.clientID))
+	case mqtt.Topic{Namespace: namespace, Level: mqtt.AccessListLevel}.Build():
+		controller.execute(ctx, commands.AccessListHandler(connectionManager, ctx, namespace, controller.clientID))
+	}
+}
+
+func (controller *controller) swipe(ctx context.Context) {
+	if controller.options.SwipeInterval <= 0 {
+		return
+	}
+
+	namespace := controller.options.Namespace
+	for {
+		timer := time.NewTimer(controller.exponential(controller.options.SwipeInterval))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+
+		connectionManager := controller.current.Load()
+		if connectionManager == nil {
+			continue
+		}
+
+		card := controller.card()
+		if controller.chance(controller.options.DenyRatio) {
+			controller.execute(ctx, commands.PublishDeniedAccess(connectionManager, ctx, namespace, controller.clientID, card))
+			continue
+		}
+
+		controller.execute(ctx, commands.PublishUnlock(connectionManager, ctx, namespace, controller.clientID, card))
+		go controller.execute(ctx, commands.DelayCommandBy(
+			controller.options.LockDelay,
+			commands.PublishLock(connectionManager, ctx, namespace, controller.clientID, card),
+		))
+	}
+}
+
+// execute runs the commands the TUI would and records each publish.
+// Publishes cut short by the fleet stopping aren't counted as errors.
+func (controller *controller) execute(ctx context.Context, cmd tea.Cmd) {
+	if cmd == nil {
+		return
+	}
+
+	started := time.Now()
+	switch msg := cmd().(type) {
+	case tea.BatchMsg:
+		for _, batched := range msg {
+			controller.execute(ctx, batched)
+		}
+	case messages.PublishMessage:
+		if ctx.Err() != nil {
+			return
+		}
+		controller.stats.Published(controller.level(msg.Topic), time.Since(started), msg.Err)
+	}
+}
+
+func (controller *controller) drop(cmd tea.Cmd) {
+	if msg, ok := cmd().(messages.PublishMessage); ok {
+		controller.stats.Dropped(controller.level(msg.Topic))
+	}
+}
+
+func (controller *controller) level(raw string) string {
+	topic, err := mqtt.ParseTopic(controller.options.Namespace, raw)
+	if err != nil {
+		return raw
+	}
+	return topic.Level
+}
+
+func (controller *controller) chance(probability float64) bool {
+	controller.randomMu.Lock()
+	defer controller.randomMu.Unlock()
+	return controller.random.Float64() < probability
+}
+
+func (controller *controller) exponential(mean time.Duration) time.Duration {
+	controller.randomMu.Lock()
+	defer controller.randomMu.Unlock()
+	return time.Duration(controller.random.ExpFloat64() * float64(mean))
+}
+
+func (controller *controller) card() string {
+	controller.randomMu.Lock()
+	defer controller.randomMu.Unlock()
+	return fmt.Sprintf("%010d", controller.random.Int63n(10_000_000_000))
+}
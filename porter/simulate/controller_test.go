@@ -0,0 +1,202 @@
+package simulate
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"strconv"
+	"testing"
+	"time"
+
+	"metamakers.org/door-controller-mqtt/connection"
+	"metamakers.org/door-controller-mqtt/mqtt"
+	"metamakers.org/door-controller-mqtt/testbroker"
+)
+
+func newTestController(seed int64) *controller {
+	return &controller{
+		clientID: "door_1",
+		options:  Options{Namespace: mqtt.DefaultNamespace},
+		stats:    NewStats(),
+		random:   rand.New(rand.NewSource(seed)),
+	}
+}
+
+func TestClientID(t *testing.T) {
+	options := Options{ClientPrefix: "sim_door_"}
+	if got := options.ClientID(0); got != "sim_door_1" {
+		t.Errorf("got %s, want sim_door_1", got)
+	}
+	if got := options.ClientID(99); got != "sim_door_100" {
+		t.Errorf("got %s, want sim_door_100", got)
+	}
+}
+
+func TestSameSeedSameSchedule(t *testing.T) {
+	first, second := newTestController(42), newTestController(42)
+	for i := 0; i < 20; i++ {
+		if a, b := first.exponential(time.Second), second.exponential(time.Second); a != b {
+			t.Fatalf("draw %d: got %s and %s, want the same seed to give the same times", i, a, b)
+		}
+		if a, b := first.card(), second.card(); a != b {
+			t.Fatalf("draw %d: got cards %s and %s, want the same", i, a, b)
+		}
+	}
+
+	// Each controller in a fleet is seeded apart so they don't publish
+	// in lockstep
+	other := newTestController(43)
+	if newTestController(42).exponential(time.Second) == other.exponential(time.Second) {
+		t.Error("got the same time from different seeds")
+	}
+}
+
+func TestExponentialMean(t *testing.T) {
+	controller := newTestController(1)
+	const draws = 20_000
+	mean := 100 * time.Millisecond
+
+	var total time.Duration
+	under := 0
+	for i := 0; i < draws; i++ {
+		gap := controller.exponential(mean)
+		if gap < 0 {
+			t.Fatalf("got a negative gap %s", gap)
+		}
+		if gap < mean {
+			under += 1
+		}
+		total += gap
+	}
+
+	if got := total / draws; math.Abs(float64(got-mean)) > float64(mean)/20 {
+		t.Errorf("got a mean of %s, want about %s", got, mean)
+	}
+	// Most gaps are shorter than the mean, 1 - 1/e of them
+	if got := float64(under) / draws; math.Abs(got-(1-1/math.E)) > 0.02 {
+		t.Errorf("got %.3f under the mean, want about %.3f", got, 1-1/math.E)
+	}
+}
+
+func TestChance(t *testing.T) {
+	controller := newTestController(1)
+	const draws = 10_000
+
+	tests := []struct {
+		probability float64
+		want        float64
+	}{
+		{probability: 0, want: 0},
+		{probability: 1, want: 1},
+		{probability: 0.25, want: 0.25},
+	}
+	for _, test := range tests {
+		hits := 0
+		for i := 0; i < draws; i++ {
+			if controller.chance(test.probability) {
+				hits += 1
+			}
+		}
+		if got := float64(hits) / draws; math.Abs(got-test.want) > 0.02 {
+			t.Errorf("%v: got %.3f, want about %v", test.probability, got, test.want)
+		}
+	}
+}
+
+func TestCard(t *testing.T) {
+	controller := newTestController(1)
+	for i := 0; i < 100; i++ {
+		card := controller.card()
+		if _, err := strconv.ParseUint(card, 10, 64); err != nil || len(card) != 10 {
+			t.Fatalf("got card %q, want 10 digits", card)
+		}
+	}
+}
+
+func TestLevel(t *testing.T) {
+	controller := newTestController(1)
+	tests := []struct {
+		topic string
+		want  string
+	}{
+		{topic: "door_controller/unlock/door_1", want: "unlock"},
+		{topic: "door_controller/check_in/door_1", want: "check_in"},
+		// Topics outside the namespace are counted under the whole topic
+		{topic: "elsewhere/unlock/door_1", want: "elsewhere/unlock/door_1"},
+	}
+	for _, test := range tests {
+		if got := controller.level(test.topic); got != test.want {
+			t.Errorf("%s: got %s, want %s", test.topic, got, test.want)
+		}
+	}
+}
+
+func TestRunFleet(t *testing.T) {
+	broker := testbroker.Start(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 1500*time.Millisecond)
+	defer cancel()
+
+	// The broker asks for health checks and sends the access list for as
+	// long as the fleet runs
+	go func() {
+		ticker := time.NewTicker(50 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				broker.Server.Publish(mqtt.Topic{Namespace: mqtt.DefaultNamespace, Level: mqtt.HealthCheckLevel}.Build(), []byte("ping"), false, 1)
+				broker.Server.Publish(mqtt.Topic{Namespace: mqtt.DefaultNamespace, Level: mqtt.AccessListLevel}.Build(), []byte("0001234567"), false, 1)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	options := Options{
+		Count:              3,
+		ClientPrefix:       "sim_door_",
+		Namespace:          mqtt.DefaultNamespace,
+		Connection:         connection.Options{URIs: []string{broker.URI}},
+		SwipeInterval:      20 * time.Millisecond,
+		DenyRatio:          0.5,
+		HealthCheckFailure: 0.5,
+		DisconnectInterval: 300 * time.Millisecond,
+		ReconnectDelay:     10 * time.Millisecond,
+		LockDelay:          10 * time.Millisecond,
+		Seed:               1,
+	}
+	stats := NewStats()
+	done := make(chan struct{})
+	go func() {
+		Run(ctx, options, stats)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("The fleet didn't stop with its context")
+	}
+
+	report := stats.Report()
+	if report.Connected != 0 {
+		t.Errorf("got %d connected, want every controller disconnected", report.Connected)
+	}
+	// Every controller connected, and at least one dropped off and came back
+	if report.Connects <= options.Count || report.Disconnects != report.Connects {
+		t.Errorf("got %d connects and %d disconnects, want more than %d of each", report.Connects, report.Disconnects, options.Count)
+	}
+	for _, level := range []string{mqtt.UnlockLevel, mqtt.LockLevel, mqtt.DeniedAccessLevel, mqtt.CheckInLevel, mqtt.LogInfoLevel} {
+		if report.Published[level] == 0 {
+			t.Errorf("got nothing published to %s, want the fleet to have published some: %+v", level, report.Published)
+		}
+	}
+	if report.Dropped[mqtt.CheckInLevel] == 0 {
+		t.Errorf("got no health checks failed, want about half: %+v", report.Dropped)
+	}
+	if report.TotalErrors() != 0 {
+		t.Errorf("got errors %+v, last %s, want none", report.Errors, report.LastError)
+	}
+	if report.Latency.Max <= 0 {
+		t.Errorf("got %+v, want the publishes timed", report.Latency)
+	}
+}
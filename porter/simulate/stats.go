@@ -0,0 +1,162 @@
+package simulate
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxLatencies caps the memory used on long runs, the percentiles are
+// taken from a reservoir sample once it's full
+const maxLatencies = 100_000
+
+// Stats is shared by every controller in the fleet
+type Stats struct {
+	mu          sync.Mutex
+	started     time.Time
+	published   map[string]int
+	errors      map[string]int
+	dropped     map[string]int
+	latencies   []time.Duration
+	observed    int
+	connects    int
+	disconnects int
+	connected   map[string]bool
+	lastError   string
+}
+
+func NewStats() *Stats {
+	return &Stats{
+		started:   time.Now(),
+		published: make(map[string]int),
+		errors:    make(map[string]int),
+		dropped:   make(map[string]int),
+		latencies: make([]time.Duration, 0),
+		connected: make(map[string]bool),
+	}
+}
+
+func (stats *Stats) Published(level string, latency time.Duration, err error) {
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+
+	if err != nil {
+		stats.errors[level] += 1
+		stats.lastError = err.Error()
+		return
+	}
+
+	stats.published[level] += 1
+	stats.observed += 1
+	if len(stats.latencies) < maxLatencies {
+		stats.latencies = append(stats.latencies, latency)
+	} else if idx := rand.Intn(stats.observed); idx < maxLatencies {
+		stats.latencies[idx] = latency
+	}
+}
+
+// Dropped counts publishes skipped on purpose, like failed health checks
+func (stats *Stats) Dropped(level string) {
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	stats.dropped[level] += 1
+}
+
+func (stats *Stats) SetConnected(clientID string, connected bool) {
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+
+	if connected && !stats.connected[clientID] {
+		stats.connects += 1
+	} else if !connected && stats.connected[clientID] {
+		stats.disconnects += 1
+	}
+	stats.connected[clientID] = connected
+}
+
+// Latency is in milliseconds, from handing a publish to the connection
+// until it was acknowledged
+type Latency struct {
+	P50 float64 `json:"p50_ms"`
+	P95 float64 `json:"p95_ms"`
+	P99 float64 `json:"p99_ms"`
+	Max float64 `json:"max_ms"`
+}
+
+type Report struct {
+	Elapsed     float64        `json:"elapsed_seconds"`
+	Connected   int            `json:"connected"`
+	Connects    int            `json:"connects"`
+	Disconnects int            `json:"disconnects"`
+	Published   map[string]int `json:"published"`
+	Errors      map[string]int `json:"errors"`
+	Dropped     map[string]int `json:"dropped"`
+	Latency     Latency        `json:"latency"`
+	LastError   string         `json:"last_error,omitempty"`
+}
+
+func (report Report) TotalPublished() int {
+	return sum(report.Published)
+}
+
+func (report Report) TotalErrors() int {
+	return sum(report.Errors)
+}
+
+func (stats *Stats) Report() Report {
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+
+	report := Report{
+		Elapsed:     time.Since(stats.started).Seconds(),
+		Connects:    stats.connects,
+		Disconnects: stats.disconnects,
+		Published:   copyCounts(stats.published),
+		Errors:      copyCounts(stats.errors),
+		Dropped:     copyCounts(stats.dropped),
+		LastError:   stats.lastError,
+	}
+	for _, connected := range stats.connected {
+		if connected {
+			report.Connected += 1
+		}
+	}
+
+	if len(stats.latencies) > 0 {
+		sorted := make([]time.Duration, len(stats.latencies))
+		copy(sorted, stats.latencies)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		percentile := func(p float64) float64 {
+			return milliseconds(sorted[int(p*float64(len(sorted)-1))])
+		}
+		report.Latency = Latency{
+			P50: percentile(0.50),
+			P95: percentile(0.95),
+			P99: percentile(0.99),
+			Max: milliseconds(sorted[len(sorted)-1]),
+		}
+	}
+
+	return report
+}
+
+func copyCounts(counts map[string]int) map[string]int {
+	copied := make(map[string]int, len(counts))
+	for key, count := range counts {
+		copied[key] = count
+	}
+	return copied
+}
+
+func sum(counts map[string]int) int {
+	total := 0
+	for _, count := range counts {
+		total += count
+	}
+	return total
+}
+
+func milliseconds(duration time.Duration) float64 {
+	return float64(duration.Microseconds()) / 1000
+}
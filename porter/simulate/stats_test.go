@@ -0,0 +1,126 @@
+package simulate
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStatsCounts(t *testing.T) {
+	stats := NewStats()
+	stats.Published("unlock", time.Millisecond, nil)
+	stats.Published("unlock", time.Millisecond, nil)
+	stats.Published("lock", time.Millisecond, nil)
+	stats.Published("unlock", time.Millisecond, errors.New("Not authorised"))
+	stats.Published("denied_access", time.Millisecond, errors.New("Connection lost"))
+	stats.Dropped("check_in")
+	stats.Dropped("check_in")
+
+	report := stats.Report()
+	tests := []struct {
+		name string
+		got  int
+		want int
+	}{
+		{name: "published unlock", got: report.Published["unlock"], want: 2},
+		{name: "published lock", got: report.Published["lock"], want: 1},
+		{name: "published denied", got: report.Published["denied_access"], want: 0},
+		{name: "total published", got: report.TotalPublished(), want: 3},
+		{name: "unlock errors", got: report.Errors["unlock"], want: 1},
+		{name: "total errors", got: report.TotalErrors(), want: 2},
+		{name: "dropped", got: report.Dropped["check_in"], want: 2},
+	}
+	for _, test := range tests {
+		if test.got != test.want {
+			t.Errorf("%s: got %d, want %d", test.name, test.got, test.want)
+		}
+	}
+	if report.LastError != "Connection lost" {
+		t.Errorf("got last error %q, want Connection lost", report.LastError)
+	}
+}
+
+func TestStatsConnections(t *testing.T) {
+	stats := NewStats()
+	stats.SetConnected("door_1", true)
+	// Both the connection going down and the session ending report the
+	// same disconnect, it's only counted once
+	stats.SetConnected("door_1", false)
+	stats.SetConnected("door_1", false)
+	stats.SetConnected("door_1", true)
+	stats.SetConnected("door_2", true)
+	stats.SetConnected("door_2", true)
+	stats.SetConnected("door_3", false)
+
+	report := stats.Report()
+	if report.Connects != 3 || report.Disconnects != 1 || report.Connected != 2 {
+		t.Errorf("got %d connects, %d disconnects and %d connected, want 3, 1 and 2", report.Connects, report.Disconnects, report.Connected)
+	}
+}
+
+func TestStatsLatency(t *testing.T) {
+	stats := NewStats()
+	if latency := stats.Report().Latency; latency != (Latency{}) {
+		t.Errorf("got %+v, want no latency before anything is published", latency)
+	}
+
+	// Published out of order, 1ms to 100ms
+	for i := 100; i > 0; i-- {
+		stats.Published("unlock", time.Duration(i)*time.Millisecond, nil)
+	}
+	// Failed publishes don't count towards latency
+	stats.Published("unlock", time.Hour, errors.New("Timed out"))
+
+	want := Latency{P50: 50, P95: 95, P99: 99, Max: 100}
+	if latency := stats.Report().Latency; latency != want {
+		t.Errorf("got %+v, want %+v", latency, want)
+	}
+}
+
+func TestStatsLatencySample(t *testing.T) {
+	stats := NewStats()
+	for i := 0; i < maxLatencies+1000; i++ {
+		stats.Published("unlock", time.Millisecond, nil)
+	}
+	if len(stats.latencies) != maxLatencies {
+		t.Errorf("got %d latencies kept, want %d", len(stats.latencies), maxLatencies)
+	}
+	if report := stats.Report(); report.Published["unlock"] != maxLatencies+1000 {
+		t.Errorf("got %d published, want every publish counted", report.Published["unlock"])
+	}
+}
+
+func TestStatsReportIsACopy(t *testing.T) {
+	stats := NewStats()
+	stats.Published("unlock", time.Millisecond, nil)
+
+	report := stats.Report()
+	report.Published["unlock"] = 100
+	report.Errors["unlock"] = 100
+	if again := stats.Report(); again.Published["unlock"] != 1 || again.Errors["unlock"] != 0 {
+		t.Errorf("got %+v, want the stats untouched by changes to a report", again)
+	}
+}
+
+func TestStatsConcurrent(t *testing.T) {
+	stats := NewStats()
+	var wait sync.WaitGroup
+	for door := 0; door < 8; door++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			for i := 0; i < 100; i++ {
+				stats.Published("unlock", time.Millisecond, nil)
+				stats.Dropped("check_in")
+				stats.Report()
+			}
+		}()
+	}
+	wait.Wait()
+
+	report := stats.Report()
+	if report.Published["unlock"] != 800 || report.Dropped["check_in"] != 800 {
+		t.Errorf("got %d published and %d dropped, want 800 each", report.Published["unlock"], report.Dropped["check_in"])
+	}
+}
@@ -0,0 +1,126 @@
+// Package testbroker runs an MQTT broker inside the test process, so
+// tests can check porter against a real broker without mosquitto
+package testbroker
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	mochi "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+)
+
+type Broker struct {
+	Server *mochi.Server
+	// URI is the broker's plain TCP listener
+	URI string
+	// WebSocketAddress is the host:port of the websocket listener
+	WebSocketAddress string
+	// Disconnects receives every client connection that ends
+	Disconnects <-chan Disconnect
+}
+
+// Disconnect is a client's connection ending, Err is nil when the client
+// sent DISCONNECT and set when the connection was dropped
+type Disconnect struct {
+	ClientID string
+	Err      error
+}
+
+// disconnectHook passes on disconnects without ever holding up the broker
+type disconnectHook struct {
+	mochi.HookBase
+	disconnects chan Disconnect
+}
+
+func (hook *disconnectHook) ID() string {
+	return "disconnects"
+}
+
+func (hook *disconnectHook) Provides(b byte) bool {
+	return b == mochi.OnDisconnect
+}
+
+func (hook *disconnectHook) OnDisconnect(client *mochi.Client, err error, expire bool) {
+	select {
+	case hook.disconnects <- Disconnect{ClientID: client.ID, Err: err}:
+	default:
+	}
+}
+
+// Start runs a broker that allows every client until the test ends
+func Start(t testing.TB) *Broker {
+	t.Helper()
+
+	server := mochi.New(&mochi.Options{
+		InlineClient: true,
+		Logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	if err := server.AddHook(new(auth.AllowHook), nil); err != nil {
+		t.Fatalf("Failed to add auth hook: %v", err)
+	}
+	disconnects := make(chan Disconnect, 100)
+	if err := server.AddHook(&disconnectHook{disconnects: disconnects}, nil); err != nil {
+		t.Fatalf("Failed to add disconnect hook: %v", err)
+	}
+
+	tcp := listeners.NewTCP(listeners.Config{ID: "tcp", Address: "127.0.0.1:0"})
+	if err := server.AddListener(tcp); err != nil {
+		t.Fatalf("Failed to listen on TCP: %v", err)
+	}
+	// The websocket listener only knows its address once it's serving,
+	// so a free port is found for it first
+	webSocketAddress := freeAddress(t)
+	if err := server.AddListener(listeners.NewWebsocket(listeners.Config{ID: "ws", Address: webSocketAddress})); err != nil {
+		t.Fatalf("Failed to listen on websockets: %v", err)
+	}
+
+	go server.Serve()
+	t.Cleanup(func() { server.Close() })
+
+	waitForListener(t, webSocketAddress)
+	return &Broker{
+		Server:           server,
+		URI:              fmt.Sprintf("mqtt://%s", tcp.Address()),
+		WebSocketAddress: webSocketAddress,
+		Disconnects:      disconnects,
+	}
+}
+
+// Publish sends a message to the broker's subscribers as if a client
+// published it
+func (broker *Broker) Publish(t testing.TB, topic string, payload string, retain bool, qos byte) {
+	t.Helper()
+	if err := broker.Server.Publish(topic, []byte(payload), retain, qos); err != nil {
+		t.Fatalf("Failed to publish to %s: %v", topic, err)
+	}
+}
+
+func freeAddress(t testing.TB) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to find a free port: %v", err)
+	}
+	defer listener.Close()
+	return listener.Addr().String()
+}
+
+func waitForListener(t testing.TB, address string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		conn, err := net.Dial("tcp", address)
+		if err == nil {
+			conn.Close()
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Broker didn't start listening on %s", address)
+}